@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"db-gdpr-anonymizer/internal/anonymizer"
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+// runDetokenize implements the detokenize command, which decrypts a single
+// value encrypted by the fpe strategy of a column and prints the original:
+//
+//	anonymize-db detokenize --config config.yaml --table customer_entity --column customer_number --reason "court order 2026-17" 8304-7712
+//
+// The log records who decrypted a value of which column and why, but not the
+// value itself.
+func runDetokenize(args []string) {
+	var tableName, columnName, reason string
+
+	flags := flag.NewFlagSet("detokenize", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", configFile, "Path to YAML configuration file")
+	flags.StringVar(&tableName, "table", "", "Table of the encrypted value")
+	flags.StringVar(&columnName, "column", "", "Column of the encrypted value")
+	flags.StringVar(&reason, "reason", "", "Legal reason for decrypting the value, recorded in the log")
+	flags.StringVar(&logDir, "log", logDir, "Directory for log files")
+	flags.Parse(args)
+
+	// Validate command line arguments
+	if configFile == "" || tableName == "" || columnName == "" || reason == "" {
+		fmt.Println("Error: --config, --table, --column and --reason flags are required")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Println("Error: exactly one value to detokenize is required")
+		flags.Usage()
+		os.Exit(1)
+	}
+	value := flags.Arg(0)
+
+	// The log stays off the console, which only shows the original value
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		fmt.Printf("Error creating log directory: %v\n", err)
+		os.Exit(1)
+	}
+	log, err := logger.NewLogger(logDir, false)
+	if err != nil {
+		fmt.Printf("Error initializing logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer log.Close()
+
+	fail := func(message string, err error) {
+		log.Error(message, map[string]interface{}{
+			"table":  tableName,
+			"column": columnName,
+			"error":  err.Error(),
+		})
+		fmt.Printf("Error: %s: %v\n", message, err)
+		log.Close()
+		os.Exit(1)
+	}
+
+	// 1. Parse configuration file and create the plan holding the strategies
+	cfg, err := config.LoadConfig(configFile)
+	if err != nil {
+		fail("Failed to load configuration", err)
+	}
+
+	plan, err := anonymizer.CreatePlan(cfg)
+	if err != nil {
+		fail("Failed to create anonymization plan", err)
+	}
+
+	// 2. Decrypt the value with the strategy of the column
+	strategy, err := anonymizer.FindFPEStrategy(plan, tableName, columnName)
+	if err != nil {
+		fail("Failed to find fpe strategy", err)
+	}
+
+	original, err := strategy.Detokenize(value)
+	if err != nil {
+		fail("Failed to detokenize value", err)
+	}
+
+	log.Info("Value detokenized", map[string]interface{}{
+		"configFile": configFile,
+		"table":      tableName,
+		"column":     columnName,
+		"reason":     reason,
+		"user":       os.Getenv("USER"),
+	})
+
+	fmt.Println(original)
+}
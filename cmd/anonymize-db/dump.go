@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"db-gdpr-anonymizer/internal/anonymizer"
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/report"
+)
+
+// runDump implements the dump command, which anonymizes a SQL dump file
+// instead of a live database:
+//
+//	anonymize-db dump --config config.yaml --in prod.sql --out anon.sql
+func runDump(args []string) {
+	var inFile, outFile string
+
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", configFile, "Path to YAML configuration file")
+	flags.StringVar(&inFile, "in", "", "Path of the SQL dump to anonymize")
+	flags.StringVar(&outFile, "out", "", "Path of the anonymized SQL dump to write")
+	flags.StringVar(&reportType, "report", reportType, "Final report format (json or text)")
+	flags.StringVar(&logDir, "log", logDir, "Directory for log files")
+	flags.Parse(args)
+
+	// Validate command line arguments
+	if configFile == "" || inFile == "" || outFile == "" {
+		fmt.Println("Error: --config, --in and --out flags are required")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if reportType != "json" && reportType != "text" {
+		fmt.Println("Error: --report must be either 'json' or 'text'")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if inPath, err := filepath.Abs(inFile); err == nil {
+		if outPath, err := filepath.Abs(outFile); err == nil && inPath == outPath {
+			fmt.Println("Error: --in and --out must be different files")
+			os.Exit(1)
+		}
+	}
+
+	log := openLogger()
+	defer log.Close()
+
+	reportGen := report.NewGenerator(false, log.GetErrorLogPath())
+
+	startTime := time.Now()
+
+	log.Info("Starting anonymize-db dump", map[string]interface{}{
+		"configFile": configFile,
+		"in":         inFile,
+		"out":        outFile,
+		"reportType": reportType,
+		"logDir":     logDir,
+	})
+
+	// 1. Parse configuration file
+	cfg, err := config.LoadDumpConfig(configFile)
+	if err != nil {
+		log.Error("Failed to load configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	// 2. Create anonymization plan
+	plan, err := anonymizer.CreatePlan(cfg)
+	if err != nil {
+		log.Error("Failed to create anonymization plan", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	dumpAnonymizer, err := anonymizer.NewDumpAnonymizer(plan, log)
+	if err != nil {
+		log.Error("Failed to create dump anonymizer", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	defer dumpAnonymizer.Close()
+
+	// 3. Stream the dump from the input to the output file
+	in, err := os.Open(inFile)
+	if err != nil {
+		log.Error("Failed to open dump file", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	out, err := os.Create(outFile)
+	if err != nil {
+		log.Error("Failed to create output file", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	results, err := dumpAnonymizer.Anonymize(context.Background(), in, out)
+	if err == nil {
+		err = out.Close()
+	} else {
+		out.Close()
+	}
+	if err != nil {
+		// A partial output file must not be mistaken for a complete dump
+		os.Remove(outFile)
+		log.Error("Failed to anonymize dump", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	// 4. Generate report
+	finalReport := outputReport(log, reportGen, results, dumpAnonymizer.ConsistencyGroups())
+
+	duration := time.Since(startTime)
+	log.Info("Dump anonymization completed", map[string]interface{}{
+		"duration":        duration.String(),
+		"tablesProcessed": finalReport.Summary.TotalTables,
+		"fieldsProcessed": finalReport.Summary.TotalFields,
+		"rowsScanned":     finalReport.Summary.TotalRowsScanned,
+		"rowsAffected":    finalReport.Summary.TotalRowsAffected,
+	})
+
+	fmt.Printf("Anonymized dump written to %s\n", outFile)
+	fmt.Printf("Completed in %v\n", duration)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"flag"
 	"fmt"
 	"os"
@@ -22,6 +23,11 @@ var (
 	reportType string
 	logDir     string
 	workers    int
+	resume     bool
+	failFast   bool
+	// snapshotFile is where the main run writes the snapshot that verify
+	// compares the anonymized values with
+	snapshotFile string
 )
 
 func init() {
@@ -30,10 +36,32 @@ func init() {
 	flag.StringVar(&reportType, "report", "text", "Final report format (json or text)")
 	flag.StringVar(&logDir, "log", "logs", "Directory for log files")
 	flag.IntVar(&workers, "workers", runtime.NumCPU(), "Number of parallel workers")
+	flag.BoolVar(&resume, "resume", false, "Resume an interrupted run from the checkpoint in the log directory")
+	flag.BoolVar(&failFast, "fail-fast", false, "Stop at the first table that fails")
+	flag.StringVar(&snapshotFile, "snapshot", "", "Path of a snapshot to take before anonymizing, for verify")
 	flag.Parse()
 }
 
 func main() {
+	// Subcommands follow the global flags
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "dump":
+			runDump(flag.Args()[1:])
+		case "scan":
+			runScan(flag.Args()[1:])
+		case "verify":
+			runVerify(flag.Args()[1:])
+		case "detokenize":
+			runDetokenize(flag.Args()[1:])
+		default:
+			fmt.Printf("Error: unknown command %s\n", flag.Arg(0))
+			flag.Usage()
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Validate command line arguments
 	if configFile == "" {
 		fmt.Println("Error: --config flag is required")
@@ -47,18 +75,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Ensure log directory exists
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		fmt.Printf("Error creating log directory: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Initialize logger
-	log, err := logger.NewLogger(logDir, true)
-	if err != nil {
-		fmt.Printf("Error initializing logger: %v\n", err)
-		os.Exit(1)
-	}
+	log := openLogger()
 	defer log.Close()
 
 	// Initialize report generator
@@ -72,6 +89,9 @@ func main() {
 		"reportType": reportType,
 		"logDir":     logDir,
 		"workers":    workers,
+		"resume":     resume,
+		"failFast":   failFast,
+		"snapshot":   snapshotFile,
 	})
 
 	// 1. Parse configuration file
@@ -83,17 +103,16 @@ func main() {
 		os.Exit(1)
 	}
 
-	// 2. Connect to database (in dry run mode, we still connect to get schema information)
-	dbConfig := database.Config{
-		Driver:   database.Driver(cfg.Database.Driver),
-		Host:     cfg.Database.Host,
-		Port:     cfg.Database.Port,
-		User:     cfg.Database.User,
-		Password: cfg.Database.Password,
-		Name:     cfg.Database.Name,
+	// Runs into a target database start over, since the copy recreates tables
+	if resume && cfg.Target != nil {
+		log.Error("Cannot resume a run into a target database", map[string]interface{}{
+			"target": cfg.Target.Name,
+		})
+		os.Exit(1)
 	}
 
-	db, err := database.Connect(dbConfig)
+	// 2. Connect to database (in dry run mode, we still connect to get schema information)
+	db, err := connect(cfg.Database)
 	if err != nil {
 		log.Error("Failed to connect to database", map[string]interface{}{
 			"error": err.Error(),
@@ -111,31 +130,209 @@ func main() {
 		os.Exit(1)
 	}
 
-	// 4. Execute anonymization plan
-	executor := anonymizer.NewExecutor(db, plan, log, dryRun, workers)
-	results, err := executor.Execute(context.Background())
+	// 4. Take a snapshot of the original values for verify. A resumed run
+	// keeps the snapshot of the interrupted run, whose values are partly gone.
+	if snapshotFile != "" && !resume {
+		snapshot, err := anonymizer.TakeSnapshot(context.Background(), db, plan, anonymizer.DefaultSampleSize)
+		if err == nil {
+			err = snapshot.Write(snapshotFile)
+		}
+		if err != nil {
+			log.Error("Failed to take snapshot", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		log.Info("Snapshot written", map[string]interface{}{
+			"file": snapshotFile,
+		})
+	}
+
+	// 5. Execute anonymization plan, in place or into the target database.
+	// A run stopped by fail fast still reports the tables it processed.
+	var results []anonymizer.ExecutionResult
+	var consistencyGroups []anonymizer.ConsistencyGroupResult
+	if cfg.Target != nil {
+		results, consistencyGroups = copyDatabase(log, db, cfg.Target, plan)
+	} else {
+		checkpoint := openCheckpoint(log, cfg)
+		executor := anonymizer.NewExecutor(db, plan, log, dryRun, workers, failFast, checkpoint)
+		results, err = executor.Execute(context.Background())
+		if err != nil {
+			log.Error("Failed to execute anonymization plan", map[string]interface{}{
+				"error": err.Error(),
+			})
+			if results == nil {
+				os.Exit(1)
+			}
+		}
+		consistencyGroups = executor.ConsistencyGroups()
+		executor.Close()
+
+		// The checkpoint is only kept until every table was completed
+		if !dryRun {
+			if checkpoint.Finished(plan) {
+				if err := checkpoint.Remove(); err != nil {
+					log.Error("Failed to remove checkpoint", map[string]interface{}{
+						"error": err.Error(),
+					})
+				}
+			} else {
+				log.Info("Run incomplete, rerun with --resume to continue", map[string]interface{}{
+					"checkpoint": checkpointPath(),
+				})
+			}
+		}
+	}
+
+	// 6. Generate report
+	finalReport := outputReport(log, reportGen, results, consistencyGroups)
+
+	duration := time.Since(startTime)
+	log.Info("Anonymization completed", map[string]interface{}{
+		"duration":        duration.String(),
+		"tablesProcessed": finalReport.Summary.TotalTables,
+		"fieldsProcessed": finalReport.Summary.TotalFields,
+		"rowsScanned":     finalReport.Summary.TotalRowsScanned,
+		"rowsAffected":    finalReport.Summary.TotalRowsAffected,
+		"failedTables":    finalReport.Summary.FailedTables,
+	})
+
+	fmt.Printf("Completed in %v\n", duration)
+
+	// Runs in which any table failed exit with an error
+	if finalReport.Failed() {
+		fmt.Printf("Anonymization failed: %d tables failed\n", finalReport.Summary.FailedTables)
+		os.Exit(1)
+	}
+}
+
+// connect connects to the database of a configuration section
+func connect(cfg config.DatabaseConfig) (*sql.DB, error) {
+	return database.Connect(database.Config{
+		Driver:   database.Driver(cfg.Driver),
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		User:     cfg.User,
+		Password: cfg.Password,
+		Name:     cfg.Name,
+	})
+}
+
+// checkpointPath returns the path of the checkpoint in the log directory
+func checkpointPath() string {
+	return filepath.Join(logDir, "checkpoint.json")
+}
+
+// openCheckpoint loads the checkpoint of an interrupted run to resume it, or
+// creates a new checkpoint for the configuration
+func openCheckpoint(log *logger.Logger, cfg *config.Config) *anonymizer.Checkpoint {
+	configHash, err := cfg.Hash()
+	if err != nil {
+		log.Error("Failed to create checkpoint", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	if !resume {
+		return anonymizer.NewCheckpoint(checkpointPath(), configHash)
+	}
+
+	checkpoint, err := anonymizer.LoadCheckpoint(checkpointPath(), configHash)
+	if err != nil {
+		log.Error("Failed to load checkpoint", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	return checkpoint
+}
+
+// copyDatabase copies the source database into the target database,
+// anonymizing it on the way
+func copyDatabase(log *logger.Logger, source *sql.DB, target *config.DatabaseConfig, plan *anonymizer.AnonymizationPlan) ([]anonymizer.ExecutionResult, []anonymizer.ConsistencyGroupResult) {
+	targetDB, err := connect(*target)
+	if err != nil {
+		log.Error("Failed to connect to target database", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	defer targetDB.Close()
+
+	copier, err := anonymizer.NewCopier(source, targetDB, plan, log, dryRun, workers, failFast)
+	if err != nil {
+		log.Error("Failed to create copier", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	defer copier.Close()
+
+	results, err := copier.Copy(context.Background())
 	if err != nil {
-		log.Error("Failed to execute anonymization plan", map[string]interface{}{
+		log.Error("Failed to copy database", map[string]interface{}{
 			"error": err.Error(),
 		})
+		// Copies that stopped after a failed table still report the others
+		if results == nil {
+			os.Exit(1)
+		}
+	}
+	return results, copier.ConsistencyGroups()
+}
+
+// openLogger creates the log directory and the logger writing to it
+func openLogger() *logger.Logger {
+	// Ensure log directory exists
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		fmt.Printf("Error creating log directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logger
+	log, err := logger.NewLogger(logDir, true)
+	if err != nil {
+		fmt.Printf("Error initializing logger: %v\n", err)
 		os.Exit(1)
 	}
+	return log
+}
 
-	// 5. Generate report
+// outputReport generates the final report from the execution results and
+// writes it in the selected format
+func outputReport(log *logger.Logger, reportGen *report.Generator, results []anonymizer.ExecutionResult, consistencyGroups []anonymizer.ConsistencyGroupResult) *report.Report {
 	// Convert anonymizer.ExecutionResult to report.ExecutionResult
 	reportResults := make([]report.ExecutionResult, len(results))
 	for i, result := range results {
 		reportResults[i] = report.ExecutionResult{
 			TableName:    result.TableName,
 			FieldName:    result.FieldName,
+			Action:       result.Action,
+			Parent:       result.Parent,
 			RowsScanned:  result.RowsScanned,
 			RowsAffected: result.RowsAffected,
+			RowsBefore:   result.RowsBefore,
+			RowsAfter:    result.RowsAfter,
 			Strategy:     result.Strategy,
+			Retries:      result.Retries,
+			Transaction:  result.Transaction,
+			Chunk:        result.Chunk,
+			Committed:    result.Committed,
 			Duration:     result.Duration,
 			Error:        result.Error,
 		}
 	}
-	finalReport := reportGen.GenerateReport(reportResults)
+	reportGroups := make([]report.ConsistencyGroupResult, len(consistencyGroups))
+	for i, group := range consistencyGroups {
+		reportGroups[i] = report.ConsistencyGroupResult{
+			Name:           group.Name,
+			Columns:        group.Columns,
+			DistinctValues: group.DistinctValues,
+		}
+	}
+	finalReport := reportGen.GenerateReport(reportResults, reportGroups)
 
 	// Output report
 	if reportType == "json" {
@@ -151,14 +348,5 @@ func main() {
 		reportGen.OutputText(finalReport)
 	}
 
-	duration := time.Since(startTime)
-	log.Info("Anonymization completed", map[string]interface{}{
-		"duration":        duration.String(),
-		"tablesProcessed": finalReport.Summary.TotalTables,
-		"fieldsProcessed": finalReport.Summary.TotalFields,
-		"rowsScanned":     finalReport.Summary.TotalRowsScanned,
-		"rowsAffected":    finalReport.Summary.TotalRowsAffected,
-	})
-
-	fmt.Printf("Completed in %v\n", duration)
+	return finalReport
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/database"
+	"db-gdpr-anonymizer/internal/scanner"
+)
+
+// runScan implements the scan command, which looks for columns holding
+// personal data and proposes a configuration for them:
+//
+//	anonymize-db scan --config config.yaml --out draft.yaml
+func runScan(args []string) {
+	var outFile string
+	var sampleSize int
+
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", configFile, "Path to YAML configuration file")
+	flags.StringVar(&outFile, "out", "", "Path of the draft configuration to write")
+	flags.IntVar(&sampleSize, "sample", scanner.DefaultSampleSize, "Number of rows sampled per table")
+	flags.StringVar(&reportType, "report", reportType, "Final report format (json or text)")
+	flags.StringVar(&logDir, "log", logDir, "Directory for log files")
+	flags.Parse(args)
+
+	// Validate command line arguments
+	if configFile == "" || outFile == "" {
+		fmt.Println("Error: --config and --out flags are required")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if reportType != "json" && reportType != "text" {
+		fmt.Println("Error: --report must be either 'json' or 'text'")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	log := openLogger()
+	defer log.Close()
+
+	startTime := time.Now()
+
+	log.Info("Starting anonymize-db scan", map[string]interface{}{
+		"configFile": configFile,
+		"out":        outFile,
+		"sample":     sampleSize,
+		"reportType": reportType,
+		"logDir":     logDir,
+	})
+
+	// 1. Parse configuration file
+	cfg, err := config.LoadScanConfig(configFile)
+	if err != nil {
+		log.Error("Failed to load configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	// 2. Connect to database
+	db, err := connect(cfg.Database)
+	if err != nil {
+		log.Error("Failed to connect to database", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	dialect, err := database.NewDialect(database.Driver(cfg.Database.Driver))
+	if err != nil {
+		log.Error("Failed to create dialect", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	// 3. Scan the tables and compare the findings with the configuration
+	findings, err := scanner.NewScanner(db, dialect, log, sampleSize).Scan(context.Background())
+	if err != nil {
+		log.Error("Failed to scan database", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	scanner.MarkCovered(findings, cfg)
+
+	// 4. Write the draft configuration for the columns not covered yet
+	out, err := os.Create(outFile)
+	if err != nil {
+		log.Error("Failed to create output file", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	err = scanner.WriteDraftConfig(out, scanner.Uncovered(findings))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Error("Failed to write draft configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	// 5. Generate report
+	scanReport := scanner.NewReport(findings)
+	if reportType == "json" {
+		jsonFile := filepath.Join(logDir, "scan.json")
+		if err := scanReport.OutputJSON(jsonFile); err != nil {
+			log.Error("Failed to output JSON report", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		fmt.Printf("JSON report written to %s\n", jsonFile)
+	} else {
+		scanReport.OutputText()
+	}
+
+	duration := time.Since(startTime)
+	log.Info("Scan completed", map[string]interface{}{
+		"duration":  duration.String(),
+		"findings":  scanReport.Summary.TotalFindings,
+		"uncovered": scanReport.Summary.Uncovered,
+	})
+
+	fmt.Printf("Draft configuration written to %s\n", outFile)
+	fmt.Printf("Completed in %v\n", duration)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"db-gdpr-anonymizer/internal/anonymizer"
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/report"
+)
+
+// runVerify implements the verify command, which checks an anonymized
+// database and exits with status 1 if any check fails:
+//
+//	anonymize-db verify --config config.yaml --snapshot snapshot.json
+func runVerify(args []string) {
+	var snapshotFile string
+	var sampleSize int
+
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", configFile, "Path to YAML configuration file")
+	flags.StringVar(&snapshotFile, "snapshot", snapshotFile, "Path of the snapshot taken before the run")
+	flags.IntVar(&sampleSize, "sample", anonymizer.DefaultSampleSize, "Number of rows sampled per table")
+	flags.StringVar(&reportType, "report", reportType, "Final report format (json or text)")
+	flags.StringVar(&logDir, "log", logDir, "Directory for log files")
+	flags.Parse(args)
+
+	// Validate command line arguments
+	if configFile == "" {
+		fmt.Println("Error: --config flag is required")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if reportType != "json" && reportType != "text" {
+		fmt.Println("Error: --report must be either 'json' or 'text'")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	log := openLogger()
+	defer log.Close()
+
+	startTime := time.Now()
+
+	log.Info("Starting anonymize-db verify", map[string]interface{}{
+		"configFile": configFile,
+		"snapshot":   snapshotFile,
+		"sample":     sampleSize,
+		"reportType": reportType,
+		"logDir":     logDir,
+	})
+
+	// 1. Parse configuration file
+	cfg, err := config.LoadConfig(configFile)
+	if err != nil {
+		log.Error("Failed to load configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	// 2. Connect to the anonymized database, the target if there is one
+	databaseConfig := cfg.Database
+	if cfg.Target != nil {
+		databaseConfig = *cfg.Target
+	}
+	db, err := connect(databaseConfig)
+	if err != nil {
+		log.Error("Failed to connect to database", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	// 3. Create anonymization plan and read the snapshot with its key
+	plan, err := anonymizer.CreatePlan(cfg)
+	if err != nil {
+		log.Error("Failed to create anonymization plan", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	var snapshot *anonymizer.Snapshot
+	if snapshotFile != "" {
+		snapshot, err = anonymizer.ReadSnapshot(snapshotFile, plan.SnapshotKey)
+		if err != nil {
+			log.Error("Failed to read snapshot", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+	}
+
+	// 4. Verify the columns of the plan
+	results, err := anonymizer.NewVerifier(db, plan, log, sampleSize).Verify(context.Background(), snapshot)
+	if err != nil {
+		log.Error("Failed to verify database", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+
+	// 5. Generate report
+	reportResults := make([]report.VerificationResult, len(results))
+	for i, result := range results {
+		reportResults[i] = report.VerificationResult{
+			TableName:    result.TableName,
+			FieldName:    result.FieldName,
+			Strategy:     result.Strategy,
+			RowsChecked:  result.RowsChecked,
+			RowsCompared: result.RowsCompared,
+			Missing:      result.Missing,
+			Unchanged:    result.Unchanged,
+			Invalid:      result.Invalid,
+			Passed:       result.Passed,
+			Skipped:      result.Skipped,
+			Message:      result.Message,
+		}
+	}
+	verifyReport := report.NewVerificationReport(reportResults, snapshotFile)
+	if reportType == "json" {
+		jsonFile := filepath.Join(logDir, "verify.json")
+		if err := verifyReport.OutputJSON(jsonFile); err != nil {
+			log.Error("Failed to output JSON report", map[string]interface{}{
+				"error": err.Error(),
+			})
+			os.Exit(1)
+		}
+		fmt.Printf("JSON report written to %s\n", jsonFile)
+	} else {
+		verifyReport.OutputText()
+	}
+
+	duration := time.Since(startTime)
+	log.Info("Verification completed", map[string]interface{}{
+		"duration": duration.String(),
+		"passed":   verifyReport.Summary.Passed,
+		"failed":   verifyReport.Summary.Failed,
+		"skipped":  verifyReport.Summary.Skipped,
+	})
+
+	fmt.Printf("Completed in %v\n", duration)
+
+	if !verifyReport.Passed() {
+		fmt.Printf("Verification failed: %d checks failed\n", verifyReport.Summary.Failed)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,295 @@
+package anonymizer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Checkpoint records the progress of a run in a file, so that an interrupted
+// run can be resumed: the tables that were completed, and for tables that are
+// processed in chunks, every completed chunk with the range of primary keys
+// it covers, so a resumed run skips exactly those chunks even when a chunk
+// before them failed. A checkpoint belongs to the configuration it was
+// written for and refuses to resume a run of another.
+//
+// A nil checkpoint records nothing and has no tables completed.
+type Checkpoint struct {
+	ConfigHash string                      `json:"config_hash"`
+	Tables     map[string]*TableCheckpoint `json:"tables"`
+
+	path  string
+	mutex sync.Mutex
+}
+
+// TableCheckpoint records the progress of a table
+type TableCheckpoint struct {
+	Completed bool         `json:"completed"`
+	Chunks    []ChunkRange `json:"chunks,omitempty"`
+
+	// The number of chunks this run completed, and the number it processes
+	// once all have been read
+	done  int
+	total int
+	ended bool
+}
+
+// ChunkRange is a completed chunk. It covers the rows whose primary key
+// follows After, or the rows from the beginning of the table if After is nil,
+// up to and including Last.
+type ChunkRange struct {
+	Chunk int           `json:"chunk"`
+	After []interface{} `json:"after,omitempty"`
+	Last  []interface{} `json:"last"`
+}
+
+// MarshalJSON implements json.Marshaler, encoding the keys with encodeKey
+func (r ChunkRange) MarshalJSON() ([]byte, error) {
+	type chunkRange ChunkRange
+	return json.Marshal(chunkRange{Chunk: r.Chunk, After: encodeKey(r.After), Last: encodeKey(r.Last)})
+}
+
+// NewCheckpoint creates an empty checkpoint for the configuration with the
+// given hash that is written to path
+func NewCheckpoint(path, configHash string) *Checkpoint {
+	return &Checkpoint{
+		ConfigHash: configHash,
+		Tables:     make(map[string]*TableCheckpoint),
+		path:       path,
+	}
+}
+
+// LoadCheckpoint reads the checkpoint at path to resume a run. It fails if
+// the checkpoint was written for another configuration.
+func LoadCheckpoint(path, configHash string) (*Checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no checkpoint to resume from at %s", path)
+		}
+		return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	defer file.Close()
+
+	// Keys are decoded as json.Number, so integers keep their precision
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+
+	checkpoint := &Checkpoint{path: path}
+	if err := decoder.Decode(checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+	if checkpoint.ConfigHash != configHash {
+		return nil, fmt.Errorf("the configuration changed since checkpoint %s was written; run without resuming to start over", path)
+	}
+
+	if checkpoint.Tables == nil {
+		checkpoint.Tables = make(map[string]*TableCheckpoint)
+	}
+	for _, table := range checkpoint.Tables {
+		for _, chunk := range table.Chunks {
+			decodeKey(chunk.After)
+			decodeKey(chunk.Last)
+		}
+	}
+
+	return checkpoint, nil
+}
+
+// Completed reports whether a table was completed
+func (c *Checkpoint) Completed(tableName string) bool {
+	if c == nil {
+		return false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	table, ok := c.Tables[tableName]
+	return ok && table.Completed
+}
+
+// CompletedChunks returns the chunks of a table completed before, in
+// primary key order
+func (c *Checkpoint) CompletedChunks(tableName string) []ChunkRange {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	table, ok := c.Tables[tableName]
+	if !ok {
+		return nil
+	}
+	chunks := make([]ChunkRange, len(table.Chunks))
+	copy(chunks, table.Chunks)
+	return chunks
+}
+
+// CompleteChunk records that a chunk of a table was completed, with the
+// primary key the chunk follows and its last primary key, which are equal if
+// the chunk is empty. Chunks complete in any order; a chunk that fails does
+// not keep the chunks after it from being recorded.
+func (c *Checkpoint) CompleteChunk(tableName string, chunk int, after, last []interface{}) error {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	table := c.table(tableName)
+	table.Chunks = append(table.Chunks, ChunkRange{Chunk: chunk, After: after, Last: last})
+	sort.SliceStable(table.Chunks, func(i, j int) bool {
+		return table.Chunks[i].Chunk < table.Chunks[j].Chunk
+	})
+	table.done++
+	table.complete()
+
+	return c.save()
+}
+
+// EndTable records that all chunks of a table were read, where chunks is the
+// number of chunks this run processed. The table is completed once they are.
+func (c *Checkpoint) EndTable(tableName string, chunks int) error {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	table := c.table(tableName)
+	table.total = chunks
+	table.ended = true
+	if !table.complete() {
+		return nil
+	}
+
+	return c.save()
+}
+
+// CompleteTable records that a table that is not processed in chunks was
+// completed
+func (c *Checkpoint) CompleteTable(tableName string) error {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	table := c.table(tableName)
+	table.Completed = true
+	table.Chunks = nil
+
+	return c.save()
+}
+
+// Finished reports whether every table of the plan was completed
+func (c *Checkpoint) Finished(plan *AnonymizationPlan) bool {
+	for _, tablePlan := range plan.Tables {
+		if !c.Completed(tablePlan.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Remove removes the checkpoint file once a run finished
+func (c *Checkpoint) Remove() error {
+	if c == nil {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
+
+// table returns the progress of a table, creating it on first use. The mutex
+// must be held.
+func (c *Checkpoint) table(tableName string) *TableCheckpoint {
+	table, ok := c.Tables[tableName]
+	if !ok {
+		table = &TableCheckpoint{}
+		c.Tables[tableName] = table
+	}
+	return table
+}
+
+// complete marks the table completed once all chunks of this run were read
+// and completed. The chunk ranges are no longer needed then. It reports
+// whether the table is completed.
+func (t *TableCheckpoint) complete() bool {
+	if t.ended && t.done >= t.total {
+		t.Completed = true
+		t.Chunks = nil
+	}
+	return t.Completed
+}
+
+// encodeKey prepares a primary key for the checkpoint and the snapshot.
+// Binary values are stored as base64 and times as RFC 3339 text, each in an
+// object, so decodeKey restores them as bytes and times rather than as text.
+func encodeKey(key []interface{}) []interface{} {
+	if key == nil {
+		return nil
+	}
+	encoded := make([]interface{}, len(key))
+	for i, value := range key {
+		if b, ok := value.([]byte); ok {
+			encoded[i] = map[string]interface{}{"binary": base64.StdEncoding.EncodeToString(b)}
+			continue
+		}
+		if t, ok := value.(time.Time); ok {
+			encoded[i] = map[string]interface{}{"time": t.Format(time.RFC3339Nano)}
+			continue
+		}
+		encoded[i] = value
+	}
+	return encoded
+}
+
+// sameKey reports whether two primary keys are equal as the checkpoint
+// stores them, so a key read from the database matches the same key loaded
+// from the checkpoint
+func sameKey(a, b []interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return keyString(a) == keyString(b)
+}
+
+// keyString returns the JSON encoding of a primary key as the checkpoint and
+// the snapshot store it. Keys read from the database and the same keys read
+// back from JSON, where times are text and whole floats are integers, give
+// the same string.
+func keyString(key []interface{}) string {
+	encoded, err := json.Marshal(encodeKey(key))
+	if err != nil {
+		return fmt.Sprintf("%v", key)
+	}
+	return string(encoded)
+}
+
+// save writes the checkpoint to its file. It writes a temporary file first
+// and renames it, so an interruption never leaves a partial checkpoint. The
+// mutex must be held.
+func (c *Checkpoint) save() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+
+	temporary := c.path + ".tmp"
+	if err := os.WriteFile(temporary, data, 0600); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(temporary, c.path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package anonymizer
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+func TestCheckpointChunks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint := NewCheckpoint(path, "hash")
+
+	// Chunks completing out of order are recorded in key order with their
+	// key ranges
+	if err := checkpoint.CompleteChunk("orders", 1, []interface{}{int64(100)}, []interface{}{int64(200)}); err != nil {
+		t.Fatalf("Failed to complete chunk: %v", err)
+	}
+	if err := checkpoint.CompleteChunk("orders", 0, nil, []interface{}{int64(100)}); err != nil {
+		t.Fatalf("Failed to complete chunk: %v", err)
+	}
+	expected := []ChunkRange{
+		{Chunk: 0, Last: []interface{}{int64(100)}},
+		{Chunk: 1, After: []interface{}{int64(100)}, Last: []interface{}{int64(200)}},
+	}
+	if chunks := checkpoint.CompletedChunks("orders"); !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("Expected completed chunks %+v, got %+v", expected, chunks)
+	}
+
+	// The table is completed once all chunks were read and completed
+	if err := checkpoint.EndTable("orders", 3); err != nil {
+		t.Fatalf("Failed to end table: %v", err)
+	}
+	if checkpoint.Completed("orders") {
+		t.Errorf("Expected orders not to be completed before its last chunk")
+	}
+	if err := checkpoint.CompleteChunk("orders", 2, []interface{}{int64(200)}, []interface{}{int64(300)}); err != nil {
+		t.Fatalf("Failed to complete chunk: %v", err)
+	}
+	if !checkpoint.Completed("orders") {
+		t.Errorf("Expected orders to be completed")
+	}
+
+	// A chunk after a failed one is recorded all the same
+	if err := checkpoint.CompleteChunk("customers", 1, []interface{}{int64(9007199254740993), "de"}, []interface{}{int64(9007199254740999), "at"}); err != nil {
+		t.Fatalf("Failed to complete chunk: %v", err)
+	}
+	if err := checkpoint.CompleteChunk("sessions", 0, nil, []interface{}{[]byte{0x00, 0xff}}); err != nil {
+		t.Fatalf("Failed to complete chunk: %v", err)
+	}
+
+	// The checkpoint loads for the same configuration only
+	if _, err := LoadCheckpoint(path, "other"); err == nil {
+		t.Errorf("Expected loading a checkpoint of another configuration to fail")
+	}
+	loaded, err := LoadCheckpoint(path, "hash")
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	if !loaded.Completed("orders") {
+		t.Errorf("Expected orders to be completed after loading")
+	}
+	expected = []ChunkRange{{Chunk: 1, After: []interface{}{int64(9007199254740993), "de"}, Last: []interface{}{int64(9007199254740999), "at"}}}
+	if chunks := loaded.CompletedChunks("customers"); !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("Expected completed chunks %+v, got %+v", expected, chunks)
+	}
+
+	// Binary keys are loaded as bytes
+	expected = []ChunkRange{{Chunk: 0, Last: []interface{}{[]byte{0x00, 0xff}}}}
+	if chunks := loaded.CompletedChunks("sessions"); !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("Expected completed chunks %+v, got %+v", expected, chunks)
+	}
+
+	if err := loaded.Remove(); err != nil {
+		t.Fatalf("Failed to remove checkpoint: %v", err)
+	}
+	if _, err := LoadCheckpoint(path, "hash"); err == nil {
+		t.Errorf("Expected loading a removed checkpoint to fail")
+	}
+}
+
+func TestExecutorSQLiteResume(t *testing.T) {
+	db := openTestDatabase(t)
+	plan := testPlan(t)
+
+	// An interrupted run completed orders and customers and the first chunk
+	// of order_items
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	interrupted := NewCheckpoint(path, "hash")
+	if err := interrupted.CompleteTable("orders"); err != nil {
+		t.Fatalf("Failed to complete table: %v", err)
+	}
+	if err := interrupted.CompleteTable("customers"); err != nil {
+		t.Fatalf("Failed to complete table: %v", err)
+	}
+	if err := interrupted.CompleteChunk("order_items", 0, nil, []interface{}{int64(11), "a"}); err != nil {
+		t.Fatalf("Failed to complete chunk: %v", err)
+	}
+
+	checkpoint, err := LoadCheckpoint(path, "hash")
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	executor := NewExecutor(db, plan, log, false, 2, false, checkpoint)
+	defer executor.Close()
+	if _, err := executor.Execute(context.Background()); err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+
+	// Completed tables and chunks are left alone
+	if orders := queryStrings(t, db, "SELECT id FROM orders"); len(orders) != 3 {
+		t.Errorf("Expected orders to be skipped, got %d orders", len(orders))
+	}
+	if emails := queryStrings(t, db, "SELECT email FROM customers WHERE id = 1"); emails[0].String != "jane@example.com" {
+		t.Errorf("Expected customers to be skipped, got %s", emails[0].String)
+	}
+	labels := queryStrings(t, db, "SELECT label FROM order_items ORDER BY order_id, sku")
+	if labels[0].String != "Old item" || labels[1].String != "Item a" {
+		t.Errorf("Expected the first chunk of order_items to be skipped, got %v", labels[:2])
+	}
+
+	// The rest is anonymized
+	for _, label := range labels[2:] {
+		if label.String == "Item b" || label.String == "Item c" || label.String == "Item d" {
+			t.Errorf("Expected the remaining order_items to be anonymized, got %s", label.String)
+		}
+	}
+	if emails := queryStrings(t, db, "SELECT email FROM newsletter WHERE \"order\" = 2"); emails[0].String == "someone@example.com" {
+		t.Errorf("Expected newsletter to be anonymized")
+	}
+	if sessions := queryStrings(t, db, "SELECT token FROM sessions"); len(sessions) != 0 {
+		t.Errorf("Expected sessions to be truncated, got %d rows", len(sessions))
+	}
+
+	if !checkpoint.Finished(plan) {
+		t.Errorf("Expected every table to be completed, got %+v", checkpoint.Tables)
+	}
+}
+
+func TestExecutorSQLiteResumeAfterFailedChunk(t *testing.T) {
+	db := openTestDatabase(t)
+	plan := testPlan(t)
+
+	// An interrupted run failed the first chunk of order_items but completed
+	// the second
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	interrupted := NewCheckpoint(path, "hash")
+	if err := interrupted.CompleteChunk("order_items", 1, []interface{}{int64(11), "a"}, []interface{}{int64(12), "a"}); err != nil {
+		t.Fatalf("Failed to complete chunk: %v", err)
+	}
+
+	checkpoint, err := LoadCheckpoint(path, "hash")
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	executor := NewExecutor(db, plan, log, false, 2, false, checkpoint)
+	defer executor.Close()
+	if _, err := executor.Execute(context.Background()); err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+
+	// The completed chunk is skipped, the chunks around it are anonymized
+	labels := queryStrings(t, db, "SELECT label FROM order_items ORDER BY order_id, sku")
+	if len(labels) != 4 {
+		t.Fatalf("Expected 4 order items to remain, got %d", len(labels))
+	}
+	if labels[0].String == "Item a" {
+		t.Errorf("Expected the failed chunk to be anonymized, got %s", labels[0].String)
+	}
+	if labels[1].String != "Item b" || labels[2].String != "Item c" {
+		t.Errorf("Expected the completed chunk to be skipped, got %v", labels[1:3])
+	}
+	if labels[3].String == "Item d" {
+		t.Errorf("Expected the chunk after the completed one to be anonymized, got %s", labels[3].String)
+	}
+
+	if !checkpoint.Finished(plan) {
+		t.Errorf("Expected every table to be completed, got %+v", checkpoint.Tables)
+	}
+}
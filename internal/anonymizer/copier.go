@@ -0,0 +1,451 @@
+package anonymizer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"db-gdpr-anonymizer/internal/database"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+// Copier copies a source database into a separate target database and
+// anonymizes the data on the way, leaving the source untouched. The rows of
+// each table are read from the source, anonymized in Go and inserted into the
+// target in batches, so original values of anonymized columns are never
+// written to the target. The target tables are created from the source
+// schema with their columns and primary keys; indexes, defaults and foreign
+// keys are not copied.
+type Copier struct {
+	source     *sql.DB
+	target     *sql.DB
+	plan       *AnonymizationPlan
+	sqlGen     *SQLGenerator
+	logger     *logger.Logger
+	dryRun     bool
+	maxWorkers int
+	failFast   bool
+	mappings   *MappingStore
+}
+
+// NewCopier creates a copier for a plan. Limits are rejected: every row is
+// copied, and a limit would leave the rows beyond it with their original
+// values. So are shuffled columns, which need all rows of a table read before
+// the first is copied. With failFast, the copier stops at the first table
+// that fails.
+func NewCopier(source, target *sql.DB, plan *AnonymizationPlan, logger *logger.Logger, dryRun bool, maxWorkers int, failFast bool) (*Copier, error) {
+	for _, tablePlan := range plan.Tables {
+		if tablePlan.Limit > 0 {
+			return nil, fmt.Errorf("table %s: limit is not supported when copying to a target database", tablePlan.Name)
+		}
+		for _, column := range tablePlan.Columns {
+			if _, ok := column.Strategy.(*ShuffleStrategy); ok {
+				return nil, fmt.Errorf("column %s.%s: shuffle strategy is not supported when copying to a target database", tablePlan.Name, column.Name)
+			}
+		}
+	}
+
+	mappings, err := NewMappingStore(defaultMappingMemoryEntries, os.TempDir())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Copier{
+		source:     source,
+		target:     target,
+		plan:       plan,
+		sqlGen:     NewSQLGenerator(plan, plan.Dialect),
+		logger:     logger,
+		dryRun:     dryRun,
+		maxWorkers: maxWorkers,
+		failFast:   failFast,
+		mappings:   mappings,
+	}, nil
+}
+
+// Copy copies every table of the source database into the target database.
+// Rows of delete tables and their dependent rows are left out, truncated
+// tables are created empty and tables outside the plan are copied unchanged.
+// In dry run mode, the rows are read and anonymized but nothing is written.
+func (c *Copier) Copy(ctx context.Context) ([]ExecutionResult, error) {
+	driver := c.plan.Dialect.Driver()
+
+	tables, err := database.GetTables(c.source, driver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tables: %w", err)
+	}
+
+	// Tables outside the plan are copied as they are
+	tablePlans := make(map[string]*TablePlan, len(tables))
+	for _, table := range tables {
+		tablePlans[table] = &TablePlan{Name: table, Action: ActionAnonymize, BatchSize: defaultBatchSize}
+	}
+	for _, tablePlan := range c.plan.Tables {
+		if _, ok := tablePlans[tablePlan.Name]; !ok {
+			return nil, fmt.Errorf("table %s not found in source database", tablePlan.Name)
+		}
+		tablePlans[tablePlan.Name] = tablePlan
+	}
+
+	// Rows that would be deleted are left out of their tables
+	results, exclusions, err := c.planExclusions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resultsMutex := &sync.Mutex{}
+
+	// Failed tables are reported with their error. With fail fast, the first
+	// failure cancels the tables in progress and stops the copy.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var firstFailure *ExecutionResult
+
+	// Create a worker pool; each table is copied by one worker
+	workerPool := make(chan struct{}, c.maxWorkers)
+	var wg sync.WaitGroup
+
+tables:
+	for _, table := range tables {
+		// Check if context is cancelled
+		select {
+		case <-ctx.Done():
+			break tables
+		default:
+		}
+
+		// Limit concurrent workers
+		workerPool <- struct{}{}
+		wg.Add(1)
+
+		go func(tablePlan *TablePlan) {
+			defer func() {
+				<-workerPool
+				wg.Done()
+			}()
+
+			tableResults, err := c.copyTable(ctx, tablePlan, exclusions[tablePlan.Name])
+			if err != nil {
+				c.logger.Error("Failed to copy table", map[string]interface{}{
+					"table": tablePlan.Name,
+					"error": err.Error(),
+				})
+
+				result := failedTable(tablePlan, err)
+				resultsMutex.Lock()
+				results = append(results, result)
+				if firstFailure == nil {
+					firstFailure = &result
+				}
+				resultsMutex.Unlock()
+
+				if c.failFast {
+					cancel()
+				}
+				return
+			}
+
+			resultsMutex.Lock()
+			results = append(results, tableResults...)
+			resultsMutex.Unlock()
+		}(tablePlans[table])
+	}
+
+	// Wait for all workers to finish
+	wg.Wait()
+
+	if c.failFast && firstFailure != nil {
+		return results, fmt.Errorf("stopped after table %s failed: %w", firstFailure.TableName, firstFailure.Error)
+	}
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// ConsistencyGroups returns the consistency groups of the plan with the
+// number of distinct values mapped in each during the copy
+func (c *Copier) ConsistencyGroups() []ConsistencyGroupResult {
+	return consistencyGroups(c.plan, c.mappings)
+}
+
+// Close releases resources held by the copier
+func (c *Copier) Close() error {
+	return c.mappings.Close()
+}
+
+// planExclusions plans the deletions of the delete tables and returns their
+// results, with the rows that would be deleted counted in the source, and the
+// conditions of the rows to leave out of each table
+func (c *Copier) planExclusions(ctx context.Context) ([]ExecutionResult, map[string][]string, error) {
+	results := make([]ExecutionResult, 0)
+	exclusions := make(map[string][]string)
+
+	var foreignKeys []database.ForeignKey
+	foreignKeysLoaded := false
+
+	for _, tablePlan := range c.plan.Tables {
+		if tablePlan.Action != ActionDelete {
+			continue
+		}
+
+		if !foreignKeysLoaded {
+			var err error
+			foreignKeys, err = database.GetForeignKeys(c.source, c.plan.Dialect.Driver())
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get foreign keys: %w", err)
+			}
+			foreignKeysLoaded = true
+		}
+
+		for _, step := range c.sqlGen.planDeletion(tablePlan, foreignKeys) {
+			startTime := time.Now()
+
+			var rowsMatched int64
+			if err := c.source.QueryRowContext(ctx, c.sqlGen.GenerateDeleteCountSQL(step)).Scan(&rowsMatched); err != nil {
+				return nil, nil, fmt.Errorf("failed to count rows to delete from %s: %w", step.Table, err)
+			}
+			exclusions[step.Table] = append(exclusions[step.Table], step.Condition)
+
+			duration := time.Since(startTime)
+
+			// Log the operation
+			c.logger.Info("Excluded rows", map[string]interface{}{
+				"table":       step.Table,
+				"parent":      step.Parent,
+				"rowsMatched": rowsMatched,
+				"dryRun":      c.dryRun,
+				"duration":    duration.String(),
+			})
+
+			results = append(results, ExecutionResult{
+				TableName:    step.Table,
+				Action:       ActionDelete,
+				Parent:       step.Parent,
+				RowsScanned:  rowsMatched,
+				RowsAffected: rowsMatched,
+				Duration:     duration,
+			})
+		}
+	}
+
+	return results, exclusions, nil
+}
+
+// copyTable creates a table in the target database and copies its rows,
+// leaving out the rows matching any of the exclusions. The schema is read
+// before the rows are streamed, so a worker never needs a second source
+// connection while it holds one.
+func (c *Copier) copyTable(ctx context.Context, tablePlan *TablePlan, exclusions []string) ([]ExecutionResult, error) {
+	driver := c.plan.Dialect.Driver()
+	startTime := time.Now()
+
+	columns, err := database.GetColumnDefinitions(c.source, driver, tablePlan.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+
+	// Locate the planned columns in the rows, followed by the row columns
+	// their strategies read
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.Name)
+	}
+	rowColumns := tablePlan.rowColumns()
+	located := append(columnNames(tablePlan.Columns), rowColumns...)
+	indexes := make([]int, len(located))
+	for i, column := range located {
+		indexes[i] = -1
+		for j, name := range names {
+			if name == column {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] < 0 {
+			return nil, fmt.Errorf("column %s.%s not found in source database", tablePlan.Name, column)
+		}
+	}
+
+	// Use the primary key from the plan if it's set, otherwise get it
+	primaryKey := tablePlan.PrimaryKey
+	if len(primaryKey) == 0 {
+		primaryKey, err = database.GetPrimaryKey(c.source, driver, tablePlan.Name)
+		if err != nil {
+			c.logger.Warning("Creating table without primary key", map[string]interface{}{
+				"table": tablePlan.Name,
+				"error": err.Error(),
+			})
+		}
+	}
+
+	if !c.dryRun {
+		if _, err := c.target.ExecContext(ctx, c.sqlGen.GenerateCreateTableSQL(tablePlan.Name, columns, primaryKey)); err != nil {
+			return nil, fmt.Errorf("failed to create target table: %w", err)
+		}
+	}
+
+	// Truncated tables stay empty
+	if tablePlan.Action == ActionTruncate {
+		rowsBefore, err := c.countRows(ctx, tablePlan)
+		if err != nil {
+			return nil, err
+		}
+
+		duration := time.Since(startTime)
+
+		// Log the operation
+		c.logger.Info("Created empty table", map[string]interface{}{
+			"table":      tablePlan.Name,
+			"rowsBefore": rowsBefore,
+			"dryRun":     c.dryRun,
+			"duration":   duration.String(),
+		})
+
+		return []ExecutionResult{{
+			TableName:    tablePlan.Name,
+			Action:       ActionTruncate,
+			RowsScanned:  rowsBefore,
+			RowsAffected: rowsBefore,
+			RowsBefore:   rowsBefore,
+			Strategy:     "omit",
+			Duration:     duration,
+		}}, nil
+	}
+
+	// Rows of delete tables are copied without the excluded ones, but
+	// otherwise unchanged
+	anonymize := tablePlan.Action == ActionAnonymize
+
+	rows, err := c.source.QueryContext(ctx, c.sqlGen.GenerateCopySelectSQL(tablePlan, names, exclusions))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+	defer rows.Close()
+
+	maxRows := c.sqlGen.maxInsertRows(tablePlan, len(names))
+	batch := make([][]interface{}, 0, maxRows)
+	var rowsCopied, rowsAnonymized int64
+
+	for rows.Next() {
+		values := make([]interface{}, len(names))
+		dest := make([]interface{}, len(names), len(names)+1)
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		// Rows of tables with a where condition tell whether they match it
+		matches := int64(1)
+		if tablePlan.Where != "" {
+			dest = append(dest, &matches)
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+
+		if anonymize && matches == 1 {
+			row := rowColumnValues(rowColumns, indexes[len(tablePlan.Columns):], func(index int) interface{} {
+				return normalizeValue(values[index])
+			})
+			for i, column := range tablePlan.Columns {
+				value, err := c.replacement(column, values[indexes[i]], row)
+				if err != nil {
+					return nil, fmt.Errorf("failed to anonymize %s.%s: %w", tablePlan.Name, column.Name, err)
+				}
+				values[indexes[i]] = value
+			}
+			rowsAnonymized++
+		}
+
+		batch = append(batch, values)
+		if len(batch) == maxRows {
+			if err := c.insertRows(ctx, tablePlan, names, batch); err != nil {
+				return nil, err
+			}
+			rowsCopied += int64(len(batch))
+			batch = batch[:0]
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	if len(batch) > 0 {
+		if err := c.insertRows(ctx, tablePlan, names, batch); err != nil {
+			return nil, err
+		}
+		rowsCopied += int64(len(batch))
+	}
+
+	duration := time.Since(startTime)
+
+	// Log the operation
+	c.logger.Info("Copied table", map[string]interface{}{
+		"table":          tablePlan.Name,
+		"rowsCopied":     rowsCopied,
+		"rowsAnonymized": rowsAnonymized,
+		"dryRun":         c.dryRun,
+		"duration":       duration.String(),
+	})
+
+	// Create results for each column
+	results := make([]ExecutionResult, 0, len(tablePlan.Columns))
+	if anonymize {
+		for _, column := range tablePlan.Columns {
+			results = append(results, ExecutionResult{
+				TableName:    tablePlan.Name,
+				FieldName:    column.Name,
+				Action:       ActionAnonymize,
+				RowsScanned:  rowsCopied,
+				RowsAffected: rowsAnonymized,
+				Strategy:     column.Strategy.GetType(),
+				Duration:     duration,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// replacement computes the new value of a column from its original value
+// and the row columns of its table. SQL expressions are evaluated by the
+// source database when the rows are read, so their values are already final.
+func (c *Copier) replacement(column *ColumnPlan, original interface{}, row map[string]interface{}) (interface{}, error) {
+	switch strategy := column.Strategy.(type) {
+	case ValueStrategy:
+		return anonymizeValue(c.mappings, column, normalizeValue(original), row)
+	case *FixedValueStrategy:
+		return strategy.Value, nil
+	case *NullStrategy:
+		return nil, nil
+	default:
+		return original, nil
+	}
+}
+
+// insertRows inserts a batch of rows into the target table
+func (c *Copier) insertRows(ctx context.Context, tablePlan *TablePlan, columns []string, rows [][]interface{}) error {
+	if c.dryRun {
+		return nil
+	}
+
+	sqlQuery, args, err := c.sqlGen.GenerateInsertSQL(tablePlan.Name, columns, rows)
+	if err != nil {
+		return err
+	}
+	if _, err := c.target.ExecContext(ctx, sqlQuery, args...); err != nil {
+		return fmt.Errorf("failed to insert rows: %w", err)
+	}
+	return nil
+}
+
+// countRows counts the rows of a table in the source database
+func (c *Copier) countRows(ctx context.Context, tablePlan *TablePlan) (int64, error) {
+	var count int64
+	err := c.source.QueryRowContext(ctx, c.sqlGen.GenerateCountSQL(tablePlan)).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,193 @@
+package anonymizer
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/database"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+// runTestCopy copies the test database into a new SQLite database, which it
+// returns together with the results
+func runTestCopy(t *testing.T, source *sql.DB, dryRun bool) (*sql.DB, []ExecutionResult) {
+	t.Helper()
+
+	target, err := database.Connect(database.Config{
+		Driver: database.SQLite,
+		Name:   filepath.Join(t.TempDir(), "target.db"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open target database: %v", err)
+	}
+	t.Cleanup(func() { target.Close() })
+
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{Driver: "sqlite"},
+		Seed:     "test-seed",
+		Tables: map[string]config.TableConfig{
+			"customers": {
+				Where: "id < 3",
+				Columns: map[string]config.ColumnConfig{
+					"email": {Type: "faker.email", ConsistencyGroup: "email"},
+					"name":  {Value: "Jane Doe"},
+					"note":  {Expr: "'note ' || id"},
+				},
+			},
+			"newsletter": {
+				Columns: map[string]config.ColumnConfig{
+					"email": {Type: "faker.email", ConsistencyGroup: "email"},
+				},
+			},
+			"order_items": {
+				BatchSize: 2,
+				Columns: map[string]config.ColumnConfig{
+					"label": {Type: "faker.sentence"},
+				},
+			},
+			"orders": {
+				Delete: config.Bool(true),
+				Where:  "created_at < '2020-01-01'",
+			},
+			"sessions": {
+				Truncate: config.Bool(true),
+			},
+		},
+	}
+
+	plan, err := CreatePlan(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	copier, err := NewCopier(source, target, plan, log, dryRun, 2, false)
+	if err != nil {
+		t.Fatalf("Failed to create copier: %v", err)
+	}
+	defer copier.Close()
+
+	results, err := copier.Copy(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to copy database: %v", err)
+	}
+	return target, results
+}
+
+func TestCopierSQLite(t *testing.T) {
+	source := openTestDatabase(t)
+	target, results := runTestCopy(t, source, false)
+
+	// The source is untouched
+	if emails := queryStrings(t, source, `SELECT email FROM customers ORDER BY id`); emails[0].String != "jane@example.com" {
+		t.Errorf("Expected source emails to be kept, got %v", emails)
+	}
+	if orders := queryStrings(t, source, `SELECT id FROM orders`); len(orders) != 3 {
+		t.Errorf("Expected source orders to be kept, got %v", orders)
+	}
+
+	// Rows matching the where condition are anonymized, the others copied
+	names := queryStrings(t, target, `SELECT name FROM customers ORDER BY id`)
+	if len(names) != 3 {
+		t.Fatalf("Expected 3 customers, got %v", names)
+	}
+	notes := queryStrings(t, target, `SELECT note FROM customers ORDER BY id`)
+	if names[0].String != "Jane Doe" || names[2].String != "Nobody" || notes[1].String != "note 2" || notes[2].String != "x" {
+		t.Errorf("Unexpected customer names %v and notes %v", names, notes)
+	}
+
+	// The consistency group maps john@example.com to the same fake email
+	emails := queryStrings(t, target, `SELECT email FROM customers ORDER BY id`)
+	if emails[0].String == "jane@example.com" || emails[1].String == "john@example.com" || emails[2].Valid {
+		t.Errorf("Expected customer emails to be anonymized, got %v", emails)
+	}
+	newsletter := queryStrings(t, target, `SELECT email FROM newsletter ORDER BY "order"`)
+	if newsletter[0] != emails[1] {
+		t.Errorf("Expected newsletter email '%s' to match customer email '%s'", newsletter[0].String, emails[1].String)
+	}
+
+	// Old orders are left out together with their items
+	orders := queryStrings(t, target, `SELECT id FROM orders ORDER BY id`)
+	if len(orders) != 2 || orders[0].String != "11" {
+		t.Errorf("Expected orders 11 and 12 to be copied, got %v", orders)
+	}
+	labels := queryStrings(t, target, `SELECT label FROM order_items ORDER BY order_id, sku`)
+	if len(labels) != 4 {
+		t.Fatalf("Expected 4 order items to be copied, got %d", len(labels))
+	}
+	for _, label := range labels {
+		if label.String == "Item a" || label.String == "Item b" || label.String == "Item c" || label.String == "Item d" {
+			t.Errorf("Expected order item labels to be anonymized, got '%s'", label.String)
+		}
+	}
+
+	// Truncated tables are created empty
+	if sessions := queryStrings(t, target, `SELECT token FROM sessions`); len(sessions) != 0 {
+		t.Errorf("Expected sessions to be empty, got %v", sessions)
+	}
+
+	// Primary keys are created from the source schema
+	primaryKey, err := database.GetPrimaryKey(target, database.SQLite, "order_items")
+	if err != nil || len(primaryKey) != 2 || primaryKey[0] != "order_id" {
+		t.Errorf("Expected order_items primary key (order_id, sku), got %v (%v)", primaryKey, err)
+	}
+
+	deleted := make(map[string]int64)
+	for _, result := range results {
+		if result.Action == ActionDelete {
+			deleted[result.TableName] = result.RowsAffected
+		}
+	}
+	if deleted["orders"] != 1 || deleted["order_items"] != 1 {
+		t.Errorf("Expected one order and one order item to be left out, got %v", deleted)
+	}
+}
+
+func TestCopierSQLiteDryRun(t *testing.T) {
+	source := openTestDatabase(t)
+	target, results := runTestCopy(t, source, true)
+
+	// Nothing is written to the target
+	if tables, err := database.GetTables(target, database.SQLite); err != nil || len(tables) != 0 {
+		t.Errorf("Expected dry run to create no tables, got %v (%v)", tables, err)
+	}
+
+	// The rows that would be anonymized are counted
+	anonymized := make(map[string]int64)
+	for _, result := range results {
+		if result.Action == ActionAnonymize {
+			anonymized[result.TableName] = result.RowsAffected
+		}
+	}
+	if anonymized["customers"] != 2 || anonymized["newsletter"] != 2 || anonymized["order_items"] != 4 {
+		t.Errorf("Unexpected anonymized row counts %v", anonymized)
+	}
+}
+
+func TestCopierRejectsLimit(t *testing.T) {
+	plan, err := CreatePlan(&config.Config{
+		Tables: map[string]config.TableConfig{
+			"customers": {
+				Limit: 10,
+				Columns: map[string]config.ColumnConfig{
+					"email": {Null: true},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+
+	if _, err := NewCopier(nil, nil, plan, nil, false, 1, false); err == nil {
+		t.Error("Expected error for limit, got nil")
+	}
+}
@@ -0,0 +1,412 @@
+package anonymizer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateParams lists the parameters accepted by each date strategy
+var dateParams = map[string]map[string]bool{
+	"date_shift":    {"days": true, "key": true},
+	"date_truncate": {"to": true},
+	"age_bucket":    {"size": true, "max": true, "reference": true, "output": true},
+}
+
+// datePattern matches dates and timestamps written as text, such as MySQL
+// DATE, DATETIME and TIMESTAMP values read without parseTime and PostgreSQL
+// timestamptz values in dumps: the date, the time of day and the time zone
+var datePattern = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})([ T]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?)?(\s*(?:Z|[+-]\d{2}(?::?\d{2})?))?$`)
+
+// dateValue is a date or timestamp read from a column. Drivers return them as
+// time.Time or as text; a replaced value keeps the representation it was read
+// in, and text keeps its format, time of day and time zone as written.
+type dateValue struct {
+	time  time.Time
+	text  bool
+	clock string
+	zone  string
+}
+
+// parseDate parses an original date or timestamp. MySQL zero dates, in which
+// the year, month or day is zero, are reported by zero and kept as they are.
+func parseDate(strategy string, original interface{}) (value dateValue, zero bool, err error) {
+	switch v := original.(type) {
+	case time.Time:
+		return dateValue{time: v}, false, nil
+	case string:
+		match := datePattern.FindStringSubmatch(v)
+		if match == nil {
+			return dateValue{}, false, fmt.Errorf("%s strategy cannot read %q as a date", strategy, v)
+		}
+		year, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+		day, _ := strconv.Atoi(match[3])
+		if year == 0 || month == 0 || day == 0 {
+			return dateValue{}, true, nil
+		}
+		date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if date.Month() != time.Month(month) || date.Day() != day {
+			return dateValue{}, false, fmt.Errorf("%s strategy cannot read %q as a date", strategy, v)
+		}
+		value := dateValue{time: date, text: true, clock: match[4], zone: match[5]}
+		if value.clock != "" && value.zone != "" {
+			value = value.utc()
+		}
+		return value, false, nil
+	default:
+		return dateValue{}, false, fmt.Errorf("%s strategy requires dates, got %T", strategy, original)
+	}
+}
+
+// utc returns a text timestamp with a time zone offset in UTC. The offset of
+// a timestamptz value is that of its own date in the session time zone, and
+// under daylight saving time differs from the offset at a replaced date, so
+// dates are replaced in UTC, where the date and midnight of the value are
+// the same at any date. The clock and offset keep their format.
+func (v dateValue) utc() dateValue {
+	digits := func(text string, from int) int {
+		if len(text) < from+2 {
+			return 0
+		}
+		n, _ := strconv.Atoi(text[from : from+2])
+		return n
+	}
+
+	// The clock is a separator, hours, minutes and optionally seconds and
+	// their fraction, which the offset in whole minutes leaves unchanged
+	clock := v.clock[1:]
+	hour, min, sec := digits(clock, 0), digits(clock, 3), digits(clock, 6)
+	year, month, day := v.time.Date()
+	instant := time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+
+	zone := strings.TrimSpace(v.zone)
+	if zone != "Z" {
+		offset := time.Duration(digits(zone, 1))*time.Hour + time.Duration(digits(strings.Replace(zone, ":", "", 1), 3))*time.Minute
+		if zone[0] == '-' {
+			offset = -offset
+		}
+		instant = instant.Add(-offset)
+	}
+
+	hour, min, sec = instant.Clock()
+	utcClock := fmt.Sprintf("%c%02d:%02d", v.clock[0], hour, min)
+	if len(clock) > 5 {
+		utcClock += fmt.Sprintf(":%02d%s", sec, clock[8:])
+	}
+	year, month, day = instant.Date()
+	return dateValue{
+		time:  time.Date(year, month, day, 0, 0, 0, 0, time.UTC),
+		text:  true,
+		clock: utcClock,
+		zone:  zeroDigits(strings.Replace(v.zone, "-", "+", 1)),
+	}
+}
+
+// withDate returns the value with its date replaced, keeping its time of day
+func (v dateValue) withDate(year int, month time.Month, day int) interface{} {
+	if v.text {
+		return fmt.Sprintf("%04d-%02d-%02d%s%s", year, month, day, v.clock, v.zone)
+	}
+	hour, min, sec := v.time.Clock()
+	return time.Date(year, month, day, hour, min, sec, v.time.Nanosecond(), v.time.Location())
+}
+
+// atMidnight returns the value with its date replaced and its time of day set
+// to midnight, in the time zone of the value
+func (v dateValue) atMidnight(year int, month time.Month, day int) interface{} {
+	if v.text {
+		return fmt.Sprintf("%04d-%02d-%02d%s%s", year, month, day, zeroDigits(v.clock), v.zone)
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, v.time.Location())
+}
+
+// zeroDigits returns the text with its digits replaced by zeros
+func zeroDigits(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return '0'
+		}
+		return r
+	}, text)
+}
+
+// DateShiftStrategy shifts dates by a number of days between -Days and Days,
+// never zero, keeping their time of day. The offset is derived from a keyed
+// HMAC of the value of the Key column, so all dates of an entity, such as a
+// customer's birth date, registration and orders, shift by the same offset
+// and the entity's timeline stays coherent. Without a key column, the offset
+// is derived from the date itself.
+type DateShiftStrategy struct {
+	Days   int
+	Key    string
+	secret []byte
+}
+
+// newDateShiftStrategy creates a date_shift strategy from its params and the
+// date_shift_key the offsets are derived from. Dates shift by up to 30 days
+// by default.
+func newDateShiftStrategy(secret []byte, params map[string]interface{}) (*DateShiftStrategy, error) {
+	if err := checkParams("date_shift", dateParams["date_shift"], params); err != nil {
+		return nil, err
+	}
+
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("date_shift strategy requires date_shift_key")
+	}
+
+	strategy := &DateShiftStrategy{Days: 30, secret: secret}
+	if days, ok := params["days"]; ok {
+		value, ok := intParam(days)
+		if !ok || value < 1 {
+			return nil, fmt.Errorf("param days of date_shift strategy must be a positive number of days, got %v", days)
+		}
+		strategy.Days = value
+	}
+
+	if key, ok := params["key"]; ok {
+		value, ok := key.(string)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("param key of date_shift strategy must be a column, got %v", key)
+		}
+		strategy.Key = value
+	}
+	return strategy, nil
+}
+
+// GenerateSQL implements AnonymizationStrategy.GenerateSQL. Shifted dates
+// are computed per row and bound as parameters by GenerateBatchUpdateSQL; as
+// an expression on its own, the strategy keeps the column unchanged.
+func (s *DateShiftStrategy) GenerateSQL(tableName, columnName string) string {
+	return columnName
+}
+
+// GetType implements AnonymizationStrategy.GetType
+func (s *DateShiftStrategy) GetType() string {
+	return "date_shift"
+}
+
+// RowColumns implements RowStrategy.RowColumns
+func (s *DateShiftStrategy) RowColumns() []string {
+	if s.Key == "" {
+		return nil
+	}
+	return []string{s.Key}
+}
+
+// Anonymize implements ValueStrategy.Anonymize for strategies without a key
+// column. NULL values are kept as NULL.
+func (s *DateShiftStrategy) Anonymize(original interface{}) (interface{}, error) {
+	return s.AnonymizeRow(original, nil)
+}
+
+// AnonymizeRow implements RowStrategy.AnonymizeRow. Dates of rows whose key
+// is NULL are shifted as if there were no key column.
+func (s *DateShiftStrategy) AnonymizeRow(original interface{}, row map[string]interface{}) (interface{}, error) {
+	if original == nil {
+		return nil, nil
+	}
+	value, zero, err := parseDate("date_shift", original)
+	if zero || err != nil {
+		return original, err
+	}
+
+	key := fmt.Sprintf("%v", original)
+	if s.Key != "" {
+		keyValue, ok := row[s.Key]
+		if !ok {
+			return nil, fmt.Errorf("key column %s of date_shift strategy was not read", s.Key)
+		}
+		if keyValue != nil {
+			key = fmt.Sprintf("%v", keyValue)
+		}
+	}
+
+	year, month, day := value.time.Date()
+	year, month, day = time.Date(year, month, day, 0, 0, 0, 0, time.UTC).AddDate(0, 0, s.offset(key)).Date()
+	return value.withDate(year, month, day), nil
+}
+
+// offset returns the number of days the dates of a key are shifted by
+func (s *DateShiftStrategy) offset(key string) int {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("date_shift"))
+	mac.Write([]byte{0})
+	mac.Write([]byte(key))
+	digest := mac.Sum(nil)
+
+	offset := int(binary.BigEndian.Uint64(digest)%uint64(s.Days)) + 1
+	if digest[8]&1 == 1 {
+		offset = -offset
+	}
+	return offset
+}
+
+// DateTruncateStrategy truncates dates to the first day of their month or
+// year, at midnight in their time zone
+type DateTruncateStrategy struct {
+	To string
+}
+
+// newDateTruncateStrategy creates a date_truncate strategy from its params
+func newDateTruncateStrategy(params map[string]interface{}) (*DateTruncateStrategy, error) {
+	if err := checkParams("date_truncate", dateParams["date_truncate"], params); err != nil {
+		return nil, err
+	}
+
+	strategy := &DateTruncateStrategy{To: "month"}
+	if to, ok := params["to"]; ok {
+		if to != "month" && to != "year" {
+			return nil, fmt.Errorf("param to of date_truncate strategy must be month or year, got %v", to)
+		}
+		strategy.To = to.(string)
+	}
+	return strategy, nil
+}
+
+// GenerateSQL implements AnonymizationStrategy.GenerateSQL. Truncated dates
+// are computed per row and bound as parameters by GenerateBatchUpdateSQL; as
+// an expression on its own, the strategy keeps the column unchanged.
+func (s *DateTruncateStrategy) GenerateSQL(tableName, columnName string) string {
+	return columnName
+}
+
+// GetType implements AnonymizationStrategy.GetType
+func (s *DateTruncateStrategy) GetType() string {
+	return "date_truncate"
+}
+
+// Anonymize implements ValueStrategy.Anonymize. NULL values are kept as NULL.
+func (s *DateTruncateStrategy) Anonymize(original interface{}) (interface{}, error) {
+	if original == nil {
+		return nil, nil
+	}
+	value, zero, err := parseDate("date_truncate", original)
+	if zero || err != nil {
+		return original, err
+	}
+
+	year, month, _ := value.time.Date()
+	if s.To == "year" {
+		month = time.January
+	}
+	return value.atMidnight(year, month, 1), nil
+}
+
+// AgeBucketStrategy generalizes dates of birth to age ranges of Size years,
+// with the age taken on the Reference date. Ages from Max on, if set, fall
+// into one range. The strategy writes either a date of birth that has the
+// middle age of the range, so that date columns keep dates, or a label of
+// the range such as 30-39 for text columns.
+type AgeBucketStrategy struct {
+	Size      int
+	Max       int
+	Reference time.Time
+	Output    string
+}
+
+// newAgeBucketStrategy creates an age_bucket strategy from its params. The
+// reference date defaults to the current date.
+func newAgeBucketStrategy(params map[string]interface{}) (*AgeBucketStrategy, error) {
+	if err := checkParams("age_bucket", dateParams["age_bucket"], params); err != nil {
+		return nil, err
+	}
+
+	year, month, day := time.Now().UTC().Date()
+	strategy := &AgeBucketStrategy{Size: 10, Reference: time.Date(year, month, day, 0, 0, 0, 0, time.UTC), Output: "date"}
+
+	if size, ok := params["size"]; ok {
+		value, ok := intParam(size)
+		if !ok || value < 1 {
+			return nil, fmt.Errorf("param size of age_bucket strategy must be a positive number of years, got %v", size)
+		}
+		strategy.Size = value
+	}
+
+	if max, ok := params["max"]; ok {
+		value, ok := intParam(max)
+		if !ok || value < strategy.Size || value%strategy.Size != 0 {
+			return nil, fmt.Errorf("param max of age_bucket strategy must be a multiple of size %d, got %v", strategy.Size, max)
+		}
+		strategy.Max = value
+	}
+
+	if reference, ok := params["reference"]; ok {
+		value, ok := reference.(string)
+		date, err := time.Parse("2006-01-02", value)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("param reference of age_bucket strategy must be a date such as 2026-01-01, got %v", reference)
+		}
+		strategy.Reference = date
+	}
+
+	if output, ok := params["output"]; ok {
+		if output != "date" && output != "label" {
+			return nil, fmt.Errorf("param output of age_bucket strategy must be date or label, got %v", output)
+		}
+		strategy.Output = output.(string)
+	}
+
+	return strategy, nil
+}
+
+// GenerateSQL implements AnonymizationStrategy.GenerateSQL. Age ranges are
+// computed per row and bound as parameters by GenerateBatchUpdateSQL; as an
+// expression on its own, the strategy keeps the column unchanged.
+func (s *AgeBucketStrategy) GenerateSQL(tableName, columnName string) string {
+	return columnName
+}
+
+// GetType implements AnonymizationStrategy.GetType
+func (s *AgeBucketStrategy) GetType() string {
+	return "age_bucket"
+}
+
+// Anonymize implements ValueStrategy.Anonymize. NULL values are kept as NULL,
+// and dates after the reference date fall into the first range.
+func (s *AgeBucketStrategy) Anonymize(original interface{}) (interface{}, error) {
+	if original == nil {
+		return nil, nil
+	}
+	value, zero, err := parseDate("age_bucket", original)
+	if zero || err != nil {
+		return original, err
+	}
+
+	year, month, day := value.time.Date()
+	age := s.Reference.Year() - year
+	if s.Reference.Month() < month || (s.Reference.Month() == month && s.Reference.Day() < day) {
+		age--
+	}
+	if age < 0 {
+		age = 0
+	}
+
+	lower := age / s.Size * s.Size
+	open := s.Max > 0 && lower >= s.Max
+	if open {
+		lower = s.Max
+	}
+
+	if s.Output == "label" {
+		switch {
+		case open:
+			return fmt.Sprintf("%d+", lower), nil
+		case s.Size == 1:
+			return strconv.Itoa(lower), nil
+		default:
+			return fmt.Sprintf("%d-%d", lower, lower+s.Size-1), nil
+		}
+	}
+
+	middle := lower + s.Size/2
+	if open {
+		middle = lower
+	}
+	return value.atMidnight(s.Reference.AddDate(-middle, 0, 0).Date()), nil
+}
@@ -0,0 +1,338 @@
+package anonymizer
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+func TestDateShiftStrategy(t *testing.T) {
+	strategy, err := newDateShiftStrategy([]byte("test-seed"), map[string]interface{}{"days": 30})
+	if err != nil {
+		t.Fatalf("Failed to create date_shift strategy: %v", err)
+	}
+
+	// Text keeps its format and time of day, and timestamps with an offset
+	// are shifted in UTC
+	tests := []struct {
+		original string
+		pattern  string
+	}{
+		{"1980-05-17", `^\d{4}-\d{2}-\d{2}$`},
+		{"2024-01-31 12:34:56", `^\d{4}-\d{2}-\d{2} 12:34:56$`},
+		{"2024-01-31 12:34:56.123456", `^\d{4}-\d{2}-\d{2} 12:34:56\.123456$`},
+		{"2024-01-31 12:34:56.5+01", `^\d{4}-\d{2}-\d{2} 11:34:56\.5\+00$`},
+		{"2024-01-31T12:34:56Z", `^\d{4}-\d{2}-\d{2}T12:34:56Z$`},
+	}
+	for _, test := range tests {
+		value, err := strategy.Anonymize(test.original)
+		if err != nil {
+			t.Fatalf("Failed to shift %s: %v", test.original, err)
+		}
+		if !regexp.MustCompile(test.pattern).MatchString(value.(string)) {
+			t.Errorf("Expected %s to shift to a value matching %s, got %s", test.original, test.pattern, value)
+		}
+		original, _ := time.Parse("2006-01-02", test.original[:10])
+		shifted, _ := time.Parse("2006-01-02", value.(string)[:10])
+		if days := shifted.Sub(original).Hours() / 24; days == 0 || days < -30 || days > 30 {
+			t.Errorf("Expected %s to shift by 1 to 30 days, got %v", test.original, days)
+		}
+	}
+
+	// Times keep their time of day and location
+	zone := time.FixedZone("", 2*60*60)
+	original := time.Date(2024, 3, 30, 23, 30, 0, 0, zone)
+	value, err := strategy.Anonymize(original)
+	if err != nil {
+		t.Fatalf("Failed to shift %v: %v", original, err)
+	}
+	shifted := value.(time.Time)
+	if shifted.Location() != zone || shifted.Hour() != 23 || shifted.Minute() != 30 || shifted.Equal(original) {
+		t.Errorf("Expected %v to shift by whole days, got %v", original, shifted)
+	}
+
+	// Rows with the same key shift by the same offset
+	keyed, _ := newDateShiftStrategy([]byte("test-seed"), map[string]interface{}{"days": 365, "key": "customer_id"})
+	born, _ := keyed.AnonymizeRow("1980-05-17", map[string]interface{}{"customer_id": int64(42)})
+	registered, _ := keyed.AnonymizeRow("2020-02-01", map[string]interface{}{"customer_id": "42"})
+	bornDate, _ := time.Parse("2006-01-02", born.(string))
+	registeredDate, _ := time.Parse("2006-01-02", registered.(string))
+	if got := registeredDate.Sub(bornDate); got != time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC).Sub(time.Date(1980, 5, 17, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the dates of a customer to keep their distance, got %s and %s", born, registered)
+	}
+	if _, err := keyed.AnonymizeRow("1980-05-17", nil); err == nil {
+		t.Error("Expected error for a row without its key column, got nil")
+	}
+
+	// NULL and MySQL zero dates stay as they are
+	for _, kept := range []interface{}{nil, "0000-00-00", "0000-00-00 00:00:00"} {
+		if value, err := strategy.Anonymize(kept); value != kept || err != nil {
+			t.Errorf("Expected %v to stay, got %v, %v", kept, value, err)
+		}
+	}
+
+	for _, invalid := range []interface{}{"yesterday", "2024-02-30", int64(20240131)} {
+		if _, err := strategy.Anonymize(invalid); err == nil {
+			t.Errorf("Expected error for %v, got nil", invalid)
+		}
+	}
+}
+
+func TestDateTruncateStrategy(t *testing.T) {
+	zone := time.FixedZone("", -5*60*60)
+	tests := []struct {
+		to       string
+		original interface{}
+		expected interface{}
+	}{
+		{"month", "1980-05-17", "1980-05-01"},
+		{"month", "2024-01-31 12:34:56.123456", "2024-01-01 00:00:00.000000"},
+		{"year", "2024-08-31 12:34:56+02:00", "2024-01-01 00:00:00+00:00"},
+		{"month", "2024-07-01 00:30:00+02", "2024-06-01 00:00:00+00"},
+		{"month", "2024-03-31 20:00:00-05:30", "2024-04-01 00:00:00+00:00"},
+		{"year", time.Date(2024, 8, 31, 22, 0, 0, 0, zone), time.Date(2024, 1, 1, 0, 0, 0, 0, zone)},
+		{"month", nil, nil},
+		{"month", "0000-00-00", "0000-00-00"},
+	}
+	for _, test := range tests {
+		strategy, err := newDateTruncateStrategy(map[string]interface{}{"to": test.to})
+		if err != nil {
+			t.Fatalf("Failed to create date_truncate strategy: %v", err)
+		}
+		value, err := strategy.Anonymize(test.original)
+		if err != nil {
+			t.Fatalf("Failed to truncate %v: %v", test.original, err)
+		}
+		if !sameDate(value, test.expected) {
+			t.Errorf("Expected %v truncated to the %s to be %v, got %v", test.original, test.to, test.expected, value)
+		}
+	}
+
+	for _, params := range []map[string]interface{}{{"to": "week"}, {"to": 1}, {"days": 1}} {
+		if _, err := newDateTruncateStrategy(params); err == nil {
+			t.Errorf("Expected error for params %v, got nil", params)
+		}
+	}
+}
+
+func TestAgeBucketStrategy(t *testing.T) {
+	tests := []struct {
+		params   map[string]interface{}
+		original interface{}
+		expected interface{}
+	}{
+		// Aged 35 on the reference date
+		{map[string]interface{}{"output": "label"}, "1990-06-30", "30-39"},
+		// Aged 34, the birthday is a day after the reference date
+		{map[string]interface{}{"output": "label"}, "1990-07-02", "30-39"},
+		{map[string]interface{}{"output": "label", "size": 5}, "1990-07-02 08:00:00", "30-34"},
+		{map[string]interface{}{"output": "label", "max": 90}, "1920-01-01", "90+"},
+		{map[string]interface{}{"output": "label", "size": 1}, "2025-12-31", "0"},
+		// Dates of birth become the date of the middle age of their range
+		{nil, "1990-06-30", "1990-07-01"},
+		{nil, "1981-12-24 10:11:12", "1980-07-01 00:00:00"},
+		{map[string]interface{}{"max": 90}, time.Date(1920, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(1935, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{nil, nil, nil},
+	}
+	for _, test := range tests {
+		params := map[string]interface{}{"reference": "2025-07-01"}
+		for name, value := range test.params {
+			params[name] = value
+		}
+		strategy, err := newAgeBucketStrategy(params)
+		if err != nil {
+			t.Fatalf("Failed to create age_bucket strategy with %v: %v", params, err)
+		}
+		value, err := strategy.Anonymize(test.original)
+		if err != nil {
+			t.Fatalf("Failed to bucket %v: %v", test.original, err)
+		}
+		if !sameDate(value, test.expected) {
+			t.Errorf("Expected %v with %v to be %v, got %v", test.original, test.params, test.expected, value)
+		}
+	}
+
+	invalid := []map[string]interface{}{
+		{"size": 0},
+		{"max": 85},
+		{"reference": "01.07.2025"},
+		{"output": "years"},
+		{"bucket": 10},
+	}
+	for _, params := range invalid {
+		if _, err := newAgeBucketStrategy(params); err == nil {
+			t.Errorf("Expected error for params %v, got nil", params)
+		}
+	}
+}
+
+// openDateDatabase creates a SQLite database whose customers have dates of
+// birth and registration besides their orders
+func openDateDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db := openTestDatabase(t)
+	statements := []string{
+		`ALTER TABLE customers ADD COLUMN dob DATE`,
+		`ALTER TABLE customers ADD COLUMN created_at DATETIME`,
+		`ALTER TABLE customers ADD COLUMN birth_month TEXT`,
+		`UPDATE customers SET dob = '1980-05-17', created_at = '2018-02-01 10:00:00', birth_month = '1980-05-17' WHERE id = 1`,
+		`UPDATE customers SET dob = '1992-11-03', created_at = '2021-06-15 18:30:00' WHERE id = 2`,
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to set up database: %v", err)
+		}
+	}
+	return db
+}
+
+func TestExecutorSQLiteDateShift(t *testing.T) {
+	db := openDateDatabase(t)
+
+	// The dates of customers and their orders shift by customer
+	plan, err := CreatePlan(&config.Config{
+		Database:     config.DatabaseConfig{Driver: "sqlite"},
+		DateShiftKey: config.KeyConfig{Value: "date-shift-key"},
+		Converters: map[string]config.ConverterConfig{
+			"customer_date": {Type: "date_shift", Params: map[string]interface{}{"days": 180, "key": "id"}},
+			"order_date":    {Type: "date_shift", Params: map[string]interface{}{"days": 180, "key": "customer_id"}},
+		},
+		Tables: map[string]config.TableConfig{
+			"customers": {
+				Columns: map[string]config.ColumnConfig{
+					"dob":         {Converter: "customer_date"},
+					"created_at":  {Converter: "customer_date"},
+					"birth_month": {Type: "date_truncate"},
+				},
+			},
+			"orders": {
+				Columns: map[string]config.ColumnConfig{
+					"created_at": {Converter: "order_date"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+	executor := NewExecutor(db, plan, log, false, 2, false, nil)
+	defer executor.Close()
+	if _, err := executor.Execute(context.Background()); err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+
+	// The timeline of each customer keeps its distances
+	query := `SELECT (julianday(o.created_at) - julianday(c.created_at)) || ' ' || (julianday(c.created_at) - julianday(c.dob)) FROM orders o JOIN customers c ON c.id = o.customer_id ORDER BY o.id`
+	if got, want := queryStrings(t, db, query), queryStrings(t, openDateDatabase(t), query); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the timelines of customers to keep their distances, got %v, want %v", got, want)
+	}
+	for _, dob := range queryStrings(t, db, "SELECT date(dob) FROM customers") {
+		if dob.String == "1980-05-17" || dob.String == "1992-11-03" {
+			t.Errorf("Expected dates of birth to shift, got %s", dob.String)
+		}
+	}
+
+	// Dates held as text keep their format
+	months := queryStrings(t, db, "SELECT birth_month FROM customers ORDER BY id")
+	if months[0].String != "1980-05-01" || months[1].Valid {
+		t.Errorf("Expected birth months 1980-05-01 and NULL, got %v", months)
+	}
+	for _, created := range queryStrings(t, db, "SELECT created_at FROM orders") {
+		if !regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`).MatchString(created.String) {
+			t.Errorf("Expected order dates to keep their format, got %s", created.String)
+		}
+	}
+}
+
+func TestCreatePlanDateErrors(t *testing.T) {
+	keyed := map[string]interface{}{"days": 30, "key": "customer_id"}
+	invalid := []map[string]config.ColumnConfig{
+		// The key column keeps its original values
+		{"created_at": {Converter: "order_date"}, "customer_id": {Type: "faker.numerify"}},
+		{"created_at": {Converter: "order_date"}, "customer_id": {Null: true}},
+		// Consistency groups map dates without their key
+		{"created_at": {Converter: "order_date", ConsistencyGroup: "dates"}},
+	}
+	for _, columns := range invalid {
+		cfg := &config.Config{
+			Database:     config.DatabaseConfig{Driver: "sqlite"},
+			DateShiftKey: config.KeyConfig{Value: "date-shift-key"},
+			Converters:   map[string]config.ConverterConfig{"order_date": {Type: "date_shift", Params: keyed}},
+			Tables:       map[string]config.TableConfig{"orders": {Columns: columns}},
+		}
+		if _, err := CreatePlan(cfg); err == nil {
+			t.Errorf("Expected error for columns %v, got nil", columns)
+		}
+	}
+
+	// The offsets are derived from a date_shift_key, not from the seed
+	cfg := &config.Config{
+		Database:   config.DatabaseConfig{Driver: "sqlite"},
+		Seed:       "test-seed",
+		Converters: map[string]config.ConverterConfig{"order_date": {Type: "date_shift", Params: keyed}},
+		Tables:     map[string]config.TableConfig{"orders": {Columns: map[string]config.ColumnConfig{"created_at": {Converter: "order_date"}}}},
+	}
+	if _, err := CreatePlan(cfg); err == nil {
+		t.Error("Expected error for date_shift without date_shift_key, got nil")
+	}
+
+	invalidParams := []map[string]interface{}{
+		{"days": 0},
+		{"days": "30"},
+		{"days": 30, "key": ""},
+		{"days": 30, "seed": "x"},
+	}
+	for _, params := range invalidParams {
+		if _, err := newDateShiftStrategy([]byte("test-seed"), params); err == nil {
+			t.Errorf("Expected error for params %v, got nil", params)
+		}
+	}
+}
+
+func TestDumpAnonymizerDateShift(t *testing.T) {
+	// Customer 1 has rows in both the COPY block and the INSERT statement
+	dump := "COPY public.orders (id, created_at, customer_id) FROM stdin;\n" +
+		"10\t2024-03-01 09:00:00+01\t1\n" +
+		"11\t2024-03-05 09:00:00+01\t2\n" +
+		"\\.\n" +
+		"INSERT INTO public.orders (customer_id, id, created_at) VALUES (1, 12, '2024-03-11 09:00:00+01');\n"
+
+	cfg := &config.Config{
+		Database:     config.DatabaseConfig{Driver: "postgres"},
+		DateShiftKey: config.KeyConfig{Value: "date-shift-key"},
+		Converters: map[string]config.ConverterConfig{
+			"order_date": {Type: "date_shift", Params: map[string]interface{}{"days": 90, "key": "customer_id"}},
+		},
+		Tables: map[string]config.TableConfig{
+			"orders": {
+				Columns: map[string]config.ColumnConfig{
+					"created_at": {Converter: "order_date"},
+				},
+			},
+		},
+	}
+
+	out, _ := anonymizeTestDump(t, cfg, dump)
+	dates := regexp.MustCompile(`(\d{4}-\d{2}-\d{2}) 08:00:00\+00`).FindAllStringSubmatch(out, -1)
+	if len(dates) != 3 {
+		t.Fatalf("Expected 3 shifted dates, got %q", out)
+	}
+	first, _ := time.Parse("2006-01-02", dates[0][1])
+	third, _ := time.Parse("2006-01-02", dates[2][1])
+	if days := third.Sub(first).Hours() / 24; days != 10 || dates[0][1] == "2024-03-01" {
+		t.Errorf("Expected the orders of customer 1 to shift alike, got %q", out)
+	}
+}
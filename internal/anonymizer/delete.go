@@ -0,0 +1,154 @@
+package anonymizer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"db-gdpr-anonymizer/internal/database"
+)
+
+// DeleteStep is a single DELETE statement of a row deletion. The rows of a
+// dependent table are selected through the foreign key that references the
+// rows deleted from its parent. SelfReferences are the foreign keys of the
+// table that reference the table itself: before the rows are deleted, these
+// keys are set to NULL in every row that references one of them, so rows
+// referencing each other can be deleted together.
+type DeleteStep struct {
+	Table          string
+	Parent         string
+	Condition      string
+	SelfReferences []database.ForeignKey
+}
+
+// planDeletion orders the deletion of the rows of a delete table and of all
+// rows that depend on them through foreign keys, children first so that no
+// statement violates a constraint. Self references are unlinked by their
+// step instead of being followed, and reference cycles are not followed.
+func (g *SQLGenerator) planDeletion(tablePlan *TablePlan, foreignKeys []database.ForeignKey) []DeleteStep {
+	// Index the foreign keys by referenced table, in a stable order
+	children := make(map[string][]database.ForeignKey)
+	for _, foreignKey := range foreignKeys {
+		children[foreignKey.ReferencedTable] = append(children[foreignKey.ReferencedTable], foreignKey)
+	}
+	for _, references := range children {
+		sort.Slice(references, func(i, j int) bool {
+			if references[i].Table != references[j].Table {
+				return references[i].Table < references[j].Table
+			}
+			return references[i].Name < references[j].Name
+		})
+	}
+
+	var steps []DeleteStep
+	path := make(map[string]bool)
+
+	var visit func(step DeleteStep)
+	visit = func(step DeleteStep) {
+		table := g.foreignKeyTable(step.Table, foreignKeys)
+		path[table] = true
+		for _, foreignKey := range children[table] {
+			if foreignKey.Table == table {
+				step.SelfReferences = append(step.SelfReferences, foreignKey)
+				continue
+			}
+			if path[foreignKey.Table] {
+				continue
+			}
+			visit(DeleteStep{
+				Table:     foreignKey.Table,
+				Parent:    step.Table,
+				Condition: g.referenceCondition(foreignKey, step.Condition),
+			})
+		}
+		path[table] = false
+		steps = append(steps, step)
+	}
+
+	visit(DeleteStep{Table: tablePlan.Name, Condition: tablePlan.Where})
+
+	return steps
+}
+
+// foreignKeyTable returns the name foreign keys use for a table. SQL Server
+// foreign keys name the tables of the default schema without their schema,
+// so a schema-qualified name that no foreign key uses falls back to the bare
+// table name.
+func (g *SQLGenerator) foreignKeyTable(name string, foreignKeys []database.ForeignKey) string {
+	separator := strings.LastIndex(name, ".")
+	if g.dialect.Driver() != database.SQLServer || separator < 0 {
+		return name
+	}
+
+	bare := name[separator+1:]
+	for _, foreignKey := range foreignKeys {
+		if foreignKey.Table == name || foreignKey.ReferencedTable == name {
+			return name
+		}
+	}
+	for _, foreignKey := range foreignKeys {
+		if foreignKey.Table == bare || foreignKey.ReferencedTable == bare {
+			return bare
+		}
+	}
+	return name
+}
+
+// selfReferenceCondition renders the condition selecting the rows whose self
+// referencing foreign key references a row matching condition. The rows are
+// read through a derived table, since MySQL does not allow a subquery to
+// select from the table an UPDATE modifies.
+func (g *SQLGenerator) selfReferenceCondition(foreignKey database.ForeignKey, condition string) string {
+	if len(foreignKey.Columns) == 1 || g.dialect.SupportsRowValues() {
+		referencedColumns := strings.Join(g.quoteAll(foreignKey.ReferencedColumns), ", ")
+		return fmt.Sprintf(
+			"%s IN (SELECT %s FROM (SELECT %s FROM %s WHERE %s) %s)",
+			g.keyTuple(foreignKey.Columns),
+			referencedColumns,
+			referencedColumns,
+			g.quote(foreignKey.Table),
+			condition,
+			g.quote("referenced"),
+		)
+	}
+
+	conditions := make([]string, 0, len(foreignKey.Columns)+1)
+	for i, column := range foreignKey.Columns {
+		conditions = append(conditions, fmt.Sprintf(
+			"%s.%s = %s.%s",
+			g.quote("referenced"), g.quote(foreignKey.ReferencedColumns[i]),
+			g.quote(foreignKey.Table), g.quote(column),
+		))
+	}
+	conditions = append(conditions, fmt.Sprintf("(%s)", condition))
+
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s %s WHERE %s)", g.quote(foreignKey.Table), g.quote("referenced"), strings.Join(conditions, " AND "))
+}
+
+// referenceCondition renders the condition selecting the rows whose foreign
+// key references a parent row matching parentCondition. Composite keys on
+// databases without row values correlate the parent rows with EXISTS; the
+// tables on a deletion path are distinct, so their names qualify the columns.
+func (g *SQLGenerator) referenceCondition(foreignKey database.ForeignKey, parentCondition string) string {
+	if len(foreignKey.Columns) == 1 || g.dialect.SupportsRowValues() {
+		return fmt.Sprintf(
+			"%s IN (SELECT %s FROM %s WHERE %s)",
+			g.keyTuple(foreignKey.Columns),
+			strings.Join(g.quoteAll(foreignKey.ReferencedColumns), ", "),
+			g.quote(foreignKey.ReferencedTable),
+			parentCondition,
+		)
+	}
+
+	conditions := make([]string, 0, len(foreignKey.Columns)+1)
+	for i, column := range foreignKey.Columns {
+		conditions = append(conditions, fmt.Sprintf(
+			"%s.%s = %s.%s",
+			g.quote(foreignKey.ReferencedTable), g.quote(foreignKey.ReferencedColumns[i]),
+			g.quote(foreignKey.Table), g.quote(column),
+		))
+	}
+	conditions = append(conditions, fmt.Sprintf("(%s)", parentCondition))
+
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s)", g.quote(foreignKey.ReferencedTable), strings.Join(conditions, " AND "))
+}
@@ -0,0 +1,148 @@
+package anonymizer
+
+import (
+	"reflect"
+	"testing"
+
+	"db-gdpr-anonymizer/internal/database"
+)
+
+func TestPlanDeletion(t *testing.T) {
+	tablePlan := &TablePlan{
+		Name:   "sales_order",
+		Action: ActionDelete,
+		Where:  "created_at < '2023-01-01'",
+	}
+	foreignKeys := []database.ForeignKey{
+		{Name: "fk_item_order", Table: "sales_order_item", Columns: []string{"order_id"}, ReferencedTable: "sales_order", ReferencedColumns: []string{"entity_id"}},
+		{Name: "fk_item_parent", Table: "sales_order_item", Columns: []string{"parent_item_id"}, ReferencedTable: "sales_order_item", ReferencedColumns: []string{"item_id"}},
+		{Name: "fk_address_order", Table: "sales_order_address", Columns: []string{"parent_id"}, ReferencedTable: "sales_order", ReferencedColumns: []string{"entity_id"}},
+		{Name: "fk_tax_item", Table: "sales_order_tax_item", Columns: []string{"item_id", "store_id"}, ReferencedTable: "sales_order_item", ReferencedColumns: []string{"item_id", "store_id"}},
+		{Name: "fk_order_store", Table: "sales_order", Columns: []string{"store_id"}, ReferencedTable: "store", ReferencedColumns: []string{"store_id"}},
+	}
+
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.MySQLDialect{})
+	steps := generator.planDeletion(tablePlan, foreignKeys)
+
+	expected := []DeleteStep{
+		{
+			Table:     "sales_order_address",
+			Parent:    "sales_order",
+			Condition: "`parent_id` IN (SELECT `entity_id` FROM `sales_order` WHERE created_at < '2023-01-01')",
+		},
+		{
+			Table:     "sales_order_tax_item",
+			Parent:    "sales_order_item",
+			Condition: "(`item_id`, `store_id`) IN (SELECT `item_id`, `store_id` FROM `sales_order_item` WHERE `order_id` IN (SELECT `entity_id` FROM `sales_order` WHERE created_at < '2023-01-01'))",
+		},
+		{
+			Table:          "sales_order_item",
+			Parent:         "sales_order",
+			Condition:      "`order_id` IN (SELECT `entity_id` FROM `sales_order` WHERE created_at < '2023-01-01')",
+			SelfReferences: foreignKeys[1:2],
+		},
+		{
+			Table:     "sales_order",
+			Condition: "created_at < '2023-01-01'",
+		},
+	}
+
+	if len(steps) != len(expected) {
+		t.Fatalf("Expected %d steps, got %d: %v", len(expected), len(steps), steps)
+	}
+	for i, step := range steps {
+		if !reflect.DeepEqual(step, expected[i]) {
+			t.Errorf("Expected step %d to be %+v, got %+v", i, expected[i], step)
+		}
+	}
+
+	// Items referencing deleted items are unlinked before the deletion
+	expectedSQL := "UPDATE `sales_order_item` SET `parent_item_id` = NULL WHERE `parent_item_id` IN " +
+		"(SELECT `item_id` FROM (SELECT `item_id` FROM `sales_order_item` WHERE `order_id` IN " +
+		"(SELECT `entity_id` FROM `sales_order` WHERE created_at < '2023-01-01')) `referenced`)"
+	if sql := generator.GenerateUnlinkSQL(steps[2], steps[2].SelfReferences[0]); sql != expectedSQL {
+		t.Errorf("Expected SQL '%s', got '%s'", expectedSQL, sql)
+	}
+}
+
+func TestPlanDeletionCycle(t *testing.T) {
+	tablePlan := &TablePlan{
+		Name:   "a",
+		Action: ActionDelete,
+		Where:  "id = 1",
+	}
+	foreignKeys := []database.ForeignKey{
+		{Name: "fk_b_a", Table: "b", Columns: []string{"a_id"}, ReferencedTable: "a", ReferencedColumns: []string{"id"}},
+		{Name: "fk_a_b", Table: "a", Columns: []string{"b_id"}, ReferencedTable: "b", ReferencedColumns: []string{"id"}},
+	}
+
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.MySQLDialect{})
+	steps := generator.planDeletion(tablePlan, foreignKeys)
+
+	if len(steps) != 2 || steps[0].Table != "b" || steps[1].Table != "a" {
+		t.Errorf("Expected steps for b and a, got %v", steps)
+	}
+}
+
+func TestPlanDeletionSQLServer(t *testing.T) {
+	tablePlan := &TablePlan{
+		Name:   "OINV",
+		Action: ActionDelete,
+		Where:  "DocDate < '2020-01-01'",
+	}
+	foreignKeys := []database.ForeignKey{
+		{Name: "FK_INV1_OINV", Table: "INV1", Columns: []string{"DocEntry"}, ReferencedTable: "OINV", ReferencedColumns: []string{"DocEntry"}},
+		{Name: "FK_INV2_INV1", Table: "INV2", Columns: []string{"DocEntry", "LineNum"}, ReferencedTable: "INV1", ReferencedColumns: []string{"DocEntry", "LineNum"}},
+	}
+
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.SQLServerDialect{})
+	steps := generator.planDeletion(tablePlan, foreignKeys)
+
+	expected := []DeleteStep{
+		{
+			Table:  "INV2",
+			Parent: "INV1",
+			Condition: "EXISTS (SELECT 1 FROM [INV1] WHERE [INV1].[DocEntry] = [INV2].[DocEntry] AND [INV1].[LineNum] = [INV2].[LineNum] " +
+				"AND ([DocEntry] IN (SELECT [DocEntry] FROM [OINV] WHERE DocDate < '2020-01-01')))",
+		},
+		{
+			Table:     "INV1",
+			Parent:    "OINV",
+			Condition: "[DocEntry] IN (SELECT [DocEntry] FROM [OINV] WHERE DocDate < '2020-01-01')",
+		},
+		{
+			Table:     "OINV",
+			Condition: "DocDate < '2020-01-01'",
+		},
+	}
+
+	if len(steps) != len(expected) {
+		t.Fatalf("Expected %d steps, got %d: %v", len(expected), len(steps), steps)
+	}
+	for i, step := range steps {
+		if !reflect.DeepEqual(step, expected[i]) {
+			t.Errorf("Expected step %d to be %+v, got %+v", i, expected[i], step)
+		}
+	}
+	if sql := generator.GenerateDeleteSQL(steps[2]); sql != "DELETE FROM [OINV] WHERE DocDate < '2020-01-01'" {
+		t.Errorf("Unexpected delete SQL '%s'", sql)
+	}
+
+	// A schema-qualified name finds the foreign keys of its table in the
+	// default schema, and tables of other schemas keep their schema
+	tablePlan.Name = "dbo.OINV"
+	foreignKeys = append(foreignKeys, database.ForeignKey{Name: "FK_AUDIT_OINV", Table: "audit.OINV_LOG", Columns: []string{"DocEntry"}, ReferencedTable: "OINV", ReferencedColumns: []string{"DocEntry"}})
+	steps = generator.planDeletion(tablePlan, foreignKeys)
+	if len(steps) != 4 || steps[2].Table != "audit.OINV_LOG" || steps[3].Table != "dbo.OINV" {
+		t.Errorf("Expected steps for INV2, INV1, audit.OINV_LOG and dbo.OINV, got %v", steps)
+	}
+
+	// Composite self references are matched with EXISTS
+	selfReference := database.ForeignKey{Name: "FK_INV1_BASE", Table: "INV1", Columns: []string{"BaseEntry", "BaseLine"}, ReferencedTable: "INV1", ReferencedColumns: []string{"DocEntry", "LineNum"}}
+	expectedSQL := "UPDATE [INV1] SET [BaseEntry] = NULL, [BaseLine] = NULL WHERE EXISTS (SELECT 1 FROM [INV1] [referenced] " +
+		"WHERE [referenced].[DocEntry] = [INV1].[BaseEntry] AND [referenced].[LineNum] = [INV1].[BaseLine] " +
+		"AND ([DocEntry] IN (SELECT [DocEntry] FROM [OINV] WHERE DocDate < '2020-01-01')))"
+	if sql := generator.GenerateUnlinkSQL(steps[1], selfReference); sql != expectedSQL {
+		t.Errorf("Expected SQL '%s', got '%s'", expectedSQL, sql)
+	}
+}
@@ -0,0 +1,958 @@
+package anonymizer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-gdpr-anonymizer/internal/database"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+// dumpBufferSize is the size of the read and write buffers of a dump
+const dumpBufferSize = 1 << 20
+
+var (
+	// createTablePattern matches the start of a CREATE TABLE statement up to the table name
+	createTablePattern = regexp.MustCompile(`(?i)^\s*CREATE\s+(?:(?:GLOBAL|LOCAL)\s+)?(?:(?:TEMPORARY|TEMP|UNLOGGED)\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?`)
+	// insertPattern matches the start of an INSERT or REPLACE statement up to the table name
+	insertPattern = regexp.MustCompile(`(?is)^\s*(?:INSERT|REPLACE)\b.*?\bINTO\s+`)
+	// copyPattern matches the start of a COPY statement up to the table name
+	copyPattern = regexp.MustCompile(`(?i)^\s*COPY\s+`)
+	// copyFromStdinPattern matches the source of a COPY block embedded in a dump
+	copyFromStdinPattern = regexp.MustCompile(`(?i)^FROM\s+stdin\b`)
+
+	// tableConstraintKeywords start the definitions of a CREATE TABLE
+	// statement that are not columns
+	tableConstraintKeywords = map[string]bool{
+		"CHECK":      true,
+		"CONSTRAINT": true,
+		"EXCLUDE":    true,
+		"FOREIGN":    true,
+		"FULLTEXT":   true,
+		"INDEX":      true,
+		"KEY":        true,
+		"LIKE":       true,
+		"PRIMARY":    true,
+		"SPATIAL":    true,
+		"UNIQUE":     true,
+	}
+
+	// mysqlStringEscaper escapes string literals the way mysqldump does
+	mysqlStringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`)
+	// copyFieldEscaper escapes the fields of a COPY block in text format
+	copyFieldEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+)
+
+// DumpAnonymizer anonymizes the data of a SQL dump file, as written by
+// mysqldump or pg_dump, without a database connection. The dump is streamed:
+// INSERT statements are rewritten one row at a time and COPY blocks one line
+// at a time, so the file is never held in memory as a whole. The columns of
+// a row are identified by the column list of its statement or else by the
+// CREATE TABLE statement of its table.
+type DumpAnonymizer struct {
+	plan     *AnonymizationPlan
+	logger   *logger.Logger
+	mappings *MappingStore
+
+	// backslashEscapes is set for MySQL dumps, whose string literals escape
+	// special characters with backslashes
+	backslashEscapes bool
+
+	tables  map[string]*TablePlan
+	columns map[string][]string
+	stats   map[string]*dumpStats
+
+	// createTable collects the lines of the CREATE TABLE statement being read
+	createTable strings.Builder
+}
+
+// dumpStats holds the rows of a table found in a dump
+type dumpStats struct {
+	rows     int64
+	duration time.Duration
+}
+
+// NewDumpAnonymizer creates a dump anonymizer for a plan. Everything that
+// needs the database to evaluate SQL, such as where conditions, deletions and
+// SQL expressions, is rejected.
+func NewDumpAnonymizer(plan *AnonymizationPlan, logger *logger.Logger) (*DumpAnonymizer, error) {
+	tables := make(map[string]*TablePlan, len(plan.Tables))
+	for _, tablePlan := range plan.Tables {
+		if tablePlan.Action == ActionDelete {
+			return nil, fmt.Errorf("table %s: delete is not supported for dump files", tablePlan.Name)
+		}
+		if tablePlan.Where != "" || tablePlan.Limit > 0 {
+			return nil, fmt.Errorf("table %s: where and limit are not supported for dump files", tablePlan.Name)
+		}
+		for _, column := range tablePlan.Columns {
+			switch column.Strategy.(type) {
+			case *ShuffleStrategy:
+				return nil, fmt.Errorf("column %s.%s: shuffle strategy is not supported for dump files", tablePlan.Name, column.Name)
+			case ValueStrategy, *FixedValueStrategy, *NullStrategy:
+			default:
+				return nil, fmt.Errorf("column %s.%s: %s strategy is not supported for dump files", tablePlan.Name, column.Name, column.Strategy.GetType())
+			}
+		}
+		tables[tablePlan.Name] = tablePlan
+	}
+
+	mappings, err := NewMappingStore(defaultMappingMemoryEntries, os.TempDir())
+	if err != nil {
+		return nil, err
+	}
+
+	return &DumpAnonymizer{
+		plan:             plan,
+		logger:           logger,
+		mappings:         mappings,
+		backslashEscapes: plan.Dialect.Driver() == database.MySQL,
+		tables:           tables,
+		columns:          make(map[string][]string),
+		stats:            make(map[string]*dumpStats),
+	}, nil
+}
+
+// Anonymize reads a dump from in and writes it to out with the data of the
+// planned tables anonymized. Everything else is copied unchanged.
+func (d *DumpAnonymizer) Anonymize(ctx context.Context, in io.Reader, out io.Writer) ([]ExecutionResult, error) {
+	reader := bufio.NewReaderSize(in, dumpBufferSize)
+	writer := bufio.NewWriterSize(out, dumpBufferSize)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		start, err := reader.Peek(len("REPLACE "))
+		if len(start) == 0 {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		switch {
+		case hasPrefixFold(start, "INSERT ") || hasPrefixFold(start, "REPLACE "):
+			err = d.rewriteInsert(reader, writer)
+		case hasPrefixFold(start, "COPY "):
+			err = d.rewriteCopy(reader, writer)
+		default:
+			err = d.copyLine(reader, writer)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	return d.results(), nil
+}
+
+// ConsistencyGroups returns the consistency groups of the plan with the
+// number of distinct values mapped in each
+func (d *DumpAnonymizer) ConsistencyGroups() []ConsistencyGroupResult {
+	return consistencyGroups(d.plan, d.mappings)
+}
+
+// Close releases resources held by the dump anonymizer
+func (d *DumpAnonymizer) Close() error {
+	return d.mappings.Close()
+}
+
+// copyLine copies a line that holds no data, learning the columns of tables
+// from CREATE TABLE statements on the way
+func (d *DumpAnonymizer) copyLine(reader *bufio.Reader, writer *bufio.Writer) error {
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if _, err := writer.WriteString(line); err != nil {
+		return err
+	}
+
+	if d.createTable.Len() == 0 && !createTablePattern.MatchString(line) {
+		return nil
+	}
+	d.createTable.WriteString(line)
+	if !strings.HasSuffix(strings.TrimSpace(line), ";") {
+		return nil
+	}
+
+	statement := d.createTable.String()
+	d.createTable.Reset()
+	if name, columns := d.parseCreateTable(statement); name != "" {
+		d.columns[name] = columns
+	}
+	return nil
+}
+
+// parseCreateTable returns the table name and column names of a CREATE TABLE
+// statement, or an empty name for statements without column definitions
+func (d *DumpAnonymizer) parseCreateTable(statement string) (string, []string) {
+	loc := createTablePattern.FindStringIndex(statement)
+	name, _, rest := readIdentifier(statement[loc[1]:])
+	rest = strings.TrimSpace(rest)
+	if name == "" || !strings.HasPrefix(rest, "(") {
+		return "", nil
+	}
+
+	body, _ := d.enclosed(rest)
+	var columns []string
+	for _, definition := range d.splitList(body) {
+		column, quoted, _ := readIdentifier(definition)
+		if column == "" || (!quoted && tableConstraintKeywords[strings.ToUpper(column)]) {
+			continue
+		}
+		columns = append(columns, column)
+	}
+	return name, columns
+}
+
+// rewriteInsert rewrites an INSERT statement. Rows of truncated tables are
+// dropped together with their statement.
+func (d *DumpAnonymizer) rewriteInsert(reader *bufio.Reader, writer *bufio.Writer) error {
+	header, hasValues, err := d.readInsertHeader(reader)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	var columns []string
+	if loc := insertPattern.FindStringIndex(header); loc != nil && hasValues {
+		var rest string
+		name, _, rest = readIdentifier(header[loc[1]:])
+		if rest = strings.TrimSpace(rest); strings.HasPrefix(rest, "(") {
+			list, _ := d.enclosed(rest)
+			for _, column := range d.splitList(list) {
+				column, _, _ = readIdentifier(column)
+				columns = append(columns, column)
+			}
+		}
+	}
+
+	tablePlan := d.lookupTable(name)
+	if tablePlan == nil {
+		if _, err := writer.WriteString(header); err != nil {
+			return err
+		}
+		if !hasValues {
+			return nil
+		}
+		return d.rewriteRows(reader, writer, nil)
+	}
+
+	startTime := time.Now()
+	stats := d.tableStats(tablePlan)
+	defer func() {
+		stats.duration += time.Since(startTime)
+	}()
+
+	if tablePlan.Action == ActionTruncate {
+		err := d.rewriteRows(reader, bufio.NewWriter(io.Discard), func(values []string) error {
+			stats.rows++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Drop the line break that ended the statement as well
+		if next, _ := reader.Peek(1); len(next) > 0 && next[0] == '\n' {
+			_, err = reader.ReadByte()
+		}
+		return err
+	}
+
+	indexes, columnCount, err := d.columnIndexes(tablePlan, name, columns)
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.WriteString(header); err != nil {
+		return err
+	}
+	rowColumns := tablePlan.rowColumns()
+	return d.rewriteRows(reader, writer, func(values []string) error {
+		stats.rows++
+		if len(values) != columnCount {
+			return fmt.Errorf("row %d of table %s has %d values, expected %d", stats.rows, tablePlan.Name, len(values), columnCount)
+		}
+		row := rowColumnValues(rowColumns, indexes[len(tablePlan.Columns):], func(index int) interface{} {
+			return d.decodeLiteral(values[index])
+		})
+		for i, column := range tablePlan.Columns {
+			raw := values[indexes[i]]
+			value, err := d.replacement(column, d.decodeLiteral(raw), row)
+			if err != nil {
+				return fmt.Errorf("failed to anonymize %s.%s: %w", tablePlan.Name, column.Name, err)
+			}
+			values[indexes[i]] = replaceTrimmed(raw, d.literal(value))
+		}
+		return nil
+	})
+}
+
+// readInsertHeader reads an INSERT statement up to and including the VALUES
+// keyword. Statements without VALUES are read up to their end and reported
+// with hasValues unset.
+func (d *DumpAnonymizer) readInsertHeader(reader *bufio.Reader) (string, bool, error) {
+	var header strings.Builder
+	for {
+		c, err := reader.ReadByte()
+		if err == io.EOF {
+			return header.String(), false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		header.WriteByte(c)
+
+		switch c {
+		case '\'', '"', '`':
+			if err := d.readQuoted(reader, &header, c, c == '\'' && d.backslashEscapes); err != nil {
+				return "", false, err
+			}
+		case ';':
+			return header.String(), false, nil
+		default:
+			if endsWithKeyword(header.String(), "VALUES") {
+				next, _ := reader.Peek(1)
+				if len(next) == 0 || next[0] == '(' || isSpace(next[0]) {
+					return header.String(), true, nil
+				}
+			}
+		}
+	}
+}
+
+// rewriteRows streams the rows following VALUES up to the end of the
+// statement. Each row is passed to rewrite as the raw SQL text of its values,
+// which rewrite may replace; a nil rewrite copies the rows unchanged.
+func (d *DumpAnonymizer) rewriteRows(reader *bufio.Reader, writer *bufio.Writer, rewrite func(values []string) error) error {
+	for {
+		c, err := reader.ReadByte()
+		if err == io.EOF {
+			return fmt.Errorf("unexpected end of dump in INSERT statement")
+		}
+		if err != nil {
+			return err
+		}
+
+		switch c {
+		case '(':
+			values, err := d.readRow(reader)
+			if err != nil {
+				return err
+			}
+			if rewrite != nil {
+				if err := rewrite(values); err != nil {
+					return err
+				}
+			}
+			writer.WriteByte('(')
+			writer.WriteString(strings.Join(values, ","))
+			if err := writer.WriteByte(')'); err != nil {
+				return err
+			}
+		case ';':
+			return writer.WriteByte(c)
+		default:
+			// The separators between rows
+			if err := writer.WriteByte(c); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readRow reads the values of a row up to its closing parenthesis. Each value
+// is returned as its raw SQL text, including surrounding whitespace.
+func (d *DumpAnonymizer) readRow(reader *bufio.Reader) ([]string, error) {
+	var values []string
+	var value strings.Builder
+	depth := 0
+	for {
+		c, err := reader.ReadByte()
+		if err == io.EOF {
+			return nil, fmt.Errorf("unexpected end of dump in INSERT statement")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch c {
+		case '\'':
+			escapes := d.backslashEscapes || isEscapeStringPrefix(value.String())
+			value.WriteByte(c)
+			if err := d.readQuoted(reader, &value, c, escapes); err != nil {
+				return nil, err
+			}
+			continue
+		case '"', '`':
+			value.WriteByte(c)
+			if err := d.readQuoted(reader, &value, c, false); err != nil {
+				return nil, err
+			}
+			continue
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return append(values, value.String()), nil
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				values = append(values, value.String())
+				value.Reset()
+				continue
+			}
+		}
+		value.WriteByte(c)
+	}
+}
+
+// readQuoted copies a quoted string or identifier whose opening quote has
+// been read, up to and including its closing quote. Doubled quotes are part
+// of the text; with escapes, so is every character after a backslash.
+func (d *DumpAnonymizer) readQuoted(reader *bufio.Reader, text *strings.Builder, quote byte, escapes bool) error {
+	for {
+		c, err := reader.ReadByte()
+		if err == io.EOF {
+			return fmt.Errorf("unexpected end of dump in quoted text")
+		}
+		if err != nil {
+			return err
+		}
+		text.WriteByte(c)
+
+		if escapes && c == '\\' {
+			next, err := reader.ReadByte()
+			if err != nil {
+				return fmt.Errorf("unexpected end of dump in quoted text")
+			}
+			text.WriteByte(next)
+			continue
+		}
+		if c == quote {
+			if next, _ := reader.Peek(1); len(next) > 0 && next[0] == quote {
+				reader.ReadByte()
+				text.WriteByte(quote)
+				continue
+			}
+			return nil
+		}
+	}
+}
+
+// rewriteCopy rewrites a COPY ... FROM stdin block of a PostgreSQL dump, one
+// tab separated line per row up to the terminating \. line
+func (d *DumpAnonymizer) rewriteCopy(reader *bufio.Reader, writer *bufio.Writer) error {
+	header, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if _, err := writer.WriteString(header); err != nil {
+		return err
+	}
+
+	loc := copyPattern.FindStringIndex(header)
+	name, _, rest := readIdentifier(header[loc[1]:])
+	var columns []string
+	if rest = strings.TrimSpace(rest); strings.HasPrefix(rest, "(") {
+		var list string
+		list, rest = d.enclosed(rest)
+		for _, column := range d.splitList(list) {
+			column, _, _ = readIdentifier(column)
+			columns = append(columns, column)
+		}
+	}
+	if !copyFromStdinPattern.MatchString(strings.TrimSpace(rest)) {
+		// COPY to or from a file carries no data in the dump
+		return nil
+	}
+
+	tablePlan := d.lookupTable(name)
+	var stats *dumpStats
+	var indexes []int
+	var columnCount int
+	var rowColumns []string
+	if tablePlan != nil {
+		stats = d.tableStats(tablePlan)
+		if tablePlan.Action != ActionTruncate {
+			indexes, columnCount, err = d.columnIndexes(tablePlan, name, columns)
+			if err != nil {
+				return err
+			}
+			rowColumns = tablePlan.rowColumns()
+		}
+	}
+
+	startTime := time.Now()
+	defer func() {
+		if stats != nil {
+			stats.duration += time.Since(startTime)
+		}
+	}()
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line == "" {
+			return fmt.Errorf("unexpected end of dump in COPY block of table %s", name)
+		}
+
+		content := strings.TrimSuffix(line, "\n")
+		if strings.TrimSuffix(content, "\r") == `\.` || tablePlan == nil {
+			if _, err := writer.WriteString(line); err != nil {
+				return err
+			}
+			if strings.TrimSuffix(content, "\r") == `\.` {
+				return nil
+			}
+			continue
+		}
+
+		stats.rows++
+		if tablePlan.Action == ActionTruncate {
+			continue
+		}
+
+		fields := strings.Split(content, "\t")
+		if len(fields) != columnCount {
+			return fmt.Errorf("row %d of table %s has %d values, expected %d", stats.rows, tablePlan.Name, len(fields), columnCount)
+		}
+		row := rowColumnValues(rowColumns, indexes[len(tablePlan.Columns):], func(index int) interface{} {
+			return decodeCopyField(fields[index])
+		})
+		for i, column := range tablePlan.Columns {
+			value, err := d.replacement(column, decodeCopyField(fields[indexes[i]]), row)
+			if err != nil {
+				return fmt.Errorf("failed to anonymize %s.%s: %w", tablePlan.Name, column.Name, err)
+			}
+			fields[indexes[i]] = encodeCopyField(value)
+		}
+		if _, err := writer.WriteString(strings.Join(fields, "\t") + line[len(content):]); err != nil {
+			return err
+		}
+	}
+}
+
+// replacement computes the new value of a column from its original value
+// and the row columns of its table
+func (d *DumpAnonymizer) replacement(column *ColumnPlan, original interface{}, row map[string]interface{}) (interface{}, error) {
+	switch strategy := column.Strategy.(type) {
+	case ValueStrategy:
+		return anonymizeValue(d.mappings, column, original, row)
+	case *FixedValueStrategy:
+		return strategy.Value, nil
+	default:
+		return nil, nil
+	}
+}
+
+// lookupTable returns the plan of a table in the dump. Schema qualified
+// names also match plans of the unqualified table name.
+func (d *DumpAnonymizer) lookupTable(name string) *TablePlan {
+	if tablePlan, ok := d.tables[name]; ok {
+		return tablePlan
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return d.tables[name[i+1:]]
+	}
+	return nil
+}
+
+// tableStats returns the statistics of a table, creating them on first use
+func (d *DumpAnonymizer) tableStats(tablePlan *TablePlan) *dumpStats {
+	stats, ok := d.stats[tablePlan.Name]
+	if !ok {
+		stats = &dumpStats{}
+		d.stats[tablePlan.Name] = stats
+	}
+	return stats
+}
+
+// columnIndexes returns the position of each planned column in the rows of
+// a table, followed by those of its row columns, and the number of values per
+// row. The columns of the statement take precedence over those of the CREATE
+// TABLE statement.
+func (d *DumpAnonymizer) columnIndexes(tablePlan *TablePlan, name string, columns []string) ([]int, int, error) {
+	if len(columns) == 0 {
+		columns = d.columns[name]
+	}
+	if i := strings.LastIndex(name, "."); len(columns) == 0 && i >= 0 {
+		columns = d.columns[name[i+1:]]
+	}
+	if len(columns) == 0 {
+		return nil, 0, fmt.Errorf("columns of table %s are unknown: its data has no column list and follows no CREATE TABLE statement", tablePlan.Name)
+	}
+
+	located := append(columnNames(tablePlan.Columns), tablePlan.rowColumns()...)
+	indexes := make([]int, len(located))
+	for i, column := range located {
+		indexes[i] = -1
+		for j, name := range columns {
+			if strings.EqualFold(name, column) {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] < 0 {
+			return nil, 0, fmt.Errorf("column %s.%s not found in dump", tablePlan.Name, column)
+		}
+	}
+	return indexes, len(columns), nil
+}
+
+// results reports the rows of every planned table found in the dump
+func (d *DumpAnonymizer) results() []ExecutionResult {
+	var results []ExecutionResult
+	for _, tablePlan := range d.plan.Tables {
+		stats, ok := d.stats[tablePlan.Name]
+		if !ok {
+			d.logger.Warning("Table not found in dump", map[string]interface{}{
+				"table": tablePlan.Name,
+			})
+			stats = &dumpStats{}
+		}
+
+		d.logger.Info("Processed table", map[string]interface{}{
+			"table":    tablePlan.Name,
+			"action":   tablePlan.Action,
+			"rows":     stats.rows,
+			"duration": stats.duration.String(),
+		})
+
+		if tablePlan.Action == ActionTruncate {
+			results = append(results, ExecutionResult{
+				TableName:    tablePlan.Name,
+				Action:       ActionTruncate,
+				RowsScanned:  stats.rows,
+				RowsAffected: stats.rows,
+				RowsBefore:   stats.rows,
+				Strategy:     "omit",
+				Duration:     stats.duration,
+			})
+			continue
+		}
+
+		for _, column := range tablePlan.Columns {
+			results = append(results, ExecutionResult{
+				TableName:    tablePlan.Name,
+				FieldName:    column.Name,
+				Action:       ActionAnonymize,
+				RowsScanned:  stats.rows,
+				RowsAffected: stats.rows,
+				Strategy:     column.Strategy.GetType(),
+				Duration:     stats.duration,
+			})
+		}
+	}
+	return results
+}
+
+// decodeLiteral returns the value of a SQL literal of a row: nil for NULL,
+// the unescaped text of strings and the raw text of anything else, such as
+// numbers
+func (d *DumpAnonymizer) decodeLiteral(raw string) interface{} {
+	value := strings.TrimSpace(raw)
+	if strings.EqualFold(value, "NULL") {
+		return nil
+	}
+
+	// MySQL character set introducers, as in _binary 'abc'
+	if strings.HasPrefix(value, "_") {
+		if i := strings.IndexByte(value, '\''); i > 0 {
+			value = value[i:]
+		}
+	}
+
+	escapes := d.backslashEscapes
+	if len(value) > 1 && (value[0] == 'E' || value[0] == 'e') && value[1] == '\'' {
+		escapes = true
+		value = value[1:]
+	}
+	if len(value) < 2 || value[0] != '\'' || value[len(value)-1] != '\'' {
+		return value
+	}
+
+	var text strings.Builder
+	body := value[1 : len(value)-1]
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\'' && i+1 < len(body) && body[i+1] == '\'':
+			i++
+		case escapes && c == '\\' && i+1 < len(body):
+			i++
+			switch body[i] {
+			case '0':
+				c = 0
+			case 'b':
+				c = '\b'
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'Z':
+				c = '\x1a'
+			case '%', '_':
+				// Kept escaped, as MySQL does outside of LIKE patterns
+				text.WriteByte('\\')
+				c = body[i]
+			default:
+				c = body[i]
+			}
+		}
+		text.WriteByte(c)
+	}
+	return text.String()
+}
+
+// literal renders a value as a SQL literal of the dump's database
+func (d *DumpAnonymizer) literal(value interface{}) string {
+	if text, ok := value.(string); ok && d.backslashEscapes {
+		return "'" + mysqlStringEscaper.Replace(text) + "'"
+	}
+	return sqlLiteral(value)
+}
+
+// enclosed returns the text inside the parentheses that s starts with and
+// the text following them
+func (d *DumpAnonymizer) enclosed(s string) (string, string) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '\'' && d.backslashEscapes {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return s[1:i], s[i+1:]
+			}
+		}
+	}
+	return strings.TrimPrefix(s, "("), ""
+}
+
+// splitList splits a comma separated list at the commas outside of quotes
+// and parentheses
+func (d *DumpAnonymizer) splitList(s string) []string {
+	var items []string
+	depth := 0
+	start := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '\'' && d.backslashEscapes {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// readIdentifier reads a table or column name, possibly quoted and schema
+// qualified, from the start of s. It returns the name without quotes,
+// whether any part of it was quoted and the rest of s.
+func readIdentifier(s string) (string, bool, string) {
+	s = strings.TrimLeft(s, " \t\r\n")
+	var parts []string
+	quoted := false
+	for s != "" {
+		var part string
+		switch s[0] {
+		case '`', '"', '[':
+			closing := s[0]
+			if closing == '[' {
+				closing = ']'
+			}
+			var text strings.Builder
+			i := 1
+			for ; i < len(s); i++ {
+				if s[i] == closing {
+					if i+1 < len(s) && s[i+1] == closing {
+						text.WriteByte(closing)
+						i++
+						continue
+					}
+					break
+				}
+				text.WriteByte(s[i])
+			}
+			part = text.String()
+			s = s[min(i+1, len(s)):]
+			quoted = true
+		default:
+			i := 0
+			for i < len(s) && isIdentifierByte(s[i]) {
+				i++
+			}
+			if i == 0 {
+				return strings.Join(parts, "."), quoted, s
+			}
+			part, s = s[:i], s[i:]
+		}
+
+		parts = append(parts, part)
+		if !strings.HasPrefix(s, ".") {
+			break
+		}
+		s = s[1:]
+	}
+	return strings.Join(parts, "."), quoted, s
+}
+
+// decodeCopyField returns the value of a field of a COPY block in text
+// format: nil for \N and the unescaped text otherwise
+func decodeCopyField(field string) interface{} {
+	if field == `\N` {
+		return nil
+	}
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var text strings.Builder
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c != '\\' || i+1 == len(field) {
+			text.WriteByte(c)
+			continue
+		}
+		i++
+		switch field[i] {
+		case 'b':
+			text.WriteByte('\b')
+		case 'f':
+			text.WriteByte('\f')
+		case 'n':
+			text.WriteByte('\n')
+		case 'r':
+			text.WriteByte('\r')
+		case 't':
+			text.WriteByte('\t')
+		case 'v':
+			text.WriteByte('\v')
+		case 'x':
+			// One or two hex digits
+			end := i + 1
+			for end < len(field) && end < i+3 && isHexDigit(field[end]) {
+				end++
+			}
+			if code, err := strconv.ParseUint(field[i+1:end], 16, 8); err == nil {
+				text.WriteByte(byte(code))
+				i = end - 1
+			} else {
+				text.WriteByte('x')
+			}
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// One to three octal digits
+			end := i + 1
+			for end < len(field) && end < i+3 && field[end] >= '0' && field[end] <= '7' {
+				end++
+			}
+			code, _ := strconv.ParseUint(field[i:end], 8, 8)
+			text.WriteByte(byte(code))
+			i = end - 1
+		default:
+			text.WriteByte(field[i])
+		}
+	}
+	return text.String()
+}
+
+// encodeCopyField renders a value as a field of a COPY block in text format
+func encodeCopyField(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return `\N`
+	case string:
+		return copyFieldEscaper.Replace(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	default:
+		return copyFieldEscaper.Replace(fmt.Sprintf("%v", v))
+	}
+}
+
+// replaceTrimmed replaces raw with replacement, keeping the whitespace around raw
+func replaceTrimmed(raw, replacement string) string {
+	trimmed := strings.TrimLeft(raw, " \t\r\n")
+	leading := raw[:len(raw)-len(trimmed)]
+	trailing := trimmed[len(strings.TrimRight(trimmed, " \t\r\n")):]
+	return leading + replacement + trailing
+}
+
+// endsWithKeyword reports whether s ends with keyword as a whole word
+func endsWithKeyword(s, keyword string) bool {
+	if len(s) < len(keyword) || !strings.EqualFold(s[len(s)-len(keyword):], keyword) {
+		return false
+	}
+	return len(s) == len(keyword) || !isIdentifierByte(s[len(s)-len(keyword)-1])
+}
+
+// isEscapeStringPrefix reports whether text, the part of a value before a
+// quote, makes the quote start a PostgreSQL escape string such as E'a\tb'
+func isEscapeStringPrefix(text string) bool {
+	text = strings.TrimLeft(text, " \t\r\n")
+	return text == "E" || text == "e"
+}
+
+// hasPrefixFold reports whether b starts with prefix, ignoring case
+func hasPrefixFold(b []byte, prefix string) bool {
+	return len(b) >= len(prefix) && strings.EqualFold(string(b[:len(prefix)]), prefix)
+}
+
+// isIdentifierByte reports whether c can be part of an unquoted identifier
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// isSpace reports whether c is whitespace
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// isHexDigit reports whether c is a hexadecimal digit
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,254 @@
+package anonymizer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+// anonymizeTestDump anonymizes a dump with a plan created from cfg
+func anonymizeTestDump(t *testing.T, cfg *config.Config, dump string) (string, []ExecutionResult) {
+	t.Helper()
+
+	plan, err := CreatePlan(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	dumpAnonymizer, err := NewDumpAnonymizer(plan, log)
+	if err != nil {
+		t.Fatalf("Failed to create dump anonymizer: %v", err)
+	}
+	defer dumpAnonymizer.Close()
+
+	var out bytes.Buffer
+	results, err := dumpAnonymizer.Anonymize(context.Background(), strings.NewReader(dump), &out)
+	if err != nil {
+		t.Fatalf("Failed to anonymize dump: %v", err)
+	}
+	return out.String(), results
+}
+
+func TestDumpAnonymizerMySQL(t *testing.T) {
+	dump := "/*!40101 SET NAMES utf8mb4 */;\n" +
+		"CREATE TABLE `customers` (\n" +
+		"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+		"  `email` varchar(255) DEFAULT NULL COMMENT 'it\\'s (an) email, really',\n" +
+		"  `name` varchar(255) DEFAULT NULL,\n" +
+		"  `balance` decimal(10,2) DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `idx_email` (`email`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n" +
+		"INSERT INTO `customers` VALUES (1,'jane@example.com','O\\'Brien; (x)',1.50),(2,NULL,'a\\\\b',NULL),(3,'john@example.com','John',2.00);\n" +
+		"CREATE TABLE `sessions` (`id` int, `token` text);\n" +
+		"INSERT INTO `sessions` VALUES (1,'secret'),(2,'other');\n" +
+		"INSERT INTO `orders` VALUES (1,'keep; (me)');\n" +
+		"INSERT INTO `newsletter` (`email`, `id`) VALUES ('john@example.com', 5);\n"
+
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{Driver: "mysql"},
+		Seed:     "test-seed",
+		Tables: map[string]config.TableConfig{
+			"customers": {
+				Columns: map[string]config.ColumnConfig{
+					"email":   {Type: "faker.email", ConsistencyGroup: "email"},
+					"name":    {Value: "Jane's"},
+					"balance": {Null: true},
+				},
+			},
+			"newsletter": {
+				Columns: map[string]config.ColumnConfig{
+					"email": {Type: "faker.email", ConsistencyGroup: "email"},
+				},
+			},
+			"sessions": {Truncate: config.Bool(true)},
+		},
+	}
+
+	out, results := anonymizeTestDump(t, cfg, dump)
+	lines := strings.Split(out, "\n")
+
+	// Schema statements and unplanned tables are copied unchanged
+	if !strings.HasPrefix(out, "/*!40101 SET NAMES utf8mb4 */;\nCREATE TABLE `customers` (\n") {
+		t.Errorf("Expected schema to be copied, got %s", out)
+	}
+	if !strings.Contains(out, "INSERT INTO `orders` VALUES (1,'keep; (me)');\n") {
+		t.Errorf("Expected unplanned table to be copied, got %s", out)
+	}
+
+	// Rows of truncated tables are dropped with their statement
+	if strings.Contains(out, "secret") || !strings.Contains(out, "CREATE TABLE `sessions` (`id` int, `token` text);\nINSERT INTO `orders`") {
+		t.Errorf("Expected sessions rows to be dropped, got %s", out)
+	}
+
+	// Values are replaced in place
+	var customers string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "INSERT INTO `customers`") {
+			customers = line
+		}
+	}
+	if strings.Contains(customers, "jane@example.com") || strings.Contains(customers, "Brien") {
+		t.Errorf("Expected customers to be anonymized, got %s", customers)
+	}
+	if !strings.HasPrefix(customers, "INSERT INTO `customers` VALUES (1,'") ||
+		!strings.Contains(customers, "','Jane\\'s',NULL),(2,NULL,'Jane\\'s',NULL),(3,'") {
+		t.Errorf("Unexpected customers statement %s", customers)
+	}
+
+	// The consistency group maps john@example.com to the same fake email
+	start := strings.Index(customers, "(3,'") + len("(3,'")
+	john := customers[start : start+strings.Index(customers[start:], "'")]
+	if !strings.Contains(out, "INSERT INTO `newsletter` (`email`, `id`) VALUES ('"+john+"', 5);\n") {
+		t.Errorf("Expected newsletter email to be %s, got %s", john, out)
+	}
+
+	rows := make(map[string]int64)
+	for _, result := range results {
+		rows[result.TableName] = result.RowsScanned
+	}
+	if rows["customers"] != 3 || rows["newsletter"] != 1 || rows["sessions"] != 2 {
+		t.Errorf("Unexpected row counts %v", rows)
+	}
+}
+
+func TestDumpAnonymizerPostgres(t *testing.T) {
+	dump := "SET standard_conforming_strings = on;\n" +
+		"CREATE TABLE public.customers (\n" +
+		"    id integer NOT NULL,\n" +
+		"    email text,\n" +
+		"    \"Note\" text,\n" +
+		"    CONSTRAINT customers_pkey PRIMARY KEY (id)\n" +
+		");\n" +
+		"COPY public.customers (id, email, \"Note\") FROM stdin;\n" +
+		"1\tjane@example.com\tline\\none\n" +
+		"2\t\\N\tx\n" +
+		"\\.\n" +
+		"\n" +
+		"INSERT INTO public.customers VALUES (3, 'o''neil@example.com', E'a\\'b');\n" +
+		"COPY public.sessions (id, token) FROM stdin;\n" +
+		"1\tsecret\n" +
+		"\\.\n"
+
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{Driver: "postgres"},
+		Seed:     "test-seed",
+		Tables: map[string]config.TableConfig{
+			"customers": {
+				Columns: map[string]config.ColumnConfig{
+					"email": {Type: "faker.email"},
+					"Note":  {Value: "it's a\ttab"},
+				},
+			},
+			"sessions": {Truncate: config.Bool(true)},
+		},
+	}
+
+	out, _ := anonymizeTestDump(t, cfg, dump)
+	lines := strings.Split(out, "\n")
+
+	if lines[7] != "COPY public.customers (id, email, \"Note\") FROM stdin;" {
+		t.Errorf("Expected COPY header to be copied, got %s", lines[7])
+	}
+	fields := strings.Split(lines[8], "\t")
+	if len(fields) != 3 || fields[0] != "1" || fields[1] == "jane@example.com" || fields[2] != `it's a\ttab` {
+		t.Errorf("Unexpected COPY row %q", lines[8])
+	}
+	if lines[9] != "2\t\\N\tit's a\\ttab" || lines[10] != `\.` {
+		t.Errorf("Unexpected COPY rows %q", lines[9:11])
+	}
+	if !strings.HasPrefix(lines[12], "INSERT INTO public.customers VALUES (3, '") ||
+		!strings.HasSuffix(lines[12], "', 'it''s a\ttab');") || strings.Contains(lines[12], "neil") {
+		t.Errorf("Unexpected INSERT %s", lines[12])
+	}
+
+	// Truncated tables keep an empty COPY block
+	if lines[13] != "COPY public.sessions (id, token) FROM stdin;" || lines[14] != `\.` {
+		t.Errorf("Expected an empty sessions COPY block, got %q", lines[13:])
+	}
+}
+
+func TestDumpAnonymizerErrors(t *testing.T) {
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	// SQL expressions cannot be evaluated without a database
+	plan, err := CreatePlan(&config.Config{
+		Tables: map[string]config.TableConfig{
+			"admin_user": {
+				Columns: map[string]config.ColumnConfig{
+					"email": {Expr: "CONCAT('admin', user_id)"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	if _, err := NewDumpAnonymizer(plan, log); err == nil {
+		t.Error("Expected error for expression strategy, got nil")
+	}
+
+	// Rows need known columns
+	plan, err = CreatePlan(&config.Config{
+		Tables: map[string]config.TableConfig{
+			"customers": {
+				Columns: map[string]config.ColumnConfig{
+					"email": {Null: true},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	dumpAnonymizer, err := NewDumpAnonymizer(plan, log)
+	if err != nil {
+		t.Fatalf("Failed to create dump anonymizer: %v", err)
+	}
+	defer dumpAnonymizer.Close()
+
+	var out bytes.Buffer
+	if _, err := dumpAnonymizer.Anonymize(context.Background(), strings.NewReader("INSERT INTO `customers` VALUES (1,'a');\n"), &out); err == nil {
+		t.Error("Expected error for unknown columns, got nil")
+	}
+	if _, err := dumpAnonymizer.Anonymize(context.Background(), strings.NewReader("INSERT INTO `customers` (`id`, `mail`) VALUES (1,'a');\n"), &out); err == nil {
+		t.Error("Expected error for missing column, got nil")
+	}
+}
+
+func TestDecodeCopyField(t *testing.T) {
+	tests := []struct {
+		field    string
+		expected interface{}
+	}{
+		{`\N`, nil},
+		{`plain`, "plain"},
+		{`a\tb\\c\nd`, "a\tb\\c\nd"},
+		{`\101\x42`, "AB"},
+	}
+
+	for _, test := range tests {
+		if value := decodeCopyField(test.field); value != test.expected {
+			t.Errorf("Expected %q to decode to %q, got %q", test.field, test.expected, value)
+		}
+		if test.expected != nil && test.field != `\101\x42` {
+			if field := encodeCopyField(test.expected); field != test.field {
+				t.Errorf("Expected %q to encode to %q, got %q", test.expected, test.field, field)
+			}
+		}
+	}
+}
@@ -2,12 +2,15 @@ package anonymizer
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"fmt"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
-	"db-gdpr-anonymizer/internal/faker"
+	"db-gdpr-anonymizer/internal/database"
 	"db-gdpr-anonymizer/internal/logger"
 )
 
@@ -15,9 +18,17 @@ import (
 type ExecutionResult struct {
 	TableName    string
 	FieldName    string
+	Action       string
+	Parent       string
 	RowsScanned  int64
 	RowsAffected int64
+	RowsBefore   int64
+	RowsAfter    int64
 	Strategy     string
+	Retries      int
+	Transaction  string
+	Chunk        int
+	Committed    bool
 	Duration     time.Duration
 	Error        error
 }
@@ -30,19 +41,52 @@ type Executor struct {
 	logger     *logger.Logger
 	dryRun     bool
 	maxWorkers int
-	faker      *faker.Generator
+	failFast   bool
+	mappings   *MappingStore
+	checkpoint *Checkpoint
+
+	foreignKeys       []database.ForeignKey
+	foreignKeysLoaded bool
+
+	statementsMutex sync.Mutex
+	statements      map[string]*sql.Stmt
+}
+
+// transaction is a database transaction with the statements prepared in it
+type transaction struct {
+	tx         *sql.Tx
+	statements map[string]*sql.Stmt
+}
+
+// batchStatement is a statement of a chunk with the arguments to bind
+type batchStatement struct {
+	query string
+	args  []interface{}
 }
 
-// NewExecutor creates a new executor
-func NewExecutor(db *sql.DB, plan *AnonymizationPlan, logger *logger.Logger, dryRun bool, maxWorkers int) *Executor {
+// rowValues holds the primary key of a row, the original values of its
+// value strategy and row columns, and the values drawn for its shuffled
+// columns
+type rowValues struct {
+	primaryKey []interface{}
+	values     map[string]interface{}
+	shuffled   map[string]interface{}
+}
+
+// NewExecutor creates a new executor. The executor records its progress in
+// checkpoint, if set, and skips the tables and chunks it records as completed.
+// With failFast, it stops at the first table or chunk that fails.
+func NewExecutor(db *sql.DB, plan *AnonymizationPlan, logger *logger.Logger, dryRun bool, maxWorkers int, failFast bool, checkpoint *Checkpoint) *Executor {
 	return &Executor{
 		db:         db,
 		plan:       plan,
-		sqlGen:     NewSQLGenerator(plan),
+		sqlGen:     NewSQLGenerator(plan, plan.Dialect),
 		logger:     logger,
 		dryRun:     dryRun,
 		maxWorkers: maxWorkers,
-		faker:      faker.NewGenerator(),
+		failFast:   failFast,
+		checkpoint: checkpoint,
+		statements: make(map[string]*sql.Stmt),
 	}
 }
 
@@ -51,26 +95,94 @@ func (e *Executor) Execute(ctx context.Context) ([]ExecutionResult, error) {
 	results := make([]ExecutionResult, 0)
 	resultsMutex := &sync.Mutex{}
 
+	// Create the mapping store shared by all consistency groups
+	mappings, err := NewMappingStore(defaultMappingMemoryEntries, os.TempDir())
+	if err != nil {
+		return nil, err
+	}
+	e.mappings = mappings
+
+	// Prepared statements are shared by the chunks of a table
+	defer e.closeStatements()
+
+	// Failed tables and chunks are reported with their error. With fail fast,
+	// the first failure cancels the chunks in progress and stops the run.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var firstFailure *ExecutionResult
+	fail := func(result ExecutionResult, message string, fields map[string]interface{}) {
+		fields["table"] = result.TableName
+		fields["error"] = result.Error.Error()
+		e.logger.Error(message, fields)
+
+		resultsMutex.Lock()
+		results = append(results, result)
+		if firstFailure == nil {
+			firstFailure = &result
+		}
+		resultsMutex.Unlock()
+
+		if e.failFast {
+			cancel()
+		}
+	}
+
 	// Create a worker pool
 	workerPool := make(chan struct{}, e.maxWorkers)
 	var wg sync.WaitGroup
 
+tables:
 	for _, tablePlan := range e.plan.Tables {
 		// Check if context is cancelled
 		select {
 		case <-ctx.Done():
-			return results, ctx.Err()
+			break tables
 		default:
 		}
 
+		// Tables completed by an interrupted run are not processed again
+		if e.checkpoint.Completed(tablePlan.Name) {
+			e.logger.Info("Skipping completed table", map[string]interface{}{
+				"table": tablePlan.Name,
+			})
+			continue
+		}
+
+		// Rows of delete tables are removed with their dependent rows
+		if tablePlan.Action == ActionDelete {
+			deleteResults, err := e.deleteRows(ctx, tablePlan)
+			if err != nil {
+				fail(failedTable(tablePlan, err), "Failed to delete rows", map[string]interface{}{})
+				continue
+			}
+
+			resultsMutex.Lock()
+			results = append(results, deleteResults...)
+			resultsMutex.Unlock()
+			e.completeTable(tablePlan)
+			continue
+		}
+
+		// Truncated tables are emptied as a whole
+		if tablePlan.Action == ActionTruncate {
+			result, err := e.truncateTable(ctx, tablePlan)
+			if err != nil {
+				fail(failedTable(tablePlan, fmt.Errorf("failed to truncate table: %w", err)), "Failed to truncate table", map[string]interface{}{})
+				continue
+			}
+
+			resultsMutex.Lock()
+			results = append(results, result)
+			resultsMutex.Unlock()
+			e.completeTable(tablePlan)
+			continue
+		}
+
 		// Use the primary key from the plan if it's set, otherwise get it
-		if tablePlan.PrimaryKey == "" {
+		if len(tablePlan.PrimaryKey) == 0 {
 			primaryKey, err := e.getPrimaryKey(tablePlan.Name)
 			if err != nil {
-				e.logger.Error("Failed to get primary key", map[string]interface{}{
-					"table":  tablePlan.Name,
-					"error":  err.Error(),
-				})
+				fail(failedTable(tablePlan, fmt.Errorf("failed to get primary key: %w", err)), "Failed to get primary key", map[string]interface{}{})
 				continue
 			}
 			tablePlan.PrimaryKey = primaryKey
@@ -79,10 +191,7 @@ func (e *Executor) Execute(ctx context.Context) ([]ExecutionResult, error) {
 		// Count rows to be anonymized
 		rowCount, err := e.countRows(tablePlan)
 		if err != nil {
-			e.logger.Error("Failed to count rows", map[string]interface{}{
-				"table":  tablePlan.Name,
-				"error":  err.Error(),
-			})
+			fail(failedTable(tablePlan, fmt.Errorf("failed to count rows: %w", err)), "Failed to count rows", map[string]interface{}{})
 			continue
 		}
 
@@ -93,37 +202,105 @@ func (e *Executor) Execute(ctx context.Context) ([]ExecutionResult, error) {
 			"columns":   len(tablePlan.Columns),
 		})
 
-		// If the table has a primary key, we can process it in chunks
-		if tablePlan.PrimaryKey != "" && rowCount > 1000 {
-			// Get primary key range
-			minPK, maxPK, err := e.getPrimaryKeyRange(tablePlan)
-			if err != nil {
-				e.logger.Error("Failed to get primary key range", map[string]interface{}{
-					"table":  tablePlan.Name,
-					"error":  err.Error(),
-				})
+		// Large tables are processed in chunks. Tables with value strategies
+		// are always processed row by row in chunks, since every row needs its
+		// own value derived from the original.
+		if tablePlan.HasValueStrategies() || rowCount > int64(tablePlan.BatchSize) {
+			// Tables committed as a whole are processed chunk after chunk in
+			// their transaction
+			if tablePlan.Transaction == TransactionTable {
+				tableResults, err := e.processTableTransaction(ctx, tablePlan)
+				if err != nil {
+					// Every chunk of the transaction failed with it
+					for _, result := range tableResults[:len(tableResults)-1] {
+						resultsMutex.Lock()
+						results = append(results, result)
+						resultsMutex.Unlock()
+					}
+					fail(tableResults[len(tableResults)-1], "Failed to process table", map[string]interface{}{})
+					continue
+				}
+
+				resultsMutex.Lock()
+				results = append(results, tableResults...)
+				resultsMutex.Unlock()
+				e.completeTable(tablePlan)
 				continue
 			}
 
-			// Process in chunks
-			chunkSize := 1000
-			for offset := minPK; offset <= maxPK; offset += chunkSize {
+			// Page through the table by primary key; each page is one chunk.
+			// A resumed table skips the chunks completed before and reads the
+			// rows between them, never past the first key of the next
+			// completed chunk, so no row is anonymized twice.
+			completed := e.checkpoint.CompletedChunks(tablePlan.Name)
+			if len(completed) > 0 {
+				e.logger.Info("Resuming table", map[string]interface{}{
+					"table":           tablePlan.Name,
+					"completedChunks": len(completed),
+				})
+			}
+			var lastKey []interface{}
+			processed := 0
+			for chunk := 0; ctx.Err() == nil; chunk++ {
+				if len(completed) > 0 && sameKey(completed[0].After, lastKey) {
+					chunk = completed[0].Chunk
+					lastKey = completed[0].Last
+					completed = completed[1:]
+					continue
+				}
+				var until []interface{}
+				if len(completed) > 0 {
+					until = completed[0].After
+				}
+
+				var rows []rowValues
+				readRetries, err := withRetry(ctx, e.plan.Retry, e.logger, map[string]interface{}{
+					"table": tablePlan.Name,
+					"chunk": chunk,
+				}, func() error {
+					var err error
+					rows, err = e.getNextRows(ctx, tablePlan, nil, lastKey, until)
+					return err
+				})
+				if err != nil {
+					// The chunks after one that cannot be read are not
+					// processed either
+					fail(e.failedChunk(tablePlan, chunk, 0, fmt.Errorf("failed to read chunk %d: %w", chunk, err)), "Failed to read chunk", map[string]interface{}{
+						"chunk": chunk,
+					})
+					break
+				}
+				// The rows before a completed chunk were deleted since
+				if len(rows) == 0 && until != nil {
+					lastKey = until
+					chunk--
+					continue
+				}
+				// An empty first chunk still reports the table
+				if len(rows) == 0 && chunk > 0 {
+					e.endTable(tablePlan, processed)
+					break
+				}
+				after := lastKey
+				if len(rows) > 0 {
+					lastKey = rows[len(rows)-1].primaryKey
+				}
+
 				// Limit concurrent workers
 				workerPool <- struct{}{}
 				wg.Add(1)
+				processed++
 
-				go func(tablePlan *TablePlan, offset int) {
+				go func(tablePlan *TablePlan, chunk int, rows []rowValues, after, lastKey []interface{}, readRetries int) {
 					defer func() {
 						<-workerPool
 						wg.Done()
 					}()
 
-					chunkResult, err := e.processChunk(ctx, tablePlan, offset, chunkSize)
+					chunkResult, err := e.processChunk(ctx, tablePlan, nil, chunk, rows, readRetries)
 					if err != nil {
-						e.logger.Error("Failed to process chunk", map[string]interface{}{
-							"table":  tablePlan.Name,
-							"offset": offset,
-							"error":  err.Error(),
+						fail(e.failedChunk(tablePlan, chunk, len(rows), fmt.Errorf("failed to process chunk %d: %w", chunk, err)), "Failed to process chunk", map[string]interface{}{
+							"chunk": chunk,
 						})
 						return
 					}
@@ -131,43 +308,105 @@ func (e *Executor) Execute(ctx context.Context) ([]ExecutionResult, error) {
 					resultsMutex.Lock()
 					results = append(results, chunkResult...)
 					resultsMutex.Unlock()
-				}(tablePlan, offset)
+					e.completeChunk(tablePlan, chunk, after, lastKey)
+				}(tablePlan, chunk, rows, after, lastKey, readRetries)
+
+				if until == nil && len(rows) < tablePlan.BatchSize {
+					e.endTable(tablePlan, processed)
+					break
+				}
 			}
 		} else {
 			// Process the whole table at once
 			tableResults, err := e.processTable(ctx, tablePlan)
 			if err != nil {
-				e.logger.Error("Failed to process table", map[string]interface{}{
-					"table": tablePlan.Name,
-					"error": err.Error(),
-				})
+				fail(failedTable(tablePlan, fmt.Errorf("failed to process table: %w", err)), "Failed to process table", map[string]interface{}{})
 				continue
 			}
 
 			resultsMutex.Lock()
 			results = append(results, tableResults...)
 			resultsMutex.Unlock()
+			e.completeTable(tablePlan)
 		}
 	}
 
 	// Wait for all workers to finish
 	wg.Wait()
 
+	if e.failFast && firstFailure != nil {
+		return results, fmt.Errorf("stopped after table %s failed: %w", firstFailure.TableName, firstFailure.Error)
+	}
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
 	return results, nil
 }
 
+// ConsistencyGroups returns the consistency groups of the plan with the
+// number of distinct values mapped in each during execution
+func (e *Executor) ConsistencyGroups() []ConsistencyGroupResult {
+	if e.mappings == nil {
+		return nil
+	}
+	return consistencyGroups(e.plan, e.mappings)
+}
+
+// Close releases resources held by the executor
+func (e *Executor) Close() error {
+	if e.mappings == nil {
+		return nil
+	}
+	return e.mappings.Close()
+}
+
+// completeTable records in the checkpoint that a table was completed
+func (e *Executor) completeTable(tablePlan *TablePlan) {
+	if e.dryRun {
+		return
+	}
+	if err := e.checkpoint.CompleteTable(tablePlan.Name); err != nil {
+		e.logger.Error("Failed to record checkpoint", map[string]interface{}{
+			"table": tablePlan.Name,
+			"error": err.Error(),
+		})
+	}
+}
+
+// completeChunk records in the checkpoint that a chunk of a table was
+// completed, with the primary key it follows and its last primary key
+func (e *Executor) completeChunk(tablePlan *TablePlan, chunk int, after, lastKey []interface{}) {
+	if e.dryRun {
+		return
+	}
+	if err := e.checkpoint.CompleteChunk(tablePlan.Name, chunk, after, lastKey); err != nil {
+		e.logger.Error("Failed to record checkpoint", map[string]interface{}{
+			"table": tablePlan.Name,
+			"chunk": chunk,
+			"error": err.Error(),
+		})
+	}
+}
+
+// endTable records in the checkpoint that all chunks of a table were read
+func (e *Executor) endTable(tablePlan *TablePlan, chunks int) {
+	if e.dryRun {
+		return
+	}
+	if err := e.checkpoint.EndTable(tablePlan.Name, chunks); err != nil {
+		e.logger.Error("Failed to record checkpoint", map[string]interface{}{
+			"table": tablePlan.Name,
+			"error": err.Error(),
+		})
+	}
+}
+
 // processTable processes a whole table at once
 func (e *Executor) processTable(ctx context.Context, tablePlan *TablePlan) ([]ExecutionResult, error) {
 	results := make([]ExecutionResult, 0, len(tablePlan.Columns))
 
 	// Generate SQL
-	sqlQuery, err := e.sqlGen.GenerateTableSQL(tablePlan)
-	if err != nil {
-		return nil, err
-	}
-
-	// Replace faker placeholders with actual fake data
-	sqlQuery, err = e.faker.ReplaceFakerPlaceholders(sqlQuery)
+	sqlQuery, args, err := e.sqlGen.GenerateTableSQL(tablePlan)
 	if err != nil {
 		return nil, err
 	}
@@ -181,13 +420,22 @@ func (e *Executor) processTable(ctx context.Context, tablePlan *TablePlan) ([]Ex
 	// Execute SQL
 	startTime := time.Now()
 	var rowsAffected int64
+	var retries int
 
 	if !e.dryRun {
-		result, err := e.db.ExecContext(ctx, sqlQuery)
+		retries, err = withRetry(ctx, e.plan.Retry, e.logger, map[string]interface{}{
+			"table": tablePlan.Name,
+		}, func() error {
+			result, err := e.db.ExecContext(ctx, sqlQuery, args...)
+			if err != nil {
+				return err
+			}
+			rowsAffected, _ = result.RowsAffected()
+			return nil
+		})
 		if err != nil {
 			return nil, err
 		}
-		rowsAffected, _ = result.RowsAffected()
 	} else {
 		// In dry run mode, we simulate the number of rows affected
 		rowsAffected = rowCount
@@ -200,6 +448,7 @@ func (e *Executor) processTable(ctx context.Context, tablePlan *TablePlan) ([]Ex
 		"table":        tablePlan.Name,
 		"rowsScanned":  rowCount,
 		"rowsAffected": rowsAffected,
+		"retries":      retries,
 		"dryRun":       e.dryRun,
 		"duration":     duration.String(),
 	})
@@ -211,7 +460,9 @@ func (e *Executor) processTable(ctx context.Context, tablePlan *TablePlan) ([]Ex
 			FieldName:    column.Name,
 			RowsScanned:  rowCount,
 			RowsAffected: rowsAffected,
+			Action:       ActionAnonymize,
 			Strategy:     column.Strategy.GetType(),
+			Retries:      retries,
 			Duration:     duration,
 		})
 	}
@@ -219,45 +470,254 @@ func (e *Executor) processTable(ctx context.Context, tablePlan *TablePlan) ([]Ex
 	return results, nil
 }
 
-// processChunk processes a chunk of a table
-func (e *Executor) processChunk(ctx context.Context, tablePlan *TablePlan, offset, chunkSize int) ([]ExecutionResult, error) {
-	results := make([]ExecutionResult, 0, len(tablePlan.Columns))
+// truncateTable empties a table. Tables referenced by foreign keys of other
+// tables cannot be truncated and are emptied with DELETE instead.
+func (e *Executor) truncateTable(ctx context.Context, tablePlan *TablePlan) (ExecutionResult, error) {
+	rowsBefore, err := e.countRows(tablePlan)
+	if err != nil {
+		return ExecutionResult{}, err
+	}
 
-	// Get the primary key values for this chunk
-	primaryKeyValues, err := e.getPrimaryKeysInRange(tablePlan, offset, chunkSize)
+	referenced, err := e.isReferenced(tablePlan.Name)
 	if err != nil {
-		return nil, err
+		return ExecutionResult{}, err
+	}
+
+	method := "truncate"
+	sqlQuery := e.sqlGen.GenerateTruncateSQL(tablePlan)
+	if referenced || !e.plan.Dialect.SupportsTruncate() {
+		method = "delete"
+		sqlQuery = e.sqlGen.GenerateDeleteAllSQL(tablePlan)
 	}
 
-	// Process each row individually to ensure unique fake data for each row
 	startTime := time.Now()
-	var totalRowsAffected int64
+	var rowsAfter int64
+	var retries int
+
+	if !e.dryRun {
+		retries, err = withRetry(ctx, e.plan.Retry, e.logger, map[string]interface{}{
+			"table": tablePlan.Name,
+		}, func() error {
+			_, err := e.db.ExecContext(ctx, sqlQuery)
+			return err
+		})
+		if err != nil {
+			return ExecutionResult{}, err
+		}
+		rowsAfter, err = e.countRows(tablePlan)
+		if err != nil {
+			return ExecutionResult{}, err
+		}
+	}
+	// In dry run mode, the table is reported as it would be afterwards: empty
+
+	duration := time.Since(startTime)
+
+	// Log the operation
+	e.logger.Info("Truncated table", map[string]interface{}{
+		"table":      tablePlan.Name,
+		"method":     method,
+		"rowsBefore": rowsBefore,
+		"rowsAfter":  rowsAfter,
+		"retries":    retries,
+		"dryRun":     e.dryRun,
+		"duration":   duration.String(),
+	})
+
+	return ExecutionResult{
+		TableName:    tablePlan.Name,
+		Action:       ActionTruncate,
+		RowsScanned:  rowsBefore,
+		RowsAffected: rowsBefore - rowsAfter,
+		RowsBefore:   rowsBefore,
+		RowsAfter:    rowsAfter,
+		Strategy:     method,
+		Retries:      retries,
+		Duration:     duration,
+	}, nil
+}
 
-	for _, pkValue := range primaryKeyValues {
-		// Generate SQL for a single row
-		sqlQuery, err := e.sqlGen.GenerateSingleRowSQL(tablePlan, tablePlan.PrimaryKey, pkValue)
+// deleteRows deletes the rows matching the where condition of a delete table
+// and, children first, all rows that reference them through foreign keys. The
+// statements run in one transaction, so a failure leaves every table intact,
+// and a transaction failing with a transient error is run again as a whole.
+// In dry run mode, only the rows that would be deleted are counted.
+func (e *Executor) deleteRows(ctx context.Context, tablePlan *TablePlan) ([]ExecutionResult, error) {
+	foreignKeys, err := e.getForeignKeys()
+	if err != nil {
+		return nil, err
+	}
+	steps := e.sqlGen.planDeletion(tablePlan, foreignKeys)
+
+	var results []ExecutionResult
+	retries, err := withRetry(ctx, e.plan.Retry, e.logger, map[string]interface{}{
+		"table": tablePlan.Name,
+	}, func() error {
+		var err error
+		results, err = e.deleteSteps(ctx, steps)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].Retries = retries
+	}
+	return results, nil
+}
+
+// deleteSteps runs the steps of a deletion in one transaction
+func (e *Executor) deleteSteps(ctx context.Context, steps []DeleteStep) ([]ExecutionResult, error) {
+	var tx *sql.Tx
+	var err error
+	if !e.dryRun {
+		tx, err = e.db.BeginTx(ctx, nil)
 		if err != nil {
 			return nil, err
 		}
+		defer tx.Rollback()
+	}
 
-		// Replace faker placeholders with actual fake data
-		// This ensures each row gets unique fake data
-		sqlQuery, err = e.faker.ReplaceFakerPlaceholders(sqlQuery)
+	results := make([]ExecutionResult, 0, len(steps))
+	for _, step := range steps {
+		startTime := time.Now()
+
+		// Count the rows before their parents are gone
+		var rowsMatched int64
+		countQuery := e.sqlGen.GenerateDeleteCountSQL(step)
+		if tx != nil {
+			err = tx.QueryRowContext(ctx, countQuery).Scan(&rowsMatched)
+		} else {
+			err = e.db.QueryRowContext(ctx, countQuery).Scan(&rowsMatched)
+		}
 		if err != nil {
+			return nil, fmt.Errorf("failed to count rows to delete from %s: %w", step.Table, err)
+		}
+
+		rowsDeleted := rowsMatched
+		if tx != nil {
+			for _, foreignKey := range step.SelfReferences {
+				if _, err := tx.ExecContext(ctx, e.sqlGen.GenerateUnlinkSQL(step, foreignKey)); err != nil {
+					return nil, fmt.Errorf("failed to unlink rows of %s through %s: %w", step.Table, foreignKey.Name, err)
+				}
+			}
+
+			result, err := tx.ExecContext(ctx, e.sqlGen.GenerateDeleteSQL(step))
+			if err != nil {
+				return nil, fmt.Errorf("failed to delete rows from %s: %w", step.Table, err)
+			}
+			rowsDeleted, _ = result.RowsAffected()
+		}
+
+		duration := time.Since(startTime)
+
+		// Log the operation
+		e.logger.Info("Deleted rows", map[string]interface{}{
+			"table":       step.Table,
+			"parent":      step.Parent,
+			"rowsMatched": rowsMatched,
+			"rowsDeleted": rowsDeleted,
+			"dryRun":      e.dryRun,
+			"duration":    duration.String(),
+		})
+
+		results = append(results, ExecutionResult{
+			TableName:    step.Table,
+			Action:       ActionDelete,
+			Parent:       step.Parent,
+			RowsScanned:  rowsMatched,
+			RowsAffected: rowsDeleted,
+			Duration:     duration,
+		})
+	}
+
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
 			return nil, err
 		}
+	}
+
+	return results, nil
+}
+
+// isReferenced reports whether foreign keys of other tables reference the table
+func (e *Executor) isReferenced(tableName string) (bool, error) {
+	foreignKeys, err := e.getForeignKeys()
+	if err != nil {
+		return false, err
+	}
+
+	tableName = e.sqlGen.foreignKeyTable(tableName, foreignKeys)
+	for _, foreignKey := range foreignKeys {
+		if foreignKey.ReferencedTable == tableName && foreignKey.Table != tableName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getForeignKeys gets the foreign keys of the database, reading them from the
+// schema on first use
+func (e *Executor) getForeignKeys() ([]database.ForeignKey, error) {
+	if !e.foreignKeysLoaded {
+		foreignKeys, err := database.GetForeignKeys(e.db, e.plan.Dialect.Driver())
+		if err != nil {
+			return nil, err
+		}
+		e.foreignKeys = foreignKeys
+		e.foreignKeysLoaded = true
+	}
+	return e.foreignKeys, nil
+}
+
+// processChunk anonymizes the rows of a chunk of a table. tx is the
+// transaction of the table if the table commits as a whole, and nil
+// otherwise. readRetries is the number of retries it took to read the rows.
+func (e *Executor) processChunk(ctx context.Context, tablePlan *TablePlan, tx *transaction, chunk int, rows []rowValues, readRetries int) ([]ExecutionResult, error) {
+	results := make([]ExecutionResult, 0, len(tablePlan.Columns))
+
+	// Compute the new values of each row and write the whole chunk at once
+	startTime := time.Now()
+	var totalRowsAffected int64
+	retries := readRetries
+
+	if len(rows) > 0 {
+		updates := make([]RowUpdate, 0, len(rows))
+		for _, row := range rows {
+			values, err := e.anonymizeRow(tablePlan, row)
+			if err != nil {
+				return nil, err
+			}
+			updates = append(updates, RowUpdate{PrimaryKey: row.primaryKey, Values: values})
+		}
+
+		// Chunks larger than a statement can bind are written in several
+		maxRows := e.sqlGen.maxBatchRows(tablePlan)
+		statements := make([]batchStatement, 0, (len(updates)+maxRows-1)/maxRows)
+		for start := 0; start < len(updates); start += maxRows {
+			end := start + maxRows
+			if end > len(updates) {
+				end = len(updates)
+			}
+
+			sqlQuery, args, err := e.sqlGen.GenerateBatchUpdateSQL(tablePlan, updates[start:end])
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, batchStatement{query: sqlQuery, args: args})
+		}
 
-		// Execute SQL for this row
 		if !e.dryRun {
-			result, err := e.db.ExecContext(ctx, sqlQuery)
+			rowsAffected, writeRetries, err := e.writeChunk(ctx, tablePlan, tx, chunk, statements)
+			retries += writeRetries
 			if err != nil {
 				return nil, err
 			}
-			rowsAffected, _ := result.RowsAffected()
-			totalRowsAffected += rowsAffected
+			totalRowsAffected = rowsAffected
 		} else {
-			// In dry run mode, we estimate one row affected per query
-			totalRowsAffected++
+			// In dry run mode, we estimate one row affected per row in the chunk
+			totalRowsAffected = int64(len(rows))
 		}
 	}
 
@@ -266,21 +726,29 @@ func (e *Executor) processChunk(ctx context.Context, tablePlan *TablePlan, offse
 	// Log the operation
 	e.logger.Info("Processed chunk", map[string]interface{}{
 		"table":        tablePlan.Name,
-		"offset":       offset,
-		"chunkSize":    chunkSize,
+		"chunk":        chunk,
+		"rows":         len(rows),
 		"rowsAffected": totalRowsAffected,
+		"retries":      retries,
+		"transaction":  tablePlan.Transaction,
 		"dryRun":       e.dryRun,
 		"duration":     duration.String(),
 	})
 
-	// Create results for each column
+	// Create results for each column. A chunk of a table transaction only
+	// commits with the table.
 	for _, column := range tablePlan.Columns {
 		results = append(results, ExecutionResult{
 			TableName:    tablePlan.Name,
 			FieldName:    column.Name,
-			RowsScanned:  int64(len(primaryKeyValues)),
+			Action:       ActionAnonymize,
+			RowsScanned:  int64(len(rows)),
 			RowsAffected: totalRowsAffected,
 			Strategy:     column.Strategy.GetType(),
+			Retries:      retries,
+			Transaction:  tablePlan.Transaction,
+			Chunk:        chunk,
+			Committed:    tx == nil,
 			Duration:     duration,
 		})
 	}
@@ -288,75 +756,474 @@ func (e *Executor) processChunk(ctx context.Context, tablePlan *TablePlan, offse
 	return results, nil
 }
 
+// writeChunk runs the statements of a chunk and returns the number of rows
+// they affected and of retries. Within the transaction of a table, they run
+// in it and are retried with the table. Otherwise, they commit together in a
+// transaction of their own, which is run again as a whole after a transient
+// error, or, without transactions, each statement commits and is retried on
+// its own. The rows are updated by primary key to values computed once, so
+// running the statements again is safe.
+func (e *Executor) writeChunk(ctx context.Context, tablePlan *TablePlan, tx *transaction, chunk int, statements []batchStatement) (int64, int, error) {
+	if tx != nil {
+		rowsAffected, err := e.runStatements(ctx, tx, statements)
+		return rowsAffected, 0, err
+	}
+
+	fields := map[string]interface{}{
+		"table": tablePlan.Name,
+		"chunk": chunk,
+	}
+
+	if tablePlan.Transaction == TransactionNone {
+		var totalRowsAffected int64
+		var totalRetries int
+		for _, statement := range statements {
+			var rowsAffected int64
+			retries, err := withRetry(ctx, e.plan.Retry, e.logger, fields, func() error {
+				var err error
+				rowsAffected, err = e.runStatements(ctx, nil, []batchStatement{statement})
+				return err
+			})
+			totalRetries += retries
+			if err != nil {
+				return 0, totalRetries, err
+			}
+			totalRowsAffected += rowsAffected
+		}
+		return totalRowsAffected, totalRetries, nil
+	}
+
+	// The statements are prepared once for the table, before the transaction
+	// holds a connection
+	for _, statement := range statements {
+		if _, err := e.prepare(ctx, nil, statement.query); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var rowsAffected int64
+	retries, err := withRetry(ctx, e.plan.Retry, e.logger, fields, func() error {
+		return e.inTransaction(ctx, func(tx *transaction) error {
+			var err error
+			rowsAffected, err = e.runStatements(ctx, tx, statements)
+			return err
+		})
+	})
+	return rowsAffected, retries, err
+}
+
+// runStatements runs statements, within tx if it is set, and returns the
+// number of rows they affected
+func (e *Executor) runStatements(ctx context.Context, tx *transaction, statements []batchStatement) (int64, error) {
+	var totalRowsAffected int64
+	for _, statement := range statements {
+		stmt, err := e.prepare(ctx, tx, statement.query)
+		if err != nil {
+			return 0, err
+		}
+		result, err := stmt.ExecContext(ctx, statement.args...)
+		if err != nil {
+			return 0, err
+		}
+		rowsAffected, _ := result.RowsAffected()
+		totalRowsAffected += rowsAffected
+	}
+	return totalRowsAffected, nil
+}
+
+// inTransaction runs fn in a transaction that commits if fn succeeds and
+// rolls back otherwise
+func (e *Executor) inTransaction(ctx context.Context, fn func(tx *transaction) error) error {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&transaction{tx: tx, statements: make(map[string]*sql.Stmt)}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// processTableTransaction anonymizes the chunks of a table one after another
+// in a single transaction, so that the table commits as a whole. A transient
+// error rolls back the transaction, which is then run again from the first
+// chunk. If the transaction does not commit, the chunks of its last attempt,
+// at least one, are returned as rolled back with the error.
+func (e *Executor) processTableTransaction(ctx context.Context, tablePlan *TablePlan) ([]ExecutionResult, error) {
+	var results []ExecutionResult
+	var chunkRows []int
+
+	run := func(tx *transaction) error {
+		results, chunkRows = nil, nil
+
+		// Shuffled columns draw their values from all rows of the table,
+		// which are read in the transaction before the first chunk
+		shuffle, err := e.readShuffle(ctx, tablePlan, tx)
+		if err != nil {
+			return fmt.Errorf("failed to read values to shuffle: %w", err)
+		}
+
+		var lastKey []interface{}
+		for chunk := 0; ; chunk++ {
+			rows, err := e.getNextRows(ctx, tablePlan, tx, lastKey, nil)
+			if err != nil {
+				return fmt.Errorf("failed to read chunk %d: %w", chunk, err)
+			}
+			if err := shuffle.assign(rows); err != nil {
+				return fmt.Errorf("failed to shuffle chunk %d: %w", chunk, err)
+			}
+			// An empty first chunk still reports the table
+			if len(rows) == 0 && chunk > 0 {
+				return nil
+			}
+			if len(rows) > 0 {
+				lastKey = rows[len(rows)-1].primaryKey
+			}
+
+			chunkRows = append(chunkRows, len(rows))
+			chunkResults, err := e.processChunk(ctx, tablePlan, tx, chunk, rows, 0)
+			if err != nil {
+				return fmt.Errorf("failed to process chunk %d: %w", chunk, err)
+			}
+			results = append(results, chunkResults...)
+
+			if len(rows) < tablePlan.BatchSize {
+				return nil
+			}
+		}
+	}
+
+	var retries int
+	var err error
+	if e.dryRun {
+		err = run(nil)
+	} else {
+		retries, err = withRetry(ctx, e.plan.Retry, e.logger, map[string]interface{}{
+			"table": tablePlan.Name,
+		}, func() error {
+			return e.inTransaction(ctx, run)
+		})
+	}
+
+	if err != nil {
+		// A transaction that fails before reading any rows fails its first
+		// chunk
+		if len(chunkRows) == 0 {
+			chunkRows = []int{0}
+		}
+		failed := make([]ExecutionResult, 0, len(chunkRows))
+		for chunk, rows := range chunkRows {
+			result := e.failedChunk(tablePlan, chunk, rows, err)
+			if chunk == 0 {
+				result.Retries = retries
+			}
+			failed = append(failed, result)
+		}
+		return failed, err
+	}
+
+	// The retries of the transaction are counted once, with its first chunk
+	for i := range results {
+		if results[i].Chunk == 0 {
+			results[i].Retries = retries
+		}
+		results[i].Committed = true
+	}
+	return results, nil
+}
+
+// failedTable returns the result of a table that failed as a whole
+func failedTable(tablePlan *TablePlan, err error) ExecutionResult {
+	return ExecutionResult{
+		TableName: tablePlan.Name,
+		Action:    tablePlan.Action,
+		Error:     err,
+	}
+}
+
+// failedChunk returns the result of a chunk that failed. Unless the table
+// runs without transactions, none of its rows were changed.
+func (e *Executor) failedChunk(tablePlan *TablePlan, chunk, rows int, err error) ExecutionResult {
+	return ExecutionResult{
+		TableName:   tablePlan.Name,
+		Action:      ActionAnonymize,
+		RowsScanned: int64(rows),
+		Transaction: tablePlan.Transaction,
+		Chunk:       chunk,
+		Error:       err,
+	}
+}
+
+// anonymizeRow computes the replacement values of the value strategy columns for a row
+func (e *Executor) anonymizeRow(tablePlan *TablePlan, row rowValues) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(row.values))
+	for _, column := range tablePlan.ValueColumns() {
+		// Shuffled values were drawn when the row was read
+		if _, ok := column.Strategy.(*ShuffleStrategy); ok {
+			values[column.Name] = row.shuffled[column.Name]
+			continue
+		}
+
+		value, err := anonymizeValue(e.mappings, column, row.values[column.Name], row.values)
+		if err != nil {
+			return nil, fmt.Errorf("failed to anonymize %s.%s: %w", tablePlan.Name, column.Name, err)
+		}
+		values[column.Name] = value
+	}
+	return values, nil
+}
+
+// anonymizeValue computes the replacement of an original value of a value
+// strategy column, with the values of the row columns of its table in row.
+// Columns of a consistency group share one original to fake mapping in
+// mappings.
+func anonymizeValue(mappings *MappingStore, column *ColumnPlan, original interface{}, row map[string]interface{}) (interface{}, error) {
+	anonymize := func() (interface{}, error) {
+		if strategy, ok := column.Strategy.(RowStrategy); ok {
+			return strategy.AnonymizeRow(original, row)
+		}
+		return column.Strategy.(ValueStrategy).Anonymize(original)
+	}
+	if column.ConsistencyGroup == "" || original == nil {
+		return anonymize()
+	}
+	return mappings.Resolve(column.ConsistencyGroup, fmt.Sprintf("%v", original), anonymize)
+}
+
+// rowColumnValues returns the values of the row columns of a table, read by
+// value at the positions of indexes
+func rowColumnValues(columns []string, indexes []int, value func(index int) interface{}) map[string]interface{} {
+	if len(columns) == 0 {
+		return nil
+	}
+	row := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		row[column] = value(indexes[i])
+	}
+	return row
+}
+
+// readShuffle reads the values of the shuffled columns of all rows of a
+// table in primary key order and shuffles them, or returns nil if the table
+// has no shuffled columns. Without a configured seed, the shuffle is random.
+func (e *Executor) readShuffle(ctx context.Context, tablePlan *TablePlan, tx *transaction) (*shuffler, error) {
+	shuffle, err := newShuffler(tablePlan)
+	if shuffle == nil || err != nil {
+		return nil, err
+	}
+
+	var lastKey []interface{}
+	read := 0
+	for {
+		rows, err := e.getNextRows(ctx, tablePlan, tx, lastKey, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			shuffle.add(row)
+			read++
+		}
+		if len(rows) < tablePlan.BatchSize {
+			break
+		}
+		lastKey = rows[len(rows)-1].primaryKey
+	}
+
+	seed := []byte(e.plan.Seed)
+	if len(seed) == 0 {
+		seed = make([]byte, 32)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, fmt.Errorf("failed to create seed: %w", err)
+		}
+	}
+	pooled, kept := shuffle.shuffle(seed)
+
+	e.logger.Info("Read values to shuffle", map[string]interface{}{
+		"table":  tablePlan.Name,
+		"rows":   read,
+		"pooled": pooled,
+	})
+	if kept > 0 {
+		e.logger.Warning("Table has a single row to shuffle, which keeps its values", map[string]interface{}{
+			"table": tablePlan.Name,
+		})
+	}
+	return shuffle, nil
+}
+
 // countRows counts the number of rows that will be anonymized
 func (e *Executor) countRows(tablePlan *TablePlan) (int64, error) {
 	sql := e.sqlGen.GenerateCountSQL(tablePlan)
 	var count int64
 	err := e.db.QueryRow(sql).Scan(&count)
+	if tablePlan.Limit > 0 && count > int64(tablePlan.Limit) {
+		count = int64(tablePlan.Limit)
+	}
 	return count, err
 }
 
-// getPrimaryKey gets the primary key column for a table
-func (e *Executor) getPrimaryKey(tableName string) (string, error) {
+// getPrimaryKey gets the primary key columns for a table
+func (e *Executor) getPrimaryKey(tableName string) ([]string, error) {
 	// First, check if the primary key is specified in the plan
 	for _, tablePlan := range e.plan.Tables {
-		if tablePlan.Name == tableName && tablePlan.PrimaryKey != "" {
+		if tablePlan.Name == tableName && len(tablePlan.PrimaryKey) > 0 {
 			return tablePlan.PrimaryKey, nil
 		}
 	}
 
-	// If not specified, fall back to "id" as a default
-	// This is a simplified implementation and might not work for all databases
-	// In a real implementation, you would query the database schema
-	return "id", nil
-}
-
-// getPrimaryKeyRange gets the min and max values of the primary key
-func (e *Executor) getPrimaryKeyRange(tablePlan *TablePlan) (int, int, error) {
-	sql := e.sqlGen.GeneratePrimaryKeyRangeSQL(tablePlan.Name, tablePlan.PrimaryKey, tablePlan.Where)
-	var min, max int
-	err := e.db.QueryRow(sql).Scan(&min, &max)
-	return min, max, err
+	// If not specified, read it from the database schema
+	return database.GetPrimaryKey(e.db, e.plan.Dialect.Driver(), tableName)
 }
 
-// getPrimaryKeysInRange gets all primary key values in the specified range
-func (e *Executor) getPrimaryKeysInRange(tablePlan *TablePlan, offset, chunkSize int) ([]int, error) {
-	// Generate SQL to get primary keys in range
-	sql := fmt.Sprintf(
-		"SELECT %s FROM %s WHERE %s >= %d AND %s < %d",
-		tablePlan.PrimaryKey,
-		tablePlan.Name,
-		tablePlan.PrimaryKey,
-		offset,
-		tablePlan.PrimaryKey,
-		offset+chunkSize,
-	)
+// getNextRows gets the next chunk of rows following lastKey in primary key
+// order, with the original values of the value strategy columns and of the
+// row columns of the table. A nil lastKey starts from the beginning of the
+// table, and rows after until are not read unless it is nil.
+func (e *Executor) getNextRows(ctx context.Context, tablePlan *TablePlan, tx *transaction, lastKey, until []interface{}) ([]rowValues, error) {
+	valueColumns := tablePlan.ValueColumns()
 
-	// Add additional WHERE clause if specified in the table plan
-	if tablePlan.Where != "" {
-		sql = fmt.Sprintf("%s AND %s", sql, tablePlan.Where)
+	columns := make([]string, 0, len(valueColumns))
+	for _, column := range valueColumns {
+		columns = append(columns, column.Name)
 	}
+	columns = append(columns, tablePlan.rowColumns()...)
 
 	// Execute the query
-	rows, err := e.db.Query(sql)
+	query, args := e.sqlGen.GenerateKeysetSelectSQL(tablePlan, columns, lastKey, until)
+	stmt, err := e.prepare(ctx, tx, query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	// Collect primary key values
-	var primaryKeys []int
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect primary key and original values
+	var result []rowValues
 	for rows.Next() {
-		var pk int
-		if err := rows.Scan(&pk); err != nil {
+		scanned := make([]interface{}, len(tablePlan.PrimaryKey)+len(columns))
+		dest := make([]interface{}, len(scanned))
+		for i := range scanned {
+			dest[i] = &scanned[i]
+		}
+
+		if err := rows.Scan(dest...); err != nil {
 			return nil, err
 		}
-		primaryKeys = append(primaryKeys, pk)
+
+		row := rowValues{
+			primaryKey: make([]interface{}, len(tablePlan.PrimaryKey)),
+			values:     make(map[string]interface{}, len(columns)),
+		}
+		for i := range tablePlan.PrimaryKey {
+			row.primaryKey[i] = normalizeKeyValue(scanned[i], columnTypes[i])
+		}
+		for i, column := range columns {
+			row.values[column] = normalizeValue(scanned[len(tablePlan.PrimaryKey)+i])
+		}
+		result = append(result, row)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return primaryKeys, nil
+	return result, nil
+}
+
+// prepare returns the prepared statement for query, preparing it on first
+// use. Chunks of the same size share one statement, so a table typically
+// prepares one statement for its full chunks and one for the last. Within a
+// transaction, statements already prepared for the table are bound to it, and
+// others are prepared in it for the length of the transaction.
+func (e *Executor) prepare(ctx context.Context, tx *transaction, query string) (*sql.Stmt, error) {
+	// The lock is not held while preparing, since a transaction holding the
+	// only connection may be waiting for it
+	e.statementsMutex.Lock()
+	prepared, ok := e.statements[query]
+	e.statementsMutex.Unlock()
+
+	if tx != nil {
+		if stmt, ok := tx.statements[query]; ok {
+			return stmt, nil
+		}
+
+		var stmt *sql.Stmt
+		if ok {
+			stmt = tx.tx.StmtContext(ctx, prepared)
+		} else {
+			var err error
+			stmt, err = tx.tx.PrepareContext(ctx, query)
+			if err != nil {
+				return nil, fmt.Errorf("failed to prepare statement: %w", err)
+			}
+		}
+		tx.statements[query] = stmt
+		return stmt, nil
+	}
+
+	if ok {
+		return prepared, nil
+	}
+
+	stmt, err := e.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+
+	e.statementsMutex.Lock()
+	defer e.statementsMutex.Unlock()
+
+	// Another worker may have prepared the same statement meanwhile
+	if prepared, ok := e.statements[query]; ok {
+		stmt.Close()
+		return prepared, nil
+	}
+	e.statements[query] = stmt
+	return stmt, nil
+}
+
+// closeStatements closes all prepared statements
+func (e *Executor) closeStatements() {
+	e.statementsMutex.Lock()
+	defer e.statementsMutex.Unlock()
+
+	for query, stmt := range e.statements {
+		stmt.Close()
+		delete(e.statements, query)
+	}
+}
+
+// normalizeValue converts driver specific representations of scanned values
+// into plain Go values
+func normalizeValue(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return value
+}
+
+// normalizeKeyValue normalizes a scanned primary key value. Values of binary
+// columns stay bytes, since a string does not match them in the WHERE clause
+// of the update.
+func normalizeKeyValue(value interface{}, columnType *sql.ColumnType) interface{} {
+	if isBinaryType(columnType.DatabaseTypeName()) {
+		return value
+	}
+	return normalizeValue(value)
+}
+
+// isBinaryType reports whether a database type name is a binary type
+func isBinaryType(typeName string) bool {
+	typeName = strings.ToUpper(typeName)
+	return strings.Contains(typeName, "BINARY") || strings.Contains(typeName, "BLOB") || typeName == "BYTEA" || typeName == "IMAGE"
 }
@@ -0,0 +1,359 @@
+package anonymizer
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/database"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+// openTestDatabase creates a SQLite database with a small shop schema
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := database.Connect(database.Config{
+		Driver: database.SQLite,
+		Name:   filepath.Join(t.TempDir(), "shop.db"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	statements := []string{
+		`CREATE TABLE customers (id INTEGER PRIMARY KEY, email TEXT, name TEXT, note TEXT)`,
+		`CREATE TABLE newsletter ("order" INTEGER PRIMARY KEY, email TEXT)`,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES customers (id), created_at TEXT)`,
+		`CREATE TABLE order_items (order_id INTEGER REFERENCES orders, sku TEXT, label TEXT, PRIMARY KEY (order_id, sku))`,
+		`CREATE TABLE sessions (id INTEGER PRIMARY KEY, token TEXT)`,
+		`INSERT INTO customers VALUES (1, 'jane@example.com', 'Jane', 'vip'), (2, 'john@example.com', 'John', NULL), (3, NULL, 'Nobody', 'x')`,
+		`INSERT INTO newsletter VALUES (1, 'john@example.com'), (2, 'someone@example.com')`,
+		`INSERT INTO orders VALUES (10, 1, '2019-05-01'), (11, 1, '2024-05-01'), (12, 2, '2024-06-01')`,
+		`INSERT INTO order_items VALUES (10, 'a', 'Old item'), (11, 'a', 'Item a'), (11, 'b', 'Item b'), (12, 'a', 'Item c'), (12, 'b', 'Item d')`,
+		`INSERT INTO sessions VALUES (1, 'secret'), (2, 'other')`,
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to set up database: %v", err)
+		}
+	}
+
+	return db
+}
+
+// testPlan creates the plan that anonymizes the test database
+func testPlan(t *testing.T) *AnonymizationPlan {
+	t.Helper()
+
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{Driver: "sqlite"},
+		Seed:     "test-seed",
+		Tables: map[string]config.TableConfig{
+			"customers": {
+				Columns: map[string]config.ColumnConfig{
+					"email": {Type: "faker.email", ConsistencyGroup: "email"},
+					"name":  {Value: "Jane Doe"},
+					"note":  {Null: true},
+				},
+			},
+			"newsletter": {
+				Columns: map[string]config.ColumnConfig{
+					"email": {Type: "faker.email", ConsistencyGroup: "email"},
+				},
+			},
+			"order_items": {
+				BatchSize: 2,
+				Columns: map[string]config.ColumnConfig{
+					"label": {Type: "faker.sentence"},
+				},
+			},
+			"orders": {
+				Delete: config.Bool(true),
+				Where:  "created_at < '2020-01-01'",
+			},
+			"sessions": {
+				Truncate: config.Bool(true),
+			},
+		},
+	}
+
+	plan, err := CreatePlan(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	return plan
+}
+
+// runTestPlan anonymizes the test database
+func runTestPlan(t *testing.T, db *sql.DB, dryRun bool) []ExecutionResult {
+	t.Helper()
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	executor := NewExecutor(db, testPlan(t), log, dryRun, 2, false, nil)
+	defer executor.Close()
+
+	results, err := executor.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	return results
+}
+
+// queryStrings returns the single column results of query
+func queryStrings(t *testing.T, db *sql.DB, query string) []sql.NullString {
+	t.Helper()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("Failed to query %s: %v", query, err)
+	}
+	defer rows.Close()
+
+	var values []sql.NullString
+	for rows.Next() {
+		var value sql.NullString
+		if err := rows.Scan(&value); err != nil {
+			t.Fatalf("Failed to scan %s: %v", query, err)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func TestExecutorSQLite(t *testing.T) {
+	db := openTestDatabase(t)
+	runTestPlan(t, db, false)
+
+	// Faker columns are replaced, NULL stays NULL, fixed values and nulls are set
+	customers := queryStrings(t, db, `SELECT email FROM customers ORDER BY id`)
+	if customers[0].String == "jane@example.com" || customers[1].String == "john@example.com" {
+		t.Errorf("Expected customer emails to be anonymized, got %v", customers)
+	}
+	if customers[2].Valid {
+		t.Errorf("Expected NULL email to stay NULL, got '%s'", customers[2].String)
+	}
+	for _, name := range queryStrings(t, db, `SELECT name FROM customers`) {
+		if name.String != "Jane Doe" {
+			t.Errorf("Expected name to be 'Jane Doe', got '%s'", name.String)
+		}
+	}
+	for _, note := range queryStrings(t, db, `SELECT note FROM customers`) {
+		if note.Valid {
+			t.Errorf("Expected note to be NULL, got '%s'", note.String)
+		}
+	}
+
+	// The consistency group maps john@example.com to the same fake email
+	newsletter := queryStrings(t, db, `SELECT email FROM newsletter ORDER BY "order"`)
+	if newsletter[0] != customers[1] {
+		t.Errorf("Expected newsletter email '%s' to match customer email '%s'", newsletter[0].String, customers[1].String)
+	}
+
+	// Old orders are deleted together with their items
+	orders := queryStrings(t, db, `SELECT id FROM orders ORDER BY id`)
+	if len(orders) != 2 || orders[0].String != "11" {
+		t.Errorf("Expected orders 11 and 12 to remain, got %v", orders)
+	}
+	labels := queryStrings(t, db, `SELECT label FROM order_items ORDER BY order_id, sku`)
+	if len(labels) != 4 {
+		t.Fatalf("Expected 4 order items to remain, got %d", len(labels))
+	}
+	for _, label := range labels {
+		if label.String == "Item a" || label.String == "Item b" || label.String == "Item c" || label.String == "Item d" {
+			t.Errorf("Expected order item labels to be anonymized, got '%s'", label.String)
+		}
+	}
+
+	// Truncated tables are empty
+	if sessions := queryStrings(t, db, `SELECT token FROM sessions`); len(sessions) != 0 {
+		t.Errorf("Expected sessions to be empty, got %v", sessions)
+	}
+}
+
+func TestExecutorSQLiteDryRun(t *testing.T) {
+	db := openTestDatabase(t)
+	results := runTestPlan(t, db, true)
+
+	// Nothing changes
+	if emails := queryStrings(t, db, `SELECT email FROM customers ORDER BY id`); emails[0].String != "jane@example.com" {
+		t.Errorf("Expected dry run to keep emails, got %v", emails)
+	}
+	if orders := queryStrings(t, db, `SELECT id FROM orders`); len(orders) != 3 {
+		t.Errorf("Expected dry run to keep orders, got %v", orders)
+	}
+	if sessions := queryStrings(t, db, `SELECT token FROM sessions`); len(sessions) != 2 {
+		t.Errorf("Expected dry run to keep sessions, got %v", sessions)
+	}
+
+	// The rows that would be deleted are counted per table
+	deleted := make(map[string]int64)
+	for _, result := range results {
+		if result.Action == ActionDelete {
+			deleted[result.TableName] = result.RowsAffected
+		}
+	}
+	if deleted["orders"] != 1 || deleted["order_items"] != 1 {
+		t.Errorf("Expected one order and one order item to be deleted, got %v", deleted)
+	}
+}
+
+func TestExecutorSQLiteBinaryKey(t *testing.T) {
+	db := openTestDatabase(t)
+	statements := []string{
+		`CREATE TABLE tokens (id BLOB PRIMARY KEY, label TEXT)`,
+		`INSERT INTO tokens VALUES (x'00ff', 'first'), (x'0102', 'second'), (x'ff00', 'third')`,
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to set up database: %v", err)
+		}
+	}
+
+	plan, err := CreatePlan(&config.Config{
+		Database: config.DatabaseConfig{Driver: "sqlite"},
+		Tables: map[string]config.TableConfig{
+			"tokens": {
+				BatchSize: 2,
+				Columns: map[string]config.ColumnConfig{
+					"label": {Value: "anonymized"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	executor := NewExecutor(db, plan, log, false, 2, true, nil)
+	defer executor.Close()
+	if _, err := executor.Execute(context.Background()); err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+
+	// Rows are matched by their binary key, not by its text
+	for _, label := range queryStrings(t, db, `SELECT label FROM tokens`) {
+		if label.String != "anonymized" {
+			t.Errorf("Expected label to be 'anonymized', got '%s'", label.String)
+		}
+	}
+}
+
+func TestExecutorSQLiteSelfReference(t *testing.T) {
+	db := openTestDatabase(t)
+	statements := []string{
+		`CREATE TABLE order_lines (id INTEGER PRIMARY KEY, order_id INTEGER REFERENCES orders, parent_line_id INTEGER REFERENCES order_lines)`,
+		`INSERT INTO order_lines VALUES (1, 10, NULL), (2, 10, 1), (3, 11, 2), (4, 11, 3)`,
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to set up database: %v", err)
+		}
+	}
+
+	runTestPlan(t, db, false)
+
+	// The lines of the deleted order are gone, and the line referencing
+	// them is unlinked
+	lines := queryStrings(t, db, `SELECT id || ':' || COALESCE(parent_line_id, '') FROM order_lines ORDER BY id`)
+	if len(lines) != 2 || lines[0].String != "3:" || lines[1].String != "4:3" {
+		t.Errorf("Expected lines 3 and 4 to remain with line 3 unlinked, got %v", lines)
+	}
+}
+
+func TestExecutorSQLiteLimit(t *testing.T) {
+	db := openTestDatabase(t)
+
+	// The faker column is anonymized in chunks, which only read the limited
+	// rows
+	plan, err := CreatePlan(&config.Config{
+		Database: config.DatabaseConfig{Driver: "sqlite"},
+		Tables: map[string]config.TableConfig{
+			"customers": {
+				BatchSize: 1,
+				Limit:     2,
+				OrderBy:   "id DESC",
+				Columns: map[string]config.ColumnConfig{
+					"name": {Type: "faker.sentence"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	executor := NewExecutor(db, plan, log, false, 2, false, nil)
+	defer executor.Close()
+	if _, err := executor.Execute(context.Background()); err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+
+	names := queryStrings(t, db, `SELECT name FROM customers ORDER BY id`)
+	if names[0].String != "Jane" || names[1].String == "John" || names[2].String == "Nobody" {
+		t.Errorf("Expected only the last 2 customers to be anonymized, got %v", names)
+	}
+}
+
+func TestExecutorSQLiteFailure(t *testing.T) {
+	for _, failFast := range []bool{false, true} {
+		db := openTestDatabase(t)
+		if _, err := db.Exec(`CREATE TRIGGER keep_sessions BEFORE DELETE ON sessions BEGIN SELECT RAISE(ABORT, 'sessions are kept'); END`); err != nil {
+			t.Fatalf("Failed to create trigger: %v", err)
+		}
+
+		log, err := logger.NewLogger(t.TempDir(), false)
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+		defer log.Close()
+
+		executor := NewExecutor(db, testPlan(t), log, false, 2, failFast, nil)
+		defer executor.Close()
+
+		results, err := executor.Execute(context.Background())
+		if failFast && err == nil {
+			t.Errorf("Expected fail fast to stop the run with an error")
+		}
+		if !failFast && err != nil {
+			t.Errorf("Expected the run to continue after the failed table, got %v", err)
+		}
+
+		// The failed table is reported with its error
+		var failed []ExecutionResult
+		for _, result := range results {
+			if result.Error != nil {
+				failed = append(failed, result)
+			}
+		}
+		if len(failed) != 1 || failed[0].TableName != "sessions" || failed[0].Action != ActionTruncate {
+			t.Errorf("Expected the truncation of sessions to fail, got %+v", failed)
+		}
+
+		// Without fail fast, the tables after it are still anonymized
+		emails := queryStrings(t, db, `SELECT email FROM customers WHERE id = 1`)
+		if anonymized := emails[0].String != "jane@example.com"; anonymized == failFast {
+			t.Errorf("Expected customers to be anonymized %v with fail fast %v", !failFast, failFast)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package anonymizer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+
+	"db-gdpr-anonymizer/internal/fpe"
+)
+
+// fpeParams lists the parameters accepted by the fpe strategy
+var fpeParams = map[string]bool{
+	"alphabet": true,
+	"radix":    true,
+	"tweak":    true,
+}
+
+// fpeDigits are the characters of the alphabets selected by radix
+const fpeDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// FPEStrategy encrypts values with FF1 format-preserving encryption, so that
+// the characters of the alphabet are replaced by characters of the same
+// alphabet and the value keeps its length. Characters outside the alphabet,
+// such as separators, are kept in place. Unlike hashes, encrypted values can
+// be decrypted with the key by Detokenize.
+type FPEStrategy struct {
+	Alphabet []rune
+	Tweak    []byte
+	cipher   *fpe.FF1
+}
+
+// newFPEStrategy creates an fpe strategy from its params and the AES key,
+// written as 32, 48 or 64 hexadecimal characters
+func newFPEStrategy(key []byte, params map[string]interface{}) (*FPEStrategy, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("fpe strategy requires fpe_key")
+	}
+	aesKey, err := hex.DecodeString(string(key))
+	if err != nil {
+		return nil, fmt.Errorf("fpe_key must be hexadecimal: %w", err)
+	}
+	if len(aesKey) != 16 && len(aesKey) != 24 && len(aesKey) != 32 {
+		return nil, fmt.Errorf("fpe_key must be 32, 48 or 64 hexadecimal characters, got %d", len(key))
+	}
+
+	if err := checkParams("fpe", fpeParams, params); err != nil {
+		return nil, err
+	}
+
+	strategy := &FPEStrategy{Alphabet: []rune(fpeDigits[:10])}
+	_, hasAlphabet := params["alphabet"]
+	_, hasRadix := params["radix"]
+	if hasAlphabet && hasRadix {
+		return nil, fmt.Errorf("params alphabet and radix of fpe strategy cannot be combined")
+	}
+
+	if radix, ok := params["radix"]; ok {
+		value, ok := intParam(radix)
+		if !ok || value < 2 || value > len(fpeDigits) {
+			return nil, fmt.Errorf("param radix of fpe strategy must be between 2 and %d, got %v", len(fpeDigits), radix)
+		}
+		strategy.Alphabet = []rune(fpeDigits[:value])
+	}
+
+	if alphabet, ok := params["alphabet"]; ok {
+		value, ok := alphabet.(string)
+		if !ok || utf8.RuneCountInString(value) < 2 {
+			return nil, fmt.Errorf("param alphabet of fpe strategy must be a string of at least 2 characters, got %v", alphabet)
+		}
+		seen := make(map[rune]bool)
+		for _, c := range value {
+			if seen[c] {
+				return nil, fmt.Errorf("param alphabet of fpe strategy contains %q more than once", c)
+			}
+			seen[c] = true
+		}
+		strategy.Alphabet = []rune(value)
+	}
+
+	if tweak, ok := params["tweak"]; ok {
+		value, ok := tweak.(string)
+		if !ok {
+			return nil, fmt.Errorf("param tweak of fpe strategy must be a string")
+		}
+		strategy.Tweak = []byte(value)
+	}
+
+	strategy.cipher, err = fpe.NewFF1(aesKey, len(strategy.Alphabet))
+	if err != nil {
+		return nil, err
+	}
+	return strategy, nil
+}
+
+// GenerateSQL implements AnonymizationStrategy.GenerateSQL. Encrypted values
+// are computed per row and bound as parameters by GenerateBatchUpdateSQL; as
+// an expression on its own, the strategy keeps the column unchanged.
+func (s *FPEStrategy) GenerateSQL(tableName, columnName string) string {
+	return columnName
+}
+
+// GetType implements AnonymizationStrategy.GetType
+func (s *FPEStrategy) GetType() string {
+	return "fpe"
+}
+
+// Anonymize implements ValueStrategy.Anonymize. NULL values are kept as NULL.
+func (s *FPEStrategy) Anonymize(original interface{}) (interface{}, error) {
+	if original == nil {
+		return nil, nil
+	}
+	return s.transform(fmt.Sprintf("%v", original), s.cipher.Encrypt)
+}
+
+// Detokenize decrypts a value encrypted by the strategy with the same key,
+// alphabet and tweak
+func (s *FPEStrategy) Detokenize(value string) (string, error) {
+	return s.transform(value, s.cipher.Decrypt)
+}
+
+// transform encrypts or decrypts the characters of the alphabet in a value,
+// keeping the other characters in place
+func (s *FPEStrategy) transform(value string, cipher func(numerals []int, tweak []byte) ([]int, error)) (string, error) {
+	characters := []rune(value)
+
+	positions := make([]int, 0, len(characters))
+	numerals := make([]int, 0, len(characters))
+	for i, c := range characters {
+		if numeral := s.numeral(c); numeral >= 0 {
+			positions = append(positions, i)
+			numerals = append(numerals, numeral)
+		}
+	}
+	if len(numerals) < s.cipher.MinLength() {
+		return "", fmt.Errorf("fpe strategy requires at least %d characters of the alphabet %s, got %d", s.cipher.MinLength(), string(s.Alphabet), len(numerals))
+	}
+
+	result, err := cipher(numerals, s.Tweak)
+	if err != nil {
+		return "", err
+	}
+	for i, position := range positions {
+		characters[position] = s.Alphabet[result[i]]
+	}
+	return string(characters), nil
+}
+
+// numeral returns the position of a character in the alphabet, or -1 if the
+// character is not part of it
+func (s *FPEStrategy) numeral(c rune) int {
+	for i, a := range s.Alphabet {
+		if a == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindFPEStrategy returns the fpe strategy of a column of the plan, to
+// detokenize its values
+func FindFPEStrategy(plan *AnonymizationPlan, tableName, columnName string) (*FPEStrategy, error) {
+	for _, table := range plan.Tables {
+		if table.Name != tableName {
+			continue
+		}
+		for _, column := range table.Columns {
+			if column.Name != columnName {
+				continue
+			}
+			strategy, ok := column.Strategy.(*FPEStrategy)
+			if !ok {
+				return nil, fmt.Errorf("column %s.%s uses the %s strategy, not fpe", tableName, columnName, column.Strategy.GetType())
+			}
+			return strategy, nil
+		}
+		return nil, fmt.Errorf("column %s.%s is not configured", tableName, columnName)
+	}
+	return nil, fmt.Errorf("table %s is not configured", tableName)
+}
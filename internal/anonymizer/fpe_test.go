@@ -0,0 +1,154 @@
+package anonymizer
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"db-gdpr-anonymizer/internal/config"
+)
+
+func TestFPEStrategy(t *testing.T) {
+	key := []byte("2b7e151628aed2a6abf7158809cf4f3c")
+
+	tests := []struct {
+		params   map[string]interface{}
+		original interface{}
+		pattern  string
+	}{
+		// Customer numbers keep their digits and separators
+		{nil, "100-000-123", `^\d{3}-\d{3}-\d{3}$`},
+		{nil, int64(4711000042), `^\d{10}$`},
+		// Loyalty IDs keep their prefix outside the alphabet
+		{map[string]interface{}{"alphabet": "0123456789ABCDEFGHJKLMNPQRSTUVWXYZ"}, "ly-7K3Q9ZP2", `^ly-[0-9A-HJ-NP-Z]{8}$`},
+		{map[string]interface{}{"radix": uint64(16), "tweak": "orders"}, "deadbeef00", `^[0-9a-f]{10}$`},
+	}
+
+	for _, test := range tests {
+		strategy, err := newFPEStrategy(key, test.params)
+		if err != nil {
+			t.Fatalf("Failed to create fpe strategy with %v: %v", test.params, err)
+		}
+
+		value, err := strategy.Anonymize(test.original)
+		if err != nil {
+			t.Fatalf("Failed to encrypt %v: %v", test.original, err)
+		}
+		if !regexp.MustCompile(test.pattern).MatchString(value.(string)) {
+			t.Errorf("Expected %v encrypted with %v to match %s, got %s", test.original, test.params, test.pattern, value)
+		}
+		if value == test.original {
+			t.Errorf("Expected %v to change", test.original)
+		}
+
+		// Equal values encrypt equally and decrypt to the original
+		again, _ := strategy.Anonymize(test.original)
+		if again != value {
+			t.Errorf("Expected equal values to encrypt equally, got %s and %s", value, again)
+		}
+		original, err := strategy.Detokenize(value.(string))
+		if err != nil {
+			t.Fatalf("Failed to detokenize %s: %v", value, err)
+		}
+		if expected := fmt.Sprintf("%v", test.original); original != expected {
+			t.Errorf("Expected %s to detokenize to %s, got %s", value, expected, original)
+		}
+	}
+
+	// The tweak changes the encryption
+	plain, _ := newFPEStrategy(key, nil)
+	tweaked, _ := newFPEStrategy(key, map[string]interface{}{"tweak": "customers"})
+	plainValue, _ := plain.Anonymize("0123456789")
+	tweakedValue, _ := tweaked.Anonymize("0123456789")
+	if plainValue == tweakedValue {
+		t.Errorf("Expected the tweak to change the encryption, got %s", plainValue)
+	}
+
+	// FF1 sample of NIST SP 800-38G
+	if plainValue != "2433477484" {
+		t.Errorf("Expected 0123456789 to encrypt to 2433477484, got %s", plainValue)
+	}
+
+	// NULL stays NULL
+	if value, err := plain.Anonymize(nil); value != nil || err != nil {
+		t.Errorf("Expected NULL to stay NULL, got %v, %v", value, err)
+	}
+
+	// Values with fewer than a million possible values are not encrypted
+	if _, err := plain.Anonymize("12-345"); err == nil {
+		t.Error("Expected error for 5 digits, got nil")
+	}
+}
+
+func TestNewFPEStrategyErrors(t *testing.T) {
+	key := []byte("2b7e151628aed2a6abf7158809cf4f3c")
+
+	for _, invalidKey := range []string{"", "secret", "2b7e151628aed2a6"} {
+		if _, err := newFPEStrategy([]byte(invalidKey), nil); err == nil {
+			t.Errorf("Expected error for key '%s', got nil", invalidKey)
+		}
+	}
+
+	invalid := []map[string]interface{}{
+		{"radix": 1},
+		{"radix": 37},
+		{"radix": "10"},
+		{"alphabet": "a"},
+		{"alphabet": "abca"},
+		{"alphabet": "abc", "radix": 3},
+		{"tweak": 42},
+		{"mode": "ff3"},
+	}
+	for _, params := range invalid {
+		if _, err := newFPEStrategy(key, params); err == nil {
+			t.Errorf("Expected error for params %v, got nil", params)
+		}
+	}
+}
+
+func TestFindFPEStrategy(t *testing.T) {
+	cfg := &config.Config{
+		FPEKey: config.KeyConfig{Value: "2b7e151628aed2a6abf7158809cf4f3c"},
+		Converters: map[string]config.ConverterConfig{
+			"loyalty_id": {Type: "fpe", Params: map[string]interface{}{"radix": 36}},
+		},
+		Tables: map[string]config.TableConfig{
+			"customer_entity": {
+				Columns: map[string]config.ColumnConfig{
+					"customer_number": {Type: "fpe"},
+					"loyalty_id":      {Converter: "loyalty_id"},
+					"email":           {Null: true},
+				},
+			},
+		},
+	}
+
+	plan, err := CreatePlan(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+
+	strategy, err := FindFPEStrategy(plan, "customer_entity", "loyalty_id")
+	if err != nil {
+		t.Fatalf("Failed to find fpe strategy: %v", err)
+	}
+	if len(strategy.Alphabet) != 36 {
+		t.Errorf("Expected an alphabet of 36 characters, got %s", string(strategy.Alphabet))
+	}
+
+	if _, err := FindFPEStrategy(plan, "customer_entity", "email"); err == nil {
+		t.Error("Expected error for a column without fpe strategy, got nil")
+	}
+	if _, err := FindFPEStrategy(plan, "customer_entity", "missing"); err == nil {
+		t.Error("Expected error for a missing column, got nil")
+	}
+	if _, err := FindFPEStrategy(plan, "sales_order", "customer_number"); err == nil {
+		t.Error("Expected error for a missing table, got nil")
+	}
+
+	// The fpe strategy requires a key
+	cfg.FPEKey = config.KeyConfig{}
+	if _, err := CreatePlan(cfg); err == nil {
+		t.Error("Expected error for fpe strategy without key, got nil")
+	}
+}
@@ -0,0 +1,249 @@
+package anonymizer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"db-gdpr-anonymizer/internal/config"
+)
+
+// Hash encodings
+const (
+	// EncodingHex encodes hashes as lowercase hexadecimal, 64 characters
+	EncodingHex = "hex"
+	// EncodingBase32 encodes hashes as lowercase base32 without padding, 52
+	// characters
+	EncodingBase32 = "base32"
+)
+
+// hashParams lists the parameters accepted by the hash strategy
+var hashParams = map[string]bool{
+	"encoding": true,
+	"length":   true,
+	"template": true,
+}
+
+// hashPlaceholder matches {hash} and {hash:N} in hash templates
+var hashPlaceholder = regexp.MustCompile(`\{hash(?::(\d+))?\}`)
+
+// base32Encoding is the lowercase RFC 4648 alphabet without padding, so that
+// hashes fit into email addresses and identifiers
+var base32Encoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// HashStrategy replaces values by a keyed HMAC-SHA256 of the original value.
+// Equal values hash equally across tables and runs with the same key, so
+// distinct values can still be counted and joined, while the key keeps
+// values from being recovered by hashing guesses.
+type HashStrategy struct {
+	Key      []byte
+	Encoding string
+	// Length truncates the encoded hash, if set
+	Length int
+	// Template formats the hash, if set, replacing {hash} with the encoded
+	// hash and {hash:N} with its first N characters
+	Template string
+}
+
+// newHashStrategy creates a hash strategy from its params
+func newHashStrategy(key []byte, params map[string]interface{}) (*HashStrategy, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("hash strategy requires hash_key")
+	}
+
+	if err := checkParams("hash", hashParams, params); err != nil {
+		return nil, err
+	}
+
+	strategy := &HashStrategy{Key: key, Encoding: EncodingHex}
+	if encoding, ok := params["encoding"]; ok {
+		value, ok := encoding.(string)
+		if !ok || (value != EncodingHex && value != EncodingBase32) {
+			return nil, fmt.Errorf("param encoding of hash strategy must be hex or base32, got %v", encoding)
+		}
+		strategy.Encoding = value
+	}
+
+	fullLength := strategy.encodedLength()
+	if length, ok := params["length"]; ok {
+		value, ok := intParam(length)
+		if !ok || value < 1 || value > fullLength {
+			return nil, fmt.Errorf("param length of hash strategy must be between 1 and %d, got %v", fullLength, length)
+		}
+		strategy.Length = value
+	}
+
+	if template, ok := params["template"]; ok {
+		value, ok := template.(string)
+		if !ok {
+			return nil, fmt.Errorf("param template of hash strategy must be a string")
+		}
+		matches := hashPlaceholder.FindAllStringSubmatch(value, -1)
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("template %s of hash strategy must contain {hash} or {hash:N}", value)
+		}
+		for _, match := range matches {
+			if match[1] == "" {
+				continue
+			}
+			if n, err := strconv.Atoi(match[1]); err != nil || n < 1 || n > fullLength {
+				return nil, fmt.Errorf("template %s of hash strategy: %s must take between 1 and %d characters", value, match[0], fullLength)
+			}
+		}
+		strategy.Template = value
+	}
+
+	return strategy, nil
+}
+
+// GenerateSQL implements AnonymizationStrategy.GenerateSQL. Hashes are
+// computed per row and bound as parameters by GenerateBatchUpdateSQL; as an
+// expression on its own, the strategy keeps the column unchanged.
+func (s *HashStrategy) GenerateSQL(tableName, columnName string) string {
+	return columnName
+}
+
+// GetType implements AnonymizationStrategy.GetType
+func (s *HashStrategy) GetType() string {
+	return "hash"
+}
+
+// Anonymize implements ValueStrategy.Anonymize. NULL values are kept as NULL.
+func (s *HashStrategy) Anonymize(original interface{}) (interface{}, error) {
+	if original == nil {
+		return nil, nil
+	}
+
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(fmt.Sprintf("%v", original)))
+	sum := mac.Sum(nil)
+
+	var encoded string
+	if s.Encoding == EncodingBase32 {
+		encoded = base32Encoding.EncodeToString(sum)
+	} else {
+		encoded = hex.EncodeToString(sum)
+	}
+	if s.Length > 0 {
+		encoded = encoded[:s.Length]
+	}
+
+	if s.Template == "" {
+		return encoded, nil
+	}
+	return hashPlaceholder.ReplaceAllStringFunc(s.Template, func(placeholder string) string {
+		match := hashPlaceholder.FindStringSubmatch(placeholder)
+		if match[1] == "" {
+			return encoded
+		}
+		n, _ := strconv.Atoi(match[1])
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		return encoded[:n]
+	}), nil
+}
+
+// pattern returns a regular expression matching the values of the strategy
+func (s *HashStrategy) pattern() *regexp.Regexp {
+	alphabet := "[0-9a-f]"
+	if s.Encoding == EncodingBase32 {
+		alphabet = "[a-z2-7]"
+	}
+	length := s.Length
+	if length == 0 {
+		length = s.encodedLength()
+	}
+	hash := fmt.Sprintf("%s{%d}", alphabet, length)
+
+	if s.Template == "" {
+		return regexp.MustCompile("^" + hash + "$")
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, match := range hashPlaceholder.FindAllStringSubmatchIndex(s.Template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(s.Template[last:match[0]]))
+		last = match[1]
+		if match[2] == -1 {
+			pattern.WriteString(hash)
+			continue
+		}
+		n, _ := strconv.Atoi(s.Template[match[2]:match[3]])
+		if n > length {
+			n = length
+		}
+		pattern.WriteString(fmt.Sprintf("%s{%d}", alphabet, n))
+	}
+	pattern.WriteString(regexp.QuoteMeta(s.Template[last:]))
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
+
+// encodedLength returns the length of a hash in the encoding of the strategy
+func (s *HashStrategy) encodedLength() int {
+	if s.Encoding == EncodingBase32 {
+		return base32Encoding.EncodedLen(sha256.Size)
+	}
+	return hex.EncodedLen(sha256.Size)
+}
+
+// loadKey returns a secret key from its value or file. Keys read from files
+// have a trailing newline removed. A key that is not configured is empty.
+func loadKey(key config.KeyConfig) ([]byte, error) {
+	if key.File == "" {
+		return []byte(key.Value), nil
+	}
+
+	data, err := os.ReadFile(key.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	data = []byte(strings.TrimRight(string(data), "\r\n"))
+	if len(data) == 0 {
+		return nil, fmt.Errorf("key file %s is empty", key.File)
+	}
+	return data, nil
+}
+
+// checkParams rejects params of a strategy that are not allowed, naming the
+// first unsupported param in alphabetical order
+func checkParams(strategy string, allowed map[string]bool, params map[string]interface{}) error {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !allowed[name] {
+			return fmt.Errorf("%s strategy does not support param %s", strategy, name)
+		}
+	}
+	return nil
+}
+
+// intParam returns the value of an integer param, which is decoded as an
+// integer or a float depending on the configuration format
+func intParam(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,150 @@
+package anonymizer
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"db-gdpr-anonymizer/internal/config"
+)
+
+func TestHashStrategy(t *testing.T) {
+	key := []byte("secret")
+
+	tests := []struct {
+		params  map[string]interface{}
+		pattern string
+	}{
+		{nil, `^[0-9a-f]{64}$`},
+		{map[string]interface{}{"encoding": "base32"}, `^[a-z2-7]{52}$`},
+		{map[string]interface{}{"length": uint64(12)}, `^[0-9a-f]{12}$`},
+		{map[string]interface{}{"encoding": "base32", "length": 10.0}, `^[a-z2-7]{10}$`},
+		{map[string]interface{}{"template": "user_{hash:8}@example.test"}, `^user_[0-9a-f]{8}@example\.test$`},
+		{map[string]interface{}{"template": "{hash:4}-{hash}", "length": 6}, `^[0-9a-f]{4}-[0-9a-f]{6}$`},
+	}
+
+	for _, test := range tests {
+		strategy, err := newHashStrategy(key, test.params)
+		if err != nil {
+			t.Fatalf("Failed to create hash strategy with %v: %v", test.params, err)
+		}
+
+		value, err := strategy.Anonymize("jane@example.com")
+		if err != nil {
+			t.Fatalf("Failed to hash: %v", err)
+		}
+		if !regexp.MustCompile(test.pattern).MatchString(value.(string)) {
+			t.Errorf("Expected a hash matching %s with %v, got %s", test.pattern, test.params, value)
+		}
+		if !strategy.pattern().MatchString(value.(string)) {
+			t.Errorf("Expected the strategy pattern %s to match %s", strategy.pattern(), value)
+		}
+
+		// Equal values hash equally
+		again, _ := strategy.Anonymize("jane@example.com")
+		if again != value {
+			t.Errorf("Expected equal values to hash equally, got %s and %s", value, again)
+		}
+		other, _ := strategy.Anonymize("john@example.com")
+		if other == value {
+			t.Errorf("Expected different values to hash differently, got %s", other)
+		}
+	}
+
+	// The hash depends on the key
+	first, _ := newHashStrategy([]byte("first"), nil)
+	second, _ := newHashStrategy([]byte("second"), nil)
+	firstValue, _ := first.Anonymize(42)
+	secondValue, _ := second.Anonymize(42)
+	if firstValue == secondValue {
+		t.Errorf("Expected different keys to hash differently, got %s", firstValue)
+	}
+
+	// HMAC-SHA256 of "42" with the key "first"
+	if firstValue != "28206f1717add41f5ad8a603d375a02866b09841b5ffb32f6466cb49ee67e9f6" {
+		t.Errorf("Expected the HMAC-SHA256 of 42, got %s", firstValue)
+	}
+
+	// NULL stays NULL
+	if value, err := first.Anonymize(nil); value != nil || err != nil {
+		t.Errorf("Expected NULL to stay NULL, got %v, %v", value, err)
+	}
+}
+
+func TestNewHashStrategyErrors(t *testing.T) {
+	key := []byte("secret")
+
+	if _, err := newHashStrategy(nil, nil); err == nil {
+		t.Error("Expected error for missing key, got nil")
+	}
+
+	invalid := []map[string]interface{}{
+		{"encoding": "base64"},
+		{"length": 0},
+		{"length": 65},
+		{"encoding": "base32", "length": 53},
+		{"length": "8"},
+		{"template": "user@example.test"},
+		{"template": "user_{hash:99}"},
+		{"salt": "x"},
+	}
+	for _, params := range invalid {
+		if _, err := newHashStrategy(key, params); err == nil {
+			t.Errorf("Expected error for params %v, got nil", params)
+		}
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hash.key")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+
+	if key, err := loadKey(config.KeyConfig{File: path}); err != nil || string(key) != "from-file" {
+		t.Errorf("Expected the key from the file without newline, got '%s', %v", key, err)
+	}
+	if key, err := loadKey(config.KeyConfig{Value: "from-value"}); err != nil || string(key) != "from-value" {
+		t.Errorf("Expected the key value, got '%s', %v", key, err)
+	}
+	if key, err := loadKey(config.KeyConfig{}); err != nil || len(key) != 0 {
+		t.Errorf("Expected no key, got '%s', %v", key, err)
+	}
+	if _, err := loadKey(config.KeyConfig{File: filepath.Join(t.TempDir(), "missing.key")}); err == nil {
+		t.Error("Expected error for missing key file, got nil")
+	}
+}
+
+func TestCreatePlanHash(t *testing.T) {
+	cfg := &config.Config{
+		HashKey: config.KeyConfig{Value: "secret"},
+		Converters: map[string]config.ConverterConfig{
+			"pseudonym": {Type: "hash", Params: map[string]interface{}{"template": "user_{hash:8}@example.test"}},
+		},
+		Tables: map[string]config.TableConfig{
+			"customer_entity": {
+				Columns: map[string]config.ColumnConfig{
+					"email": {Converter: "pseudonym"},
+					"ref":   {Type: "hash"},
+				},
+			},
+		},
+	}
+
+	plan, err := CreatePlan(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	for _, column := range plan.Tables[0].Columns {
+		if _, ok := column.Strategy.(*HashStrategy); !ok {
+			t.Errorf("Expected a hash strategy for %s, got %T", column.Name, column.Strategy)
+		}
+	}
+
+	// The hash strategy requires a key
+	cfg.HashKey = config.KeyConfig{}
+	if _, err := CreatePlan(cfg); err == nil {
+		t.Error("Expected error for hash strategy without key, got nil")
+	}
+}
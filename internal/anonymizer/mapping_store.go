@@ -0,0 +1,225 @@
+package anonymizer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultMappingMemoryEntries is the number of mappings kept in memory before
+// the mapping store spills to disk
+const defaultMappingMemoryEntries = 1000000
+
+func init() {
+	// Register the value types strategies produce so they can be spilled
+	gob.Register(time.Time{})
+}
+
+// mappingKey identifies an original value within a consistency group
+type mappingKey [16]byte
+
+// spilledValue is the on-disk record of a mapped value
+type spilledValue struct {
+	Value interface{}
+}
+
+// MappingStore holds the original to pseudonym mapping of each consistency
+// group. Mappings are kept in memory up to a limit; beyond that, the mapped
+// values are moved to a temporary spill file and only a keyed digest of each
+// original value and the offset of its record stay in memory. Original values
+// are never written to disk.
+type MappingStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	spillDir   string
+	key        []byte
+	memory     map[mappingKey]interface{}
+	spilled    map[mappingKey]int64
+	spillFile  *os.File
+	spillSize  int64
+	distinct   map[string]int64
+}
+
+// NewMappingStore creates a new mapping store that keeps up to maxEntries
+// mappings in memory and spills the rest to a file in spillDir
+func NewMappingStore(maxEntries int, spillDir string) (*MappingStore, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to create mapping store key: %w", err)
+	}
+
+	return &MappingStore{
+		maxEntries: maxEntries,
+		spillDir:   spillDir,
+		key:        key,
+		memory:     make(map[mappingKey]interface{}),
+		spilled:    make(map[mappingKey]int64),
+		distinct:   make(map[string]int64),
+	}, nil
+}
+
+// Resolve returns the value mapped to original in group. If original has no
+// mapping yet, generate is called to create it.
+func (s *MappingStore) Resolve(group, original string, generate func() (interface{}, error)) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := s.digest(group, original)
+
+	if value, ok := s.memory[key]; ok {
+		return value, nil
+	}
+	if offset, ok := s.spilled[key]; ok {
+		return s.readSpilled(offset)
+	}
+
+	value, err := generate()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.memory) >= s.maxEntries {
+		if err := s.spill(); err != nil {
+			return nil, err
+		}
+	}
+	s.memory[key] = value
+	s.distinct[group]++
+
+	return value, nil
+}
+
+// DistinctValues returns the number of distinct original values mapped in each group
+func (s *MappingStore) DistinctValues() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int64, len(s.distinct))
+	for group, count := range s.distinct {
+		counts[group] = count
+	}
+	return counts
+}
+
+// Close removes the spill file, if any
+func (s *MappingStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.spillFile == nil {
+		return nil
+	}
+
+	name := s.spillFile.Name()
+	if err := s.spillFile.Close(); err != nil {
+		return err
+	}
+	s.spillFile = nil
+	return os.Remove(name)
+}
+
+// digest computes the keyed digest identifying original within group
+func (s *MappingStore) digest(group, original string) mappingKey {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(group))
+	mac.Write([]byte{0})
+	mac.Write([]byte(original))
+
+	var key mappingKey
+	copy(key[:], mac.Sum(nil))
+	return key
+}
+
+// spill moves all in-memory mappings to the spill file
+func (s *MappingStore) spill() error {
+	if s.spillFile == nil {
+		file, err := os.CreateTemp(s.spillDir, "anonymizer-mapping-*.bin")
+		if err != nil {
+			return fmt.Errorf("failed to create mapping spill file: %w", err)
+		}
+		s.spillFile = file
+	}
+
+	var buf bytes.Buffer
+	for key, value := range s.memory {
+		buf.Reset()
+		buf.Write(make([]byte, 4))
+		if err := gob.NewEncoder(&buf).Encode(spilledValue{Value: value}); err != nil {
+			return fmt.Errorf("failed to encode mapped value: %w", err)
+		}
+		record := buf.Bytes()
+		binary.BigEndian.PutUint32(record[:4], uint32(len(record)-4))
+
+		if _, err := s.spillFile.WriteAt(record, s.spillSize); err != nil {
+			return fmt.Errorf("failed to write mapping spill file: %w", err)
+		}
+		s.spilled[key] = s.spillSize
+		s.spillSize += int64(len(record))
+	}
+
+	s.memory = make(map[mappingKey]interface{})
+	return nil
+}
+
+// readSpilled reads the mapped value stored at offset in the spill file
+func (s *MappingStore) readSpilled(offset int64) (interface{}, error) {
+	header := make([]byte, 4)
+	if _, err := s.spillFile.ReadAt(header, offset); err != nil {
+		return nil, fmt.Errorf("failed to read mapping spill file: %w", err)
+	}
+
+	record := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := s.spillFile.ReadAt(record, offset+4); err != nil {
+		return nil, fmt.Errorf("failed to read mapping spill file: %w", err)
+	}
+
+	var spilled spilledValue
+	if err := gob.NewDecoder(bytes.NewReader(record)).Decode(&spilled); err != nil {
+		return nil, fmt.Errorf("failed to decode mapped value: %w", err)
+	}
+	return spilled.Value, nil
+}
+
+// ConsistencyGroupResult describes a consistency group after execution
+type ConsistencyGroupResult struct {
+	Name           string
+	Columns        []string
+	DistinctValues int64
+}
+
+// consistencyGroups lists the consistency groups of the plan with the
+// number of distinct values mapped in each
+func consistencyGroups(plan *AnonymizationPlan, store *MappingStore) []ConsistencyGroupResult {
+	columns := make(map[string][]string)
+	for _, tablePlan := range plan.Tables {
+		for _, column := range tablePlan.Columns {
+			if column.ConsistencyGroup != "" {
+				columns[column.ConsistencyGroup] = append(columns[column.ConsistencyGroup], tablePlan.Name+"."+column.Name)
+			}
+		}
+	}
+
+	distinct := store.DistinctValues()
+	results := make([]ConsistencyGroupResult, 0, len(columns))
+	for name, groupColumns := range columns {
+		sort.Strings(groupColumns)
+		results = append(results, ConsistencyGroupResult{
+			Name:           name,
+			Columns:        groupColumns,
+			DistinctValues: distinct[name],
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	return results
+}
@@ -0,0 +1,143 @@
+package anonymizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"db-gdpr-anonymizer/internal/config"
+)
+
+func TestMappingStoreResolve(t *testing.T) {
+	store, err := NewMappingStore(100, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create mapping store: %v", err)
+	}
+	defer store.Close()
+
+	calls := 0
+	generate := func() (interface{}, error) {
+		calls++
+		return fmt.Sprintf("fake-%d", calls), nil
+	}
+
+	first, err := store.Resolve("email", "jane@example.com", generate)
+	if err != nil {
+		t.Fatalf("Failed to resolve mapping: %v", err)
+	}
+	second, _ := store.Resolve("email", "jane@example.com", generate)
+	if first != second {
+		t.Errorf("Expected the same mapping for the same original, got '%v' and '%v'", first, second)
+	}
+
+	other, _ := store.Resolve("email", "john@example.com", generate)
+	if other == first {
+		t.Errorf("Expected a new mapping for a different original, got '%v'", other)
+	}
+
+	// The same original in another group gets its own mapping
+	otherGroup, _ := store.Resolve("name", "jane@example.com", generate)
+	if otherGroup == first {
+		t.Errorf("Expected a separate mapping in another group, got '%v'", otherGroup)
+	}
+
+	counts := store.DistinctValues()
+	if counts["email"] != 2 || counts["name"] != 1 {
+		t.Errorf("Expected 2 distinct emails and 1 distinct name, got %v", counts)
+	}
+}
+
+func TestMappingStoreSpill(t *testing.T) {
+	spillDir := t.TempDir()
+	store, err := NewMappingStore(2, spillDir)
+	if err != nil {
+		t.Fatalf("Failed to create mapping store: %v", err)
+	}
+
+	expected := make(map[string]interface{})
+	for i := 0; i < 10; i++ {
+		original := fmt.Sprintf("customer-%d@example.com", i)
+		value, err := store.Resolve("email", original, func() (interface{}, error) {
+			return fmt.Sprintf("fake-%d@example.test", i), nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to resolve mapping: %v", err)
+		}
+		expected[original] = value
+	}
+
+	files, _ := filepath.Glob(filepath.Join(spillDir, "*"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one spill file, got %d", len(files))
+	}
+
+	for original, want := range expected {
+		got, err := store.Resolve("email", original, func() (interface{}, error) {
+			return nil, fmt.Errorf("unexpected generation for %s", original)
+		})
+		if err != nil {
+			t.Fatalf("Failed to resolve spilled mapping: %v", err)
+		}
+		if got != want {
+			t.Errorf("Expected '%v' for %s, got '%v'", want, original, got)
+		}
+	}
+
+	if count := store.DistinctValues()["email"]; count != 10 {
+		t.Errorf("Expected 10 distinct values, got %d", count)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close mapping store: %v", err)
+	}
+	if _, err := os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected spill file to be removed on close")
+	}
+}
+
+func TestCreatePlanConsistencyGroup(t *testing.T) {
+	cfg := &config.Config{
+		Tables: map[string]config.TableConfig{
+			"customer_entity": {
+				Columns: map[string]config.ColumnConfig{
+					"email": {Type: "faker.email", ConsistencyGroup: "customer_email"},
+				},
+			},
+			"sales_order": {
+				Columns: map[string]config.ColumnConfig{
+					"customer_email": {Type: "faker.email", ConsistencyGroup: "customer_email"},
+				},
+			},
+		},
+	}
+
+	plan, err := CreatePlan(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+
+	store, err := NewMappingStore(100, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create mapping store: %v", err)
+	}
+	defer store.Close()
+
+	groups := consistencyGroups(plan, store)
+	if len(groups) != 1 {
+		t.Fatalf("Expected 1 consistency group, got %d", len(groups))
+	}
+	if len(groups[0].Columns) != 2 || groups[0].Columns[0] != "customer_entity.email" || groups[0].Columns[1] != "sales_order.customer_email" {
+		t.Errorf("Expected group columns to be listed, got %v", groups[0].Columns)
+	}
+
+	// Consistency groups need a strategy computed from the original value
+	cfg.Tables["quote"] = config.TableConfig{
+		Columns: map[string]config.ColumnConfig{
+			"customer_email": {Value: "fixed@example.test", ConsistencyGroup: "customer_email"},
+		},
+	}
+	if _, err := CreatePlan(cfg); err == nil {
+		t.Error("Expected error for consistency group on a fixed value, got nil")
+	}
+}
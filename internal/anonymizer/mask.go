@@ -0,0 +1,154 @@
+package anonymizer
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Parts of a value that the mask strategy can preserve
+const (
+	// PreserveSeparators keeps separators in place
+	PreserveSeparators = "separators"
+	// PreserveLength masks every character with one mask character
+	PreserveLength = "length"
+)
+
+// maskParams lists the parameters accepted by the mask strategy
+var maskParams = map[string]bool{
+	"keep_first": true,
+	"keep_last":  true,
+	"mask_char":  true,
+	"preserve":   true,
+}
+
+// maskSeparators are the characters that separate groups of digits or
+// letters in card numbers, phone numbers and IBANs
+const maskSeparators = " -./()"
+
+// maskRunLength is the number of mask characters that replace every run of
+// masked characters unless the length is preserved, so that masked values do
+// not reveal the length of the original
+const maskRunLength = 4
+
+// MaskStrategy replaces all but the first and last characters of values by a
+// mask character, so that 4111-1111-1111-1234 becomes XXXX-XXXX-XXXX-1234.
+// Values too short to keep that many characters are masked entirely.
+type MaskStrategy struct {
+	KeepFirst          int
+	KeepLast           int
+	MaskChar           rune
+	PreserveSeparators bool
+	PreserveLength     bool
+}
+
+// newMaskStrategy creates a mask strategy from its params
+func newMaskStrategy(params map[string]interface{}) (*MaskStrategy, error) {
+	if err := checkParams("mask", maskParams, params); err != nil {
+		return nil, err
+	}
+
+	strategy := &MaskStrategy{MaskChar: '*'}
+	for name, keep := range map[string]*int{"keep_first": &strategy.KeepFirst, "keep_last": &strategy.KeepLast} {
+		value, ok := params[name]
+		if !ok {
+			continue
+		}
+		n, ok := intParam(value)
+		if !ok || n < 0 {
+			return nil, fmt.Errorf("param %s of mask strategy must be a number of characters, got %v", name, value)
+		}
+		*keep = n
+	}
+
+	if maskChar, ok := params["mask_char"]; ok {
+		value, ok := maskChar.(string)
+		if !ok || utf8.RuneCountInString(value) != 1 {
+			return nil, fmt.Errorf("param mask_char of mask strategy must be a single character, got %v", maskChar)
+		}
+		strategy.MaskChar, _ = utf8.DecodeRuneInString(value)
+	}
+
+	if preserve, ok := params["preserve"]; ok {
+		values, ok := preserve.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("param preserve of mask strategy must be a list of separators and length")
+		}
+		for _, value := range values {
+			switch value {
+			case PreserveSeparators:
+				strategy.PreserveSeparators = true
+			case PreserveLength:
+				strategy.PreserveLength = true
+			default:
+				return nil, fmt.Errorf("param preserve of mask strategy must be a list of separators and length, got %v", value)
+			}
+		}
+	}
+
+	return strategy, nil
+}
+
+// GenerateSQL implements AnonymizationStrategy.GenerateSQL. Masked values are
+// computed per row and bound as parameters by GenerateBatchUpdateSQL; as an
+// expression on its own, the strategy keeps the column unchanged.
+func (s *MaskStrategy) GenerateSQL(tableName, columnName string) string {
+	return columnName
+}
+
+// GetType implements AnonymizationStrategy.GetType
+func (s *MaskStrategy) GetType() string {
+	return "mask"
+}
+
+// Anonymize implements ValueStrategy.Anonymize. NULL values are kept as NULL.
+func (s *MaskStrategy) Anonymize(original interface{}) (interface{}, error) {
+	if original == nil {
+		return nil, nil
+	}
+	characters := []rune(fmt.Sprintf("%v", original))
+
+	// Preserved separators are neither kept nor masked, and do not count
+	// as characters to keep
+	separator := func(c rune) bool {
+		return s.PreserveSeparators && strings.ContainsRune(maskSeparators, c)
+	}
+	count := 0
+	for _, c := range characters {
+		if !separator(c) {
+			count++
+		}
+	}
+	keepFirst, keepLast := s.KeepFirst, s.KeepLast
+	if keepFirst+keepLast >= count {
+		keepFirst, keepLast = 0, 0
+	}
+
+	var masked strings.Builder
+	index, run := 0, 0
+	flush := func() {
+		if run > 0 && !s.PreserveLength {
+			run = maskRunLength
+		}
+		for ; run > 0; run-- {
+			masked.WriteRune(s.MaskChar)
+		}
+	}
+	for _, c := range characters {
+		if separator(c) {
+			flush()
+			masked.WriteRune(c)
+			continue
+		}
+		if index < keepFirst || index >= count-keepLast {
+			flush()
+			masked.WriteRune(c)
+		} else {
+			run++
+		}
+		index++
+	}
+	flush()
+
+	return masked.String(), nil
+}
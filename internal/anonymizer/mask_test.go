@@ -0,0 +1,66 @@
+package anonymizer
+
+import (
+	"testing"
+)
+
+func TestMaskStrategy(t *testing.T) {
+	shape := []interface{}{"separators", "length"}
+
+	tests := []struct {
+		params   map[string]interface{}
+		original interface{}
+		expected interface{}
+	}{
+		// Card numbers keep their last digits
+		{map[string]interface{}{"keep_last": 4, "mask_char": "X", "preserve": shape}, "4111-1111-1111-1234", "XXXX-XXXX-XXXX-1234"},
+		// Phone numbers keep their country code
+		{map[string]interface{}{"keep_first": 3, "preserve": shape}, "+49 170 1234567", "+49 *** *******"},
+		// IBANs keep their country and check digits
+		{map[string]interface{}{"keep_first": 4, "preserve": shape}, "DE89 3704 0044 0532 0130 00", "DE89 **** **** **** **** **"},
+		// Without the length, every masked run is four characters long
+		{map[string]interface{}{"keep_last": 4, "preserve": []interface{}{"separators"}}, "4111-1111-1111-1234", "****-****-****-1234"},
+		{map[string]interface{}{"keep_first": 3, "preserve": []interface{}{"separators"}}, "+49 170 1234567", "+49 **** ****"},
+		{map[string]interface{}{"keep_last": 4}, "4111-1111-1111-1234", "****1234"},
+		{map[string]interface{}{"keep_last": 4, "preserve": []interface{}{"length"}}, "4111-1111-1111-1234", "***************1234"},
+		// Values too short to keep anything are masked entirely
+		{map[string]interface{}{"keep_last": 4, "preserve": shape}, "1234", "****"},
+		{nil, "secret", "****"},
+		// Other values are masked as text
+		{map[string]interface{}{"keep_last": uint64(2), "preserve": shape}, int64(4111111111111234), "**************34"},
+		{map[string]interface{}{"keep_first": 1, "mask_char": "•", "preserve": shape}, "Jürgen", "J•••••"},
+		// NULL stays NULL
+		{map[string]interface{}{"keep_last": 4}, nil, nil},
+	}
+
+	for _, test := range tests {
+		strategy, err := newMaskStrategy(test.params)
+		if err != nil {
+			t.Fatalf("Failed to create mask strategy with %v: %v", test.params, err)
+		}
+		masked, err := strategy.Anonymize(test.original)
+		if err != nil {
+			t.Fatalf("Failed to mask %v: %v", test.original, err)
+		}
+		if masked != test.expected {
+			t.Errorf("Expected %v masked with %v to be %v, got %v", test.original, test.params, test.expected, masked)
+		}
+	}
+}
+
+func TestNewMaskStrategyErrors(t *testing.T) {
+	invalid := []map[string]interface{}{
+		{"keep_last": -1},
+		{"keep_first": "4"},
+		{"mask_char": "XX"},
+		{"mask_char": ""},
+		{"preserve": "length"},
+		{"preserve": []interface{}{"case"}},
+		{"keep_middle": 2},
+	}
+	for _, params := range invalid {
+		if _, err := newMaskStrategy(params); err == nil {
+			t.Errorf("Expected error for params %v, got nil", params)
+		}
+	}
+}
@@ -2,41 +2,154 @@ package anonymizer
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/database"
+	"db-gdpr-anonymizer/internal/faker"
 )
 
+// defaultBatchSize is the number of rows anonymized per statement when the
+// configuration does not set a batch size
+const defaultBatchSize = 1000
+
+// Table actions
+const (
+	// ActionAnonymize rewrites the configured columns
+	ActionAnonymize = "anonymize"
+	// ActionTruncate empties the table
+	ActionTruncate = "truncate"
+	// ActionDelete deletes the rows matching the table's where condition
+	// together with the rows that depend on them
+	ActionDelete = "delete"
+)
+
+// Transaction modes, which set how much of a table commits at once
+const (
+	// TransactionChunk commits the statements of each chunk atomically
+	TransactionChunk = "chunk"
+	// TransactionTable commits all chunks of a table atomically
+	TransactionTable = "table"
+	// TransactionNone commits every statement on its own
+	TransactionNone = "none"
+)
+
+// actionOrder is the order in which the actions of a plan are executed.
+// Rows are deleted before anything else, so no time is spent anonymizing
+// rows that are about to disappear.
+var actionOrder = map[string]int{
+	ActionDelete:    0,
+	ActionTruncate:  1,
+	ActionAnonymize: 2,
+}
+
 // AnonymizationPlan represents the plan for anonymizing the database
 type AnonymizationPlan struct {
-	Tables []*TablePlan
+	Dialect database.Dialect
+	Retry   RetryPolicy
+	// Seed makes shuffles deterministic across runs, if set
+	Seed string
+	// SnapshotKey keys the fingerprints of snapshots, if set
+	SnapshotKey []byte
+	Tables      []*TablePlan
 }
 
 // TablePlan represents the plan for anonymizing a single table
 type TablePlan struct {
-	Name       string
-	PrimaryKey string
-	Where      string
-	Limit      int
-	OrderBy    string
-	Columns    []*ColumnPlan
+	Name        string
+	Action      string
+	PrimaryKey  []string
+	Where       string
+	Limit       int
+	OrderBy     string
+	BatchSize   int
+	Transaction string
+	Columns     []*ColumnPlan
 }
 
 // ColumnPlan represents the plan for anonymizing a single column
 type ColumnPlan struct {
-	Name      string
-	Strategy  AnonymizationStrategy
-	Formatter string
+	Name             string
+	Strategy         AnonymizationStrategy
+	Formatter        string
+	ConsistencyGroup string
 }
 
 // AnonymizationStrategy defines how a column should be anonymized
 type AnonymizationStrategy interface {
-	// GenerateSQL generates the SQL expression for anonymizing the column
+	// GenerateSQL generates the SQL expression for anonymizing the column.
+	// The table and column names are quoted for the dialect.
 	GenerateSQL(tableName, columnName string) string
 	// GetType returns the type of the strategy
 	GetType() string
 }
 
+// ValueStrategy is implemented by strategies that compute the new value of
+// each row in Go from the original column value
+type ValueStrategy interface {
+	AnonymizationStrategy
+	// Anonymize returns the replacement for the original column value
+	Anonymize(original interface{}) (interface{}, error)
+}
+
+// RowStrategy is implemented by value strategies whose replacement also
+// depends on other columns of the row, which are read with it
+type RowStrategy interface {
+	ValueStrategy
+	// RowColumns returns the other columns the replacement depends on
+	RowColumns() []string
+	// AnonymizeRow returns the replacement for the original column value
+	// of a row with the values of its RowColumns
+	AnonymizeRow(original interface{}, row map[string]interface{}) (interface{}, error)
+}
+
+// HasValueStrategies reports whether any column of the table needs its
+// original values read and rewritten row by row
+func (t *TablePlan) HasValueStrategies() bool {
+	for _, column := range t.Columns {
+		if _, ok := column.Strategy.(ValueStrategy); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ValueColumns returns the columns whose strategies implement ValueStrategy
+func (t *TablePlan) ValueColumns() []*ColumnPlan {
+	columns := make([]*ColumnPlan, 0, len(t.Columns))
+	for _, column := range t.Columns {
+		if _, ok := column.Strategy.(ValueStrategy); ok {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// rowColumns returns the columns that the value strategies of a table read
+// besides their own, such as shuffle partitions and date_shift keys. They
+// are read with the rows but not written.
+func (t *TablePlan) rowColumns() []string {
+	var columns []string
+	seen := make(map[string]bool)
+	for _, column := range t.Columns {
+		var read []string
+		switch strategy := column.Strategy.(type) {
+		case *ShuffleStrategy:
+			read = strategy.PartitionBy
+		case RowStrategy:
+			read = strategy.RowColumns()
+		}
+		for _, name := range read {
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+		}
+	}
+	return columns
+}
+
 // FixedValueStrategy sets a fixed value for the column
 type FixedValueStrategy struct {
 	Value interface{}
@@ -44,14 +157,7 @@ type FixedValueStrategy struct {
 
 // GenerateSQL implements AnonymizationStrategy.GenerateSQL
 func (s *FixedValueStrategy) GenerateSQL(tableName, columnName string) string {
-	switch v := s.Value.(type) {
-	case string:
-		return fmt.Sprintf("'%s'", strings.ReplaceAll(v, "'", "''"))
-	case nil:
-		return "NULL"
-	default:
-		return fmt.Sprintf("%v", v)
-	}
+	return sqlLiteral(s.Value)
 }
 
 // GetType implements AnonymizationStrategy.GetType
@@ -90,13 +196,15 @@ func (s *ExpressionStrategy) GetType() string {
 // FakerStrategy uses a faker function to generate fake data
 type FakerStrategy struct {
 	FakerType string
+	Params    faker.Params
+	Generator *faker.Generator
 }
 
-// GenerateSQL implements AnonymizationStrategy.GenerateSQL
+// GenerateSQL implements AnonymizationStrategy.GenerateSQL. Fake values are
+// generated per row and bound as parameters by GenerateBatchUpdateSQL; as an
+// expression on its own, the strategy keeps the column unchanged.
 func (s *FakerStrategy) GenerateSQL(tableName, columnName string) string {
-	// Use a placeholder that will be replaced with actual fake data at runtime
-	// Include the table name and column name to make each placeholder unique
-	return fmt.Sprintf("'[FAKER:%s:%s:%s]'", s.FakerType, tableName, columnName)
+	return columnName
 }
 
 // GetType implements AnonymizationStrategy.GetType
@@ -104,45 +212,167 @@ func (s *FakerStrategy) GetType() string {
 	return "faker"
 }
 
+// Anonymize implements ValueStrategy.Anonymize. NULL values are kept as NULL.
+func (s *FakerStrategy) Anonymize(original interface{}) (interface{}, error) {
+	if original == nil {
+		return nil, nil
+	}
+	return s.Generator.GenerateFor(s.FakerType, s.Params, fmt.Sprintf("%v", original))
+}
+
 // CreatePlan creates an anonymization plan from the configuration
 func CreatePlan(cfg *config.Config) (*AnonymizationPlan, error) {
+	dialect, err := database.NewDialect(database.Driver(cfg.Database.Driver))
+	if err != nil {
+		return nil, err
+	}
+
 	plan := &AnonymizationPlan{
-		Tables: make([]*TablePlan, 0, len(cfg.Tables)),
+		Dialect: dialect,
+		Retry:   newRetryPolicy(cfg.Retry),
+		Seed:    cfg.Seed,
+		Tables:  make([]*TablePlan, 0, len(cfg.Tables)),
+	}
+	generator := faker.NewGenerator(cfg.Seed)
+	hashKey, err := loadKey(cfg.HashKey)
+	if err != nil {
+		return nil, fmt.Errorf("hash_key: %w", err)
+	}
+	fpeKey, err := loadKey(cfg.FPEKey)
+	if err != nil {
+		return nil, fmt.Errorf("fpe_key: %w", err)
+	}
+	plan.SnapshotKey, err = loadKey(cfg.SnapshotKey)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot_key: %w", err)
+	}
+
+	shiftKey, err := loadKey(cfg.DateShiftKey)
+	if err != nil {
+		return nil, fmt.Errorf("date_shift_key: %w", err)
 	}
 
 	for tableName, tableConfig := range cfg.Tables {
+		batchSize := tableConfig.BatchSize
+		if batchSize == 0 {
+			batchSize = cfg.BatchSize
+		}
+		if batchSize == 0 {
+			batchSize = defaultBatchSize
+		}
+
+		transaction := tableConfig.Transaction
+		if transaction == "" {
+			transaction = cfg.Transaction
+		}
+		if transaction == "" {
+			transaction = TransactionChunk
+		}
+
+		action := ActionAnonymize
+		if tableConfig.ShouldTruncate() {
+			action = ActionTruncate
+		}
+		if tableConfig.ShouldDelete() {
+			action = ActionDelete
+		}
+
 		tablePlan := &TablePlan{
-			Name:       tableName,
-			PrimaryKey: tableConfig.PrimaryKey,
-			Where:      tableConfig.Where,
-			Limit:      tableConfig.Limit,
-			OrderBy:    tableConfig.OrderBy,
-			Columns:    make([]*ColumnPlan, 0, len(tableConfig.Columns)),
+			Name:        tableName,
+			Action:      action,
+			PrimaryKey:  tableConfig.PrimaryKey,
+			Where:       tableConfig.Where,
+			Limit:       tableConfig.Limit,
+			OrderBy:     tableConfig.OrderBy,
+			BatchSize:   batchSize,
+			Transaction: transaction,
+			Columns:     make([]*ColumnPlan, 0, len(tableConfig.Columns)),
 		}
 
 		for columnName, columnConfig := range tableConfig.Columns {
-			strategy, err := createStrategy(columnConfig)
+			strategy, err := createStrategy(columnConfig, cfg.Converters, generator, hashKey, fpeKey, shiftKey)
 			if err != nil {
 				return nil, fmt.Errorf("error creating strategy for %s.%s: %w", tableName, columnName, err)
 			}
 
+			if columnConfig.ConsistencyGroup != "" {
+				if _, ok := strategy.(ValueStrategy); !ok {
+					return nil, fmt.Errorf("consistency group %s on %s.%s requires a strategy computed from the original value, got %s",
+						columnConfig.ConsistencyGroup, tableName, columnName, strategy.GetType())
+				}
+			}
+
 			columnPlan := &ColumnPlan{
-				Name:      columnName,
-				Strategy:  strategy,
-				Formatter: columnConfig.Formatter,
+				Name:             columnName,
+				Strategy:         strategy,
+				Formatter:        columnConfig.Formatter,
+				ConsistencyGroup: columnConfig.ConsistencyGroup,
 			}
 
 			tablePlan.Columns = append(tablePlan.Columns, columnPlan)
 		}
 
+		// Columns that strategies read with the rows must keep their original
+		// values while the table is anonymized
+		for _, column := range tablePlan.Columns {
+			strategy, ok := column.Strategy.(RowStrategy)
+			if !ok || len(strategy.RowColumns()) == 0 {
+				continue
+			}
+			if column.ConsistencyGroup != "" {
+				return nil, fmt.Errorf("consistency group %s on %s.%s cannot be combined with a %s strategy that reads other columns",
+					column.ConsistencyGroup, tableName, column.Name, strategy.GetType())
+			}
+			for _, name := range strategy.RowColumns() {
+				for _, other := range tablePlan.Columns {
+					if other.Name == name {
+						return nil, fmt.Errorf("column %s.%s is read by the %s strategy of %s and cannot be anonymized", tableName, name, strategy.GetType(), column.Name)
+					}
+				}
+			}
+		}
+
+		// Shuffled values are drawn from all rows of the table, so a table
+		// committed in part would hold some values twice and miss others
+		shuffle, err := newShuffler(tablePlan)
+		if err != nil {
+			return nil, err
+		}
+		if shuffle != nil {
+			if tableConfig.Transaction != "" && tableConfig.Transaction != TransactionTable {
+				return nil, fmt.Errorf("table %s has shuffled columns and must commit as a whole, got transaction %s", tableName, tableConfig.Transaction)
+			}
+			tablePlan.Transaction = TransactionTable
+		}
+
 		plan.Tables = append(plan.Tables, tablePlan)
 	}
 
+	sort.Slice(plan.Tables, func(i, j int) bool {
+		if plan.Tables[i].Action != plan.Tables[j].Action {
+			return actionOrder[plan.Tables[i].Action] < actionOrder[plan.Tables[j].Action]
+		}
+		return plan.Tables[i].Name < plan.Tables[j].Name
+	})
+
 	return plan, nil
 }
 
-// createStrategy creates an anonymization strategy from the column configuration
-func createStrategy(columnConfig config.ColumnConfig) (AnonymizationStrategy, error) {
+// createStrategy creates an anonymization strategy from the column
+// configuration, resolving references to converters
+func createStrategy(columnConfig config.ColumnConfig, converters map[string]config.ConverterConfig, generator *faker.Generator, hashKey, fpeKey, shiftKey []byte) (AnonymizationStrategy, error) {
+	if columnConfig.Converter != "" {
+		converter, ok := converters[columnConfig.Converter]
+		if !ok {
+			return nil, fmt.Errorf("unknown converter: %s", columnConfig.Converter)
+		}
+		strategy, err := createTypeStrategy(converter.Type, converter.Params, generator, hashKey, fpeKey, shiftKey)
+		if err != nil {
+			return nil, fmt.Errorf("converter %s: %w", columnConfig.Converter, err)
+		}
+		return strategy, nil
+	}
+
 	if columnConfig.Null {
 		return &NullStrategy{}, nil
 	}
@@ -155,10 +385,36 @@ func createStrategy(columnConfig config.ColumnConfig) (AnonymizationStrategy, er
 		return &FixedValueStrategy{Value: columnConfig.Value}, nil
 	}
 
-	if strings.HasPrefix(columnConfig.Type, "faker.") {
-		fakerType := strings.TrimPrefix(columnConfig.Type, "faker.")
-		return &FakerStrategy{FakerType: fakerType}, nil
+	return createTypeStrategy(columnConfig.Type, columnConfig.Params, generator, hashKey, fpeKey, shiftKey)
+}
+
+// createTypeStrategy creates the strategy named by a column or converter type
+// with its params
+func createTypeStrategy(strategyType string, params map[string]interface{}, generator *faker.Generator, hashKey, fpeKey, shiftKey []byte) (AnonymizationStrategy, error) {
+	if strings.HasPrefix(strategyType, "faker.") {
+		fakerType := strings.TrimPrefix(strategyType, "faker.")
+		if err := faker.ValidateParams(fakerType, params); err != nil {
+			return nil, err
+		}
+		return &FakerStrategy{FakerType: fakerType, Params: params, Generator: generator}, nil
+	}
+
+	switch strategyType {
+	case "hash":
+		return newHashStrategy(hashKey, params)
+	case "mask":
+		return newMaskStrategy(params)
+	case "fpe":
+		return newFPEStrategy(fpeKey, params)
+	case "shuffle":
+		return newShuffleStrategy(params)
+	case "date_shift":
+		return newDateShiftStrategy(shiftKey, params)
+	case "date_truncate":
+		return newDateTruncateStrategy(params)
+	case "age_bucket":
+		return newAgeBucketStrategy(params)
 	}
 
-	return nil, fmt.Errorf("unsupported anonymization strategy: %s", columnConfig.Type)
+	return nil, fmt.Errorf("unsupported anonymization strategy: %s", strategyType)
 }
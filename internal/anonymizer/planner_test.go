@@ -1,9 +1,11 @@
 package anonymizer
 
 import (
+	"strings"
 	"testing"
 
 	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/faker"
 )
 
 func TestCreatePlan(t *testing.T) {
@@ -144,7 +146,8 @@ func TestCreateStrategy(t *testing.T) {
 	fixedConfig := config.ColumnConfig{
 		Value: "test",
 	}
-	strategy, err := createStrategy(fixedConfig)
+	generator := faker.NewGenerator("")
+	strategy, err := createStrategy(fixedConfig, nil, generator, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("Failed to create fixed value strategy: %v", err)
 	}
@@ -160,7 +163,7 @@ func TestCreateStrategy(t *testing.T) {
 	nullConfig := config.ColumnConfig{
 		Null: true,
 	}
-	strategy, err = createStrategy(nullConfig)
+	strategy, err = createStrategy(nullConfig, nil, generator, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("Failed to create null strategy: %v", err)
 	}
@@ -176,7 +179,7 @@ func TestCreateStrategy(t *testing.T) {
 	exprConfig := config.ColumnConfig{
 		Expr: "CONCAT('test', id)",
 	}
-	strategy, err = createStrategy(exprConfig)
+	strategy, err = createStrategy(exprConfig, nil, generator, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("Failed to create expression strategy: %v", err)
 	}
@@ -192,7 +195,7 @@ func TestCreateStrategy(t *testing.T) {
 	fakerConfig := config.ColumnConfig{
 		Type: "faker.email",
 	}
-	strategy, err = createStrategy(fakerConfig)
+	strategy, err = createStrategy(fakerConfig, nil, generator, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("Failed to create faker strategy: %v", err)
 	}
@@ -200,16 +203,223 @@ func TestCreateStrategy(t *testing.T) {
 		t.Errorf("Expected strategy type to be 'faker', got '%s'", strategy.GetType())
 	}
 	sql = strategy.GenerateSQL("table", "column")
-	if sql != "FAKER('email')" {
-		t.Errorf("Expected SQL to be 'FAKER('email')', got '%s'", sql)
+	if sql != "column" {
+		t.Errorf("Expected SQL to be 'column', got '%s'", sql)
 	}
 
 	// Test unsupported strategy
 	unsupportedConfig := config.ColumnConfig{
 		Type: "unsupported",
 	}
-	_, err = createStrategy(unsupportedConfig)
+	_, err = createStrategy(unsupportedConfig, nil, generator, nil, nil, nil)
 	if err == nil {
 		t.Error("Expected error for unsupported strategy, got nil")
 	}
-}
\ No newline at end of file
+}
+
+func TestCreateStrategyConverter(t *testing.T) {
+	generator := faker.NewGenerator("test-seed")
+	converters := map[string]config.ConverterConfig{
+		"magento_email": {
+			Type:   "faker.email",
+			Params: map[string]interface{}{"domain": "example.test"},
+		},
+		"broken": {
+			Type:   "faker.email",
+			Params: map[string]interface{}{"length": "10"},
+		},
+	}
+
+	strategy, err := createStrategy(config.ColumnConfig{Converter: "magento_email"}, converters, generator, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create converter strategy: %v", err)
+	}
+	fakerStrategy, ok := strategy.(*FakerStrategy)
+	if !ok {
+		t.Fatalf("Expected a faker strategy, got %T", strategy)
+	}
+	if fakerStrategy.FakerType != "email" || fakerStrategy.Params.String("domain") != "example.test" {
+		t.Errorf("Expected email faker with domain example.test, got %s with %v", fakerStrategy.FakerType, fakerStrategy.Params)
+	}
+
+	value, err := fakerStrategy.Anonymize("jane.doe@example.com")
+	if err != nil {
+		t.Fatalf("Failed to anonymize value: %v", err)
+	}
+	if !strings.HasSuffix(value.(string), "@example.test") {
+		t.Errorf("Expected an email address at example.test, got '%v'", value)
+	}
+
+	if _, err := createStrategy(config.ColumnConfig{Converter: "missing"}, converters, generator, nil, nil, nil); err == nil {
+		t.Error("Expected error for unknown converter, got nil")
+	}
+	if _, err := createStrategy(config.ColumnConfig{Converter: "broken"}, converters, generator, nil, nil, nil); err == nil {
+		t.Error("Expected error for unsupported converter param, got nil")
+	}
+}
+
+func TestCreateStrategyColumnParams(t *testing.T) {
+	generator := faker.NewGenerator("test-seed")
+
+	// Params of a column configure its type as those of a converter do
+	strategy, err := createStrategy(config.ColumnConfig{Type: "date_truncate", Params: map[string]interface{}{"to": "year"}}, nil, generator, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create date_truncate strategy: %v", err)
+	}
+	if truncate, ok := strategy.(*DateTruncateStrategy); !ok || truncate.To != "year" {
+		t.Errorf("Expected truncation to the year, got %+v", strategy)
+	}
+
+	strategy, err = createStrategy(config.ColumnConfig{Type: "age_bucket", Params: map[string]interface{}{"max": 90}}, nil, generator, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create age_bucket strategy: %v", err)
+	}
+	if bucket, ok := strategy.(*AgeBucketStrategy); !ok || bucket.Max != 90 {
+		t.Errorf("Expected age buckets up to 90, got %+v", strategy)
+	}
+
+	if _, err := createStrategy(config.ColumnConfig{Type: "date_truncate", Params: map[string]interface{}{"to": "week"}}, nil, generator, nil, nil, nil); err == nil {
+		t.Error("Expected error for unsupported column param, got nil")
+	}
+}
+
+func TestCreatePlanBatchSize(t *testing.T) {
+	cfg := &config.Config{
+		BatchSize: 250,
+		Tables: map[string]config.TableConfig{
+			"customer_entity": {},
+			"sales_order":     {BatchSize: 5000},
+		},
+	}
+
+	plan, err := CreatePlan(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+
+	for _, table := range plan.Tables {
+		expected := 250
+		if table.Name == "sales_order" {
+			expected = 5000
+		}
+		if table.BatchSize != expected {
+			t.Errorf("Expected batch size of '%s' to be %d, got %d", table.Name, expected, table.BatchSize)
+		}
+	}
+
+	// Test default batch size
+	cfg.BatchSize = 0
+	plan, err = CreatePlan(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	for _, table := range plan.Tables {
+		if table.Name == "customer_entity" && table.BatchSize != defaultBatchSize {
+			t.Errorf("Expected default batch size %d, got %d", defaultBatchSize, table.BatchSize)
+		}
+	}
+}
+
+func TestCreatePlanTransaction(t *testing.T) {
+	cfg := &config.Config{
+		Tables: map[string]config.TableConfig{
+			"customer_entity": {},
+			"sales_order":     {Transaction: TransactionTable},
+		},
+	}
+
+	// Tables commit by chunk unless configured otherwise
+	plan, err := CreatePlan(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	for _, table := range plan.Tables {
+		expected := TransactionChunk
+		if table.Name == "sales_order" {
+			expected = TransactionTable
+		}
+		if table.Transaction != expected {
+			t.Errorf("Expected transaction of '%s' to be %s, got %s", table.Name, expected, table.Transaction)
+		}
+	}
+
+	// The global mode applies to tables without their own
+	cfg.Transaction = TransactionNone
+	plan, err = CreatePlan(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	for _, table := range plan.Tables {
+		expected := TransactionNone
+		if table.Name == "sales_order" {
+			expected = TransactionTable
+		}
+		if table.Transaction != expected {
+			t.Errorf("Expected transaction of '%s' to be %s, got %s", table.Name, expected, table.Transaction)
+		}
+	}
+}
+
+func TestCreatePlanTruncate(t *testing.T) {
+	cfg := &config.Config{
+		Tables: map[string]config.TableConfig{
+			"customer_log": {
+				Truncate: config.Bool(true),
+			},
+			"customer_entity": {
+				Columns: map[string]config.ColumnConfig{
+					"email": {Type: "faker.email"},
+				},
+			},
+		},
+	}
+
+	plan, err := CreatePlan(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+
+	for _, table := range plan.Tables {
+		expected := ActionAnonymize
+		if table.Name == "customer_log" {
+			expected = ActionTruncate
+		}
+		if table.Action != expected {
+			t.Errorf("Expected action '%s' for table %s, got '%s'", expected, table.Name, table.Action)
+		}
+	}
+}
+
+func TestCreatePlanActionOrder(t *testing.T) {
+	cfg := &config.Config{
+		Tables: map[string]config.TableConfig{
+			"customer_entity": {
+				Columns: map[string]config.ColumnConfig{
+					"email": {Type: "faker.email"},
+				},
+			},
+			"customer_log": {
+				Truncate: config.Bool(true),
+			},
+			"sales_order": {
+				Delete: config.Bool(true),
+				Where:  "created_at < NOW() - INTERVAL 2 YEAR",
+			},
+		},
+	}
+
+	plan, err := CreatePlan(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+
+	expected := []string{"sales_order", "customer_log", "customer_entity"}
+	for i, table := range plan.Tables {
+		if table.Name != expected[i] {
+			t.Errorf("Expected table %d to be %s, got %s", i, expected[i], table.Name)
+		}
+	}
+	if plan.Tables[0].Action != ActionDelete {
+		t.Errorf("Expected action '%s', got '%s'", ActionDelete, plan.Tables[0].Action)
+	}
+}
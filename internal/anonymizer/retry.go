@@ -0,0 +1,97 @@
+package anonymizer
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/database"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+// Retry defaults used when the configuration does not set them
+const (
+	defaultMaxAttempts  = 5
+	defaultInitialDelay = 500 * time.Millisecond
+	defaultMaxDelay     = 30 * time.Second
+)
+
+// RetryPolicy defines how often and after which delays statements failing
+// with transient errors are run again
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// newRetryPolicy creates the retry policy of a configuration
+func newRetryPolicy(cfg config.RetryConfig) RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts:  cfg.MaxAttempts,
+		InitialDelay: cfg.InitialDelay,
+		MaxDelay:     cfg.MaxDelay,
+	}
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = defaultMaxAttempts
+	}
+	if policy.MaxDelay == 0 {
+		policy.MaxDelay = defaultMaxDelay
+	}
+	if policy.InitialDelay == 0 {
+		policy.InitialDelay = defaultInitialDelay
+	}
+	if policy.InitialDelay > policy.MaxDelay {
+		policy.InitialDelay = policy.MaxDelay
+	}
+	return policy
+}
+
+// Delay returns the delay before the retry that follows the given failed
+// attempt, counting from 1. The delay doubles with every attempt up to the
+// maximum delay, and a random half of it is jitter, so that workers failing
+// together do not retry together.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.InitialDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// withRetry runs operation until it succeeds, fails with an error that is not
+// transient, or has made the maximum number of attempts. It returns the
+// number of retries and the error of the last attempt. fields describe the
+// operation in the log.
+func withRetry(ctx context.Context, policy RetryPolicy, log *logger.Logger, fields map[string]interface{}, operation func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := operation()
+		if err == nil || attempt >= policy.MaxAttempts || !database.IsRetryable(err) {
+			return attempt - 1, err
+		}
+
+		delay := policy.Delay(attempt)
+		data := make(map[string]interface{}, len(fields)+3)
+		for key, value := range fields {
+			data[key] = value
+		}
+		data["error"] = err.Error()
+		data["attempt"] = attempt
+		data["delay"] = delay.String()
+		log.Warning("Retrying after transient error", data)
+
+		select {
+		case <-ctx.Done():
+			return attempt - 1, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
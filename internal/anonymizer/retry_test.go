@@ -0,0 +1,108 @@
+package anonymizer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/logger"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	policy := newRetryPolicy(config.RetryConfig{})
+	if policy.MaxAttempts != defaultMaxAttempts || policy.InitialDelay != defaultInitialDelay || policy.MaxDelay != defaultMaxDelay {
+		t.Errorf("Expected the default policy, got %+v", policy)
+	}
+
+	// The initial delay is capped by the maximum delay
+	policy = newRetryPolicy(config.RetryConfig{MaxAttempts: 1, MaxDelay: 100 * time.Millisecond})
+	if policy.MaxAttempts != 1 || policy.InitialDelay != 100*time.Millisecond {
+		t.Errorf("Expected 1 attempt with an initial delay of 100ms, got %+v", policy)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{9, time.Second},
+	}
+
+	// Half of each delay is jitter
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			if delay := policy.Delay(test.attempt); delay < test.max/2 || delay > test.max {
+				t.Errorf("Expected the delay after attempt %d to be between %v and %v, got %v", test.attempt, test.max/2, test.max, delay)
+			}
+		}
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	fields := map[string]interface{}{"table": "customer_entity"}
+
+	// Transient errors are retried until the operation succeeds
+	attempts := 0
+	retries, err := withRetry(context.Background(), policy, log, fields, func() error {
+		attempts++
+		if attempts < 3 {
+			return deadlock
+		}
+		return nil
+	})
+	if err != nil || retries != 2 {
+		t.Errorf("Expected success after 2 retries, got %d retries and error %v", retries, err)
+	}
+
+	// up to the maximum number of attempts
+	attempts = 0
+	retries, err = withRetry(context.Background(), policy, log, fields, func() error {
+		attempts++
+		return deadlock
+	})
+	if !errors.Is(err, deadlock) || retries != 2 || attempts != 3 {
+		t.Errorf("Expected the deadlock after 3 attempts, got %d attempts and error %v", attempts, err)
+	}
+
+	// Fatal errors are not retried
+	duplicate := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+	attempts = 0
+	retries, err = withRetry(context.Background(), policy, log, fields, func() error {
+		attempts++
+		return duplicate
+	})
+	if !errors.Is(err, duplicate) || retries != 0 || attempts != 1 {
+		t.Errorf("Expected the duplicate entry after 1 attempt, got %d attempts and error %v", attempts, err)
+	}
+
+	// A cancelled run stops waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	policy.InitialDelay, policy.MaxDelay = time.Hour, time.Hour
+	_, err = withRetry(ctx, policy, log, fields, func() error {
+		return deadlock
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the run to be cancelled, got %v", err)
+	}
+}
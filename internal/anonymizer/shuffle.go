@@ -0,0 +1,321 @@
+package anonymizer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	mathrand "math/rand"
+	"sort"
+	"strings"
+)
+
+// shuffleParams lists the parameters accepted by the shuffle strategy
+var shuffleParams = map[string]bool{
+	"group":        true,
+	"partition_by": true,
+}
+
+// ShuffleStrategy permutes the existing values of a column across the rows
+// of its table, so that the values keep their distribution but no longer
+// belong to their row. Columns of the same group are shuffled together and
+// keep their combinations, such as city and postcode, and rows are only
+// shuffled among rows with the same values of the partition columns.
+//
+// The strategy is a ValueStrategy, so its columns are read and written row
+// by row like others, but its values are drawn by the executor from the
+// values of all rows of the table rather than computed from the original.
+type ShuffleStrategy struct {
+	// Group names the columns of a table that are shuffled together; a
+	// column without a group is shuffled on its own
+	Group string
+	// PartitionBy lists the columns whose values partition the rows
+	PartitionBy []string
+}
+
+// newShuffleStrategy creates a shuffle strategy from its params
+func newShuffleStrategy(params map[string]interface{}) (*ShuffleStrategy, error) {
+	if err := checkParams("shuffle", shuffleParams, params); err != nil {
+		return nil, err
+	}
+
+	strategy := &ShuffleStrategy{}
+	if group, ok := params["group"]; ok {
+		value, ok := group.(string)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("param group of shuffle strategy must be a name, got %v", group)
+		}
+		strategy.Group = value
+	}
+
+	// A single partition column can be given without a list
+	if partitionBy, ok := params["partition_by"]; ok {
+		values, ok := partitionBy.([]interface{})
+		if !ok {
+			values = []interface{}{partitionBy}
+		}
+		for _, value := range values {
+			column, ok := value.(string)
+			if !ok || column == "" {
+				return nil, fmt.Errorf("param partition_by of shuffle strategy must be a column or a list of columns, got %v", partitionBy)
+			}
+			strategy.PartitionBy = append(strategy.PartitionBy, column)
+		}
+	}
+
+	return strategy, nil
+}
+
+// GenerateSQL implements AnonymizationStrategy.GenerateSQL. Shuffled values
+// are assigned per row and bound as parameters by GenerateBatchUpdateSQL; as
+// an expression on its own, the strategy keeps the column unchanged.
+func (s *ShuffleStrategy) GenerateSQL(tableName, columnName string) string {
+	return columnName
+}
+
+// GetType implements AnonymizationStrategy.GetType
+func (s *ShuffleStrategy) GetType() string {
+	return "shuffle"
+}
+
+// Anonymize implements ValueStrategy.Anonymize. A shuffled value depends on
+// the other rows of the table and cannot be computed from the original alone.
+func (s *ShuffleStrategy) Anonymize(original interface{}) (interface{}, error) {
+	return nil, fmt.Errorf("shuffle strategy values are drawn from the rows of the table")
+}
+
+// pooledPartition is the key of the partition the rows of single-row
+// partitions are pooled in; keys of other partitions never start with NUL
+const pooledPartition = "\x00pooled"
+
+// shuffleGroup holds the values of columns that are shuffled together,
+// partitioned by the values of the partition columns
+type shuffleGroup struct {
+	key         string
+	columns     []string
+	partitionBy []string
+
+	// values holds the value tuples of the rows of each partition, and next
+	// the position of the tuple assigned to the next row of the partition.
+	// pooled maps single-row partitions to the partition they were pooled in.
+	values map[string][]shuffleTuple
+	next   map[string]int
+	pooled map[string]string
+}
+
+// shuffleTuple is the tuple of values of a row, with the position of the row
+// in primary key order
+type shuffleTuple struct {
+	row    int
+	values []interface{}
+}
+
+// shuffler assigns the rows of a table values of its shuffled columns drawn
+// without replacement from the shuffled values of all its rows. Rows are
+// assigned values in primary key order, so a shuffle with the same seed
+// assigns every row the same values again. A nil shuffler assigns nothing.
+type shuffler struct {
+	table  string
+	groups []*shuffleGroup
+	rows   int
+}
+
+// newShuffler creates the shuffler of a table, or returns nil if the table
+// has no shuffled columns. Columns of a group must share their partition
+// columns, which must not be anonymized themselves, since the partitions
+// would change as the table is anonymized.
+func newShuffler(tablePlan *TablePlan) (*shuffler, error) {
+	groups := make(map[string]*shuffleGroup)
+	for _, column := range tablePlan.Columns {
+		strategy, ok := column.Strategy.(*ShuffleStrategy)
+		if !ok {
+			continue
+		}
+		if column.ConsistencyGroup != "" {
+			return nil, fmt.Errorf("shuffled column %s.%s cannot be part of consistency group %s", tablePlan.Name, column.Name, column.ConsistencyGroup)
+		}
+
+		// Columns shuffled on their own are keyed by a name no group has
+		key := "\x00" + column.Name
+		if strategy.Group != "" {
+			key = strategy.Group
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &shuffleGroup{key: key, partitionBy: strategy.PartitionBy}
+			groups[key] = group
+		} else if strings.Join(group.partitionBy, ",") != strings.Join(strategy.PartitionBy, ",") {
+			return nil, fmt.Errorf("columns of shuffle group %s in table %s must have the same partition_by", strategy.Group, tablePlan.Name)
+		}
+		group.columns = append(group.columns, column.Name)
+
+		for _, partitionColumn := range strategy.PartitionBy {
+			for _, other := range tablePlan.Columns {
+				if other.Name == partitionColumn {
+					return nil, fmt.Errorf("column %s.%s partitions shuffled column %s and cannot be anonymized", tablePlan.Name, partitionColumn, column.Name)
+				}
+			}
+		}
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	s := &shuffler{table: tablePlan.Name, groups: make([]*shuffleGroup, 0, len(groups))}
+	for _, group := range groups {
+		sort.Strings(group.columns)
+		group.values = make(map[string][]shuffleTuple)
+		group.next = make(map[string]int)
+		group.pooled = make(map[string]string)
+		s.groups = append(s.groups, group)
+	}
+	sort.Slice(s.groups, func(i, j int) bool {
+		return s.groups[i].key < s.groups[j].key
+	})
+	return s, nil
+}
+
+// add adds the values of a row to the values to shuffle
+func (s *shuffler) add(row rowValues) {
+	for _, group := range s.groups {
+		partition := group.partition(row)
+		tuple := shuffleTuple{row: s.rows, values: make([]interface{}, len(group.columns))}
+		for i, column := range group.columns {
+			tuple.values[i] = row.values[column]
+		}
+		group.values[partition] = append(group.values[partition], tuple)
+	}
+	s.rows++
+}
+
+// shuffle shuffles the values of each partition once all rows were added,
+// seeded by the seed, the table, the group and the partition. The values are
+// shuffled in a single cycle, so that no row keeps its own values. The rows
+// of single-row partitions are pooled first; shuffle returns the number of
+// rows pooled and of rows kept, see shuffleGroup.pool.
+func (s *shuffler) shuffle(seed []byte) (pooled, kept int) {
+	for _, group := range s.groups {
+		groupPooled, groupKept := group.pool()
+		pooled += groupPooled
+		kept += groupKept
+
+		for partition, values := range group.values {
+			mac := hmac.New(sha256.New, seed)
+			mac.Write([]byte("shuffle"))
+			mac.Write([]byte{0})
+			mac.Write([]byte(s.table))
+			mac.Write([]byte{0})
+			mac.Write([]byte(group.key))
+			mac.Write([]byte{0})
+			mac.Write([]byte(partition))
+			digest := mac.Sum(nil)
+
+			// Sattolo's algorithm swaps each value only with one before it,
+			// which yields a cyclic permutation without fixed points
+			rnd := mathrand.New(mathrand.NewSource(int64(binary.BigEndian.Uint64(digest))))
+			for i := len(values) - 1; i > 0; i-- {
+				j := rnd.Intn(i)
+				values[i], values[j] = values[j], values[i]
+			}
+		}
+	}
+	return pooled, kept
+}
+
+// assign assigns the next rows of the table their shuffled values. It fails
+// if the rows of a partition outnumber its values, which happens when rows
+// are added to the table while it is anonymized.
+func (s *shuffler) assign(rows []rowValues) error {
+	if s == nil {
+		return nil
+	}
+	for i := range rows {
+		rows[i].shuffled = make(map[string]interface{})
+		for _, group := range s.groups {
+			partition := group.partition(rows[i])
+			values := group.values[partition]
+			next := group.next[partition]
+			if next >= len(values) {
+				return fmt.Errorf("table %s has more rows to shuffle than were read; rows were added while it was anonymized", s.table)
+			}
+			for j, column := range group.columns {
+				rows[i].shuffled[column] = values[next].values[j]
+			}
+			group.next[partition] = next + 1
+		}
+	}
+	return nil
+}
+
+// partition returns the key of the partition of a row, or of the partition
+// it was pooled in
+func (g *shuffleGroup) partition(row rowValues) string {
+	values := make([]interface{}, len(g.partitionBy))
+	for i, column := range g.partitionBy {
+		values[i] = row.values[column]
+	}
+	partition := partitionKey(values)
+	if pooled, ok := g.pooled[partition]; ok {
+		return pooled
+	}
+	return partition
+}
+
+// pool moves the rows of partitions with a single row, which cannot be
+// shuffled within them, into a partition shuffled together. A lone single
+// row joins the first other partition instead. It returns the number of rows
+// moved and the number of rows left in a partition of their own, which
+// happens only if the group has a single row.
+func (g *shuffleGroup) pool() (pooled, kept int) {
+	var singles, others []string
+	for partition, values := range g.values {
+		if len(values) == 1 {
+			singles = append(singles, partition)
+		} else {
+			others = append(others, partition)
+		}
+	}
+	if len(singles) == 0 {
+		return 0, 0
+	}
+	if len(singles) == 1 && len(others) == 0 {
+		return 0, 1
+	}
+
+	sort.Strings(singles)
+	sort.Strings(others)
+	target := pooledPartition
+	if len(singles) == 1 {
+		target = others[0]
+	}
+	for _, partition := range singles {
+		g.values[target] = append(g.values[target], g.values[partition]...)
+		delete(g.values, partition)
+		g.pooled[partition] = target
+	}
+
+	// Rows are assigned in primary key order, so the tuples of the pooled
+	// rows are kept in that order too
+	values := g.values[target]
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].row < values[j].row
+	})
+	return len(singles), 0
+}
+
+// partitionKey returns a key that identifies the values of the partition
+// columns of a row, telling apart values of different types and NULL
+func partitionKey(values []interface{}) string {
+	var key strings.Builder
+	for i, value := range values {
+		if i > 0 {
+			key.WriteByte(0)
+		}
+		if value == nil {
+			key.WriteString("NULL")
+			continue
+		}
+		fmt.Fprintf(&key, "%T:%v", value, value)
+	}
+	return key.String()
+}
@@ -0,0 +1,329 @@
+package anonymizer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+// openShuffleDatabase creates a SQLite database with addresses in two
+// countries
+func openShuffleDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db := openTestDatabase(t)
+	statements := []string{
+		`CREATE TABLE addresses (id INTEGER PRIMARY KEY, street TEXT, city TEXT, postcode TEXT, country_id INTEGER)`,
+	}
+	for i := 1; i <= 12; i++ {
+		country := 1
+		if i%3 == 0 {
+			country = 2
+		}
+		statements = append(statements, fmt.Sprintf(`INSERT INTO addresses VALUES (%d, 'Street %d', 'City %d', '%05d', %d)`, i, i, i, i*1000, country))
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to set up database: %v", err)
+		}
+	}
+	return db
+}
+
+// shufflePlan creates a plan that shuffles city and postcode together within
+// countries and streets across all addresses
+func shufflePlan(t *testing.T, seed string) *AnonymizationPlan {
+	t.Helper()
+
+	plan, err := CreatePlan(&config.Config{
+		Database: config.DatabaseConfig{Driver: "sqlite"},
+		Seed:     seed,
+		Converters: map[string]config.ConverterConfig{
+			"address": {Type: "shuffle", Params: map[string]interface{}{"group": "address", "partition_by": "country_id"}},
+		},
+		Tables: map[string]config.TableConfig{
+			"addresses": {
+				BatchSize: 3,
+				Columns: map[string]config.ColumnConfig{
+					"street":   {Type: "shuffle"},
+					"city":     {Converter: "address"},
+					"postcode": {Converter: "address"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	return plan
+}
+
+// executeShuffle runs a shuffle plan against the database
+func executeShuffle(t *testing.T, db *sql.DB, plan *AnonymizationPlan) ([]ExecutionResult, error) {
+	t.Helper()
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	executor := NewExecutor(db, plan, log, false, 2, false, nil)
+	defer executor.Close()
+	return executor.Execute(context.Background())
+}
+
+// queryAddresses returns the addresses in id order
+func queryAddresses(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+
+	var addresses []string
+	for _, address := range queryStrings(t, db, "SELECT country_id || ' ' || city || ' ' || postcode || ' ' || street FROM addresses ORDER BY id") {
+		addresses = append(addresses, address.String)
+	}
+	return addresses
+}
+
+// checkShuffled checks that the addresses hold a permutation of the original
+// streets and, within each country, of the original cities with their
+// postcodes
+func checkShuffled(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	original := openShuffleDatabase(t)
+	query := "SELECT country_id || ' ' || city || ' ' || postcode FROM addresses ORDER BY 1"
+	if got, want := queryStrings(t, db, query), queryStrings(t, original, query); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected cities and postcodes shuffled within countries, got %v, want %v", got, want)
+	}
+	query = "SELECT street FROM addresses ORDER BY 1"
+	if got, want := queryStrings(t, db, query), queryStrings(t, original, query); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected streets to be shuffled, got %v, want %v", got, want)
+	}
+
+	// No row keeps its own street, city or postcode
+	shuffled := queryStrings(t, db, "SELECT street || ' ' || city || ' ' || postcode FROM addresses ORDER BY id")
+	for i, address := range queryStrings(t, original, "SELECT street || ' ' || city || ' ' || postcode FROM addresses ORDER BY id") {
+		if shuffled[i] == address {
+			t.Errorf("Expected row %d to be shuffled, got its own values %s", i+1, address.String)
+		}
+	}
+}
+
+func TestExecutorSQLiteShuffle(t *testing.T) {
+	db := openShuffleDatabase(t)
+	results, err := executeShuffle(t, db, shufflePlan(t, "test-seed"))
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	checkShuffled(t, db)
+
+	// The chunks commit with the table
+	var rows int64
+	for _, result := range results {
+		if result.FieldName == "city" {
+			rows += result.RowsAffected
+		}
+		if result.Strategy != "shuffle" {
+			t.Errorf("Expected shuffle results, got %s", result.Strategy)
+		}
+		if result.Transaction != TransactionTable || !result.Committed {
+			t.Errorf("Expected chunk %d to commit with the table, got %+v", result.Chunk, result)
+		}
+	}
+	if rows != 12 {
+		t.Errorf("Expected 12 rows shuffled, got %d", rows)
+	}
+
+	// The same seed shuffles the same way
+	again := openShuffleDatabase(t)
+	if _, err := executeShuffle(t, again, shufflePlan(t, "test-seed")); err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	if got, want := queryAddresses(t, again), queryAddresses(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the same seed to shuffle the same way, got %v, want %v", got, want)
+	}
+}
+
+func TestExecutorSQLiteShuffleFailure(t *testing.T) {
+	db := openShuffleDatabase(t)
+
+	// The second chunk fails and the whole table is rolled back, so no value
+	// is held twice
+	if _, err := db.Exec(`CREATE TRIGGER fail_address BEFORE UPDATE ON addresses WHEN OLD.id = 5 BEGIN SELECT RAISE(ABORT, 'address is locked'); END`); err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+	results, err := executeShuffle(t, db, shufflePlan(t, ""))
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	failed := false
+	for _, result := range results {
+		if result.Committed {
+			t.Errorf("Expected chunk %d to be rolled back, got %+v", result.Chunk, result)
+		}
+		failed = failed || result.Error != nil
+	}
+	if !failed {
+		t.Error("Expected the table to fail, got no error")
+	}
+	if got, want := queryAddresses(t, db), queryAddresses(t, openShuffleDatabase(t)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected addresses to stay unchanged, got %v, want %v", got, want)
+	}
+
+	// A rerun shuffles the whole table
+	if _, err := db.Exec(`DROP TRIGGER fail_address`); err != nil {
+		t.Fatalf("Failed to drop trigger: %v", err)
+	}
+	if _, err := executeShuffle(t, db, shufflePlan(t, "")); err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	checkShuffled(t, db)
+}
+
+func TestExecutorSQLiteShuffleSingleRow(t *testing.T) {
+	// The only addresses in countries 3 and 4 are pooled and swapped, and
+	// the other countries are shuffled within them
+	db := openShuffleDatabase(t)
+	if _, err := db.Exec(`INSERT INTO addresses VALUES (13, 'Street 13', 'City 13', '13000', 3), (14, 'Street 14', 'City 14', '14000', 4)`); err != nil {
+		t.Fatalf("Failed to insert addresses: %v", err)
+	}
+	results, err := executeShuffle(t, db, shufflePlan(t, "test-seed"))
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("Expected the table to be shuffled, got %v", result.Error)
+		}
+	}
+	pooled := queryStrings(t, db, "SELECT city FROM addresses WHERE id > 12 ORDER BY id")
+	if len(pooled) != 2 || pooled[0].String != "City 14" || pooled[1].String != "City 13" {
+		t.Errorf("Expected addresses 13 and 14 to be swapped, got %v", pooled)
+	}
+	query := "SELECT country_id || ' ' || city FROM addresses WHERE id <= 12 ORDER BY 1"
+	if got, want := queryStrings(t, db, query), queryStrings(t, openShuffleDatabase(t), query); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected cities shuffled within countries 1 and 2, got %v, want %v", got, want)
+	}
+
+	// A lone address in country 3 joins another country
+	db = openShuffleDatabase(t)
+	if _, err := db.Exec(`INSERT INTO addresses VALUES (13, 'Street 13', 'City 13', '13000', 3)`); err != nil {
+		t.Fatalf("Failed to insert address: %v", err)
+	}
+	if _, err := executeShuffle(t, db, shufflePlan(t, "test-seed")); err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	if got := queryStrings(t, db, "SELECT city FROM addresses WHERE id = 13"); len(got) != 1 || got[0].String == "City 13" {
+		t.Errorf("Expected address 13 to be shuffled, got %v", got)
+	}
+	query = "SELECT city FROM addresses ORDER BY 1"
+	if got, want := queryStrings(t, db, query), queryStrings(t, db, "SELECT 'City ' || id FROM addresses ORDER BY 1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected a permutation of the cities, got %v, want %v", got, want)
+	}
+}
+
+func TestNewShuffleStrategy(t *testing.T) {
+	tests := []struct {
+		params   map[string]interface{}
+		expected *ShuffleStrategy
+	}{
+		{nil, &ShuffleStrategy{}},
+		{map[string]interface{}{"group": "address"}, &ShuffleStrategy{Group: "address"}},
+		{map[string]interface{}{"partition_by": "country_id"}, &ShuffleStrategy{PartitionBy: []string{"country_id"}}},
+		{map[string]interface{}{"partition_by": []interface{}{"country_id", "region"}}, &ShuffleStrategy{PartitionBy: []string{"country_id", "region"}}},
+	}
+	for _, test := range tests {
+		strategy, err := newShuffleStrategy(test.params)
+		if err != nil {
+			t.Fatalf("Failed to create shuffle strategy with %v: %v", test.params, err)
+		}
+		if !reflect.DeepEqual(strategy, test.expected) {
+			t.Errorf("Expected %+v for %v, got %+v", test.expected, test.params, strategy)
+		}
+	}
+
+	invalid := []map[string]interface{}{
+		{"group": ""},
+		{"group": 1},
+		{"partition_by": []interface{}{"country_id", 1}},
+		{"seed": "x"},
+	}
+	for _, params := range invalid {
+		if _, err := newShuffleStrategy(params); err == nil {
+			t.Errorf("Expected error for params %v, got nil", params)
+		}
+	}
+
+	// Shuffled values cannot be computed from the original alone
+	if _, err := (&ShuffleStrategy{}).Anonymize("Berlin"); err == nil {
+		t.Error("Expected error for anonymizing a single value, got nil")
+	}
+}
+
+func TestCreatePlanShuffleErrors(t *testing.T) {
+	converters := map[string]config.ConverterConfig{
+		"by_country": {Type: "shuffle", Params: map[string]interface{}{"group": "address", "partition_by": "country_id"}},
+		"by_region":  {Type: "shuffle", Params: map[string]interface{}{"group": "address", "partition_by": "region"}},
+	}
+	invalid := []map[string]config.ColumnConfig{
+		// Partitions must not change while the table is anonymized
+		{"city": {Converter: "by_country"}, "country_id": {Type: "faker.numerify"}},
+		// Columns shuffled together share their partitions
+		{"city": {Converter: "by_country"}, "postcode": {Converter: "by_region"}},
+		{"city": {Type: "shuffle", ConsistencyGroup: "city"}},
+	}
+	for _, columns := range invalid {
+		cfg := &config.Config{
+			Database:   config.DatabaseConfig{Driver: "sqlite"},
+			Converters: converters,
+			Tables:     map[string]config.TableConfig{"addresses": {Columns: columns}},
+		}
+		if _, err := CreatePlan(cfg); err == nil {
+			t.Errorf("Expected error for columns %v, got nil", columns)
+		}
+	}
+
+	// Shuffled tables commit as a whole
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{Driver: "sqlite"},
+		Tables: map[string]config.TableConfig{
+			"addresses": {Transaction: TransactionChunk, Columns: map[string]config.ColumnConfig{"city": {Type: "shuffle"}}},
+		},
+	}
+	if _, err := CreatePlan(cfg); err == nil {
+		t.Error("Expected error for shuffled table with chunk transactions, got nil")
+	}
+}
+
+func TestShufflerGroups(t *testing.T) {
+	plan := shufflePlan(t, "test-seed")
+	shuffle, err := newShuffler(plan.Tables[0])
+	if err != nil {
+		t.Fatalf("Failed to create shuffler: %v", err)
+	}
+
+	var groups [][]string
+	for _, group := range shuffle.groups {
+		groups = append(groups, group.columns)
+	}
+	if expected := [][]string{{"street"}, {"city", "postcode"}}; !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Expected groups %v, got %v", expected, groups)
+	}
+
+	columns := plan.Tables[0].rowColumns()
+	sort.Strings(columns)
+	if !reflect.DeepEqual(columns, []string{"country_id"}) {
+		t.Errorf("Expected country_id to partition the table, got %v", columns)
+	}
+
+	// Tables without shuffled columns have no shuffler
+	if shuffle, err := newShuffler(&TablePlan{Name: "customers"}); shuffle != nil || err != nil {
+		t.Errorf("Expected no shuffler, got %v, %v", shuffle, err)
+	}
+}
@@ -0,0 +1,243 @@
+package anonymizer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"db-gdpr-anonymizer/internal/database"
+)
+
+// DefaultSampleSize is the number of rows per table that snapshots and
+// verification sample when no sample size is set
+const DefaultSampleSize = 1000
+
+// Snapshot holds fingerprints of the original values of the planned columns
+// for a sample of rows of each anonymized table, taken before the plan is
+// executed. The fingerprints are keyed with the snapshot key of the
+// configuration, which is never written to the snapshot, so the snapshot
+// holds no values and its fingerprints cannot be matched against guessed
+// values without the key; only the primary keys of the rows are stored as
+// they are. KeyCheck is the fingerprint of a fixed text, which tells whether
+// a snapshot is read with the key it was taken with.
+type Snapshot struct {
+	KeyCheck string                    `json:"key_check"`
+	Tables   map[string]*TableSnapshot `json:"tables"`
+
+	key []byte
+}
+
+// TableSnapshot holds the fingerprints of the sampled rows of a table
+type TableSnapshot struct {
+	PrimaryKey []string      `json:"primary_key"`
+	Rows       []SnapshotRow `json:"rows"`
+}
+
+// SnapshotRow holds the fingerprints of the original values of a row by
+// column. NULL values have no fingerprint.
+type SnapshotRow struct {
+	Key          []interface{}     `json:"key"`
+	Fingerprints map[string]string `json:"fingerprints"`
+}
+
+// MarshalJSON implements json.Marshaler, encoding the key with encodeKey
+func (r SnapshotRow) MarshalJSON() ([]byte, error) {
+	type snapshotRow SnapshotRow
+	return json.Marshal(snapshotRow{Key: encodeKey(r.Key), Fingerprints: r.Fingerprints})
+}
+
+// keyedRow holds the primary key and the values of other columns of a row
+type keyedRow struct {
+	key    []interface{}
+	values []interface{}
+}
+
+// snapshotKeyCheck is the text whose fingerprint checks the snapshot key
+const snapshotKeyCheck = "snapshot key check"
+
+// TakeSnapshot takes a snapshot of up to sampleSize rows per table, keyed
+// with the snapshot key of the plan. Tables with a limit are left out, since
+// the rows the limit selects are not known before execution.
+func TakeSnapshot(ctx context.Context, db *sql.DB, plan *AnonymizationPlan, sampleSize int) (*Snapshot, error) {
+	if len(plan.SnapshotKey) == 0 {
+		return nil, fmt.Errorf("a snapshot_key is required to take a snapshot")
+	}
+
+	snapshot := &Snapshot{
+		Tables: make(map[string]*TableSnapshot),
+		key:    plan.SnapshotKey,
+	}
+	snapshot.KeyCheck = snapshot.fingerprint(snapshotKeyCheck)
+	sqlGen := NewSQLGenerator(plan, plan.Dialect)
+
+	for _, tablePlan := range plan.Tables {
+		if tablePlan.Action != ActionAnonymize || tablePlan.Limit > 0 {
+			continue
+		}
+
+		primaryKey := tablePlan.PrimaryKey
+		if len(primaryKey) == 0 {
+			var err error
+			primaryKey, err = database.GetPrimaryKey(db, plan.Dialect.Driver(), tablePlan.Name)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: %w", tablePlan.Name, err)
+			}
+		}
+
+		sampled := *tablePlan
+		sampled.PrimaryKey = primaryKey
+		columns := columnNames(tablePlan.Columns)
+
+		rows, err := readKeyedRows(ctx, db, sqlGen.GenerateSampleSQL(&sampled, columns, sampleSize), nil, len(primaryKey), len(columns))
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample table %s: %w", tablePlan.Name, err)
+		}
+
+		tableSnapshot := &TableSnapshot{PrimaryKey: primaryKey, Rows: make([]SnapshotRow, 0, len(rows))}
+		for _, row := range rows {
+			snapshotRow := SnapshotRow{Key: row.key, Fingerprints: make(map[string]string, len(columns))}
+			for i, column := range columns {
+				if row.values[i] != nil {
+					snapshotRow.Fingerprints[column] = snapshot.fingerprint(row.values[i])
+				}
+			}
+			tableSnapshot.Rows = append(tableSnapshot.Rows, snapshotRow)
+		}
+		snapshot.Tables[tablePlan.Name] = tableSnapshot
+	}
+
+	return snapshot, nil
+}
+
+// ReadSnapshot reads a snapshot from a file. It fails unless key is the key
+// the snapshot was taken with.
+func ReadSnapshot(filePath string, key []byte) (*Snapshot, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("a snapshot_key is required to read a snapshot")
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	// Keys are decoded as json.Number, so integers keep their precision
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+
+	snapshot := Snapshot{key: key}
+	if err := decoder.Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", filePath, err)
+	}
+	if !hmac.Equal([]byte(snapshot.fingerprint(snapshotKeyCheck)), []byte(snapshot.KeyCheck)) {
+		return nil, fmt.Errorf("snapshot %s was taken with another snapshot_key", filePath)
+	}
+
+	for _, tableSnapshot := range snapshot.Tables {
+		for _, row := range tableSnapshot.Rows {
+			decodeKey(row.Key)
+		}
+	}
+
+	return &snapshot, nil
+}
+
+// Write writes the snapshot to a file
+func (s *Snapshot) Write(filePath string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// decodeKey converts the json.Number values of a primary key decoded from
+// JSON to numbers, so they are bound as numbers, as they were read from the
+// database. Binary values and times encoded by encodeKey are converted back
+// to bytes and times.
+func decodeKey(key []interface{}) {
+	for i, value := range key {
+		switch v := value.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				key[i] = n
+			} else if f, err := v.Float64(); err == nil {
+				key[i] = f
+			}
+		case map[string]interface{}:
+			if encoded, ok := v["binary"].(string); ok {
+				if b, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+					key[i] = b
+				}
+			}
+			if encoded, ok := v["time"].(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, encoded); err == nil {
+					key[i] = t
+				}
+			}
+		}
+	}
+}
+
+// fingerprint returns the fingerprint of a value: its HMAC-SHA256 keyed with
+// the snapshot key, shortened to 128 bits
+func (s *Snapshot) fingerprint(value interface{}) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(fmt.Sprintf("%v", value)))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// readKeyedRows runs a query that selects keyColumns primary key columns
+// followed by columns other columns and returns its rows with normalized
+// values
+func readKeyedRows(ctx context.Context, db *sql.DB, query string, args []interface{}, keyColumns, columns int) ([]keyedRow, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []keyedRow
+	for rows.Next() {
+		scanned := make([]interface{}, keyColumns+columns)
+		dest := make([]interface{}, len(scanned))
+		for i := range scanned {
+			dest[i] = &scanned[i]
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		for i := range scanned {
+			scanned[i] = normalizeValue(scanned[i])
+		}
+		result = append(result, keyedRow{key: scanned[:keyColumns], values: scanned[keyColumns:]})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// columnNames returns the names of columns
+func columnNames(columns []*ColumnPlan) []string {
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.Name)
+	}
+	return names
+}
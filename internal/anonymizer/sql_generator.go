@@ -3,34 +3,42 @@ package anonymizer
 import (
 	"fmt"
 	"strings"
+	"time"
+
+	"db-gdpr-anonymizer/internal/database"
 )
 
 // SQLGenerator generates SQL statements for anonymization
 type SQLGenerator struct {
-	plan *AnonymizationPlan
+	plan    *AnonymizationPlan
+	dialect database.Dialect
 }
 
-// NewSQLGenerator creates a new SQL generator
-func NewSQLGenerator(plan *AnonymizationPlan) *SQLGenerator {
+// NewSQLGenerator creates a new SQL generator for the given dialect
+func NewSQLGenerator(plan *AnonymizationPlan, dialect database.Dialect) *SQLGenerator {
 	return &SQLGenerator{
-		plan: plan,
+		plan:    plan,
+		dialect: dialect,
 	}
 }
 
-// GenerateTableSQL generates SQL statements for anonymizing a table
-func (g *SQLGenerator) GenerateTableSQL(tablePlan *TablePlan) (string, error) {
+// GenerateTableSQL generates SQL statements for anonymizing a table with
+// the arguments to bind to its parameters. Columns with value strategies
+// need a value per row and are written with GenerateBatchUpdateSQL instead.
+func (g *SQLGenerator) GenerateTableSQL(tablePlan *TablePlan) (string, []interface{}, error) {
 	if len(tablePlan.Columns) == 0 {
-		return "", fmt.Errorf("no columns to anonymize in table %s", tablePlan.Name)
+		return "", nil, fmt.Errorf("no columns to anonymize in table %s", tablePlan.Name)
 	}
 
+	params := g.newParameters()
+
 	// Build SET clause
 	setClause := make([]string, 0, len(tablePlan.Columns))
 	for _, column := range tablePlan.Columns {
-		setClause = append(setClause, fmt.Sprintf(
-			"%s = %s",
-			column.Name,
-			column.Strategy.GenerateSQL(tablePlan.Name, column.Name),
-		))
+		if _, ok := column.Strategy.(ValueStrategy); ok {
+			return "", nil, fmt.Errorf("column %s.%s needs a value per row and cannot be updated for the whole table", tablePlan.Name, column.Name)
+		}
+		setClause = append(setClause, fmt.Sprintf("%s = %s", g.quote(column.Name), g.columnExpression(tablePlan, column, params)))
 	}
 
 	// Build WHERE clause
@@ -39,29 +47,47 @@ func (g *SQLGenerator) GenerateTableSQL(tablePlan *TablePlan) (string, error) {
 		whereClause = fmt.Sprintf("WHERE %s", tablePlan.Where)
 	}
 
-	// Build LIMIT clause
+	// Build LIMIT and ORDER BY clauses
 	limitClause := ""
-	if tablePlan.Limit > 0 {
-		limitClause = fmt.Sprintf("LIMIT %d", tablePlan.Limit)
-	}
-
-	// Build ORDER BY clause
 	orderByClause := ""
-	if tablePlan.OrderBy != "" {
-		orderByClause = fmt.Sprintf("ORDER BY %s", tablePlan.OrderBy)
+	if g.dialect.SupportsUpdateLimit() {
+		if tablePlan.Limit > 0 {
+			limitClause = fmt.Sprintf("LIMIT %d", tablePlan.Limit)
+		}
+		if tablePlan.OrderBy != "" {
+			orderByClause = fmt.Sprintf("ORDER BY %s", tablePlan.OrderBy)
+		}
+	} else if tablePlan.Limit > 0 {
+		// Select the limited rows by primary key in a subquery instead. The
+		// order only matters together with a limit, so it is dropped otherwise.
+		if len(tablePlan.PrimaryKey) == 0 {
+			return "", nil, fmt.Errorf("limit on table %s requires a primary key", tablePlan.Name)
+		}
+		if len(tablePlan.PrimaryKey) > 1 && !g.dialect.SupportsRowValues() {
+			return "", nil, fmt.Errorf("limit on table %s with a composite primary key is not supported by %s", tablePlan.Name, g.dialect.Driver())
+		}
+		rest := fmt.Sprintf("FROM %s", g.quote(tablePlan.Name))
+		if tablePlan.Where != "" {
+			rest = fmt.Sprintf("%s WHERE %s", rest, tablePlan.Where)
+		}
+		if tablePlan.OrderBy != "" {
+			rest = fmt.Sprintf("%s ORDER BY %s", rest, tablePlan.OrderBy)
+		}
+		subquery := g.selectSQL(strings.Join(g.quoteAll(tablePlan.PrimaryKey), ", "), rest, tablePlan.Limit)
+		whereClause = fmt.Sprintf("WHERE %s IN (%s)", g.keyTuple(tablePlan.PrimaryKey), subquery)
 	}
 
 	// Build the complete SQL statement
 	sql := fmt.Sprintf(
 		"UPDATE %s SET %s %s %s %s",
-		tablePlan.Name,
+		g.quote(tablePlan.Name),
 		strings.Join(setClause, ", "),
 		whereClause,
 		orderByClause,
 		limitClause,
 	)
 
-	return sql, nil
+	return sql, params.args, nil
 }
 
 // GenerateCountSQL generates SQL statements for counting rows that will be anonymized
@@ -71,108 +97,536 @@ func (g *SQLGenerator) GenerateCountSQL(tablePlan *TablePlan) string {
 		whereClause = fmt.Sprintf("WHERE %s", tablePlan.Where)
 	}
 
-	return fmt.Sprintf("SELECT COUNT(*) FROM %s %s", tablePlan.Name, whereClause)
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s %s", g.quote(tablePlan.Name), whereClause)
 }
 
-// GenerateChunkedSQL generates SQL statements for anonymizing a table in chunks
-func (g *SQLGenerator) GenerateChunkedSQL(tablePlan *TablePlan, primaryKey string, chunkSize int, offset int) (string, error) {
-	if len(tablePlan.Columns) == 0 {
-		return "", fmt.Errorf("no columns to anonymize in table %s", tablePlan.Name)
+// GenerateKeysetSelectSQL generates SQL that reads the next chunk of rows in
+// primary key order: the primary key columns followed by columns. Paging
+// continues after lastKey, or starts at the beginning when lastKey is nil,
+// and reads no row after until unless it is nil. A table with a limit only
+// reads the limited rows, selected as by GenerateTableSQL.
+func (g *SQLGenerator) GenerateKeysetSelectSQL(tablePlan *TablePlan, columns []string, lastKey, until []interface{}) (string, []interface{}) {
+	params := g.newParameters()
+
+	selectList := make([]string, 0, len(tablePlan.PrimaryKey)+len(columns))
+	selectList = append(selectList, g.quoteAll(tablePlan.PrimaryKey)...)
+	selectList = append(selectList, g.quoteAll(columns)...)
+
+	// Build WHERE clause
+	conditions := make([]string, 0, 3)
+	if lastKey != nil {
+		conditions = append(conditions, g.keyAfter(tablePlan.PrimaryKey, lastKey, params))
+	}
+	if until != nil {
+		conditions = append(conditions, fmt.Sprintf("NOT %s", g.keyAfter(tablePlan.PrimaryKey, until, params)))
+	}
+	if tablePlan.Where != "" {
+		conditions = append(conditions, fmt.Sprintf("(%s)", tablePlan.Where))
+	}
+	if tablePlan.Limit > 0 {
+		conditions = append(conditions, g.limitCondition(tablePlan))
 	}
 
-	if primaryKey == "" {
-		return "", fmt.Errorf("primary key is required for chunked anonymization")
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = fmt.Sprintf(" WHERE %s", strings.Join(conditions, " AND "))
 	}
 
-	// Build SET clause
-	setClause := make([]string, 0, len(tablePlan.Columns))
-	for _, column := range tablePlan.Columns {
-		setClause = append(setClause, fmt.Sprintf(
-			"%s = %s",
-			column.Name,
-			column.Strategy.GenerateSQL(tablePlan.Name, column.Name),
+	rest := fmt.Sprintf(
+		"FROM %s%s ORDER BY %s",
+		g.quote(tablePlan.Name),
+		whereClause,
+		strings.Join(g.quoteAll(tablePlan.PrimaryKey), ", "),
+	)
+
+	return g.selectSQL(strings.Join(selectList, ", "), rest, tablePlan.BatchSize), params.args
+}
+
+// limitCondition renders the condition selecting the rows within the limit of
+// a table: the first rows matching its where condition in its order, with
+// ties broken by primary key, so every chunk selects the same rows. The rows
+// are read through a derived table, since MySQL does not allow a limit in an
+// IN subquery.
+func (g *SQLGenerator) limitCondition(tablePlan *TablePlan) string {
+	primaryKey := strings.Join(g.quoteAll(tablePlan.PrimaryKey), ", ")
+	rest := fmt.Sprintf("FROM %s", g.quote(tablePlan.Name))
+	if tablePlan.Where != "" {
+		rest = fmt.Sprintf("%s WHERE (%s)", rest, tablePlan.Where)
+	}
+	if tablePlan.OrderBy != "" {
+		rest = fmt.Sprintf("%s ORDER BY %s, %s", rest, tablePlan.OrderBy, primaryKey)
+	} else {
+		rest = fmt.Sprintf("%s ORDER BY %s", rest, primaryKey)
+	}
+	limited := g.selectSQL(primaryKey, rest, tablePlan.Limit)
+
+	if len(tablePlan.PrimaryKey) == 1 || g.dialect.SupportsRowValues() {
+		return fmt.Sprintf("%s IN (SELECT %s FROM (%s) %s)", g.keyTuple(tablePlan.PrimaryKey), primaryKey, limited, g.quote("limited"))
+	}
+
+	conditions := make([]string, 0, len(tablePlan.PrimaryKey))
+	for _, column := range tablePlan.PrimaryKey {
+		conditions = append(conditions, fmt.Sprintf(
+			"%s.%s = %s.%s",
+			g.quote("limited"), g.quote(column),
+			g.quote(tablePlan.Name), g.quote(column),
 		))
 	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM (%s) %s WHERE %s)", limited, g.quote("limited"), strings.Join(conditions, " AND "))
+}
+
+// GenerateSampleSQL generates SQL that reads up to limit rows of a table
+// matching its where condition: the primary key columns followed by columns,
+// in primary key order
+func (g *SQLGenerator) GenerateSampleSQL(tablePlan *TablePlan, columns []string, limit int) string {
+	selectList := make([]string, 0, len(tablePlan.PrimaryKey)+len(columns))
+	selectList = append(selectList, g.quoteAll(tablePlan.PrimaryKey)...)
+	selectList = append(selectList, g.quoteAll(columns)...)
 
-	// Build WHERE clause with chunk boundaries
-	whereClause := fmt.Sprintf("%s >= %d AND %s < %d", primaryKey, offset, primaryKey, offset+chunkSize)
+	rest := fmt.Sprintf("FROM %s", g.quote(tablePlan.Name))
 	if tablePlan.Where != "" {
-		whereClause = fmt.Sprintf("(%s) AND %s", whereClause, tablePlan.Where)
+		rest = fmt.Sprintf("%s WHERE (%s)", rest, tablePlan.Where)
+	}
+	if len(tablePlan.PrimaryKey) > 0 {
+		rest = fmt.Sprintf("%s ORDER BY %s", rest, strings.Join(g.quoteAll(tablePlan.PrimaryKey), ", "))
 	}
 
-	// Build the complete SQL statement
+	return g.selectSQL(strings.Join(selectList, ", "), rest, limit)
+}
+
+// GenerateKeyLookupSQL generates SQL that reads the rows with the given
+// primary keys, whatever the where condition of the table: the primary key
+// columns followed by columns. It returns the arguments to bind with it.
+func (g *SQLGenerator) GenerateKeyLookupSQL(tablePlan *TablePlan, columns []string, keys [][]interface{}) (string, []interface{}) {
+	params := g.newParameters()
+
+	selectList := make([]string, 0, len(tablePlan.PrimaryKey)+len(columns))
+	selectList = append(selectList, g.quoteAll(tablePlan.PrimaryKey)...)
+	selectList = append(selectList, g.quoteAll(columns)...)
+
 	sql := fmt.Sprintf(
-		"UPDATE %s SET %s WHERE %s",
-		tablePlan.Name,
-		strings.Join(setClause, ", "),
-		whereClause,
+		"SELECT %s FROM %s WHERE %s",
+		strings.Join(selectList, ", "),
+		g.quote(tablePlan.Name),
+		g.keyIn(tablePlan.PrimaryKey, keys, params),
 	)
 
-	return sql, nil
+	return sql, params.args
 }
 
-// GeneratePrimaryKeyRangeSQL generates SQL to get the min and max primary key values
-func (g *SQLGenerator) GeneratePrimaryKeyRangeSQL(tableName string, primaryKey string, whereClause string) string {
-	where := ""
-	if whereClause != "" {
-		where = fmt.Sprintf("WHERE %s", whereClause)
+// GenerateTruncateSQL generates SQL that empties a table. Databases without
+// TRUNCATE TABLE delete all rows instead.
+func (g *SQLGenerator) GenerateTruncateSQL(tablePlan *TablePlan) string {
+	if !g.dialect.SupportsTruncate() {
+		return g.GenerateDeleteAllSQL(tablePlan)
 	}
+	return fmt.Sprintf("TRUNCATE TABLE %s", g.quote(tablePlan.Name))
+}
 
+// GenerateDeleteAllSQL generates SQL that deletes every row of a table, for
+// tables that cannot be truncated because other tables reference them
+func (g *SQLGenerator) GenerateDeleteAllSQL(tablePlan *TablePlan) string {
+	return fmt.Sprintf("DELETE FROM %s", g.quote(tablePlan.Name))
+}
+
+// GenerateDeleteSQL generates SQL that deletes the rows selected by a delete step
+func (g *SQLGenerator) GenerateDeleteSQL(step DeleteStep) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", g.quote(step.Table), step.Condition)
+}
+
+// GenerateUnlinkSQL generates SQL that sets a self referencing foreign key of
+// a delete step to NULL in the rows that reference rows the step deletes
+func (g *SQLGenerator) GenerateUnlinkSQL(step DeleteStep, foreignKey database.ForeignKey) string {
+	assignments := make([]string, 0, len(foreignKey.Columns))
+	for _, column := range foreignKey.Columns {
+		assignments = append(assignments, fmt.Sprintf("%s = NULL", g.quote(column)))
+	}
 	return fmt.Sprintf(
-		"SELECT MIN(%s), MAX(%s) FROM %s %s",
-		primaryKey,
-		primaryKey,
-		tableName,
-		where,
+		"UPDATE %s SET %s WHERE %s",
+		g.quote(step.Table),
+		strings.Join(assignments, ", "),
+		g.selfReferenceCondition(foreignKey, step.Condition),
 	)
 }
 
-// GenerateSingleRowSQL generates SQL for anonymizing a single row
-func (g *SQLGenerator) GenerateSingleRowSQL(tablePlan *TablePlan, primaryKey string, pkValue int) (string, error) {
+// GenerateDeleteCountSQL generates SQL that counts the rows selected by a delete step
+func (g *SQLGenerator) GenerateDeleteCountSQL(step DeleteStep) string {
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", g.quote(step.Table), step.Condition)
+}
+
+// RowUpdate holds the replacement values computed in Go for the value
+// strategy columns of a single row
+type RowUpdate struct {
+	PrimaryKey []interface{}
+	Values     map[string]interface{}
+}
+
+// GenerateBatchUpdateSQL generates a single statement that anonymizes all
+// rows of a batch, each with its own values for the value strategy columns,
+// together with the arguments to bind to its parameters:
+//
+//	UPDATE t SET c = CASE pk WHEN ? THEN ? ... ELSE c END WHERE pk IN (?, ...)
+//
+// Composite keys use CASE WHEN a = ? AND b = ? THEN ... and a tuple IN list.
+// The CASE form works for every dialect: each parameter is compared with or
+// falls back to a column, which gives PostgreSQL the type to bind it with.
+func (g *SQLGenerator) GenerateBatchUpdateSQL(tablePlan *TablePlan, rows []RowUpdate) (string, []interface{}, error) {
 	if len(tablePlan.Columns) == 0 {
-		return "", fmt.Errorf("no columns to anonymize in table %s", tablePlan.Name)
+		return "", nil, fmt.Errorf("no columns to anonymize in table %s", tablePlan.Name)
+	}
+
+	if len(tablePlan.PrimaryKey) == 0 {
+		return "", nil, fmt.Errorf("primary key is required for batch anonymization")
+	}
+
+	if len(rows) == 0 {
+		return "", nil, fmt.Errorf("no rows to anonymize in batch for table %s", tablePlan.Name)
 	}
 
-	if primaryKey == "" {
-		return "", fmt.Errorf("primary key is required for single row anonymization")
+	for _, row := range rows {
+		if len(row.PrimaryKey) != len(tablePlan.PrimaryKey) {
+			return "", nil, fmt.Errorf("primary key of table %s has %d columns, got %d values", tablePlan.Name, len(tablePlan.PrimaryKey), len(row.PrimaryKey))
+		}
+		for _, column := range tablePlan.ValueColumns() {
+			if _, ok := row.Values[column.Name]; !ok {
+				return "", nil, fmt.Errorf("no value computed for column %s.%s", tablePlan.Name, column.Name)
+			}
+		}
 	}
 
+	params := g.newParameters()
+	singleKey := len(tablePlan.PrimaryKey) == 1
+
 	// Build SET clause
 	setClause := make([]string, 0, len(tablePlan.Columns))
 	for _, column := range tablePlan.Columns {
-		// For FakerStrategy, we need to include the primary key value in the placeholder
-		// to ensure each row gets unique fake data
-		if strategy, ok := column.Strategy.(*FakerStrategy); ok {
-			// Create a custom placeholder that includes the primary key value
-			placeholder := fmt.Sprintf("'[FAKER:%s:%s:%s:%d]'", strategy.FakerType, tablePlan.Name, column.Name, pkValue)
-			setClause = append(setClause, fmt.Sprintf(
-				"%s = %s",
-				column.Name,
-				placeholder,
-			))
-		} else {
-			// For other strategies, use the normal GenerateSQL method
-			setClause = append(setClause, fmt.Sprintf(
-				"%s = %s",
-				column.Name,
-				column.Strategy.GenerateSQL(tablePlan.Name, column.Name),
-			))
-		}
-	}
-
-	// Build WHERE clause for a single row
-	whereClause := fmt.Sprintf("%s = %d", primaryKey, pkValue)
+		if _, ok := column.Strategy.(ValueStrategy); !ok {
+			setClause = append(setClause, fmt.Sprintf("%s = %s", g.quote(column.Name), g.columnExpression(tablePlan, column, params)))
+			continue
+		}
+
+		var caseExpr strings.Builder
+		caseExpr.WriteString("CASE")
+		if singleKey {
+			fmt.Fprintf(&caseExpr, " %s", g.quote(tablePlan.PrimaryKey[0]))
+		}
+		for _, row := range rows {
+			caseExpr.WriteString(" WHEN ")
+			if singleKey {
+				caseExpr.WriteString(params.add(row.PrimaryKey[0]))
+			} else {
+				caseExpr.WriteString(g.keyEquals(tablePlan.PrimaryKey, row.PrimaryKey, params))
+			}
+			fmt.Fprintf(&caseExpr, " THEN %s", params.add(row.Values[column.Name]))
+		}
+		fmt.Fprintf(&caseExpr, " ELSE %s END", g.quote(column.Name))
+
+		setClause = append(setClause, fmt.Sprintf("%s = %s", g.quote(column.Name), caseExpr.String()))
+	}
+
+	// Build WHERE clause restricted to the rows of the batch
+	keys := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, row.PrimaryKey)
+	}
+	whereClause := g.keyIn(tablePlan.PrimaryKey, keys, params)
 	if tablePlan.Where != "" {
-		whereClause = fmt.Sprintf("(%s) AND %s", whereClause, tablePlan.Where)
+		whereClause = fmt.Sprintf("%s AND (%s)", whereClause, tablePlan.Where)
+	}
+
+	if maxParameters := g.dialect.MaxParameters(); len(params.args) > maxParameters {
+		return "", nil, fmt.Errorf("batch of table %s needs %d parameters, more than the %d a statement can bind; lower its batch_size", tablePlan.Name, len(params.args), maxParameters)
 	}
 
-	// Build the complete SQL statement
 	sql := fmt.Sprintf(
 		"UPDATE %s SET %s WHERE %s",
-		tablePlan.Name,
+		g.quote(tablePlan.Name),
 		strings.Join(setClause, ", "),
 		whereClause,
 	)
 
-	return sql, nil
+	return sql, params.args, nil
+}
+
+// GenerateCreateTableSQL generates SQL that creates a table with the given
+// columns and primary key. Defaults, indexes and foreign keys are not part of
+// the definition.
+func (g *SQLGenerator) GenerateCreateTableSQL(tableName string, columns []database.ColumnDefinition, primaryKey []string) string {
+	definitions := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		definition := fmt.Sprintf("%s %s", g.quote(column.Name), column.Type)
+		if !column.Nullable {
+			definition += " NOT NULL"
+		}
+		definitions = append(definitions, definition)
+	}
+	if len(primaryKey) > 0 {
+		definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(g.quoteAll(primaryKey), ", ")))
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (%s)", g.quote(tableName), strings.Join(definitions, ", "))
+}
+
+// GenerateCopySelectSQL generates SQL that reads every row of a table to copy
+// it: the columns in table order, with SQL expression strategies evaluated
+// for the rows matching the where condition of the table. Tables with a where
+// condition select whether each row matches it as an additional last column.
+// Rows matching any of the exclusions are left out.
+func (g *SQLGenerator) GenerateCopySelectSQL(tablePlan *TablePlan, columns []string, exclusions []string) string {
+	expressions := make(map[string]string)
+	for _, column := range tablePlan.Columns {
+		if expression, ok := column.Strategy.(*ExpressionStrategy); ok {
+			expressions[column.Name] = expression.Expression
+		}
+	}
+
+	selectList := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		expression, ok := expressions[column]
+		switch {
+		case !ok:
+			selectList = append(selectList, g.quote(column))
+		case tablePlan.Where != "":
+			selectList = append(selectList, fmt.Sprintf("CASE WHEN (%s) THEN (%s) ELSE %s END", tablePlan.Where, expression, g.quote(column)))
+		default:
+			selectList = append(selectList, fmt.Sprintf("(%s)", expression))
+		}
+	}
+	if tablePlan.Where != "" {
+		selectList = append(selectList, fmt.Sprintf("CASE WHEN (%s) THEN 1 ELSE 0 END", tablePlan.Where))
+	}
+
+	sql := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selectList, ", "), g.quote(tablePlan.Name))
+	if len(exclusions) > 0 {
+		// A condition that evaluates to NULL excludes nothing, as in DELETE
+		conditions := make([]string, 0, len(exclusions))
+		for _, exclusion := range exclusions {
+			conditions = append(conditions, fmt.Sprintf("(%s)", exclusion))
+		}
+		sql = fmt.Sprintf("%s WHERE CASE WHEN %s THEN 1 ELSE 0 END = 0", sql, strings.Join(conditions, " OR "))
+	}
+	return sql
+}
+
+// GenerateInsertSQL generates a single statement that inserts rows into the
+// columns of a table, together with the arguments to bind to its parameters
+func (g *SQLGenerator) GenerateInsertSQL(tableName string, columns []string, rows [][]interface{}) (string, []interface{}, error) {
+	if len(rows) == 0 {
+		return "", nil, fmt.Errorf("no rows to insert into table %s", tableName)
+	}
+
+	params := g.newParameters()
+	values := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if len(row) != len(columns) {
+			return "", nil, fmt.Errorf("table %s has %d columns, got %d values", tableName, len(columns), len(row))
+		}
+		placeholders := make([]string, 0, len(row))
+		for _, value := range row {
+			placeholders = append(placeholders, params.add(value))
+		}
+		values = append(values, fmt.Sprintf("(%s)", strings.Join(placeholders, ", ")))
+	}
+
+	if maxParameters := g.dialect.MaxParameters(); len(params.args) > maxParameters {
+		return "", nil, fmt.Errorf("insert into table %s needs %d parameters, more than the %d a statement can bind", tableName, len(params.args), maxParameters)
+	}
+
+	sql := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES %s",
+		g.quote(tableName),
+		strings.Join(g.quoteAll(columns), ", "),
+		strings.Join(values, ", "),
+	)
+
+	return sql, params.args, nil
+}
+
+// maxInsertRows returns the number of rows of a table with the given number
+// of columns that GenerateInsertSQL can write in one statement, up to the
+// batch size of the table
+func (g *SQLGenerator) maxInsertRows(tablePlan *TablePlan, columns int) int {
+	rows := tablePlan.BatchSize
+	if columns > 0 && g.dialect.MaxParameters()/columns < rows {
+		rows = g.dialect.MaxParameters() / columns
+	}
+	if rows < 1 {
+		return 1
+	}
+	return rows
+}
+
+// maxBatchRows returns the number of rows that GenerateBatchUpdateSQL can
+// write in one statement without binding more parameters than the dialect
+// allows
+func (g *SQLGenerator) maxBatchRows(tablePlan *TablePlan) int {
+	keyColumns := len(tablePlan.PrimaryKey)
+	valueColumns := len(tablePlan.ValueColumns())
+
+	// Fixed values are bound once per statement, every row binds its key in
+	// the WHERE clause and its key and value in the CASE of each value column
+	fixed := 0
+	for _, column := range tablePlan.Columns {
+		if _, ok := column.Strategy.(*FixedValueStrategy); ok {
+			fixed++
+		}
+	}
+	perRow := keyColumns + valueColumns*(keyColumns+1)
+	if perRow == 0 {
+		return tablePlan.BatchSize
+	}
+
+	if rows := (g.dialect.MaxParameters() - fixed) / perRow; rows > 1 {
+		return rows
+	}
+	return 1
+}
+
+// columnExpression renders the SQL expression of a column whose strategy does
+// not compute values per row. Fixed values are bound as parameters.
+func (g *SQLGenerator) columnExpression(tablePlan *TablePlan, column *ColumnPlan, params *parameters) string {
+	if fixed, ok := column.Strategy.(*FixedValueStrategy); ok {
+		return params.add(fixed.Value)
+	}
+	return column.Strategy.GenerateSQL(g.quote(tablePlan.Name), g.quote(column.Name))
+}
+
+// quote quotes an identifier for the dialect
+func (g *SQLGenerator) quote(name string) string {
+	return g.dialect.QuoteIdentifier(name)
+}
+
+// quoteAll quotes a list of identifiers for the dialect
+func (g *SQLGenerator) quoteAll(names []string) []string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, g.quote(name))
+	}
+	return quoted
+}
+
+// keyTuple renders key columns as a row value, or as the bare column for
+// single column keys
+func (g *SQLGenerator) keyTuple(columns []string) string {
+	if len(columns) == 1 {
+		return g.quote(columns[0])
+	}
+	return fmt.Sprintf("(%s)", strings.Join(g.quoteAll(columns), ", "))
+}
+
+// keyEquals renders a condition matching key columns to the values bound
+// for them: a = ? AND b = ?
+func (g *SQLGenerator) keyEquals(columns []string, values []interface{}, params *parameters) string {
+	conditions := make([]string, 0, len(columns))
+	for i, column := range columns {
+		conditions = append(conditions, fmt.Sprintf("%s = %s", g.quote(column), params.add(values[i])))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// keyIn renders a condition matching the rows with one of keys:
+// pk IN (?, ?) or (a, b) IN ((?, ?), (?, ?)). Without row values, every
+// composite key is matched column by column instead.
+func (g *SQLGenerator) keyIn(columns []string, keys [][]interface{}, params *parameters) string {
+	if len(columns) == 1 || g.dialect.SupportsRowValues() {
+		tuples := make([]string, 0, len(keys))
+		for _, key := range keys {
+			tuples = append(tuples, params.addTuple(key))
+		}
+		keyList := fmt.Sprintf("(%s)", strings.Join(tuples, ", "))
+		if len(columns) > 1 {
+			keyList = g.dialect.RowValueList(tuples)
+		}
+		return fmt.Sprintf("%s IN %s", g.keyTuple(columns), keyList)
+	}
+
+	conditions := make([]string, 0, len(keys))
+	for _, key := range keys {
+		conditions = append(conditions, fmt.Sprintf("(%s)", g.keyEquals(columns, key, params)))
+	}
+	return fmt.Sprintf("(%s)", strings.Join(conditions, " OR "))
+}
+
+// keyAfter renders a condition selecting the keys that follow values in key
+// order. Without row values, (a, b) > (?, ?) is spelled out as
+// (a > ? OR (a = ? AND b > ?)).
+func (g *SQLGenerator) keyAfter(columns []string, values []interface{}, params *parameters) string {
+	if len(columns) == 1 || g.dialect.SupportsRowValues() {
+		return fmt.Sprintf("%s > %s", g.keyTuple(columns), params.addTuple(values))
+	}
+
+	alternatives := make([]string, 0, len(columns))
+	for i, column := range columns {
+		// Bind the parameters in the order they appear in the statement
+		if i == 0 {
+			alternatives = append(alternatives, fmt.Sprintf("%s > %s", g.quote(column), params.add(values[i])))
+			continue
+		}
+		equal := g.keyEquals(columns[:i], values[:i], params)
+		alternatives = append(alternatives, fmt.Sprintf("(%s AND %s > %s)", equal, g.quote(column), params.add(values[i])))
+	}
+	return fmt.Sprintf("(%s)", strings.Join(alternatives, " OR "))
+}
+
+// selectSQL renders a SELECT of selectList followed by rest, the FROM clause
+// and everything after it, restricted to limit rows
+func (g *SQLGenerator) selectSQL(selectList, rest string, limit int) string {
+	top, limitClause := g.dialect.LimitClauses(limit)
+	if top != "" {
+		selectList = fmt.Sprintf("%s %s", top, selectList)
+	}
+	sql := fmt.Sprintf("SELECT %s %s", selectList, rest)
+	if limitClause != "" {
+		sql = fmt.Sprintf("%s %s", sql, limitClause)
+	}
+	return sql
+}
+
+// parameters collects the arguments bound to the parameters of a statement
+type parameters struct {
+	dialect database.Dialect
+	args    []interface{}
+}
+
+// newParameters starts collecting the arguments of a new statement
+func (g *SQLGenerator) newParameters() *parameters {
+	return &parameters{dialect: g.dialect}
+}
+
+// add binds value to the next parameter and returns its placeholder
+func (p *parameters) add(value interface{}) string {
+	p.args = append(p.args, value)
+	return p.dialect.Placeholder(len(p.args))
+}
+
+// addTuple binds values like add and returns their placeholders as a row
+// value, or as a single placeholder for one value
+func (p *parameters) addTuple(values []interface{}) string {
+	placeholders := make([]string, 0, len(values))
+	for _, value := range values {
+		placeholders = append(placeholders, p.add(value))
+	}
+	if len(placeholders) == 1 {
+		return placeholders[0]
+	}
+	return fmt.Sprintf("(%s)", strings.Join(placeholders, ", "))
+}
+
+// sqlLiteral renders a Go value as a SQL literal
+func sqlLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(v, "'", "''"))
+	case time.Time:
+		return fmt.Sprintf("'%s'", v.Format("2006-01-02 15:04:05.999999-07:00"))
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case nil:
+		return "NULL"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
 }
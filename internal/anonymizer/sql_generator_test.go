@@ -1,8 +1,12 @@
 package anonymizer
 
 import (
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"db-gdpr-anonymizer/internal/database"
 )
 
 func TestGenerateTableSQL(t *testing.T) {
@@ -31,20 +35,25 @@ func TestGenerateTableSQL(t *testing.T) {
 	}
 
 	// Create SQL generator
-	generator := NewSQLGenerator(plan)
+	generator := NewSQLGenerator(plan, database.MySQLDialect{})
+
+	// Faker values are computed per row and cannot be set for the whole table
+	if _, _, err := generator.GenerateTableSQL(plan.Tables[0]); err == nil {
+		t.Error("Expected error for faker column, got nil")
+	}
 
 	// Generate SQL for the table
-	sql, err := generator.GenerateTableSQL(plan.Tables[0])
+	plan.Tables[0].Columns = plan.Tables[0].Columns[1:]
+	sql, args, err := generator.GenerateTableSQL(plan.Tables[0])
 	if err != nil {
 		t.Fatalf("Failed to generate SQL: %v", err)
 	}
 
 	// Verify SQL
 	expectedParts := []string{
-		"UPDATE customer_entity SET",
-		"email = FAKER('email')",
-		"firstname = 'John'",
-		"lastname = NULL",
+		"UPDATE `customer_entity` SET",
+		"`firstname` = ?",
+		"`lastname` = NULL",
 		"WHERE entity_id > 1000",
 	}
 
@@ -53,47 +62,10 @@ func TestGenerateTableSQL(t *testing.T) {
 			t.Errorf("Expected SQL to contain '%s', but it doesn't: %s", part, sql)
 		}
 	}
-}
 
-func TestGenerateChunkedSQL(t *testing.T) {
-	// Create a test plan
-	tablePlan := &TablePlan{
-		Name:       "customer_entity",
-		PrimaryKey: "entity_id",
-		Where:      "is_active = 1",
-		Columns: []*ColumnPlan{
-			{
-				Name:     "email",
-				Strategy: &FakerStrategy{FakerType: "email"},
-			},
-			{
-				Name:     "firstname",
-				Strategy: &FixedValueStrategy{Value: "John"},
-			},
-		},
-	}
-
-	// Create SQL generator
-	generator := NewSQLGenerator(&AnonymizationPlan{})
-
-	// Generate chunked SQL
-	sql, err := generator.GenerateChunkedSQL(tablePlan, "entity_id", 1000, 5000)
-	if err != nil {
-		t.Fatalf("Failed to generate chunked SQL: %v", err)
-	}
-
-	// Verify SQL
-	expectedParts := []string{
-		"UPDATE customer_entity SET",
-		"email = FAKER('email')",
-		"firstname = 'John'",
-		"WHERE (entity_id >= 5000 AND entity_id < 6000) AND is_active = 1",
-	}
-
-	for _, part := range expectedParts {
-		if !strings.Contains(sql, part) {
-			t.Errorf("Expected SQL to contain '%s', but it doesn't: %s", part, sql)
-		}
+	// Fixed values are bound as arguments
+	if !reflect.DeepEqual(args, []interface{}{"John"}) {
+		t.Errorf("Expected args to be [John], got %v", args)
 	}
 }
 
@@ -105,13 +77,13 @@ func TestGenerateCountSQL(t *testing.T) {
 	}
 
 	// Create SQL generator
-	generator := NewSQLGenerator(&AnonymizationPlan{})
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.MySQLDialect{})
 
 	// Generate count SQL
 	sql := generator.GenerateCountSQL(tablePlan)
 
 	// Verify SQL
-	expected := "SELECT COUNT(*) FROM customer_entity WHERE is_active = 1"
+	expected := "SELECT COUNT(*) FROM `customer_entity` WHERE is_active = 1"
 	if sql != expected {
 		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
 	}
@@ -119,31 +91,169 @@ func TestGenerateCountSQL(t *testing.T) {
 	// Test without where clause
 	tablePlan.Where = ""
 	sql = generator.GenerateCountSQL(tablePlan)
-	expected = "SELECT COUNT(*) FROM customer_entity "
+	expected = "SELECT COUNT(*) FROM `customer_entity` "
 	if sql != expected {
 		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
 	}
 }
 
-func TestGeneratePrimaryKeyRangeSQL(t *testing.T) {
-	// Create SQL generator
-	generator := NewSQLGenerator(&AnonymizationPlan{})
+func TestGenerateKeysetSelectSQL(t *testing.T) {
+	tablePlan := &TablePlan{
+		Name:       "customer_entity",
+		PrimaryKey: []string{"entity_id"},
+		Where:      "is_active = 1",
+		BatchSize:  500,
+	}
 
-	// Generate primary key range SQL
-	sql := generator.GeneratePrimaryKeyRangeSQL("customer_entity", "entity_id", "is_active = 1")
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.MySQLDialect{})
 
-	// Verify SQL
-	expected := "SELECT MIN(entity_id), MAX(entity_id) FROM customer_entity WHERE is_active = 1"
+	// Test first chunk
+	sql, args := generator.GenerateKeysetSelectSQL(tablePlan, []string{"email"}, nil, nil)
+	expected := "SELECT `entity_id`, `email` FROM `customer_entity` WHERE (is_active = 1) ORDER BY `entity_id` LIMIT 500"
 	if sql != expected {
 		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
 	}
+	if len(args) != 0 {
+		t.Errorf("Expected no args, got %v", args)
+	}
 
-	// Test without where clause
-	sql = generator.GeneratePrimaryKeyRangeSQL("customer_entity", "entity_id", "")
-	expected = "SELECT MIN(entity_id), MAX(entity_id) FROM customer_entity "
+	// Test following chunk
+	sql, args = generator.GenerateKeysetSelectSQL(tablePlan, []string{"email"}, []interface{}{int64(1500)}, nil)
+	expected = "SELECT `entity_id`, `email` FROM `customer_entity` WHERE `entity_id` > ? AND (is_active = 1) ORDER BY `entity_id` LIMIT 500"
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{int64(1500)}) {
+		t.Errorf("Expected args to be [1500], got %v", args)
+	}
+
+	// Test chunk bounded by the key of a chunk completed before
+	sql, args = generator.GenerateKeysetSelectSQL(tablePlan, []string{"email"}, []interface{}{int64(1500)}, []interface{}{int64(3000)})
+	expected = "SELECT `entity_id`, `email` FROM `customer_entity` WHERE `entity_id` > ? AND NOT `entity_id` > ? AND (is_active = 1) ORDER BY `entity_id` LIMIT 500"
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{int64(1500), int64(3000)}) {
+		t.Errorf("Expected args to be [1500 3000], got %v", args)
+	}
+
+	// Test limited chunk, which only reads the limited rows
+	limited := *tablePlan
+	limited.Limit = 100
+	limited.OrderBy = "created_at DESC"
+	sql, _ = generator.GenerateKeysetSelectSQL(&limited, []string{"email"}, []interface{}{int64(1500)}, nil)
+	expected = "SELECT `entity_id`, `email` FROM `customer_entity` WHERE `entity_id` > ? AND (is_active = 1) AND " +
+		"`entity_id` IN (SELECT `entity_id` FROM (SELECT `entity_id` FROM `customer_entity` WHERE (is_active = 1) ORDER BY created_at DESC, `entity_id` LIMIT 100) `limited`) " +
+		"ORDER BY `entity_id` LIMIT 500"
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+
+	// Test composite non-integer key without where clause
+	tablePlan = &TablePlan{
+		Name:       "catalog_product_option_type_price",
+		PrimaryKey: []string{"option_type_id", "store_code"},
+		BatchSize:  100,
+	}
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.PostgresDialect{})
+	sql, args = generator.GenerateKeysetSelectSQL(tablePlan, nil, []interface{}{int64(7), "de"}, nil)
+	expected = `SELECT "option_type_id", "store_code" FROM "catalog_product_option_type_price" ` +
+		`WHERE ("option_type_id", "store_code") > ($1, $2) ORDER BY "option_type_id", "store_code" LIMIT 100`
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{int64(7), "de"}) {
+		t.Errorf("Expected args to be [7 de], got %v", args)
+	}
+
+	// Test SQL Server, which limits with TOP and has no row value comparison
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.SQLServerDialect{})
+	sql, args = generator.GenerateKeysetSelectSQL(tablePlan, nil, []interface{}{int64(7), "de"}, nil)
+	expected = "SELECT TOP (100) [option_type_id], [store_code] FROM [catalog_product_option_type_price] " +
+		"WHERE ([option_type_id] > @p1 OR ([option_type_id] = @p2 AND [store_code] > @p3)) ORDER BY [option_type_id], [store_code]"
 	if sql != expected {
 		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
 	}
+	if !reflect.DeepEqual(args, []interface{}{int64(7), int64(7), "de"}) {
+		t.Errorf("Expected args to be [7 7 de], got %v", args)
+	}
+
+	// Test limited composite key on SQL Server, matched column by column
+	limited = *tablePlan
+	limited.Limit = 10
+	sql, _ = generator.GenerateKeysetSelectSQL(&limited, nil, nil, nil)
+	expected = "SELECT TOP (100) [option_type_id], [store_code] FROM [catalog_product_option_type_price] " +
+		"WHERE EXISTS (SELECT 1 FROM (SELECT TOP (10) [option_type_id], [store_code] FROM [catalog_product_option_type_price] ORDER BY [option_type_id], [store_code]) [limited] " +
+		"WHERE [limited].[option_type_id] = [catalog_product_option_type_price].[option_type_id] AND [limited].[store_code] = [catalog_product_option_type_price].[store_code]) " +
+		"ORDER BY [option_type_id], [store_code]"
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+}
+
+func TestGenerateSampleSQL(t *testing.T) {
+	tablePlan := &TablePlan{
+		Name:       "customer_entity",
+		PrimaryKey: []string{"entity_id"},
+		Where:      "is_active = 1",
+	}
+
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.MySQLDialect{})
+	sql := generator.GenerateSampleSQL(tablePlan, []string{"email"}, 1000)
+	expected := "SELECT `entity_id`, `email` FROM `customer_entity` WHERE (is_active = 1) ORDER BY `entity_id` LIMIT 1000"
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+
+	// Test SQL Server, which limits with TOP
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.SQLServerDialect{})
+	sql = generator.GenerateSampleSQL(tablePlan, []string{"email"}, 1000)
+	expected = "SELECT TOP (1000) [entity_id], [email] FROM [customer_entity] WHERE (is_active = 1) ORDER BY [entity_id]"
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+
+	// Test table without primary key, which is sampled in no particular order
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.PostgresDialect{})
+	sql = generator.GenerateSampleSQL(&TablePlan{Name: "guest_log"}, []string{"ip"}, 10)
+	expected = `SELECT "ip" FROM "guest_log" LIMIT 10`
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+}
+
+func TestGenerateKeyLookupSQL(t *testing.T) {
+	tablePlan := &TablePlan{
+		Name:       "customer_entity",
+		PrimaryKey: []string{"entity_id"},
+		Where:      "is_active = 1",
+	}
+	keys := [][]interface{}{{int64(1)}, {int64(2)}}
+
+	// The where condition is ignored, since rows may no longer match it
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.PostgresDialect{})
+	sql, args := generator.GenerateKeyLookupSQL(tablePlan, []string{"email"}, keys)
+	expected := `SELECT "entity_id", "email" FROM "customer_entity" WHERE "entity_id" IN ($1, $2)`
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{int64(1), int64(2)}) {
+		t.Errorf("Expected args to be [1 2], got %v", args)
+	}
+
+	// Test composite key on SQL Server, which has no row value comparison
+	tablePlan = &TablePlan{Name: "order_items", PrimaryKey: []string{"order_id", "sku"}}
+	keys = [][]interface{}{{int64(11), "a"}, {int64(12), "b"}}
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.SQLServerDialect{})
+	sql, args = generator.GenerateKeyLookupSQL(tablePlan, []string{"label"}, keys)
+	expected = "SELECT [order_id], [sku], [label] FROM [order_items] " +
+		"WHERE (([order_id] = @p1 AND [sku] = @p2) OR ([order_id] = @p3 AND [sku] = @p4))"
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{int64(11), "a", int64(12), "b"}) {
+		t.Errorf("Expected args to be [11 a 12 b], got %v", args)
+	}
 }
 
 func TestFixedValueStrategyGenerateSQL(t *testing.T) {
@@ -195,7 +305,345 @@ func TestExpressionStrategyGenerateSQL(t *testing.T) {
 func TestFakerStrategyGenerateSQL(t *testing.T) {
 	strategy := &FakerStrategy{FakerType: "email"}
 	sql := strategy.GenerateSQL("table", "column")
-	if sql != "FAKER('email')" {
-		t.Errorf("Expected SQL to be 'FAKER('email')', got '%s'", sql)
+	if sql != "column" {
+		t.Errorf("Expected SQL to be 'column', got '%s'", sql)
+	}
+
+	// Strategies keeping the column unchanged get its quoted name
+	tablePlan := &TablePlan{Name: "sales-order"}
+	column := &ColumnPlan{Name: "order", Strategy: strategy}
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.MySQLDialect{})
+	if sql := generator.columnExpression(tablePlan, column, generator.newParameters()); sql != "`order`" {
+		t.Errorf("Expected SQL to be '`order`', got '%s'", sql)
+	}
+}
+
+func TestGenerateBatchUpdateSQL(t *testing.T) {
+	tablePlan := &TablePlan{
+		Name:       "customer_entity",
+		PrimaryKey: []string{"entity_id"},
+		Where:      "is_active = 1",
+		Columns: []*ColumnPlan{
+			{
+				Name:     "email",
+				Strategy: &FakerStrategy{FakerType: "email"},
+			},
+			{
+				Name:     "firstname",
+				Strategy: &FixedValueStrategy{Value: "John"},
+			},
+		},
+	}
+	rows := []RowUpdate{
+		{PrimaryKey: []interface{}{1}, Values: map[string]interface{}{"email": "o'brien@example.test]'"}},
+		{PrimaryKey: []interface{}{2}, Values: map[string]interface{}{"email": nil}},
+	}
+	expectedArgs := []interface{}{1, "o'brien@example.test]'", 2, nil, "John", 1, 2}
+
+	// Test MySQL
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.MySQLDialect{})
+	sql, args, err := generator.GenerateBatchUpdateSQL(tablePlan, rows)
+	if err != nil {
+		t.Fatalf("Failed to generate batch update SQL: %v", err)
+	}
+	expected := "UPDATE `customer_entity` SET " +
+		"`email` = CASE `entity_id` WHEN ? THEN ? WHEN ? THEN ? ELSE `email` END, " +
+		"`firstname` = ? " +
+		"WHERE `entity_id` IN (?, ?) AND (is_active = 1)"
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("Expected args to be %v, got %v", expectedArgs, args)
+	}
+
+	// Test PostgreSQL
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.PostgresDialect{})
+	sql, args, err = generator.GenerateBatchUpdateSQL(tablePlan, rows)
+	if err != nil {
+		t.Fatalf("Failed to generate batch update SQL: %v", err)
 	}
-}
\ No newline at end of file
+	expected = `UPDATE "customer_entity" SET ` +
+		`"email" = CASE "entity_id" WHEN $1 THEN $2 WHEN $3 THEN $4 ELSE "email" END, ` +
+		`"firstname" = $5 ` +
+		`WHERE "entity_id" IN ($6, $7) AND (is_active = 1)`
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("Expected args to be %v, got %v", expectedArgs, args)
+	}
+
+	// Test SQL Server
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.SQLServerDialect{})
+	sql, args, err = generator.GenerateBatchUpdateSQL(tablePlan, rows)
+	if err != nil {
+		t.Fatalf("Failed to generate batch update SQL: %v", err)
+	}
+	expected = "UPDATE [customer_entity] SET " +
+		"[email] = CASE [entity_id] WHEN @p1 THEN @p2 WHEN @p3 THEN @p4 ELSE [email] END, " +
+		"[firstname] = @p5 " +
+		"WHERE [entity_id] IN (@p6, @p7) AND (is_active = 1)"
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("Expected args to be %v, got %v", expectedArgs, args)
+	}
+
+	// Test missing value for a value strategy column
+	if _, _, err := generator.GenerateBatchUpdateSQL(tablePlan, []RowUpdate{{PrimaryKey: []interface{}{1}}}); err == nil {
+		t.Error("Expected error for missing value, got nil")
+	}
+
+	// Test empty batch
+	if _, _, err := generator.GenerateBatchUpdateSQL(tablePlan, nil); err == nil {
+		t.Error("Expected error for empty batch, got nil")
+	}
+
+	// Test batch exceeding the parameter limit
+	large := make([]RowUpdate, database.PostgresDialect{}.MaxParameters()/3+1)
+	for i := range large {
+		large[i] = RowUpdate{PrimaryKey: []interface{}{i}, Values: map[string]interface{}{"email": "a@example.test"}}
+	}
+	if _, _, err := generator.GenerateBatchUpdateSQL(tablePlan, large); err == nil {
+		t.Error("Expected error for too many parameters, got nil")
+	}
+}
+
+func TestGenerateBatchUpdateSQLCompositeKey(t *testing.T) {
+	tablePlan := &TablePlan{
+		Name:       "customer_grid_flat",
+		PrimaryKey: []string{"entity_id", "store_code"},
+		Columns: []*ColumnPlan{
+			{
+				Name:     "email",
+				Strategy: &FakerStrategy{FakerType: "email"},
+			},
+		},
+	}
+	rows := []RowUpdate{
+		{PrimaryKey: []interface{}{1, "de"}, Values: map[string]interface{}{"email": "a@example.test"}},
+		{PrimaryKey: []interface{}{1, "en"}, Values: map[string]interface{}{"email": "b@example.test"}},
+	}
+	expectedArgs := []interface{}{1, "de", "a@example.test", 1, "en", "b@example.test", 1, "de", 1, "en"}
+
+	// Test MySQL
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.MySQLDialect{})
+	sql, args, err := generator.GenerateBatchUpdateSQL(tablePlan, rows)
+	if err != nil {
+		t.Fatalf("Failed to generate batch update SQL: %v", err)
+	}
+	expected := "UPDATE `customer_grid_flat` SET `email` = CASE " +
+		"WHEN `entity_id` = ? AND `store_code` = ? THEN ? " +
+		"WHEN `entity_id` = ? AND `store_code` = ? THEN ? ELSE `email` END " +
+		"WHERE (`entity_id`, `store_code`) IN ((?, ?), (?, ?))"
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("Expected args to be %v, got %v", expectedArgs, args)
+	}
+
+	// Test PostgreSQL
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.PostgresDialect{})
+	sql, _, err = generator.GenerateBatchUpdateSQL(tablePlan, rows)
+	if err != nil {
+		t.Fatalf("Failed to generate batch update SQL: %v", err)
+	}
+	expected = `UPDATE "customer_grid_flat" SET "email" = CASE ` +
+		`WHEN "entity_id" = $1 AND "store_code" = $2 THEN $3 ` +
+		`WHEN "entity_id" = $4 AND "store_code" = $5 THEN $6 ELSE "email" END ` +
+		`WHERE ("entity_id", "store_code") IN (($7, $8), ($9, $10))`
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+
+	// Test SQL Server, which matches composite keys column by column
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.SQLServerDialect{})
+	sql, args, err = generator.GenerateBatchUpdateSQL(tablePlan, rows)
+	if err != nil {
+		t.Fatalf("Failed to generate batch update SQL: %v", err)
+	}
+	expected = "UPDATE [customer_grid_flat] SET [email] = CASE " +
+		"WHEN [entity_id] = @p1 AND [store_code] = @p2 THEN @p3 " +
+		"WHEN [entity_id] = @p4 AND [store_code] = @p5 THEN @p6 ELSE [email] END " +
+		"WHERE (([entity_id] = @p7 AND [store_code] = @p8) OR ([entity_id] = @p9 AND [store_code] = @p10))"
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("Expected args to be %v, got %v", expectedArgs, args)
+	}
+
+	// Test key arity mismatch
+	if _, _, err := generator.GenerateBatchUpdateSQL(tablePlan, []RowUpdate{{PrimaryKey: []interface{}{1}, Values: rows[0].Values}}); err == nil {
+		t.Error("Expected error for primary key arity mismatch, got nil")
+	}
+}
+
+func TestGenerateTruncateSQL(t *testing.T) {
+	tablePlan := &TablePlan{
+		Name:   "customer_log",
+		Action: ActionTruncate,
+	}
+	generator := NewSQLGenerator(&AnonymizationPlan{Tables: []*TablePlan{tablePlan}}, database.MySQLDialect{})
+
+	if sql := generator.GenerateTruncateSQL(tablePlan); sql != "TRUNCATE TABLE `customer_log`" {
+		t.Errorf("Expected SQL to be 'TRUNCATE TABLE `customer_log`', got '%s'", sql)
+	}
+	if sql := generator.GenerateDeleteAllSQL(tablePlan); sql != "DELETE FROM `customer_log`" {
+		t.Errorf("Expected SQL to be 'DELETE FROM `customer_log`', got '%s'", sql)
+	}
+}
+
+func TestGenerateTableSQLQuoting(t *testing.T) {
+	tablePlan := &TablePlan{
+		Name:       "sales-order",
+		PrimaryKey: []string{"entity_id"},
+		Where:      "status = 'canceled'",
+		OrderBy:    "created_at",
+		Limit:      100,
+		Columns: []*ColumnPlan{
+			{
+				Name:     "order",
+				Strategy: &NullStrategy{},
+			},
+		},
+	}
+
+	// Test MySQL, which limits the UPDATE itself
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.MySQLDialect{})
+	sql, _, err := generator.GenerateTableSQL(tablePlan)
+	if err != nil {
+		t.Fatalf("Failed to generate SQL: %v", err)
+	}
+	expected := "UPDATE `sales-order` SET `order` = NULL WHERE status = 'canceled' ORDER BY created_at LIMIT 100"
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+
+	// Test PostgreSQL, which selects the limited rows in a subquery
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.PostgresDialect{})
+	sql, _, err = generator.GenerateTableSQL(tablePlan)
+	if err != nil {
+		t.Fatalf("Failed to generate SQL: %v", err)
+	}
+	expected = `UPDATE "sales-order" SET "order" = NULL WHERE "entity_id" IN ` +
+		`(SELECT "entity_id" FROM "sales-order" WHERE status = 'canceled' ORDER BY created_at LIMIT 100)  `
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+
+	// Test SQL Server, which selects the limited rows with TOP
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.SQLServerDialect{})
+	sql, _, err = generator.GenerateTableSQL(tablePlan)
+	if err != nil {
+		t.Fatalf("Failed to generate SQL: %v", err)
+	}
+	expected = "UPDATE [sales-order] SET [order] = NULL WHERE [entity_id] IN " +
+		"(SELECT TOP (100) [entity_id] FROM [sales-order] WHERE status = 'canceled' ORDER BY created_at)  "
+	if sql != expected {
+		t.Errorf("Expected SQL to be '%s', got '%s'", expected, sql)
+	}
+
+	// Test SQL Server with a composite primary key, which cannot be matched with IN
+	tablePlan.PrimaryKey = []string{"entity_id", "store_id"}
+	if _, _, err := generator.GenerateTableSQL(tablePlan); err == nil {
+		t.Error("Expected error for limit with a composite primary key, got nil")
+	}
+}
+
+func TestMaxBatchRows(t *testing.T) {
+	tablePlan := &TablePlan{
+		Name:       "customer_entity",
+		PrimaryKey: []string{"entity_id"},
+		BatchSize:  1000,
+		Columns: []*ColumnPlan{
+			{Name: "email", Strategy: &FakerStrategy{FakerType: "email"}},
+			{Name: "firstname", Strategy: &FixedValueStrategy{Value: "John"}},
+		},
+	}
+
+	// Every row binds its key for the WHERE clause and key and value for the CASE
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.SQLServerDialect{})
+	if rows := generator.maxBatchRows(tablePlan); rows != 699 {
+		t.Errorf("Expected 699 rows per statement, got %d", rows)
+	}
+
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.MySQLDialect{})
+	if rows := generator.maxBatchRows(tablePlan); rows != 21844 {
+		t.Errorf("Expected 21844 rows per statement, got %d", rows)
+	}
+}
+
+func TestGenerateCopySQL(t *testing.T) {
+	tablePlan := &TablePlan{
+		Name:      "customers",
+		Where:     "id > 10",
+		BatchSize: 1000,
+		Columns: []*ColumnPlan{
+			{Name: "email", Strategy: &FakerStrategy{FakerType: "email"}},
+			{Name: "login", Strategy: &ExpressionStrategy{Expression: "CONCAT('user', id)"}},
+		},
+	}
+	generator := NewSQLGenerator(&AnonymizationPlan{}, database.PostgresDialect{})
+
+	columns := []database.ColumnDefinition{
+		{Name: "id", Type: "integer"},
+		{Name: "email", Type: "character varying(255)", Nullable: true},
+		{Name: "login", Type: "text", Nullable: true},
+	}
+	sql := generator.GenerateCreateTableSQL("customers", columns, []string{"id"})
+	expected := `CREATE TABLE "customers" ("id" integer NOT NULL, "email" character varying(255), "login" text, PRIMARY KEY ("id"))`
+	if sql != expected {
+		t.Errorf("Expected SQL '%s', got '%s'", expected, sql)
+	}
+
+	// Expressions are evaluated for the rows matching the where condition,
+	// which are flagged in the last column
+	sql = generator.GenerateCopySelectSQL(tablePlan, []string{"id", "email", "login"}, []string{"id IN (SELECT 1)"})
+	expected = `SELECT "id", "email", CASE WHEN (id > 10) THEN (CONCAT('user', id)) ELSE "login" END, CASE WHEN (id > 10) THEN 1 ELSE 0 END ` +
+		`FROM "customers" WHERE CASE WHEN (id IN (SELECT 1)) THEN 1 ELSE 0 END = 0`
+	if sql != expected {
+		t.Errorf("Expected SQL '%s', got '%s'", expected, sql)
+	}
+
+	sql, args, err := generator.GenerateInsertSQL("customers", []string{"id", "email"}, [][]interface{}{{1, "a"}, {2, nil}})
+	if err != nil {
+		t.Fatalf("Failed to generate SQL: %v", err)
+	}
+	expected = `INSERT INTO "customers" ("id", "email") VALUES ($1, $2), ($3, $4)`
+	if sql != expected {
+		t.Errorf("Expected SQL '%s', got '%s'", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []interface{}{1, "a", 2, nil}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+
+	// Inserts are limited by the parameters a statement can bind
+	generator = NewSQLGenerator(&AnonymizationPlan{}, database.SQLServerDialect{})
+	if rows := generator.maxInsertRows(tablePlan, 3); rows != 699 {
+		t.Errorf("Expected 699 rows per insert, got %d", rows)
+	}
+}
+
+func TestSQLLiteral(t *testing.T) {
+	zone := time.FixedZone("CEST", 2*60*60)
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"O'Brien", `'O''Brien'`},
+		{time.Date(2024, 7, 15, 10, 0, 0, 0, zone), `'2024-07-15 10:00:00+02:00'`},
+		{time.Date(2024, 7, 15, 10, 0, 0, 500000000, time.UTC), `'2024-07-15 10:00:00.5+00:00'`},
+		{true, "TRUE"},
+		{nil, "NULL"},
+		{42, "42"},
+	}
+	for _, test := range tests {
+		if literal := sqlLiteral(test.value); literal != test.expected {
+			t.Errorf("Expected literal %s for %v, got %s", test.expected, test.value, literal)
+		}
+	}
+}
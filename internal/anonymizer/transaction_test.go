@@ -0,0 +1,128 @@
+package anonymizer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+// executeTransaction anonymizes the test database with order_items committed
+// in the given transaction mode, and returns the results of order_items
+func executeTransaction(t *testing.T, db *sql.DB, transaction string) []ExecutionResult {
+	t.Helper()
+
+	plan := testPlan(t)
+	for _, table := range plan.Tables {
+		if table.Name == "order_items" {
+			table.Transaction = transaction
+		}
+	}
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	executor := NewExecutor(db, plan, log, false, 2, false, nil)
+	defer executor.Close()
+
+	results, err := executor.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+
+	var items []ExecutionResult
+	for _, result := range results {
+		if result.TableName == "order_items" && result.Action == ActionAnonymize {
+			items = append(items, result)
+		}
+	}
+	return items
+}
+
+// failOrder makes updates of the items of an order fail
+func failOrder(t *testing.T, db *sql.DB, orderID int) {
+	t.Helper()
+
+	trigger := fmt.Sprintf(`CREATE TRIGGER fail_order BEFORE UPDATE ON order_items WHEN NEW.order_id = %d BEGIN SELECT RAISE(ABORT, 'order is locked'); END`, orderID)
+	if _, err := db.Exec(trigger); err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+}
+
+func TestExecutorSQLiteTransaction(t *testing.T) {
+	tests := []struct {
+		transaction string
+		// labels of order_items 11a, 11b, 12a and 12b that stay unchanged
+		unchanged []string
+		committed map[int]bool
+	}{
+		// Each chunk commits on its own, the failing chunk is rolled back
+		{TransactionChunk, []string{"", "", "Item c", "Item d"}, map[int]bool{0: true, 1: false}},
+		// The whole table is rolled back
+		{TransactionTable, []string{"Item a", "Item b", "Item c", "Item d"}, map[int]bool{0: false, 1: false}},
+		// Statements commit on their own
+		{TransactionNone, []string{"", "", "Item c", "Item d"}, map[int]bool{0: true, 1: false}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.transaction, func(t *testing.T) {
+			db := openTestDatabase(t)
+			failOrder(t, db, 12)
+			results := executeTransaction(t, db, test.transaction)
+
+			labels := queryStrings(t, db, "SELECT label FROM order_items ORDER BY order_id, sku")
+			for i, label := range labels {
+				if test.unchanged[i] == "" && (label.String == "Item a" || label.String == "Item b") {
+					t.Errorf("Expected order item %d to be anonymized, got %s", i, label.String)
+				}
+				if test.unchanged[i] != "" && label.String != test.unchanged[i] {
+					t.Errorf("Expected order item %d to stay %s, got %s", i, test.unchanged[i], label.String)
+				}
+			}
+
+			committed := make(map[int]bool)
+			for _, result := range results {
+				if result.Transaction != test.transaction {
+					t.Errorf("Expected transaction %s, got %s", test.transaction, result.Transaction)
+				}
+				if result.Error == nil && result.RowsAffected != 2 {
+					t.Errorf("Expected chunk %d to update 2 rows, got %d", result.Chunk, result.RowsAffected)
+				}
+				committed[result.Chunk] = result.Committed
+			}
+			for chunk, expected := range test.committed {
+				if got, ok := committed[chunk]; !ok || got != expected {
+					t.Errorf("Expected chunk %d committed to be %v, got %v", chunk, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestExecutorSQLiteTableTransaction(t *testing.T) {
+	db := openTestDatabase(t)
+	results := executeTransaction(t, db, TransactionTable)
+
+	// The chunks commit with the table
+	chunks := make(map[int]bool)
+	for _, result := range results {
+		if result.Error != nil || !result.Committed {
+			t.Errorf("Expected chunk %d to commit, got %+v", result.Chunk, result)
+		}
+		chunks[result.Chunk] = true
+	}
+	if len(chunks) != 2 {
+		t.Errorf("Expected 2 chunks, got %v", chunks)
+	}
+
+	for _, label := range queryStrings(t, db, "SELECT label FROM order_items ORDER BY order_id, sku") {
+		if label.String == "Item a" || label.String == "Item b" || label.String == "Item c" || label.String == "Item d" {
+			t.Errorf("Expected order item labels to be anonymized, got '%s'", label.String)
+		}
+	}
+}
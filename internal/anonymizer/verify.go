@@ -0,0 +1,359 @@
+package anonymizer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"db-gdpr-anonymizer/internal/database"
+	"db-gdpr-anonymizer/internal/faker"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+// lookupBatchSize is the number of snapshot rows looked up per statement
+const lookupBatchSize = 500
+
+// VerificationResult represents the verification of a column, or of a whole
+// table for truncated and delete tables
+type VerificationResult struct {
+	TableName    string
+	FieldName    string
+	Strategy     string
+	RowsChecked  int64
+	RowsCompared int64
+	Missing      int64
+	Unchanged    int64
+	Invalid      int64
+	Passed       bool
+	Skipped      bool
+	Message      string
+}
+
+// Verifier checks that an executed plan left no personal data behind. It
+// samples the rows of each anonymized table and checks that every value
+// has the format its strategy produces, and, with a snapshot taken before
+// execution, that no value still holds its original value. Truncated tables
+// must be empty and delete tables must have no rows left that match their
+// where condition.
+type Verifier struct {
+	db         *sql.DB
+	plan       *AnonymizationPlan
+	sqlGen     *SQLGenerator
+	logger     *logger.Logger
+	sampleSize int
+}
+
+// valueCheck reports whether a value of a column is what its strategy
+// produces; description names what is expected for messages
+type valueCheck struct {
+	valid       func(value interface{}) bool
+	description string
+}
+
+// NewVerifier creates a verifier that samples up to sampleSize rows per table
+func NewVerifier(db *sql.DB, plan *AnonymizationPlan, logger *logger.Logger, sampleSize int) *Verifier {
+	if sampleSize <= 0 {
+		sampleSize = DefaultSampleSize
+	}
+	return &Verifier{
+		db:         db,
+		plan:       plan,
+		sqlGen:     NewSQLGenerator(plan, plan.Dialect),
+		logger:     logger,
+		sampleSize: sampleSize,
+	}
+}
+
+// Verify verifies every table of the plan. The snapshot may be nil, in which
+// case only the formats are checked.
+func (v *Verifier) Verify(ctx context.Context, snapshot *Snapshot) ([]VerificationResult, error) {
+	results := make([]VerificationResult, 0)
+
+	for _, tablePlan := range v.plan.Tables {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var tableResults []VerificationResult
+		var err error
+		switch tablePlan.Action {
+		case ActionDelete, ActionTruncate:
+			var result VerificationResult
+			result, err = v.verifyEmpty(ctx, tablePlan)
+			tableResults = []VerificationResult{result}
+		default:
+			var tableSnapshot *TableSnapshot
+			if snapshot != nil {
+				tableSnapshot = snapshot.Tables[tablePlan.Name]
+			}
+			tableResults, err = v.verifyTable(ctx, tablePlan, snapshot, tableSnapshot)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify table %s: %w", tablePlan.Name, err)
+		}
+
+		for _, result := range tableResults {
+			v.logger.Info("Verified", map[string]interface{}{
+				"table":   result.TableName,
+				"column":  result.FieldName,
+				"passed":  result.Passed,
+				"skipped": result.Skipped,
+				"message": result.Message,
+			})
+		}
+		results = append(results, tableResults...)
+	}
+
+	return results, nil
+}
+
+// verifyEmpty checks that a truncated table has no rows left, or a delete
+// table no rows that match its where condition
+func (v *Verifier) verifyEmpty(ctx context.Context, tablePlan *TablePlan) (VerificationResult, error) {
+	var count int64
+	if err := v.db.QueryRowContext(ctx, v.sqlGen.GenerateCountSQL(tablePlan)).Scan(&count); err != nil {
+		return VerificationResult{}, err
+	}
+
+	result := VerificationResult{
+		TableName:   tablePlan.Name,
+		Strategy:    tablePlan.Action,
+		RowsChecked: count,
+		Passed:      count == 0,
+	}
+	if count > 0 {
+		if tablePlan.Action == ActionDelete {
+			result.Message = fmt.Sprintf("%d rows still match the where condition", count)
+		} else {
+			result.Message = fmt.Sprintf("%d rows left", count)
+		}
+	}
+	return result, nil
+}
+
+// verifyTable checks the columns of an anonymized table
+func (v *Verifier) verifyTable(ctx context.Context, tablePlan *TablePlan, snapshot *Snapshot, tableSnapshot *TableSnapshot) ([]VerificationResult, error) {
+	results := make([]VerificationResult, 0, len(tablePlan.Columns))
+	for _, column := range tablePlan.Columns {
+		results = append(results, VerificationResult{
+			TableName: tablePlan.Name,
+			FieldName: column.Name,
+			Strategy:  column.Strategy.GetType(),
+			Passed:    true,
+		})
+	}
+
+	// Which rows a limit selected is not known afterwards
+	if tablePlan.Limit > 0 {
+		for i := range results {
+			results[i].Skipped = true
+			results[i].Message = "tables with a limit are not verified"
+		}
+		return results, nil
+	}
+
+	// Use the primary key from the plan if it's set, otherwise get it. The
+	// formats can be checked without one.
+	primaryKey := tablePlan.PrimaryKey
+	if len(primaryKey) == 0 {
+		primaryKey, _ = database.GetPrimaryKey(v.db, v.plan.Dialect.Driver(), tablePlan.Name)
+	}
+	sampled := *tablePlan
+	sampled.PrimaryKey = primaryKey
+	columns := columnNames(tablePlan.Columns)
+
+	// Check that the sampled values have the format of their strategy
+	rows, err := readKeyedRows(ctx, v.db, v.sqlGen.GenerateSampleSQL(&sampled, columns, v.sampleSize), nil, len(primaryKey), len(columns))
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range tablePlan.Columns {
+		check := checkFor(column)
+		if check == nil {
+			continue
+		}
+		for _, row := range rows {
+			results[i].RowsChecked++
+			if !check.valid(row.values[i]) {
+				results[i].Invalid++
+			}
+		}
+		if results[i].Invalid > 0 {
+			results[i].Message = fmt.Sprintf("%d of %d values are not %s", results[i].Invalid, results[i].RowsChecked, check.description)
+		}
+	}
+
+	// Check that no value still holds its original value
+	if tableSnapshot != nil && len(tableSnapshot.Rows) > 0 {
+		keyed := *tablePlan
+		keyed.PrimaryKey = tableSnapshot.PrimaryKey
+
+		for start := 0; start < len(tableSnapshot.Rows); start += lookupBatchSize {
+			end := start + lookupBatchSize
+			if end > len(tableSnapshot.Rows) {
+				end = len(tableSnapshot.Rows)
+			}
+
+			// Keys are matched as they are stored in the snapshot, since
+			// keys read back from it may have other types than the driver's
+			snapshotRows := make(map[string]SnapshotRow, end-start)
+			keys := make([][]interface{}, 0, end-start)
+			for _, snapshotRow := range tableSnapshot.Rows[start:end] {
+				snapshotRows[keyString(snapshotRow.Key)] = snapshotRow
+				keys = append(keys, snapshotRow.Key)
+			}
+
+			query, args := v.sqlGen.GenerateKeyLookupSQL(&keyed, columns, keys)
+			rows, err := readKeyedRows(ctx, v.db, query, args, len(keyed.PrimaryKey), len(columns))
+			if err != nil {
+				return nil, err
+			}
+
+			// Rows deleted since the snapshot are not compared, but are
+			// counted as missing
+			matched := 0
+			for _, row := range rows {
+				snapshotRow, ok := snapshotRows[keyString(row.key)]
+				if !ok {
+					continue
+				}
+				matched++
+				for i, column := range tablePlan.Columns {
+					if !comparesOriginal(column) {
+						continue
+					}
+					results[i].RowsCompared++
+					original, ok := snapshotRow.Fingerprints[column.Name]
+					if ok && row.values[i] != nil && snapshot.fingerprint(row.values[i]) == original {
+						results[i].Unchanged++
+					}
+				}
+			}
+			for i, column := range tablePlan.Columns {
+				if comparesOriginal(column) {
+					results[i].Missing += int64(end - start - matched)
+				}
+			}
+		}
+
+		for i := range results {
+			var messages []string
+			if results[i].Unchanged > 0 {
+				messages = append(messages, fmt.Sprintf("%d of %d values still hold their original value", results[i].Unchanged, results[i].RowsCompared))
+			}
+			if results[i].Missing > 0 {
+				messages = append(messages, fmt.Sprintf("%d of %d snapshot rows were not found", results[i].Missing, len(tableSnapshot.Rows)))
+			}
+			if results[i].Message != "" {
+				messages = append(messages, results[i].Message)
+			}
+			results[i].Message = strings.Join(messages, "; ")
+		}
+	}
+
+	// A column none of whose snapshot rows were found was not compared at
+	// all, which fails rather than passing unchecked
+	for i := range results {
+		notCompared := results[i].Missing > 0 && results[i].RowsCompared == 0
+		results[i].Passed = results[i].Invalid == 0 && results[i].Unchanged == 0 && !notCompared
+	}
+
+	return results, nil
+}
+
+// comparesOriginal reports whether the values of a column are compared with
+// their original values. Fixed values and NULL are covered by the format
+// check, and shuffled values may well be their original value when other
+// rows share it, as may dates that were already truncated or the date of
+// their age range.
+func comparesOriginal(column *ColumnPlan) bool {
+	switch column.Strategy.(type) {
+	case *FixedValueStrategy, *NullStrategy, *ShuffleStrategy, *DateTruncateStrategy, *AgeBucketStrategy:
+		return false
+	}
+	return true
+}
+
+// checkFor returns the check of the values of a column, or nil if its
+// strategy produces values without a recognizable format
+func checkFor(column *ColumnPlan) *valueCheck {
+	switch strategy := column.Strategy.(type) {
+	case *NullStrategy:
+		return &valueCheck{
+			valid:       func(value interface{}) bool { return value == nil },
+			description: "NULL",
+		}
+	case *FixedValueStrategy:
+		return &valueCheck{
+			valid:       func(value interface{}) bool { return value != nil && sameValue(strategy.Value, value) },
+			description: fmt.Sprintf("the fixed value %s", sqlLiteral(strategy.Value)),
+		}
+	case *FakerStrategy:
+		validate := faker.Validator(strategy.FakerType, strategy.Params)
+		if validate == nil {
+			return nil
+		}
+		description := fmt.Sprintf("faker.%s values", strategy.FakerType)
+		if domain := strategy.Params.String("domain"); domain != "" {
+			description = fmt.Sprintf("%s at %s", description, domain)
+		}
+		// NULL stays NULL
+		return &valueCheck{
+			valid:       func(value interface{}) bool { return value == nil || validate(fmt.Sprintf("%v", value)) },
+			description: description,
+		}
+	case *HashStrategy:
+		pattern := strategy.pattern()
+		// NULL stays NULL
+		return &valueCheck{
+			valid:       func(value interface{}) bool { return value == nil || pattern.MatchString(fmt.Sprintf("%v", value)) },
+			description: fmt.Sprintf("%s hashes", strategy.Encoding),
+		}
+	case *DateTruncateStrategy:
+		// Truncated dates stay as they are when truncated again; NULL stays NULL
+		return &valueCheck{
+			valid: func(value interface{}) bool {
+				if value == nil {
+					return true
+				}
+				truncated, err := strategy.Anonymize(value)
+				return err == nil && sameDate(truncated, value)
+			},
+			description: fmt.Sprintf("dates truncated to the %s", strategy.To),
+		}
+	default:
+		return nil
+	}
+}
+
+// sameDate reports whether two dates or timestamps are equal
+func sameDate(a, b interface{}) bool {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt)
+	}
+	return a == b
+}
+
+// sameValue reports whether a value read from the database is the fixed
+// value of the configuration. Booleans and numbers are compared by value,
+// since databases return them in their own representation.
+func sameValue(expected, actual interface{}) bool {
+	e, a := fmt.Sprintf("%v", expected), fmt.Sprintf("%v", actual)
+	if e == a {
+		return true
+	}
+	if b, ok := expected.(bool); ok {
+		ab, err := strconv.ParseBool(strings.TrimSpace(a))
+		return err == nil && ab == b
+	}
+	ef, err := strconv.ParseFloat(e, 64)
+	if err != nil {
+		return false
+	}
+	af, err := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	return err == nil && ef == af
+}
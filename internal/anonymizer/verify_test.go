@@ -0,0 +1,234 @@
+package anonymizer
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+// verifyTestDatabase verifies the test database against snapshot and returns
+// the results by table and column
+func verifyTestDatabase(t *testing.T, db *sql.DB, snapshot *Snapshot) map[string]VerificationResult {
+	t.Helper()
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	results, err := NewVerifier(db, testPlan(t), log, 10).Verify(context.Background(), snapshot)
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+
+	byColumn := make(map[string]VerificationResult, len(results))
+	for _, result := range results {
+		byColumn[result.TableName+"."+result.FieldName] = result
+	}
+	return byColumn
+}
+
+// takeTestSnapshot takes a snapshot of the test database and reads it back
+// from a file
+func takeTestSnapshot(t *testing.T, db *sql.DB) *Snapshot {
+	t.Helper()
+
+	plan := testPlan(t)
+	if _, err := TakeSnapshot(context.Background(), db, plan, 10); err == nil {
+		t.Error("Expected error for a snapshot without snapshot key, got nil")
+	}
+
+	plan.SnapshotKey = []byte("snapshot-key")
+	snapshot, err := TakeSnapshot(context.Background(), db, plan, 10)
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+
+	snapshotFile := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := snapshot.Write(snapshotFile); err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+
+	// The key is not stored, and reading with another key fails
+	data, err := os.ReadFile(snapshotFile)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot file: %v", err)
+	}
+	if strings.Contains(string(data), "snapshot-key") {
+		t.Error("Expected the snapshot key not to be written to the snapshot")
+	}
+	if _, err := ReadSnapshot(snapshotFile, []byte("other-key")); err == nil {
+		t.Error("Expected error for a snapshot read with another key, got nil")
+	}
+
+	snapshot, err = ReadSnapshot(snapshotFile, plan.SnapshotKey)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+	return snapshot
+}
+
+func TestVerifierSQLite(t *testing.T) {
+	db := openTestDatabase(t)
+	snapshot := takeTestSnapshot(t, db)
+
+	if tableSnapshot := snapshot.Tables["order_items"]; tableSnapshot == nil || len(tableSnapshot.Rows) != 5 || len(tableSnapshot.PrimaryKey) != 2 {
+		t.Fatalf("Expected 5 order_items rows with a composite key in the snapshot, got %+v", tableSnapshot)
+	}
+	if _, ok := snapshot.Tables["sessions"]; ok {
+		t.Errorf("Expected truncated table not to be in the snapshot")
+	}
+
+	runTestPlan(t, db, false)
+
+	results := verifyTestDatabase(t, db, snapshot)
+	if len(results) != 7 {
+		t.Errorf("Expected 7 results, got %d", len(results))
+	}
+	for column, result := range results {
+		if !result.Passed || result.Skipped {
+			t.Errorf("Expected %s to pass, got %+v", column, result)
+		}
+	}
+
+	if result := results["customers.email"]; result.RowsChecked != 3 || result.RowsCompared != 3 {
+		t.Errorf("Expected customers.email to check and compare 3 rows, got %+v", result)
+	}
+	// The item of the deleted order is gone and counted as missing
+	if result := results["order_items.label"]; result.RowsChecked != 0 || result.RowsCompared != 4 || result.Missing != 1 {
+		t.Errorf("Expected order_items.label to compare 4 rows and miss 1, got %+v", result)
+	}
+	if result := results["customers.name"]; result.RowsChecked != 3 || result.RowsCompared != 0 {
+		t.Errorf("Expected customers.name to check 3 rows without comparing, got %+v", result)
+	}
+}
+
+func TestVerifierSQLiteNotAnonymized(t *testing.T) {
+	db := openTestDatabase(t)
+	snapshot := takeTestSnapshot(t, db)
+
+	results := verifyTestDatabase(t, db, snapshot)
+
+	expected := map[string]struct {
+		unchanged int64
+		invalid   int64
+	}{
+		"customers.email":   {2, 0},
+		"customers.name":    {0, 3},
+		"customers.note":    {0, 2},
+		"newsletter.email":  {2, 0},
+		"order_items.label": {5, 0},
+		"orders.":           {0, 0},
+		"sessions.":         {0, 0},
+	}
+	for column, counts := range expected {
+		result := results[column]
+		if result.Passed || result.Unchanged != counts.unchanged || result.Invalid != counts.invalid || result.Message == "" {
+			t.Errorf("Expected %s to fail with %d unchanged and %d invalid values, got %+v", column, counts.unchanged, counts.invalid, result)
+		}
+	}
+
+	// Without a snapshot only the formats are checked
+	results = verifyTestDatabase(t, db, nil)
+	if result := results["customers.email"]; !result.Passed || result.RowsCompared != 0 {
+		t.Errorf("Expected customers.email to pass without a snapshot, got %+v", result)
+	}
+	if result := results["customers.name"]; result.Passed {
+		t.Errorf("Expected customers.name to fail without a snapshot, got %+v", result)
+	}
+}
+
+func TestVerifierSQLiteTimeKey(t *testing.T) {
+	db := openTestDatabase(t)
+	if _, err := db.Exec(`CREATE TABLE visits (visited_at DATETIME PRIMARY KEY, ip TEXT)`); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		if _, err := db.Exec(`INSERT INTO visits VALUES (?, ?)`, time.Date(2024, 5, 1, 10, i, 0, 0, time.UTC), ip); err != nil {
+			t.Fatalf("Failed to insert visit: %v", err)
+		}
+	}
+
+	plan, err := CreatePlan(&config.Config{
+		Database: config.DatabaseConfig{Driver: "sqlite"},
+		Tables: map[string]config.TableConfig{
+			"visits": {Columns: map[string]config.ColumnConfig{"ip": {Type: "faker.ipv4"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create plan: %v", err)
+	}
+	plan.SnapshotKey = []byte("snapshot-key")
+	snapshot, err := TakeSnapshot(context.Background(), db, plan, 10)
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	snapshotFile := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := snapshot.Write(snapshotFile); err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+	if snapshot, err = ReadSnapshot(snapshotFile, plan.SnapshotKey); err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+	verifier := NewVerifier(db, plan, log, 10)
+
+	// The time keys read back from the snapshot as text still match the
+	// rows, so the unchanged addresses are found
+	results, err := verifier.Verify(context.Background(), snapshot)
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if len(results) != 1 || results[0].Passed || results[0].RowsCompared != 2 || results[0].Unchanged != 2 || results[0].Missing != 0 {
+		t.Errorf("Expected both addresses to be compared and unchanged, got %+v", results)
+	}
+
+	// Without any of the snapshot rows, nothing is compared and the column
+	// fails
+	if _, err := db.Exec(`DELETE FROM visits`); err != nil {
+		t.Fatalf("Failed to delete visits: %v", err)
+	}
+	results, err = verifier.Verify(context.Background(), snapshot)
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if len(results) != 1 || results[0].Passed || results[0].Missing != 2 {
+		t.Errorf("Expected the column to fail with 2 missing rows, got %+v", results)
+	}
+}
+
+func TestSameValue(t *testing.T) {
+	tests := []struct {
+		expected interface{}
+		actual   interface{}
+		same     bool
+	}{
+		{"Jane Doe", "Jane Doe", true},
+		{"Jane Doe", "John Doe", false},
+		{0, int64(0), true},
+		{1.5, "1.50", true},
+		{true, int64(1), true},
+		{true, "0", false},
+		{false, "false", true},
+		{"x", int64(0), false},
+	}
+
+	for _, test := range tests {
+		if same := sameValue(test.expected, test.actual); same != test.same {
+			t.Errorf("Expected sameValue(%v, %v) to be %v", test.expected, test.actual, test.same)
+		}
+	}
+}
@@ -1,16 +1,35 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/lexer"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
 )
 
 // Config represents the top-level configuration structure
 type Config struct {
-	Database   DatabaseConfig             `json:"database"`
-	Tables     map[string]TableConfig     `json:"tables"`
-	Converters map[string]ConverterConfig `json:"converters,omitempty"`
+	Database     DatabaseConfig             `json:"database"`
+	Target       *DatabaseConfig            `json:"target,omitempty"`
+	Seed         string                     `json:"seed,omitempty"`
+	BatchSize    int                        `json:"batch_size,omitempty"`
+	Transaction  string                     `json:"transaction,omitempty"`
+	Retry        RetryConfig                `json:"retry,omitempty"`
+	HashKey      KeyConfig                  `json:"hash_key,omitempty"`
+	FPEKey       KeyConfig                  `json:"fpe_key,omitempty"`
+	SnapshotKey  KeyConfig                  `json:"snapshot_key,omitempty"`
+	DateShiftKey KeyConfig                  `json:"date_shift_key,omitempty"`
+	Tables       map[string]TableConfig     `json:"tables"`
+	Converters   map[string]ConverterConfig `json:"converters,omitempty"`
 }
 
 // DatabaseConfig holds database connection information
@@ -23,95 +42,525 @@ type DatabaseConfig struct {
 	Driver   string `json:"driver"`
 }
 
+// RetryConfig defines how statements failing with transient errors, such as
+// deadlocks and lost connections, are retried
+type RetryConfig struct {
+	MaxAttempts  int           `json:"max_attempts,omitempty"`
+	InitialDelay time.Duration `json:"initial_delay,omitempty"`
+	MaxDelay     time.Duration `json:"max_delay,omitempty"`
+}
+
+// KeyConfig holds a secret key, given as a value or as the path of a file
+// containing it
+type KeyConfig struct {
+	Value string `json:"value,omitempty"`
+	File  string `json:"file,omitempty"`
+}
+
 // TableConfig defines anonymization rules for a specific table
 type TableConfig struct {
-	Truncate   bool                    `json:"truncate,omitempty"`
-	Where      string                  `json:"where,omitempty"`
-	Limit      int                     `json:"limit,omitempty"`
-	OrderBy    string                  `json:"order_by,omitempty"`
-	PrimaryKey string                  `json:"primary_key,omitempty"`
-	Columns    map[string]ColumnConfig `json:"columns,omitempty"`
+	Truncate    *bool                   `json:"truncate,omitempty"`
+	Delete      *bool                   `json:"delete,omitempty"`
+	Where       string                  `json:"where,omitempty"`
+	Limit       int                     `json:"limit,omitempty"`
+	OrderBy     string                  `json:"order_by,omitempty"`
+	PrimaryKey  StringList              `json:"primary_key,omitempty"`
+	BatchSize   int                     `json:"batch_size,omitempty"`
+	Transaction string                  `json:"transaction,omitempty"`
+	Columns     map[string]ColumnConfig `json:"columns,omitempty"`
+}
+
+// Bool returns a pointer to v, for setting optional flags such as
+// TableConfig.Truncate
+func Bool(v bool) *bool {
+	return &v
+}
+
+// ShouldTruncate reports whether the table is configured to be truncated
+func (t TableConfig) ShouldTruncate() bool {
+	return t.Truncate != nil && *t.Truncate
+}
+
+// ShouldDelete reports whether the table is configured to be deleted
+func (t TableConfig) ShouldDelete() bool {
+	return t.Delete != nil && *t.Delete
 }
 
 // ColumnConfig defines how a specific column should be anonymized
 type ColumnConfig struct {
-	Type      string      `json:"type"`
-	Formatter string      `json:"formatter,omitempty"`
-	Value     interface{} `json:"value,omitempty"`
-	Expr      string      `json:"expr,omitempty"`
-	Null      bool        `json:"null,omitempty"`
+	Type             string                 `json:"type"`
+	Params           map[string]interface{} `json:"params,omitempty"`
+	Formatter        string                 `json:"formatter,omitempty"`
+	Value            interface{}            `json:"value,omitempty"`
+	Expr             string                 `json:"expr,omitempty"`
+	Null             bool                   `json:"null,omitempty"`
+	Converter        string                 `json:"converter,omitempty"`
+	ConsistencyGroup string                 `json:"consistency_group,omitempty"`
 }
 
-// ConverterConfig defines custom converters
+// ConverterConfig defines a named strategy that columns can reference
 type ConverterConfig struct {
 	Type   string                 `json:"type"`
 	Params map[string]interface{} `json:"params,omitempty"`
 }
 
-// LoadConfig loads and parses the JSON configuration file
+// StringList is a list of strings that can be written in YAML either as a
+// single scalar or as a sequence
+type StringList []string
+
+// UnmarshalYAML implements yaml.InterfaceUnmarshaler
+func (l *StringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*l = StringList{single}
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// includeDirective holds the include list of a configuration file
+type includeDirective struct {
+	Include StringList `json:"include,omitempty"`
+}
+
+// LoadConfig loads and parses the YAML configuration file.
+//
+// Environment variables written as ${VAR} or ${VAR:-default} are expanded
+// before parsing. Files listed under the top-level include key are loaded
+// first, in order, and the including file is merged on top of them.
 func LoadConfig(filePath string) (*Config, error) {
+	config, err := loadFile(filePath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateConfig(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// LoadDumpConfig loads and parses the YAML configuration file for
+// anonymizing a dump file. The database section only selects the SQL dialect
+// of the dump, so no connection details are required.
+func LoadDumpConfig(filePath string) (*Config, error) {
+	config, err := loadFile(filePath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Database.Driver == "" {
+		// Default to MySQL if not specified
+		config.Database.Driver = "mysql"
+	}
+	if err := validateTables(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// LoadScanConfig loads and parses the YAML configuration file for scanning
+// a database. Only the database section is required; tables, if any, are
+// validated as usual and tell the scan which columns are already covered.
+func LoadScanConfig(filePath string) (*Config, error) {
+	config, err := loadFile(filePath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Database.Driver == "" {
+		// Default to MySQL if not specified
+		config.Database.Driver = "mysql"
+	}
+	if err := validateDatabase("database", &config.Database); err != nil {
+		return nil, err
+	}
+	if len(config.Tables) > 0 {
+		if err := validateTables(config); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+// loadFile loads a single configuration file and the files it includes.
+// stack holds the files currently being loaded and is used to detect cycles.
+func loadFile(filePath string, stack []string) (*Config, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config file path %s: %w", filePath, err)
+	}
+	for _, loading := range stack {
+		if loading == absPath {
+			return nil, fmt.Errorf("config include cycle detected at %s", filePath)
+		}
+	}
+	stack = append(stack, absPath)
+
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	file, err := parseYAML(filePath, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var directive includeDirective
+	if err := decodeYAML(file, &directive); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %s", filePath, yaml.FormatError(err, false, false))
+	}
+
+	merged := &Config{}
+	for _, include := range directive.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(filePath), include)
+		}
+		base, err := loadFile(include, stack)
+		if err != nil {
+			return nil, err
+		}
+		merged.merge(base)
+	}
+
 	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	if err := decodeYAML(file, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %s", filePath, yaml.FormatError(err, false, false))
 	}
+	merged.merge(&config)
 
-	if err := validateConfig(&config); err != nil {
+	return merged, nil
+}
+
+// parseYAML parses the YAML data of a configuration file and expands the
+// environment variable references in it. A plain null used as a mapping key
+// (as in "null: true") is read as the string "null" instead of a null key.
+func parseYAML(filePath string, data []byte) (*ast.File, error) {
+	tokens := lexer.Tokenize(string(data))
+	for _, tk := range tokens {
+		if tk.Type == token.NullType && tk.Next != nil && tk.Next.Type == token.MappingValueType {
+			tk.Type = token.StringType
+		}
+	}
+
+	if err := interpolateEnv(filePath, tokens); err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	file, err := parser.Parse(tokens, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %s", filePath, yaml.FormatError(err, false, false))
+	}
+	return file, nil
 }
 
-// validateConfig checks if the configuration is valid
-func validateConfig(config *Config) error {
-	// Check database configuration
-	if config.Database.Host == "" {
-		return fmt.Errorf("database host is required")
+// decodeYAML decodes a parsed configuration file into v
+func decodeYAML(file *ast.File, v interface{}) error {
+	for _, doc := range file.Docs {
+		if doc.Body == nil {
+			continue
+		}
+		if err := yaml.NodeToValue(doc.Body, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// merge applies other on top of c. Non-zero database settings and table
+// options in other win, and columns and converters are replaced by name.
+func (c *Config) merge(other *Config) {
+	c.Database.merge(other.Database)
+	if other.Target != nil {
+		if c.Target == nil {
+			c.Target = &DatabaseConfig{}
+		}
+		c.Target.merge(*other.Target)
+	}
+	if other.Seed != "" {
+		c.Seed = other.Seed
+	}
+	if other.BatchSize != 0 {
+		c.BatchSize = other.BatchSize
+	}
+	if other.Transaction != "" {
+		c.Transaction = other.Transaction
+	}
+	if other.Retry.MaxAttempts != 0 {
+		c.Retry.MaxAttempts = other.Retry.MaxAttempts
+	}
+	if other.Retry.InitialDelay != 0 {
+		c.Retry.InitialDelay = other.Retry.InitialDelay
+	}
+	if other.Retry.MaxDelay != 0 {
+		c.Retry.MaxDelay = other.Retry.MaxDelay
 	}
-	if config.Database.User == "" {
-		return fmt.Errorf("database user is required")
+	if other.HashKey.Value != "" || other.HashKey.File != "" {
+		c.HashKey = other.HashKey
 	}
-	if config.Database.Name == "" {
-		return fmt.Errorf("database name is required")
+	if other.FPEKey.Value != "" || other.FPEKey.File != "" {
+		c.FPEKey = other.FPEKey
 	}
+	if other.SnapshotKey.Value != "" || other.SnapshotKey.File != "" {
+		c.SnapshotKey = other.SnapshotKey
+	}
+	if other.DateShiftKey.Value != "" || other.DateShiftKey.File != "" {
+		c.DateShiftKey = other.DateShiftKey
+	}
+
+	if len(other.Tables) > 0 && c.Tables == nil {
+		c.Tables = make(map[string]TableConfig, len(other.Tables))
+	}
+	for name, table := range other.Tables {
+		existing, ok := c.Tables[name]
+		if !ok {
+			c.Tables[name] = table
+			continue
+		}
+		existing.merge(table)
+		c.Tables[name] = existing
+	}
+
+	if len(other.Converters) > 0 && c.Converters == nil {
+		c.Converters = make(map[string]ConverterConfig, len(other.Converters))
+	}
+	for name, converter := range other.Converters {
+		c.Converters[name] = converter
+	}
+}
+
+// merge applies the non-zero fields of other on top of d
+func (d *DatabaseConfig) merge(other DatabaseConfig) {
+	if other.Host != "" {
+		d.Host = other.Host
+	}
+	if other.Port != 0 {
+		d.Port = other.Port
+	}
+	if other.User != "" {
+		d.User = other.User
+	}
+	if other.Password != "" {
+		d.Password = other.Password
+	}
+	if other.Name != "" {
+		d.Name = other.Name
+	}
+	if other.Driver != "" {
+		d.Driver = other.Driver
+	}
+}
+
+// merge applies the set fields of other on top of t, so truncate and delete
+// can be switched back off with an explicit false
+func (t *TableConfig) merge(other TableConfig) {
+	if other.Truncate != nil {
+		t.Truncate = other.Truncate
+	}
+	if other.Delete != nil {
+		t.Delete = other.Delete
+	}
+	if other.Where != "" {
+		t.Where = other.Where
+	}
+	if other.Limit != 0 {
+		t.Limit = other.Limit
+	}
+	if other.OrderBy != "" {
+		t.OrderBy = other.OrderBy
+	}
+	if len(other.PrimaryKey) > 0 {
+		t.PrimaryKey = other.PrimaryKey
+	}
+	if other.BatchSize != 0 {
+		t.BatchSize = other.BatchSize
+	}
+	if other.Transaction != "" {
+		t.Transaction = other.Transaction
+	}
+
+	if len(other.Columns) > 0 && t.Columns == nil {
+		t.Columns = make(map[string]ColumnConfig, len(other.Columns))
+	}
+	for name, column := range other.Columns {
+		t.Columns[name] = column
+	}
+}
+
+// validateConfig checks if the configuration is valid
+func validateConfig(config *Config) error {
+	// Check database configuration
 	if config.Database.Driver == "" {
 		// Default to MySQL if not specified
 		config.Database.Driver = "mysql"
 	}
-	if config.Database.Port == 0 {
+	if err := validateDatabase("database", &config.Database); err != nil {
+		return err
+	}
+
+	// Check the target database, which is created with the column types of
+	// the source and therefore needs the same driver
+	if config.Target != nil {
+		if config.Target.Driver == "" {
+			config.Target.Driver = config.Database.Driver
+		}
+		if config.Target.Driver != config.Database.Driver {
+			return fmt.Errorf("target driver %s must match database driver %s", config.Target.Driver, config.Database.Driver)
+		}
+		if err := validateDatabase("target", config.Target); err != nil {
+			return err
+		}
+		if *config.Target == config.Database {
+			return fmt.Errorf("target must be a different database than the source")
+		}
+	}
+
+	if config.Retry.MaxAttempts < 0 || config.Retry.InitialDelay < 0 || config.Retry.MaxDelay < 0 {
+		return fmt.Errorf("retry settings must not be negative")
+	}
+	if config.Retry.MaxDelay != 0 && config.Retry.MaxDelay < config.Retry.InitialDelay {
+		return fmt.Errorf("retry max_delay %s must not be less than initial_delay %s", config.Retry.MaxDelay, config.Retry.InitialDelay)
+	}
+
+	if config.HashKey.Value != "" && config.HashKey.File != "" {
+		return fmt.Errorf("hash_key value and file cannot be combined")
+	}
+	if config.FPEKey.Value != "" && config.FPEKey.File != "" {
+		return fmt.Errorf("fpe_key value and file cannot be combined")
+	}
+	if config.SnapshotKey.Value != "" && config.SnapshotKey.File != "" {
+		return fmt.Errorf("snapshot_key value and file cannot be combined")
+	}
+	if config.DateShiftKey.Value != "" && config.DateShiftKey.File != "" {
+		return fmt.Errorf("date_shift_key value and file cannot be combined")
+	}
+
+	return validateTables(config)
+}
+
+// validateDatabase checks the connection details of a database section,
+// setting the default port of its driver
+func validateDatabase(section string, database *DatabaseConfig) error {
+	if database.Driver != "sqlite" {
+		// SQLite databases are files and only need a name, their path
+		if database.Host == "" {
+			return fmt.Errorf("%s host is required", section)
+		}
+		if database.User == "" {
+			return fmt.Errorf("%s user is required", section)
+		}
+	}
+	if database.Name == "" {
+		return fmt.Errorf("%s name is required", section)
+	}
+	if database.Port == 0 && database.Driver != "sqlite" {
 		// Set default port based on driver
-		switch config.Database.Driver {
+		switch database.Driver {
 		case "mysql":
-			config.Database.Port = 3306
+			database.Port = 3306
 		case "postgres":
-			config.Database.Port = 5432
+			database.Port = 5432
+		case "sqlserver":
+			database.Port = 1433
 		default:
-			return fmt.Errorf("unsupported database driver: %s", config.Database.Driver)
+			return fmt.Errorf("unsupported database driver: %s", database.Driver)
 		}
 	}
 
+	return nil
+}
+
+// transactionModes are the valid values of the transaction option
+var transactionModes = map[string]bool{
+	"chunk": true,
+	"table": true,
+	"none":  true,
+}
+
+// validateTables validates the table, column and converter configuration
+func validateTables(config *Config) error {
 	// Check if there are tables to anonymize
 	if len(config.Tables) == 0 {
 		return fmt.Errorf("no tables specified for anonymization")
 	}
 
+	// Check batch sizes
+	if config.BatchSize < 0 {
+		return fmt.Errorf("batch size must not be negative")
+	}
+	if config.Transaction != "" && !transactionModes[config.Transaction] {
+		return fmt.Errorf("transaction must be chunk, table or none, got %s", config.Transaction)
+	}
+	for tableName, table := range config.Tables {
+		if table.BatchSize < 0 {
+			return fmt.Errorf("batch size of table %s must not be negative", tableName)
+		}
+		if table.Transaction != "" && !transactionModes[table.Transaction] {
+			return fmt.Errorf("transaction of table %s must be chunk, table or none, got %s", tableName, table.Transaction)
+		}
+		if table.ShouldTruncate() && (len(table.Columns) > 0 || table.Where != "") {
+			return fmt.Errorf("table %s: truncate cannot be combined with columns or where", tableName)
+		}
+		for columnName, column := range table.Columns {
+			if column.Converter == "" {
+				if len(column.Params) > 0 && (column.Type == "" || column.Value != nil || column.Expr != "" || column.Null) {
+					return fmt.Errorf("column %s.%s: params require a type and cannot be combined with value, expr or null", tableName, columnName)
+				}
+				continue
+			}
+			if _, ok := config.Converters[column.Converter]; !ok {
+				return fmt.Errorf("column %s.%s references unknown converter %s", tableName, columnName, column.Converter)
+			}
+			if column.Type != "" || len(column.Params) > 0 || column.Value != nil || column.Expr != "" || column.Null {
+				return fmt.Errorf("column %s.%s: converter cannot be combined with type, params, value, expr or null", tableName, columnName)
+			}
+		}
+		if table.ShouldDelete() {
+			if table.ShouldTruncate() || len(table.Columns) > 0 {
+				return fmt.Errorf("table %s: delete cannot be combined with truncate or columns", tableName)
+			}
+			if table.Where == "" {
+				return fmt.Errorf("table %s: delete requires where, use truncate to empty the table", tableName)
+			}
+		}
+	}
+
 	return nil
 }
 
-// GetDSN returns the data source name for database connection
-func (c *DatabaseConfig) GetDSN() string {
-	switch c.Driver {
-	case "mysql":
-		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", c.User, c.Password, c.Host, c.Port, c.Name)
-	case "postgres":
-		return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-			c.Host, c.Port, c.User, c.Password, c.Name)
-	default:
-		return ""
+// Hash returns a hash of the configuration that identifies it across runs.
+// Passwords are left out, so rotating them does not change the hash, and so
+// are the hash, encryption, snapshot and date shift keys, which could
+// otherwise be guessed from the hash.
+func (c *Config) Hash() (string, error) {
+	hashed := *c
+	hashed.Database.Password = ""
+	hashed.HashKey.Value = ""
+	hashed.FPEKey.Value = ""
+	hashed.SnapshotKey.Value = ""
+	hashed.DateShiftKey.Value = ""
+	if c.Target != nil {
+		target := *c.Target
+		target.Password = ""
+		hashed.Target = &target
+	}
+
+	// Maps are marshaled with sorted keys, so equal configurations hash equally
+	data, err := json.Marshal(hashed)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash configuration: %w", err)
 	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
 }
@@ -2,7 +2,10 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -25,6 +28,10 @@ tables:
         type: faker.firstname
       lastname:
         type: faker.lastname
+      dob:
+        type: date_truncate
+        params:
+          to: year
   
   sales_order:
     where: "entity_id > 1000"
@@ -85,8 +92,8 @@ tables:
 	if !ok {
 		t.Fatalf("Expected 'customer_entity' table to exist")
 	}
-	if len(customerTable.Columns) != 3 {
-		t.Errorf("Expected 3 columns in 'customer_entity', got %d", len(customerTable.Columns))
+	if len(customerTable.Columns) != 4 {
+		t.Errorf("Expected 4 columns in 'customer_entity', got %d", len(customerTable.Columns))
 	}
 	emailCol, ok := customerTable.Columns["email"]
 	if !ok {
@@ -95,6 +102,9 @@ tables:
 	if emailCol.Type != "faker.email" {
 		t.Errorf("Expected 'email' column type to be 'faker.email', got '%s'", emailCol.Type)
 	}
+	if dobCol := customerTable.Columns["dob"]; dobCol.Params["to"] != "year" {
+		t.Errorf("Expected 'dob' column params to be {to: year}, got %v", dobCol.Params)
+	}
 
 	// Verify sales_order table
 	salesTable, ok := cfg.Tables["sales_order"]
@@ -179,6 +189,211 @@ func TestValidateConfig(t *testing.T) {
 		t.Error("Expected error for missing tables, got nil")
 	}
 
+	// Test truncate combined with columns
+	cfg = &Config{
+		Database: DatabaseConfig{
+			Host: "host",
+			User: "user",
+			Name: "name",
+		},
+		Tables: map[string]TableConfig{
+			"test": {
+				Truncate: Bool(true),
+				Columns: map[string]ColumnConfig{
+					"email": {Null: true},
+				},
+			},
+		},
+	}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for truncate combined with columns, got nil")
+	}
+
+	// Test delete without where
+	cfg = &Config{
+		Database: DatabaseConfig{
+			Host: "host",
+			User: "user",
+			Name: "name",
+		},
+		Tables: map[string]TableConfig{
+			"test": {
+				Delete: Bool(true),
+			},
+		},
+	}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for delete without where, got nil")
+	}
+
+	// Test unknown converter reference
+	cfg = &Config{
+		Database: DatabaseConfig{
+			Host: "host",
+			User: "user",
+			Name: "name",
+		},
+		Converters: map[string]ConverterConfig{
+			"magento_email": {Type: "faker.email"},
+		},
+		Tables: map[string]TableConfig{
+			"test": {
+				Columns: map[string]ColumnConfig{
+					"email": {Converter: "magento_mail"},
+				},
+			},
+		},
+	}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for unknown converter, got nil")
+	}
+
+	// Test params combined with a converter or without a type
+	params := map[string]interface{}{"to": "year"}
+	for _, column := range []ColumnConfig{
+		{Converter: "magento_email", Params: params},
+		{Value: "x", Params: params},
+		{Params: params},
+	} {
+		cfg.Tables["test"].Columns["email"] = column
+		if err := validateConfig(cfg); err == nil {
+			t.Errorf("Expected error for column %+v, got nil", column)
+		}
+	}
+
+	// Test SQLite config without host and user
+	cfg = &Config{
+		Database: DatabaseConfig{
+			Driver: "sqlite",
+			Name:   "app.db",
+		},
+		Tables: map[string]TableConfig{
+			"test": {},
+		},
+	}
+	if err := validateConfig(cfg); err != nil {
+		t.Errorf("Expected no error for SQLite config, got %v", err)
+	}
+	if cfg.Database.Port != 0 {
+		t.Errorf("Expected no default port for SQLite, got %d", cfg.Database.Port)
+	}
+
+	// Test SQL Server default port
+	cfg = &Config{
+		Database: DatabaseConfig{
+			Driver: "sqlserver",
+			Host:   "host",
+			User:   "user",
+			Name:   "name",
+		},
+		Tables: map[string]TableConfig{
+			"test": {},
+		},
+	}
+	if err := validateConfig(cfg); err != nil {
+		t.Errorf("Expected no error for SQL Server config, got %v", err)
+	}
+	if cfg.Database.Port != 1433 {
+		t.Errorf("Expected default SQL Server port 1433, got %d", cfg.Database.Port)
+	}
+
+	// Test target database defaults to the source driver and port
+	cfg = &Config{
+		Database: DatabaseConfig{
+			Driver: "postgres",
+			Host:   "prod",
+			User:   "user",
+			Name:   "shop",
+		},
+		Target: &DatabaseConfig{
+			Host: "staging",
+			User: "user",
+			Name: "shop",
+		},
+		Tables: map[string]TableConfig{
+			"test": {},
+		},
+	}
+	if err := validateConfig(cfg); err != nil {
+		t.Errorf("Expected no error for target config, got %v", err)
+	}
+	if cfg.Target.Driver != "postgres" || cfg.Target.Port != 5432 {
+		t.Errorf("Expected target postgres on port 5432, got %s on port %d", cfg.Target.Driver, cfg.Target.Port)
+	}
+
+	// Test target database with a different driver
+	cfg.Target.Driver = "mysql"
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for target driver mismatch, got nil")
+	}
+
+	// Test target database that is the source
+	cfg.Target = &DatabaseConfig{Host: "prod", User: "user", Name: "shop"}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for target equal to source, got nil")
+	}
+
+	// Test target database without name
+	cfg.Target = &DatabaseConfig{Host: "staging", User: "user"}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for missing target name, got nil")
+	}
+
+	// Test retry with a maximum delay below the initial delay
+	cfg.Target = nil
+	cfg.Retry = RetryConfig{InitialDelay: time.Second, MaxDelay: time.Millisecond}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for retry max_delay below initial_delay, got nil")
+	}
+
+	// Test negative retry attempts
+	cfg.Retry = RetryConfig{MaxAttempts: -1}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for negative retry max_attempts, got nil")
+	}
+
+	// Test hash key given as value and file
+	cfg.HashKey = KeyConfig{Value: "key", File: "hash.key"}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for hash key value and file, got nil")
+	}
+	cfg.HashKey = KeyConfig{}
+
+	// Test encryption key given as value and file
+	cfg.FPEKey = KeyConfig{Value: "key", File: "fpe.key"}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for fpe key value and file, got nil")
+	}
+	cfg.FPEKey = KeyConfig{}
+
+	// Test snapshot key given as value and file
+	cfg.SnapshotKey = KeyConfig{Value: "key", File: "snapshot.key"}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for snapshot key value and file, got nil")
+	}
+	cfg.SnapshotKey = KeyConfig{}
+
+	// Test date shift key given as value and file
+	cfg.DateShiftKey = KeyConfig{Value: "key", File: "date_shift.key"}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for date shift key value and file, got nil")
+	}
+	cfg.DateShiftKey = KeyConfig{}
+
+	// Test unknown transaction mode
+	cfg.Retry = RetryConfig{}
+	cfg.Transaction = "row"
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for unknown transaction mode, got nil")
+	}
+
+	// Test unknown transaction mode of a table
+	cfg.Transaction = "table"
+	cfg.Tables = map[string]TableConfig{"test": {Transaction: "statement"}}
+	if err := validateConfig(cfg); err == nil {
+		t.Error("Expected error for unknown table transaction mode, got nil")
+	}
+
 	// Test valid config
 	cfg = &Config{
 		Database: DatabaseConfig{
@@ -195,40 +410,377 @@ func TestValidateConfig(t *testing.T) {
 	}
 }
 
-func TestGetDSN(t *testing.T) {
-	// Test MySQL DSN
-	dbConfig := &DatabaseConfig{
-		Driver:   "mysql",
-		Host:     "localhost",
-		Port:     3306,
-		User:     "user",
-		Password: "pass",
-		Name:     "dbname",
+func TestLoadConfigEnvInterpolation(t *testing.T) {
+	t.Setenv("ANON_DB_PASSWORD", "s3cret")
+	t.Setenv("ANON_DB_HOST", "")
+
+	configContent := `
+database:
+  host: ${ANON_DB_HOST:-db.internal}
+  user: app
+  # password: ${ANON_UNSET_IN_COMMENT}
+  password: ${ANON_DB_PASSWORD}
+  name: shop
+  port: ${ANON_DB_PORT:-3307}
+
+tables:
+  customer_entity:
+    columns:
+      note:
+        value: "$${NOT_EXPANDED}"
+`
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
 	}
-	expectedDSN := "user:pass@tcp(localhost:3306)/dbname"
-	if dsn := dbConfig.GetDSN(); dsn != expectedDSN {
-		t.Errorf("Expected MySQL DSN to be '%s', got '%s'", expectedDSN, dsn)
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Database.Host != "db.internal" {
+		t.Errorf("Expected database host to be 'db.internal', got '%s'", cfg.Database.Host)
+	}
+	if cfg.Database.Password != "s3cret" {
+		t.Errorf("Expected database password to be 's3cret', got '%s'", cfg.Database.Password)
+	}
+	if cfg.Database.Port != 3307 {
+		t.Errorf("Expected database port to be 3307, got %d", cfg.Database.Port)
+	}
+	if value := cfg.Tables["customer_entity"].Columns["note"].Value; value != "${NOT_EXPANDED}" {
+		t.Errorf("Expected escaped reference to be kept literally, got '%v'", value)
 	}
 
-	// Test PostgreSQL DSN
-	dbConfig = &DatabaseConfig{
-		Driver:   "postgres",
-		Host:     "localhost",
-		Port:     5432,
-		User:     "user",
-		Password: "pass",
-		Name:     "dbname",
+	// Test values holding YAML syntax stay inside their scalar
+	t.Setenv("ANON_DB_PASSWORD", "p#ss: \"x'\ntables: {}")
+	t.Setenv("ANON_DB_USER", "app # admin")
+	specialContent := "database:\n  host: localhost\n  user: \"${ANON_DB_USER}\"\n  password: ${ANON_DB_PASSWORD}\n  name: shop\n\ntables:\n  customer_entity:\n    truncate: true\n"
+	if err := os.WriteFile(configPath, []byte(specialContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	cfg, err = LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
 	}
-	expectedDSN = "host=localhost port=5432 user=user password=pass dbname=dbname sslmode=disable"
-	if dsn := dbConfig.GetDSN(); dsn != expectedDSN {
-		t.Errorf("Expected PostgreSQL DSN to be '%s', got '%s'", expectedDSN, dsn)
+	if cfg.Database.Password != "p#ss: \"x'\ntables: {}" {
+		t.Errorf("Expected password to be substituted verbatim, got '%s'", cfg.Database.Password)
+	}
+	if cfg.Database.User != "app # admin" {
+		t.Errorf("Expected user to be substituted verbatim, got '%s'", cfg.Database.User)
+	}
+	if _, ok := cfg.Tables["customer_entity"]; !ok {
+		t.Error("Expected tables not to be replaced by the password value")
 	}
 
-	// Test unsupported driver
-	dbConfig = &DatabaseConfig{
-		Driver: "unsupported",
+	// Test missing variable without default
+	missingContent := "database:\n  host: localhost\n  password: ${ANON_MISSING_VARIABLE}\n"
+	if err := os.WriteFile(configPath, []byte(missingContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
 	}
-	if dsn := dbConfig.GetDSN(); dsn != "" {
-		t.Errorf("Expected empty DSN for unsupported driver, got '%s'", dsn)
+	_, err = LoadConfig(configPath)
+	if err == nil {
+		t.Fatal("Expected error for unset environment variable, got nil")
 	}
-}
\ No newline at end of file
+	if !strings.Contains(err.Error(), "config.yaml:3:13") {
+		t.Errorf("Expected error to contain file and position, got '%v'", err)
+	}
+}
+
+func TestLoadConfigInclude(t *testing.T) {
+	baseContent := `
+database:
+  host: localhost
+  user: magento
+  password: magento
+  name: magento
+
+tables:
+  customer_entity:
+    primary_key: entity_id
+    columns:
+      email:
+        type: faker.email
+      firstname:
+        type: faker.firstname
+  sales_order:
+    columns:
+      customer_email:
+        type: faker.email
+  sessions:
+    truncate: true
+`
+	overrideContent := `
+include: base.yaml
+
+database:
+  host: staging-db
+  name: magento_staging
+
+tables:
+  customer_entity:
+    where: "entity_id > 10"
+    columns:
+      firstname:
+        value: "Jane"
+  quote:
+    columns:
+      customer_email:
+        type: faker.email
+  sessions:
+    truncate: false
+`
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "base.yaml"), []byte(baseContent), 0644); err != nil {
+		t.Fatalf("Failed to write base config: %v", err)
+	}
+	overridePath := filepath.Join(dir, "staging.yaml")
+	if err := os.WriteFile(overridePath, []byte(overrideContent), 0644); err != nil {
+		t.Fatalf("Failed to write override config: %v", err)
+	}
+
+	cfg, err := LoadConfig(overridePath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Database.Host != "staging-db" {
+		t.Errorf("Expected database host to be 'staging-db', got '%s'", cfg.Database.Host)
+	}
+	if cfg.Database.User != "magento" {
+		t.Errorf("Expected database user to be inherited as 'magento', got '%s'", cfg.Database.User)
+	}
+	if cfg.Database.Name != "magento_staging" {
+		t.Errorf("Expected database name to be 'magento_staging', got '%s'", cfg.Database.Name)
+	}
+	if len(cfg.Tables) != 4 {
+		t.Errorf("Expected 4 tables, got %d", len(cfg.Tables))
+	}
+	if cfg.Tables["sessions"].ShouldTruncate() {
+		t.Error("Expected 'sessions' truncate to be switched off by the override")
+	}
+
+	customerTable := cfg.Tables["customer_entity"]
+	if len(customerTable.PrimaryKey) != 1 || customerTable.PrimaryKey[0] != "entity_id" {
+		t.Errorf("Expected primary key to be inherited as 'entity_id', got '%v'", customerTable.PrimaryKey)
+	}
+	if customerTable.Where != "entity_id > 10" {
+		t.Errorf("Expected where clause to be 'entity_id > 10', got '%s'", customerTable.Where)
+	}
+	if customerTable.Columns["email"].Type != "faker.email" {
+		t.Errorf("Expected 'email' column to be inherited, got '%v'", customerTable.Columns["email"])
+	}
+	if customerTable.Columns["firstname"].Value != "Jane" {
+		t.Errorf("Expected 'firstname' column to be overridden, got '%v'", customerTable.Columns["firstname"])
+	}
+
+	// Test include cycle
+	if err := os.WriteFile(filepath.Join(dir, "base.yaml"), []byte("include: staging.yaml\n"), 0644); err != nil {
+		t.Fatalf("Failed to write base config: %v", err)
+	}
+	if _, err := LoadConfig(overridePath); err == nil {
+		t.Error("Expected error for include cycle, got nil")
+	}
+}
+
+func TestLoadConfigParseError(t *testing.T) {
+	configContent := "database:\n  host: localhost\n  port: not-a-number\n"
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "broken.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	_, err := LoadConfig(configPath)
+	if err == nil {
+		t.Fatal("Expected error for invalid port, got nil")
+	}
+	if !strings.Contains(err.Error(), "broken.yaml") || !strings.Contains(err.Error(), "[3:9]") {
+		t.Errorf("Expected error to contain file name and position, got '%v'", err)
+	}
+}
+
+func TestLoadConfigCompositePrimaryKey(t *testing.T) {
+	configContent := `
+database:
+  host: localhost
+  user: magento
+  name: magento
+
+tables:
+  customer_entity:
+    primary_key: entity_id
+    columns:
+      email:
+        type: faker.email
+  catalog_product_option_type_price:
+    primary_key: [option_type_id, store_id]
+    columns:
+      title:
+        value: "Option"
+`
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	single := cfg.Tables["customer_entity"].PrimaryKey
+	if len(single) != 1 || single[0] != "entity_id" {
+		t.Errorf("Expected primary key [entity_id], got %v", single)
+	}
+
+	composite := cfg.Tables["catalog_product_option_type_price"].PrimaryKey
+	if len(composite) != 2 || composite[0] != "option_type_id" || composite[1] != "store_id" {
+		t.Errorf("Expected primary key [option_type_id store_id], got %v", composite)
+	}
+}
+
+func TestLoadDumpConfig(t *testing.T) {
+	content := `
+tables:
+  customer_entity:
+    columns:
+      email:
+        type: faker.email
+`
+	configPath := filepath.Join(t.TempDir(), "dump.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	// The connection details are not required for dump files
+	if _, err := LoadConfig(configPath); err == nil {
+		t.Error("Expected error for missing database host, got nil")
+	}
+	cfg, err := LoadDumpConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load dump config: %v", err)
+	}
+	if cfg.Database.Driver != "mysql" {
+		t.Errorf("Expected driver to default to 'mysql', got '%s'", cfg.Database.Driver)
+	}
+}
+
+func TestLoadScanConfig(t *testing.T) {
+	content := `
+database:
+  driver: sqlite
+  name: shop.db
+`
+	configPath := filepath.Join(t.TempDir(), "scan.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	// Tables are not required for scanning
+	if _, err := LoadConfig(configPath); err == nil {
+		t.Error("Expected error for missing tables, got nil")
+	}
+	cfg, err := LoadScanConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load scan config: %v", err)
+	}
+	if cfg.Database.Name != "shop.db" || len(cfg.Tables) != 0 {
+		t.Errorf("Unexpected scan config %+v", cfg)
+	}
+
+	// The database section is
+	content = `
+tables:
+  customer_entity:
+    truncate: true
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := LoadScanConfig(configPath); err == nil {
+		t.Error("Expected error for missing database host, got nil")
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			Database: DatabaseConfig{Driver: "mysql", Host: "localhost", Name: "shop", Password: "secret"},
+			Target:   &DatabaseConfig{Driver: "mysql", Host: "localhost", Name: "shop_anon", Password: "secret"},
+			Tables: map[string]TableConfig{
+				"customer_entity": {Columns: map[string]ColumnConfig{"email": {Type: "faker.email"}}},
+				"sales_order":     {Columns: map[string]ColumnConfig{"customer_email": {Type: "faker.email"}}},
+			},
+		}
+	}
+
+	hash, err := newConfig().Hash()
+	if err != nil {
+		t.Fatalf("Failed to hash config: %v", err)
+	}
+
+	// Passwords do not change the hash, and the password is kept
+	cfg := newConfig()
+	cfg.Database.Password = "rotated"
+	cfg.Target.Password = "rotated"
+	if other, _ := cfg.Hash(); other != hash {
+		t.Error("Expected passwords not to change the hash")
+	}
+	if cfg.Target.Password != "rotated" {
+		t.Errorf("Expected hashing to keep the target password, got '%s'", cfg.Target.Password)
+	}
+
+	// Neither do the hash, encryption, snapshot and date shift keys
+	cfg = newConfig()
+	cfg.HashKey.Value = "key"
+	cfg.FPEKey.Value = "2b7e151628aed2a6abf7158809cf4f3c"
+	cfg.SnapshotKey.Value = "snapshot"
+	cfg.DateShiftKey.Value = "date-shift"
+	if other, _ := cfg.Hash(); other != hash {
+		t.Error("Expected the keys not to change the hash")
+	}
+
+	// Any other change does
+	cfg = newConfig()
+	cfg.Tables["sales_order"].Columns["customer_email"] = ColumnConfig{Null: true}
+	if other, _ := cfg.Hash(); other == hash {
+		t.Error("Expected a changed column to change the hash")
+	}
+	cfg = newConfig()
+	cfg.Target.Name = "shop_copy"
+	if other, _ := cfg.Hash(); other == hash {
+		t.Error("Expected a changed target to change the hash")
+	}
+}
+
+func TestLoadConfigRetry(t *testing.T) {
+	content := `
+database:
+  driver: sqlite
+  name: shop.db
+retry:
+  max_attempts: 8
+  initial_delay: 250ms
+  max_delay: 1m
+tables:
+  customer_entity:
+    truncate: true
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	expected := RetryConfig{MaxAttempts: 8, InitialDelay: 250 * time.Millisecond, MaxDelay: time.Minute}
+	if cfg.Retry != expected {
+		t.Errorf("Expected retry %+v, got %+v", expected, cfg.Retry)
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/goccy/go-yaml/token"
+)
+
+// envPattern matches ${VAR}, ${VAR:-default} and the escaped form $${...}
+var envPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolateEnv expands environment variable references in the scalars of
+// the tokenized configuration. ${VAR:-default} falls back to default when VAR
+// is unset or empty, and $${VAR} is kept literally as ${VAR}. Values are
+// substituted into the scalars after tokenizing, so a value holding YAML
+// syntax such as "#", ": " or quotes stays part of its scalar. A plain scalar
+// that was a reference takes the type of its value, so ports stay numbers.
+// Comments are left untouched so that commented-out settings do not require
+// their variables.
+func interpolateEnv(filePath string, tokens token.Tokens) error {
+	for _, tk := range tokens {
+		var offset int
+		switch tk.Type {
+		case token.StringType:
+		case token.DoubleQuoteType, token.SingleQuoteType:
+			offset = 1
+		default:
+			continue
+		}
+		if !strings.Contains(tk.Value, "${") {
+			continue
+		}
+
+		var err error
+		value := envPattern.ReplaceAllStringFunc(tk.Value, func(reference string) string {
+			if strings.HasPrefix(reference, "$$") {
+				return reference[1:]
+			}
+
+			match := envPattern.FindStringSubmatch(reference)
+			value, ok := os.LookupEnv(match[1])
+			if match[2] != "" && value == "" {
+				value, ok = match[3], true
+			}
+			if !ok && err == nil {
+				column := tk.Position.Column + offset + strings.Index(tk.Value, reference)
+				err = fmt.Errorf("%s:%d:%d: environment variable %s is not set", filePath, tk.Position.Line, column, match[1])
+			}
+			return value
+		})
+		if err != nil {
+			return err
+		}
+
+		if tk.Type == token.StringType {
+			tk.Type = token.New(value, tk.Origin, tk.Position).Type
+		}
+		tk.Value = value
+	}
+	return nil
+}
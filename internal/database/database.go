@@ -3,9 +3,13 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
+	_ "github.com/microsoft/go-mssqldb"
+	_ "modernc.org/sqlite"
 )
 
 // Driver represents a database driver
@@ -16,6 +20,10 @@ const (
 	MySQL Driver = "mysql"
 	// PostgreSQL driver
 	PostgreSQL Driver = "postgres"
+	// SQLite driver
+	SQLite Driver = "sqlite"
+	// SQLServer driver for Microsoft SQL Server
+	SQLServer Driver = "sqlserver"
 )
 
 // Config holds database connection configuration
@@ -30,16 +38,9 @@ type Config struct {
 
 // Connect establishes a connection to the database
 func Connect(config Config) (*sql.DB, error) {
-	var dsn string
-
-	switch config.Driver {
-	case MySQL:
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", config.User, config.Password, config.Host, config.Port, config.Name)
-	case PostgreSQL:
-		dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-			config.Host, config.Port, config.User, config.Password, config.Name)
-	default:
-		return nil, fmt.Errorf("unsupported database driver: %s", config.Driver)
+	dsn, err := dataSourceName(config)
+	if err != nil {
+		return nil, err
 	}
 
 	db, err := sql.Open(string(config.Driver), dsn)
@@ -56,14 +57,56 @@ func Connect(config Config) (*sql.DB, error) {
 	// Set connection pool parameters
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(5)
+	if config.Driver == SQLite {
+		// SQLite allows a single writer; one connection serializes the workers
+		// instead of failing them with "database is locked"
+		db.SetMaxOpenConns(1)
+	}
 
 	return db, nil
 }
 
-// GetPrimaryKey gets the primary key column for a table
-func GetPrimaryKey(db *sql.DB, driver Driver, tableName string) (string, error) {
+// dataSourceName builds the data source name the driver of a database
+// connects with
+func dataSourceName(config Config) (string, error) {
+	switch config.Driver {
+	case MySQL:
+		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", config.User, config.Password, config.Host, config.Port, config.Name), nil
+	case PostgreSQL:
+		return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+			config.Host, config.Port, config.User, config.Password, config.Name), nil
+	case SQLite:
+		// The name is the path of the database file. Foreign keys are enforced
+		// so that deletions behave like on the other databases, and times are
+		// written in the format of SQLite's date functions.
+		separator := "?"
+		if strings.Contains(config.Name, "?") {
+			separator = "&"
+		}
+		return config.Name + separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite", nil
+	case SQLServer:
+		return sqlServerURL(config.Host, config.Port, config.User, config.Password, config.Name), nil
+	default:
+		return "", fmt.Errorf("unsupported database driver: %s", config.Driver)
+	}
+}
+
+// sqlServerURL builds the connection URL of a SQL Server database
+func sqlServerURL(host string, port int, user, password, name string) string {
+	dsn := url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(user, password),
+		Host:     fmt.Sprintf("%s:%d", host, port),
+		RawQuery: url.Values{"database": {name}}.Encode(),
+	}
+	return dsn.String()
+}
+
+// GetPrimaryKey gets the primary key columns for a table, in key order
+func GetPrimaryKey(db *sql.DB, driver Driver, tableName string) ([]string, error) {
 	var query string
-	var primaryKey string
+	var rows *sql.Rows
+	var err error
 
 	switch driver {
 	case MySQL:
@@ -73,15 +116,9 @@ func GetPrimaryKey(db *sql.DB, driver Driver, tableName string) (string, error)
 			WHERE TABLE_SCHEMA = DATABASE()
 			AND TABLE_NAME = ?
 			AND CONSTRAINT_NAME = 'PRIMARY'
-			LIMIT 1
+			ORDER BY ORDINAL_POSITION
 		`
-		err := db.QueryRow(query, tableName).Scan(&primaryKey)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				return "", fmt.Errorf("no primary key found for table %s", tableName)
-			}
-			return "", err
-		}
+		rows, err = db.Query(query, tableName)
 	case PostgreSQL:
 		query = `
 			SELECT a.attname
@@ -89,17 +126,53 @@ func GetPrimaryKey(db *sql.DB, driver Driver, tableName string) (string, error)
 			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
 			WHERE i.indrelid = $1::regclass
 			AND i.indisprimary
-			LIMIT 1
+			ORDER BY array_position(i.indkey::int2[], a.attnum)
 		`
-		err := db.QueryRow(query, tableName).Scan(&primaryKey)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				return "", fmt.Errorf("no primary key found for table %s", tableName)
-			}
-			return "", err
-		}
+		// regclass folds unquoted names to lower case, like SQL does
+		rows, err = db.Query(query, PostgresDialect{}.QuoteIdentifier(tableName))
+	case SQLite:
+		query = `
+			SELECT name
+			FROM pragma_table_info(?)
+			WHERE pk > 0
+			ORDER BY pk
+		`
+		rows, err = db.Query(query, tableName)
+	case SQLServer:
+		query = `
+			SELECT c.name
+			FROM sys.key_constraints kc
+			JOIN sys.index_columns ic ON ic.object_id = kc.parent_object_id AND ic.index_id = kc.unique_index_id
+			JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+			WHERE kc.type = 'PK'
+			AND kc.parent_object_id = OBJECT_ID(@p1)
+			ORDER BY ic.key_ordinal
+		`
+		rows, err = db.Query(query, SQLServerDialect{}.QuoteIdentifier(tableName))
 	default:
-		return "", fmt.Errorf("unsupported database driver: %s", driver)
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var primaryKey []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		primaryKey = append(primaryKey, column)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(primaryKey) == 0 {
+		return nil, fmt.Errorf("no primary key found for table %s", tableName)
 	}
 
 	return primaryKey, nil
@@ -130,6 +203,21 @@ func GetTableColumns(db *sql.DB, driver Driver, tableName string) ([]string, err
 			ORDER BY ordinal_position
 		`
 		rows, err = db.Query(query, tableName)
+	case SQLite:
+		query = `
+			SELECT name
+			FROM pragma_table_info(?)
+			ORDER BY cid
+		`
+		rows, err = db.Query(query, tableName)
+	case SQLServer:
+		query = `
+			SELECT name
+			FROM sys.columns
+			WHERE object_id = OBJECT_ID(@p1)
+			ORDER BY column_id
+		`
+		rows, err = db.Query(query, SQLServerDialect{}.QuoteIdentifier(tableName))
 	default:
 		return nil, fmt.Errorf("unsupported database driver: %s", driver)
 	}
@@ -153,4 +241,273 @@ func GetTableColumns(db *sql.DB, driver Driver, tableName string) ([]string, err
 	}
 
 	return columns, nil
-}
\ No newline at end of file
+}
+
+// GetTables gets the names of the tables of the database
+func GetTables(db *sql.DB, driver Driver) ([]string, error) {
+	var query string
+
+	switch driver {
+	case MySQL:
+		query = `
+			SELECT TABLE_NAME
+			FROM INFORMATION_SCHEMA.TABLES
+			WHERE TABLE_SCHEMA = DATABASE()
+			AND TABLE_TYPE = 'BASE TABLE'
+			ORDER BY TABLE_NAME
+		`
+	case PostgreSQL:
+		query = `
+			SELECT tablename
+			FROM pg_tables
+			WHERE schemaname = 'public'
+			ORDER BY tablename
+		`
+	case SQLite:
+		query = `
+			SELECT name
+			FROM sqlite_master
+			WHERE type = 'table'
+			AND name NOT LIKE 'sqlite_%'
+			ORDER BY name
+		`
+	case SQLServer:
+		query = `
+			SELECT name
+			FROM sys.tables
+			WHERE schema_id = SCHEMA_ID()
+			ORDER BY name
+		`
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tables, nil
+}
+
+// ColumnDefinition describes a column of a table with its type as written
+// in CREATE TABLE
+type ColumnDefinition struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+// GetColumnDefinitions gets the definitions of the columns of a table, in
+// table order
+func GetColumnDefinitions(db *sql.DB, driver Driver, tableName string) ([]ColumnDefinition, error) {
+	var query string
+	var rows *sql.Rows
+	var err error
+
+	switch driver {
+	case MySQL:
+		query = `
+			SELECT COLUMN_NAME, COLUMN_TYPE, CASE WHEN IS_NULLABLE = 'YES' THEN 1 ELSE 0 END
+			FROM INFORMATION_SCHEMA.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE()
+			AND TABLE_NAME = ?
+			ORDER BY ORDINAL_POSITION
+		`
+		rows, err = db.Query(query, tableName)
+	case PostgreSQL:
+		query = `
+			SELECT a.attname, format_type(a.atttypid, a.atttypmod), CASE WHEN a.attnotnull THEN 0 ELSE 1 END
+			FROM pg_attribute a
+			WHERE a.attrelid = $1::regclass
+			AND a.attnum > 0
+			AND NOT a.attisdropped
+			ORDER BY a.attnum
+		`
+		// regclass folds unquoted names to lower case, like SQL does
+		rows, err = db.Query(query, PostgresDialect{}.QuoteIdentifier(tableName))
+	case SQLite:
+		query = `
+			SELECT name, type, CASE WHEN "notnull" = 0 THEN 1 ELSE 0 END
+			FROM pragma_table_info(?)
+			ORDER BY cid
+		`
+		rows, err = db.Query(query, tableName)
+	case SQLServer:
+		query = `
+			SELECT c.name, t.name + CASE
+				WHEN t.name IN ('char', 'varchar', 'binary', 'varbinary')
+					THEN '(' + CASE WHEN c.max_length = -1 THEN 'max' ELSE CAST(c.max_length AS varchar(10)) END + ')'
+				WHEN t.name IN ('nchar', 'nvarchar')
+					THEN '(' + CASE WHEN c.max_length = -1 THEN 'max' ELSE CAST(c.max_length / 2 AS varchar(10)) END + ')'
+				WHEN t.name IN ('decimal', 'numeric')
+					THEN '(' + CAST(c.precision AS varchar(10)) + ', ' + CAST(c.scale AS varchar(10)) + ')'
+				WHEN t.name IN ('datetime2', 'datetimeoffset', 'time')
+					THEN '(' + CAST(c.scale AS varchar(10)) + ')'
+				ELSE ''
+			END, CASE WHEN c.is_nullable = 1 THEN 1 ELSE 0 END
+			FROM sys.columns c
+			JOIN sys.types t ON t.user_type_id = c.user_type_id
+			WHERE c.object_id = OBJECT_ID(@p1)
+			ORDER BY c.column_id
+		`
+		rows, err = db.Query(query, SQLServerDialect{}.QuoteIdentifier(tableName))
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []ColumnDefinition
+	for rows.Next() {
+		var column ColumnDefinition
+		var nullable int
+		if err := rows.Scan(&column.Name, &column.Type, &nullable); err != nil {
+			return nil, err
+		}
+		column.Nullable = nullable == 1
+		columns = append(columns, column)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns found for table %s", tableName)
+	}
+
+	return columns, nil
+}
+
+// ForeignKey describes a foreign key constraint
+type ForeignKey struct {
+	Name              string
+	Table             string
+	Columns           []string
+	ReferencedTable   string
+	ReferencedColumns []string
+}
+
+// GetForeignKeys gets all foreign key constraints of the database
+func GetForeignKeys(db *sql.DB, driver Driver) ([]ForeignKey, error) {
+	var query string
+
+	switch driver {
+	case MySQL:
+		query = `
+			SELECT CONSTRAINT_NAME, TABLE_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+			FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE
+			WHERE TABLE_SCHEMA = DATABASE()
+			AND REFERENCED_TABLE_NAME IS NOT NULL
+			ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION
+		`
+	case PostgreSQL:
+		query = `
+			SELECT con.conname, cl.relname, att.attname, rcl.relname, ratt.attname
+			FROM pg_constraint con
+			JOIN pg_class cl ON cl.oid = con.conrelid
+			JOIN pg_class rcl ON rcl.oid = con.confrelid
+			JOIN pg_namespace ns ON ns.oid = cl.relnamespace
+			CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, refattnum, ord)
+			JOIN pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = k.attnum
+			JOIN pg_attribute ratt ON ratt.attrelid = con.confrelid AND ratt.attnum = k.refattnum
+			WHERE con.contype = 'f'
+			AND ns.nspname = 'public'
+			ORDER BY cl.relname, con.conname, k.ord
+		`
+	case SQLite:
+		// SQLite foreign keys have no names; their id is unique per table.
+		// A missing referenced column means the referenced primary key.
+		query = `
+			SELECT CAST(fk.id AS TEXT), m.name, fk."from", fk."table", COALESCE(fk."to", '')
+			FROM sqlite_master m
+			JOIN pragma_foreign_key_list(m.name) fk
+			WHERE m.type = 'table'
+			ORDER BY m.name, fk.id, fk.seq
+		`
+	case SQLServer:
+		// Tables outside the default schema are named with their schema,
+		// like dbo.OINV; tables of the default schema are named as
+		// GetTables names them
+		query = `
+			SELECT fk.name,
+				CASE WHEN OBJECT_SCHEMA_NAME(fk.parent_object_id) = SCHEMA_NAME() THEN '' ELSE OBJECT_SCHEMA_NAME(fk.parent_object_id) + '.' END + OBJECT_NAME(fk.parent_object_id),
+				pc.name,
+				CASE WHEN OBJECT_SCHEMA_NAME(fk.referenced_object_id) = SCHEMA_NAME() THEN '' ELSE OBJECT_SCHEMA_NAME(fk.referenced_object_id) + '.' END + OBJECT_NAME(fk.referenced_object_id),
+				rc.name
+			FROM sys.foreign_keys fk
+			JOIN sys.foreign_key_columns fkc ON fkc.constraint_object_id = fk.object_id
+			JOIN sys.columns pc ON pc.object_id = fkc.parent_object_id AND pc.column_id = fkc.parent_column_id
+			JOIN sys.columns rc ON rc.object_id = fkc.referenced_object_id AND rc.column_id = fkc.referenced_column_id
+			ORDER BY OBJECT_SCHEMA_NAME(fk.parent_object_id), OBJECT_NAME(fk.parent_object_id), fk.name, fkc.constraint_column_id
+		`
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var foreignKeys []ForeignKey
+	for rows.Next() {
+		var name, table, column, referencedTable, referencedColumn string
+		if err := rows.Scan(&name, &table, &column, &referencedTable, &referencedColumn); err != nil {
+			return nil, err
+		}
+
+		// Rows of a composite key arrive consecutively, ordered by position
+		if n := len(foreignKeys); n > 0 && foreignKeys[n-1].Name == name && foreignKeys[n-1].Table == table {
+			foreignKeys[n-1].Columns = append(foreignKeys[n-1].Columns, column)
+			foreignKeys[n-1].ReferencedColumns = append(foreignKeys[n-1].ReferencedColumns, referencedColumn)
+			continue
+		}
+
+		foreignKeys = append(foreignKeys, ForeignKey{
+			Name:              name,
+			Table:             table,
+			Columns:           []string{column},
+			ReferencedTable:   referencedTable,
+			ReferencedColumns: []string{referencedColumn},
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Resolve references to the implicit primary key of the referenced table
+	for i, foreignKey := range foreignKeys {
+		if foreignKey.ReferencedColumns[0] != "" {
+			continue
+		}
+		primaryKey, err := GetPrimaryKey(db, driver, foreignKey.ReferencedTable)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve foreign key of table %s: %w", foreignKey.Table, err)
+		}
+		foreignKeys[i].ReferencedColumns = primaryKey
+	}
+
+	return foreignKeys, nil
+}
@@ -0,0 +1,256 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect describes the SQL syntax differences between database drivers
+type Dialect interface {
+	// Driver returns the driver the dialect belongs to
+	Driver() Driver
+	// QuoteIdentifier quotes a table or column name. Names qualified with a
+	// schema, such as sales.orders, have every part quoted.
+	QuoteIdentifier(name string) string
+	// Placeholder returns the bind parameter placeholder for the n-th
+	// parameter of a statement, counting from 1
+	Placeholder(n int) string
+	// SupportsUpdateLimit reports whether UPDATE accepts ORDER BY and LIMIT
+	SupportsUpdateLimit() bool
+	// SupportsTruncate reports whether the database has TRUNCATE TABLE
+	SupportsTruncate() bool
+	// RowValueList renders row values as the right-hand side of IN
+	RowValueList(rows []string) string
+	// MaxParameters returns the largest number of parameters a statement can bind
+	MaxParameters() int
+	// SupportsRowValues reports whether row values such as (a, b) can be
+	// compared and used with IN
+	SupportsRowValues() bool
+	// LimitClauses returns the clauses that restrict a SELECT to n rows: one
+	// that follows SELECT, such as TOP (n), and one that ends the query, such
+	// as LIMIT n. Dialects use one of them and leave the other empty.
+	LimitClauses(n int) (top, limit string)
+}
+
+// NewDialect returns the dialect of a driver. An empty driver selects MySQL,
+// the default driver of the configuration.
+func NewDialect(driver Driver) (Dialect, error) {
+	switch driver {
+	case MySQL, "":
+		return MySQLDialect{}, nil
+	case PostgreSQL:
+		return PostgresDialect{}, nil
+	case SQLite:
+		return SQLiteDialect{}, nil
+	case SQLServer:
+		return SQLServerDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+}
+
+// MySQLDialect is the dialect of MySQL and MariaDB
+type MySQLDialect struct{}
+
+// Driver implements Dialect.Driver
+func (MySQLDialect) Driver() Driver {
+	return MySQL
+}
+
+// QuoteIdentifier implements Dialect.QuoteIdentifier
+func (MySQLDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, "`", "`")
+}
+
+// Placeholder implements Dialect.Placeholder
+func (MySQLDialect) Placeholder(n int) string {
+	return "?"
+}
+
+// SupportsUpdateLimit implements Dialect.SupportsUpdateLimit
+func (MySQLDialect) SupportsUpdateLimit() bool {
+	return true
+}
+
+// SupportsTruncate implements Dialect.SupportsTruncate
+func (MySQLDialect) SupportsTruncate() bool {
+	return true
+}
+
+// RowValueList implements Dialect.RowValueList
+func (MySQLDialect) RowValueList(rows []string) string {
+	return fmt.Sprintf("(%s)", strings.Join(rows, ", "))
+}
+
+// MaxParameters implements Dialect.MaxParameters
+func (MySQLDialect) MaxParameters() int {
+	return 65535
+}
+
+// SupportsRowValues implements Dialect.SupportsRowValues
+func (MySQLDialect) SupportsRowValues() bool {
+	return true
+}
+
+// LimitClauses implements Dialect.LimitClauses
+func (MySQLDialect) LimitClauses(n int) (string, string) {
+	return "", fmt.Sprintf("LIMIT %d", n)
+}
+
+// PostgresDialect is the dialect of PostgreSQL
+type PostgresDialect struct{}
+
+// Driver implements Dialect.Driver
+func (PostgresDialect) Driver() Driver {
+	return PostgreSQL
+}
+
+// QuoteIdentifier implements Dialect.QuoteIdentifier
+func (PostgresDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, `"`, `"`)
+}
+
+// Placeholder implements Dialect.Placeholder
+func (PostgresDialect) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// SupportsUpdateLimit implements Dialect.SupportsUpdateLimit
+func (PostgresDialect) SupportsUpdateLimit() bool {
+	return false
+}
+
+// SupportsTruncate implements Dialect.SupportsTruncate
+func (PostgresDialect) SupportsTruncate() bool {
+	return true
+}
+
+// RowValueList implements Dialect.RowValueList
+func (PostgresDialect) RowValueList(rows []string) string {
+	return fmt.Sprintf("(%s)", strings.Join(rows, ", "))
+}
+
+// MaxParameters implements Dialect.MaxParameters
+func (PostgresDialect) MaxParameters() int {
+	return 65535
+}
+
+// SupportsRowValues implements Dialect.SupportsRowValues
+func (PostgresDialect) SupportsRowValues() bool {
+	return true
+}
+
+// LimitClauses implements Dialect.LimitClauses
+func (PostgresDialect) LimitClauses(n int) (string, string) {
+	return "", fmt.Sprintf("LIMIT %d", n)
+}
+
+// SQLiteDialect is the dialect of SQLite
+type SQLiteDialect struct{}
+
+// Driver implements Dialect.Driver
+func (SQLiteDialect) Driver() Driver {
+	return SQLite
+}
+
+// QuoteIdentifier implements Dialect.QuoteIdentifier
+func (SQLiteDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, `"`, `"`)
+}
+
+// Placeholder implements Dialect.Placeholder
+func (SQLiteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+// SupportsUpdateLimit implements Dialect.SupportsUpdateLimit
+func (SQLiteDialect) SupportsUpdateLimit() bool {
+	return false
+}
+
+// SupportsTruncate implements Dialect.SupportsTruncate
+func (SQLiteDialect) SupportsTruncate() bool {
+	return false
+}
+
+// RowValueList implements Dialect.RowValueList. SQLite only accepts a
+// subquery on the right-hand side of a row value IN.
+func (SQLiteDialect) RowValueList(rows []string) string {
+	return fmt.Sprintf("(VALUES %s)", strings.Join(rows, ", "))
+}
+
+// MaxParameters implements Dialect.MaxParameters
+func (SQLiteDialect) MaxParameters() int {
+	return 32766
+}
+
+// SupportsRowValues implements Dialect.SupportsRowValues
+func (SQLiteDialect) SupportsRowValues() bool {
+	return true
+}
+
+// LimitClauses implements Dialect.LimitClauses
+func (SQLiteDialect) LimitClauses(n int) (string, string) {
+	return "", fmt.Sprintf("LIMIT %d", n)
+}
+
+// SQLServerDialect is the dialect of Microsoft SQL Server
+type SQLServerDialect struct{}
+
+// Driver implements Dialect.Driver
+func (SQLServerDialect) Driver() Driver {
+	return SQLServer
+}
+
+// QuoteIdentifier implements Dialect.QuoteIdentifier
+func (SQLServerDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, "[", "]")
+}
+
+// Placeholder implements Dialect.Placeholder
+func (SQLServerDialect) Placeholder(n int) string {
+	return fmt.Sprintf("@p%d", n)
+}
+
+// SupportsUpdateLimit implements Dialect.SupportsUpdateLimit. UPDATE TOP (n)
+// exists, but cannot be combined with ORDER BY.
+func (SQLServerDialect) SupportsUpdateLimit() bool {
+	return false
+}
+
+// SupportsTruncate implements Dialect.SupportsTruncate
+func (SQLServerDialect) SupportsTruncate() bool {
+	return true
+}
+
+// RowValueList implements Dialect.RowValueList. SQL Server has no row
+// values, so the SQL generator does not use it.
+func (SQLServerDialect) RowValueList(rows []string) string {
+	return fmt.Sprintf("(%s)", strings.Join(rows, ", "))
+}
+
+// MaxParameters implements Dialect.MaxParameters. A request carries at most
+// 2100 parameters, two of which sp_executesql needs for the statement itself.
+func (SQLServerDialect) MaxParameters() int {
+	return 2098
+}
+
+// SupportsRowValues implements Dialect.SupportsRowValues
+func (SQLServerDialect) SupportsRowValues() bool {
+	return false
+}
+
+// LimitClauses implements Dialect.LimitClauses
+func (SQLServerDialect) LimitClauses(n int) (string, string) {
+	return fmt.Sprintf("TOP (%d)", n), ""
+}
+
+// quoteIdentifier quotes every dot separated part of name between open and
+// closing quote characters, doubling closing quotes inside the name
+func quoteIdentifier(name, open, closing string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = open + strings.ReplaceAll(part, closing, closing+closing) + closing
+	}
+	return strings.Join(parts, ".")
+}
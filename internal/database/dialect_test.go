@@ -0,0 +1,66 @@
+package database
+
+import "testing"
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		dialect  Dialect
+		name     string
+		expected string
+	}{
+		{MySQLDialect{}, "order", "`order`"},
+		{MySQLDialect{}, "sales-order", "`sales-order`"},
+		{MySQLDialect{}, "shop.sales_order", "`shop`.`sales_order`"},
+		{MySQLDialect{}, "odd`name", "`odd``name`"},
+		{PostgresDialect{}, "CustomerEntity", `"CustomerEntity"`},
+		{PostgresDialect{}, "public.group", `"public"."group"`},
+		{PostgresDialect{}, `odd"name`, `"odd""name"`},
+		{SQLServerDialect{}, "order", "[order]"},
+		{SQLServerDialect{}, "dbo.Sales Order", "[dbo].[Sales Order]"},
+		{SQLServerDialect{}, "odd]name", "[odd]]name]"},
+	}
+
+	for _, test := range tests {
+		if quoted := test.dialect.QuoteIdentifier(test.name); quoted != test.expected {
+			t.Errorf("Expected %s to quote %s as %s, got %s", test.dialect.Driver(), test.name, test.expected, quoted)
+		}
+	}
+}
+
+func TestNewDialect(t *testing.T) {
+	dialect, err := NewDialect("")
+	if err != nil {
+		t.Fatalf("Failed to create dialect: %v", err)
+	}
+	if dialect.Driver() != MySQL {
+		t.Errorf("Expected the default dialect to be mysql, got %s", dialect.Driver())
+	}
+
+	dialect, err = NewDialect(PostgreSQL)
+	if err != nil {
+		t.Fatalf("Failed to create dialect: %v", err)
+	}
+	if dialect.Placeholder(2) != "$2" || dialect.SupportsUpdateLimit() {
+		t.Errorf("Unexpected postgres dialect behavior")
+	}
+
+	dialect, err = NewDialect(SQLite)
+	if err != nil {
+		t.Fatalf("Failed to create dialect: %v", err)
+	}
+	if dialect.SupportsTruncate() || dialect.RowValueList([]string{"(?, ?)"}) != "(VALUES (?, ?))" {
+		t.Errorf("Unexpected sqlite dialect behavior")
+	}
+
+	dialect, err = NewDialect(SQLServer)
+	if err != nil {
+		t.Fatalf("Failed to create dialect: %v", err)
+	}
+	if top, limit := dialect.LimitClauses(10); dialect.Placeholder(3) != "@p3" || top != "TOP (10)" || limit != "" {
+		t.Errorf("Unexpected sqlserver dialect behavior")
+	}
+
+	if _, err := NewDialect("oracle"); err == nil {
+		t.Error("Expected error for unsupported driver, got nil")
+	}
+}
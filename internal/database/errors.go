@@ -0,0 +1,78 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// MySQL error numbers of transient errors
+var mysqlRetryable = map[uint16]bool{
+	1205: true, // ER_LOCK_WAIT_TIMEOUT
+	1213: true, // ER_LOCK_DEADLOCK
+	2006: true, // CR_SERVER_GONE_ERROR
+	2013: true, // CR_SERVER_LOST
+}
+
+// PostgreSQL error codes of transient errors, besides the connection
+// exception class 08
+var postgresRetryable = map[pq.ErrorCode]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"55P03": true, // lock_not_available
+	"57P01": true, // admin_shutdown
+}
+
+// SQL Server error numbers of transient errors
+var sqlServerRetryable = map[int32]bool{
+	1205: true, // deadlock victim
+	1222: true, // lock request time out
+}
+
+// SQLite primary result codes of transient errors
+var sqliteRetryable = map[int]bool{
+	5: true, // SQLITE_BUSY
+	6: true, // SQLITE_LOCKED
+}
+
+// IsRetryable reports whether an error is transient, so that the statement
+// that failed with it may succeed when run again: deadlocks, lock wait
+// timeouts, serialization failures and lost connections. Any other error,
+// such as a syntax error or a constraint violation, fails again and is fatal.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// Connections lost between or during statements
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlRetryable[mysqlErr.Number]
+	}
+
+	var postgresErr *pq.Error
+	if errors.As(err, &postgresErr) {
+		return postgresErr.Code.Class() == "08" || postgresRetryable[postgresErr.Code]
+	}
+
+	// SQL Server errors are returned both as values and as pointers
+	var sqlServerErr interface{ SQLErrorNumber() int32 }
+	if errors.As(err, &sqlServerErr) {
+		return sqlServerRetryable[sqlServerErr.SQLErrorNumber()]
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteRetryable[sqliteErr.Code()&0xff]
+	}
+
+	return false
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}, true},
+		{&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, true},
+		{&mysql.MySQLError{Number: 2013, Message: "Lost connection to MySQL server during query"}, true},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, false},
+		{&mysql.MySQLError{Number: 1054, Message: "Unknown column"}, false},
+		{mysql.ErrInvalidConn, true},
+		{driver.ErrBadConn, true},
+		{&pq.Error{Code: "40001"}, true},
+		{&pq.Error{Code: "40P01"}, true},
+		{&pq.Error{Code: "08006"}, true},
+		{&pq.Error{Code: "23505"}, false},
+		{mssql.Error{Number: 1205}, true},
+		{&mssql.Error{Number: 1205}, true},
+		{mssql.Error{Number: 2627}, false},
+		{fmt.Errorf("failed to delete rows from orders: %w", &mysql.MySQLError{Number: 1213}), true},
+		{errors.New("syntax error"), false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		if retryable := IsRetryable(test.err); retryable != test.retryable {
+			t.Errorf("Expected IsRetryable(%v) to be %v", test.err, test.retryable)
+		}
+	}
+}
+
+func TestIsRetryableSQLiteBusy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shop.db")
+	first, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer first.Close()
+	second, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer second.Close()
+
+	if _, err := first.Exec("CREATE TABLE sessions (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	// A write while another connection holds the write lock fails as busy
+	tx, err := first.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("INSERT INTO sessions VALUES (1)"); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+
+	_, err = second.Exec("INSERT INTO sessions VALUES (2)")
+	if err == nil {
+		t.Fatal("Expected the second write to fail")
+	}
+	if !IsRetryable(err) {
+		t.Errorf("Expected %v to be retryable", err)
+	}
+
+	// Constraint violations are not
+	_, err = tx.Exec("INSERT INTO sessions VALUES (1)")
+	if err == nil || IsRetryable(err) {
+		t.Errorf("Expected a constraint violation not to be retryable, got %v", err)
+	}
+}
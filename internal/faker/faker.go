@@ -1,22 +1,93 @@
 package faker
 
 import (
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
+	mathrand "math/rand"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-faker/faker/v4"
 )
 
+var (
+	// fakerMu serializes calls into go-faker, whose random source is
+	// package-level state that deterministic generation swaps out
+	fakerMu sync.Mutex
+
+	// randomSource is the random source go-faker uses outside of
+	// deterministic generation
+	randomSource = faker.NewSafeSource(mathrand.NewSource(time.Now().UnixNano()))
+)
+
 // Generator generates fake data
-type Generator struct{}
+type Generator struct {
+	seed []byte
+}
 
-// NewGenerator creates a new faker generator
-func NewGenerator() *Generator {
-	return &Generator{}
+// NewGenerator creates a new faker generator. With a non-empty seed the
+// generator is deterministic: GenerateFor derives its output from the seed,
+// the faker type and the original value.
+func NewGenerator(seed string) *Generator {
+	g := &Generator{}
+	if seed != "" {
+		g.seed = []byte(seed)
+	}
+	return g
 }
 
-// Generate generates fake data based on the specified type
+// Deterministic reports whether the generator was created with a seed
+func (g *Generator) Deterministic() bool {
+	return g.seed != nil
+}
+
+// Generate generates random fake data based on the specified type
 func (g *Generator) Generate(fakerType string) (string, error) {
+	fakerMu.Lock()
+	defer fakerMu.Unlock()
+
+	return g.generate(fakerType, nil, mathrand.New(randomSource))
+}
+
+// GenerateFor generates fake data with params replacing the original value.
+// In deterministic mode the output is seeded from HMAC-SHA256(seed, faker
+// type, original value), so identical inputs map to identical outputs across
+// tables and across runs. Otherwise the output is random.
+func (g *Generator) GenerateFor(fakerType string, params Params, original string) (string, error) {
+	if !g.Deterministic() {
+		fakerMu.Lock()
+		defer fakerMu.Unlock()
+
+		return g.generate(fakerType, params, mathrand.New(randomSource))
+	}
+
+	mac := hmac.New(sha256.New, g.seed)
+	mac.Write([]byte(canonicalType(fakerType)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(original))
+	digest := mac.Sum(nil)
+
+	fakerMu.Lock()
+	defer fakerMu.Unlock()
+
+	source := newDigestSource(digest)
+	faker.SetRandomSource(source)
+	faker.SetCryptoSource(newDigestReader(digest))
+	defer func() {
+		faker.SetRandomSource(randomSource)
+		faker.SetCryptoSource(cryptorand.Reader)
+	}()
+
+	return g.generate(fakerType, params, mathrand.New(source))
+}
+
+// generate produces a value for fakerType with params. The caller must hold
+// fakerMu; rnd drives the generators implemented in this package.
+func (g *Generator) generate(fakerType string, params Params, rnd *mathrand.Rand) (string, error) {
 	switch strings.ToLower(fakerType) {
 	case "name":
 		return faker.Name(), nil
@@ -25,6 +96,9 @@ func (g *Generator) Generate(fakerType string) (string, error) {
 	case "lastname":
 		return faker.LastName(), nil
 	case "email":
+		if domain := params.String("domain"); domain != "" {
+			return withDomain(faker.Email(), domain), nil
+		}
 		return faker.Email(), nil
 	case "phone", "phonenumber":
 		return faker.Phonenumber(), nil
@@ -43,7 +117,9 @@ func (g *Generator) Generate(fakerType string) (string, error) {
 	case "jobtitle":
 		return "Software Engineer", nil
 	case "creditcard":
-		return faker.CCNumber(), nil
+		// go-faker caches the card type for the whole process, which would
+		// make deterministic output depend on the first card generated
+		return creditCardNumber(rnd), nil
 	case "uuid":
 		return faker.UUIDHyphenated(), nil
 	case "ipv4":
@@ -57,6 +133,9 @@ func (g *Generator) Generate(fakerType string) (string, error) {
 	case "password":
 		return faker.Password(), nil
 	case "numerify":
+		if format := params.String("format"); format != "" {
+			return numerify(format, rnd), nil
+		}
 		return "123456789", nil
 	case "sentence":
 		return "This is a sample sentence.", nil
@@ -67,6 +146,122 @@ func (g *Generator) Generate(fakerType string) (string, error) {
 	}
 }
 
+// canonicalType maps faker type aliases to a single name so that aliases
+// produce identical deterministic output
+func canonicalType(fakerType string) string {
+	switch fakerType = strings.ToLower(fakerType); fakerType {
+	case "phonenumber":
+		return "phone"
+	case "streetaddress":
+		return "address"
+	case "postcode":
+		return "zipcode"
+	default:
+		return fakerType
+	}
+}
+
+// numerify replaces every # in format with a random digit
+func numerify(format string, rnd *mathrand.Rand) string {
+	var b strings.Builder
+	for _, r := range format {
+		if r == '#' {
+			b.WriteByte(byte('0' + rnd.Intn(10)))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// creditCardNumber generates a 16 digit Visa number with a valid Luhn check digit
+func creditCardNumber(rnd *mathrand.Rand) string {
+	digits := make([]int, 16)
+	digits[0] = 4
+	for i := 1; i < 15; i++ {
+		digits[i] = rnd.Intn(10)
+	}
+
+	sum := 0
+	for i := 14; i >= 0; i-- {
+		d := digits[i]
+		if (15-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	digits[15] = (10 - sum%10) % 10
+
+	var b strings.Builder
+	for _, d := range digits {
+		b.WriteByte(byte('0' + d))
+	}
+	return b.String()
+}
+
+// digestSource is a splitmix64 random source seeded from an HMAC digest
+type digestSource struct {
+	state uint64
+}
+
+// newDigestSource creates a random source seeded from digest
+func newDigestSource(digest []byte) *digestSource {
+	return &digestSource{state: binary.BigEndian.Uint64(digest[:8])}
+}
+
+// Seed implements rand.Source.Seed
+func (s *digestSource) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+// Uint64 implements rand.Source64.Uint64
+func (s *digestSource) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Int63 implements rand.Source.Int63
+func (s *digestSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// digestReader is a deterministic byte stream derived from an HMAC digest,
+// used in place of crypto/rand for generators such as UUIDs
+type digestReader struct {
+	digest  []byte
+	counter uint64
+	buf     []byte
+}
+
+// newDigestReader creates a byte stream derived from digest
+func newDigestReader(digest []byte) *digestReader {
+	return &digestReader{digest: digest}
+}
+
+// Read implements io.Reader
+func (r *digestReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			block := make([]byte, 8)
+			binary.BigEndian.PutUint64(block, r.counter)
+			r.counter++
+			sum := sha256.Sum256(append(append([]byte{}, r.digest...), block...))
+			r.buf = sum[:]
+		}
+		copied := copy(p[n:], r.buf)
+		r.buf = r.buf[copied:]
+		n += copied
+	}
+	return n, nil
+}
+
 // GetSupportedTypes returns a list of supported faker types
 func (g *Generator) GetSupportedTypes() []string {
 	return []string{
@@ -97,56 +292,3 @@ func (g *Generator) GetSupportedTypes() []string {
 		"paragraph",
 	}
 }
-
-// GenerateSQL generates a SQL expression for the specified faker type
-func (g *Generator) GenerateSQL(fakerType string, driver string) (string, error) {
-	// For MySQL and PostgreSQL, we can use different approaches
-	// In a real implementation, we would generate SQL that calls a function or uses a stored procedure
-	// For simplicity, we'll just return a placeholder that will be replaced at runtime
-
-	// In a real implementation, you might:
-	// 1. For MySQL: Create a user-defined function that generates fake data
-	// 2. For PostgreSQL: Use the pgcrypto extension for random data generation
-	// 3. For both: Use prepared statements with parameters that are replaced with fake data at runtime
-
-	return fmt.Sprintf("'[FAKER:%s]'", fakerType), nil
-}
-
-// ReplaceFakerPlaceholders replaces faker placeholders in SQL with actual fake data
-func (g *Generator) ReplaceFakerPlaceholders(sql string) (string, error) {
-	// Find all faker placeholders in the SQL
-	// Format: '[FAKER:type:tableName:columnName:pkValue]'
-	result := sql
-	for {
-		start := strings.Index(result, "'[FAKER:")
-		if start == -1 {
-			break
-		}
-
-		end := strings.Index(result[start:], "]'")
-		if end == -1 {
-			return "", fmt.Errorf("invalid faker placeholder format in SQL: %s", sql)
-		}
-		end += start
-
-		placeholder := result[start : end+2]
-		fakerInfo := result[start+8 : end]
-
-		// Extract the faker type from the placeholder
-		// The format is now 'type:tableName:columnName:pkValue' or 'type:tableName:columnName'
-		parts := strings.Split(fakerInfo, ":")
-		fakerType := parts[0]
-
-		// Generate fake data
-		fakeData, err := g.Generate(fakerType)
-		if err != nil {
-			return "", err
-		}
-
-		// Replace only the first occurrence of the placeholder with fake data
-		// This ensures each placeholder gets unique data even if they are of the same type
-		result = strings.Replace(result, placeholder, fmt.Sprintf("'%s'", strings.ReplaceAll(fakeData, "'", "''")), 1)
-	}
-
-	return result, nil
-}
@@ -0,0 +1,199 @@
+package faker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateForDeterministic(t *testing.T) {
+	generator := NewGenerator("test-seed")
+
+	for _, fakerType := range generator.GetSupportedTypes() {
+		first, err := generator.GenerateFor(fakerType, nil, "jane.doe@example.com")
+		if err != nil {
+			t.Fatalf("Failed to generate %s: %v", fakerType, err)
+		}
+
+		// Interleave a random value to make sure it does not disturb the sequence
+		if _, err := generator.Generate(fakerType); err != nil {
+			t.Fatalf("Failed to generate %s: %v", fakerType, err)
+		}
+
+		second, err := NewGenerator("test-seed").GenerateFor(fakerType, nil, "jane.doe@example.com")
+		if err != nil {
+			t.Fatalf("Failed to generate %s: %v", fakerType, err)
+		}
+
+		if first != second {
+			t.Errorf("Expected identical %s output for identical input, got '%s' and '%s'", fakerType, first, second)
+		}
+	}
+}
+
+func TestGenerateForDependsOnSeedAndOriginal(t *testing.T) {
+	generator := NewGenerator("test-seed")
+
+	email, err := generator.GenerateFor("email", nil, "jane.doe@example.com")
+	if err != nil {
+		t.Fatalf("Failed to generate email: %v", err)
+	}
+	if !strings.Contains(email, "@") {
+		t.Errorf("Expected an email address, got '%s'", email)
+	}
+
+	otherOriginal, _ := generator.GenerateFor("email", nil, "john.doe@example.com")
+	if otherOriginal == email {
+		t.Errorf("Expected different originals to map to different emails, both got '%s'", email)
+	}
+
+	otherSeed, _ := NewGenerator("other-seed").GenerateFor("email", nil, "jane.doe@example.com")
+	if otherSeed == email {
+		t.Errorf("Expected different seeds to map to different emails, both got '%s'", email)
+	}
+
+	// Aliases share the same output
+	phone, _ := generator.GenerateFor("phone", nil, "+49 170 1234567")
+	phoneNumber, _ := generator.GenerateFor("phonenumber", nil, "+49 170 1234567")
+	if phone != phoneNumber {
+		t.Errorf("Expected faker aliases to produce the same output, got '%s' and '%s'", phone, phoneNumber)
+	}
+}
+
+func TestGenerateForWithoutSeed(t *testing.T) {
+	generator := NewGenerator("")
+	if generator.Deterministic() {
+		t.Error("Expected generator without seed not to be deterministic")
+	}
+
+	if _, err := generator.GenerateFor("email", nil, "jane.doe@example.com"); err != nil {
+		t.Errorf("Failed to generate email: %v", err)
+	}
+	if _, err := generator.GenerateFor("unknown", nil, "value"); err == nil {
+		t.Error("Expected error for unsupported faker type, got nil")
+	}
+}
+
+func TestCreditCardNumberLuhn(t *testing.T) {
+	generator := NewGenerator("test-seed")
+
+	for _, original := range []string{"a", "b", "c", "d", "e"} {
+		number, err := generator.GenerateFor("creditcard", nil, original)
+		if err != nil {
+			t.Fatalf("Failed to generate credit card number: %v", err)
+		}
+		if len(number) != 16 {
+			t.Fatalf("Expected 16 digits, got '%s'", number)
+		}
+
+		sum := 0
+		for i := len(number) - 1; i >= 0; i-- {
+			d := int(number[i] - '0')
+			if (len(number)-1-i)%2 == 1 {
+				d *= 2
+				if d > 9 {
+					d -= 9
+				}
+			}
+			sum += d
+		}
+		if sum%10 != 0 {
+			t.Errorf("Expected a Luhn valid number, got '%s'", number)
+		}
+	}
+}
+
+func TestGenerateForParams(t *testing.T) {
+	generator := NewGenerator("test-seed")
+
+	email, err := generator.GenerateFor("email", Params{"domain": "example.test"}, "jane.doe@example.com")
+	if err != nil {
+		t.Fatalf("Failed to generate email: %v", err)
+	}
+	if !strings.HasSuffix(email, "@example.test") {
+		t.Errorf("Expected an email address at example.test, got '%s'", email)
+	}
+
+	// The domain does not change the local part
+	plain, _ := generator.GenerateFor("email", nil, "jane.doe@example.com")
+	if strings.Split(plain, "@")[0] != strings.Split(email, "@")[0] {
+		t.Errorf("Expected the same local part, got '%s' and '%s'", plain, email)
+	}
+
+	number, err := generator.GenerateFor("numerify", Params{"format": "DE-####"}, "12345")
+	if err != nil {
+		t.Fatalf("Failed to generate number: %v", err)
+	}
+	if len(number) != 7 || !strings.HasPrefix(number, "DE-") || strings.Contains(number, "#") {
+		t.Errorf("Expected a number in the format DE-####, got '%s'", number)
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	if err := ValidateParams("email", Params{"domain": "example.test"}); err != nil {
+		t.Errorf("Expected no error for domain param, got %v", err)
+	}
+	if err := ValidateParams("email", Params{"format": "###"}); err == nil {
+		t.Error("Expected error for unsupported param, got nil")
+	}
+	if err := ValidateParams("email", Params{"domain": 42}); err == nil {
+		t.Error("Expected error for non-string param, got nil")
+	}
+	if err := ValidateParams("firstname", nil); err != nil {
+		t.Errorf("Expected no error without params, got %v", err)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	generator := NewGenerator("test-seed")
+
+	// Generated values pass the validator of their type
+	tests := []struct {
+		fakerType string
+		params    Params
+	}{
+		{"email", nil},
+		{"email", Params{"domain": "example.test"}},
+		{"creditcard", nil},
+		{"uuid", nil},
+		{"ipv4", nil},
+		{"ipv6", nil},
+		{"numerify", Params{"format": "DE## ####"}},
+	}
+	for _, test := range tests {
+		validate := Validator(test.fakerType, test.params)
+		if validate == nil {
+			t.Fatalf("Expected a validator for %s", test.fakerType)
+		}
+		for _, original := range []string{"a", "b", "c"} {
+			value, err := generator.GenerateFor(test.fakerType, test.params, original)
+			if err != nil {
+				t.Fatalf("Failed to generate %s: %v", test.fakerType, err)
+			}
+			if !validate(value) {
+				t.Errorf("Expected %s value '%s' to be valid", test.fakerType, value)
+			}
+		}
+	}
+
+	// Original values fail them
+	invalid := []struct {
+		fakerType string
+		params    Params
+		value     string
+	}{
+		{"email", nil, "Jane Doe"},
+		{"email", Params{"domain": "example.test"}, "jane@example.com"},
+		{"creditcard", nil, "4111111111111112"},
+		{"ipv4", nil, "::1"},
+		{"numerify", Params{"format": "DE## ####"}, "DE12 34x6"},
+	}
+	for _, test := range invalid {
+		if Validator(test.fakerType, test.params)(test.value) {
+			t.Errorf("Expected %s value '%s' to be invalid", test.fakerType, test.value)
+		}
+	}
+
+	if Validator("name", nil) != nil {
+		t.Error("Expected no validator for names")
+	}
+}
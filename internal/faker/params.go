@@ -0,0 +1,59 @@
+package faker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Params holds the parameters of a faker type, such as the domain of
+// generated email addresses
+type Params map[string]interface{}
+
+// supportedParams lists the parameters accepted by each faker type
+var supportedParams = map[string][]string{
+	"email":    {"domain"},
+	"numerify": {"format"},
+}
+
+// ValidateParams checks that all params are accepted by fakerType
+func ValidateParams(fakerType string, params Params) error {
+	supported := supportedParams[canonicalType(fakerType)]
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		accepted := false
+		for _, supportedName := range supported {
+			if name == supportedName {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return fmt.Errorf("faker type %s does not support param %s", fakerType, name)
+		}
+		if _, ok := params[name].(string); !ok {
+			return fmt.Errorf("param %s of faker type %s must be a string", name, fakerType)
+		}
+	}
+	return nil
+}
+
+// String returns the value of a string param, or "" if it is not set
+func (p Params) String(name string) string {
+	value, _ := p[name].(string)
+	return value
+}
+
+// withDomain replaces the domain of an email address
+func withDomain(email, domain string) string {
+	if at := strings.LastIndex(email, "@"); at != -1 {
+		email = email[:at]
+	}
+	return email + "@" + domain
+}
@@ -0,0 +1,94 @@
+package faker
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[A-Za-z]{2,}$`)
+	uuidPattern  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// Validator returns a function that reports whether a value has the format
+// of the values fakerType generates with params, or nil for types whose
+// values have no format to recognize them by, such as names
+func Validator(fakerType string, params Params) func(value string) bool {
+	switch canonicalType(fakerType) {
+	case "email":
+		if domain := params.String("domain"); domain != "" {
+			suffix := "@" + strings.ToLower(domain)
+			return func(value string) bool {
+				return emailPattern.MatchString(value) && strings.HasSuffix(strings.ToLower(value), suffix)
+			}
+		}
+		return emailPattern.MatchString
+	case "creditcard":
+		return validCardNumber
+	case "uuid":
+		return uuidPattern.MatchString
+	case "ipv4":
+		return func(value string) bool {
+			ip := net.ParseIP(value)
+			return ip != nil && ip.To4() != nil && strings.Contains(value, ".")
+		}
+	case "ipv6":
+		return func(value string) bool {
+			return net.ParseIP(value) != nil && strings.Contains(value, ":")
+		}
+	case "numerify":
+		format := params.String("format")
+		if format == "" {
+			format = "#########"
+		}
+		return func(value string) bool {
+			return matchesNumerifyFormat(format, value)
+		}
+	default:
+		return nil
+	}
+}
+
+// matchesNumerifyFormat reports whether value is format with every # replaced
+// by a digit
+func matchesNumerifyFormat(format, value string) bool {
+	formatRunes, valueRunes := []rune(format), []rune(value)
+	if len(formatRunes) != len(valueRunes) {
+		return false
+	}
+	for i, r := range formatRunes {
+		if r == '#' {
+			if valueRunes[i] < '0' || valueRunes[i] > '9' {
+				return false
+			}
+		} else if valueRunes[i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// validCardNumber reports whether value is a card number of 13 to 19 digits
+// with a valid Luhn check digit
+func validCardNumber(value string) bool {
+	if len(value) < 13 || len(value) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := len(value) - 1; i >= 0; i-- {
+		if value[i] < '0' || value[i] > '9' {
+			return false
+		}
+		d := int(value[i] - '0')
+		if (len(value)-1-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,201 @@
+// Package fpe implements the FF1 format-preserving encryption mode of NIST
+// SP 800-38G, which encrypts strings of numerals in a given radix into
+// strings of numerals of the same radix and length.
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// Limits of FF1
+const (
+	// MinRadix is the smallest supported radix
+	MinRadix = 2
+	// MaxRadix is the largest supported radix
+	MaxRadix = 1 << 16
+	// minDomain is the smallest number of possible values, radix^length,
+	// that NIST SP 800-38G Rev. 1 accepts
+	minDomain = 1000000
+	// maxLength is the largest supported number of numerals
+	maxLength = 1<<32 - 1
+	// rounds is the number of Feistel rounds of FF1
+	rounds = 10
+)
+
+// FF1 encrypts and decrypts numeral strings with a key and radix
+type FF1 struct {
+	block cipher.Block
+	radix int
+}
+
+// NewFF1 creates an FF1 cipher with an AES key of 16, 24 or 32 bytes
+func NewFF1(key []byte, radix int) (*FF1, error) {
+	if radix < MinRadix || radix > MaxRadix {
+		return nil, fmt.Errorf("radix must be between %d and %d, got %d", MinRadix, MaxRadix, radix)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	return &FF1{block: block, radix: radix}, nil
+}
+
+// MinLength returns the smallest number of numerals the cipher encrypts
+func (f *FF1) MinLength() int {
+	length := 1
+	for domain := f.radix; domain < minDomain; domain *= f.radix {
+		length++
+	}
+	return length
+}
+
+// Encrypt encrypts a string of numerals, each less than the radix, with a
+// tweak, which may be empty
+func (f *FF1) Encrypt(numerals []int, tweak []byte) ([]int, error) {
+	return f.cipher(numerals, tweak, true)
+}
+
+// Decrypt decrypts a string of numerals encrypted with the same tweak
+func (f *FF1) Decrypt(numerals []int, tweak []byte) ([]int, error) {
+	return f.cipher(numerals, tweak, false)
+}
+
+// cipher runs the Feistel rounds of FF1 in the direction of encrypt
+func (f *FF1) cipher(numerals []int, tweak []byte, encrypt bool) ([]int, error) {
+	n := len(numerals)
+	if n < f.MinLength() || n > maxLength {
+		return nil, fmt.Errorf("length must be between %d and %d numerals in radix %d, got %d", f.MinLength(), maxLength, f.radix, n)
+	}
+	for _, numeral := range numerals {
+		if numeral < 0 || numeral >= f.radix {
+			return nil, fmt.Errorf("numeral %d is out of radix %d", numeral, f.radix)
+		}
+	}
+
+	u := n / 2
+	v := n - u
+	a := append([]int(nil), numerals[:u]...)
+	b := append([]int(nil), numerals[u:]...)
+
+	radix := big.NewInt(int64(f.radix))
+	modU := new(big.Int).Exp(radix, big.NewInt(int64(u)), nil)
+	modV := new(big.Int).Exp(radix, big.NewInt(int64(v)), nil)
+
+	// b is the number of bytes of a numeral string of length v, ceil(v *
+	// log2(radix)) / 8 rounded up, and d the number of bytes of the round
+	// function output
+	byteLen := (new(big.Int).Sub(modV, big.NewInt(1)).BitLen() + 7) / 8
+	d := 4*((byteLen+3)/4) + 4
+
+	p := make([]byte, 16)
+	p[0], p[1], p[2] = 1, 2, 1
+	p[3], p[4], p[5] = byte(f.radix>>16), byte(f.radix>>8), byte(f.radix)
+	p[6] = 10
+	p[7] = byte(u)
+	binary.BigEndian.PutUint32(p[8:12], uint32(n))
+	binary.BigEndian.PutUint32(p[12:16], uint32(len(tweak)))
+
+	// Q is the tweak, zero padding, the round number and the numeral string
+	padding := (16 - (len(tweak)+byteLen+1)%16) % 16
+	q := make([]byte, len(tweak)+padding+1+byteLen)
+	copy(q, tweak)
+
+	y := new(big.Int)
+	c := new(big.Int)
+	for round := 0; round < rounds; round++ {
+		i := round
+		if !encrypt {
+			i = rounds - 1 - round
+		}
+
+		// Encryption feeds B into the round function, decryption A
+		input := b
+		if !encrypt {
+			input = a
+		}
+		q[len(tweak)+padding] = byte(i)
+		for j := len(tweak) + padding + 1; j < len(q); j++ {
+			q[j] = 0
+		}
+		num(input, radix).FillBytes(q[len(tweak)+padding+1:])
+
+		y.SetBytes(f.expand(f.prf(p, q), d))
+
+		m, mod := u, modU
+		if i%2 == 1 {
+			m, mod = v, modV
+		}
+
+		if encrypt {
+			c.Add(num(a, radix), y)
+			c.Mod(c, mod)
+			a, b = b, str(c, radix, m)
+		} else {
+			c.Sub(num(b, radix), y)
+			c.Mod(c, mod)
+			a, b = str(c, radix, m), a
+		}
+	}
+
+	return append(a, b...), nil
+}
+
+// prf computes the CBC-MAC of P || Q with a zero IV
+func (f *FF1) prf(p, q []byte) []byte {
+	r := make([]byte, aes.BlockSize)
+	for _, data := range [][]byte{p, q} {
+		for start := 0; start < len(data); start += aes.BlockSize {
+			for j := 0; j < aes.BlockSize; j++ {
+				r[j] ^= data[start+j]
+			}
+			f.block.Encrypt(r, r)
+		}
+	}
+	return r
+}
+
+// expand extends the round function output R to d bytes with the
+// encryptions of R xor 1, R xor 2 and so on
+func (f *FF1) expand(r []byte, d int) []byte {
+	s := append([]byte(nil), r...)
+	block := make([]byte, aes.BlockSize)
+	for j := 1; len(s) < d; j++ {
+		copy(block, r)
+		counter := make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(counter[8:], uint64(j))
+		for k := range block {
+			block[k] ^= counter[k]
+		}
+		f.block.Encrypt(block, block)
+		s = append(s, block...)
+	}
+	return s[:d]
+}
+
+// num returns the number a string of numerals represents, most significant
+// numeral first
+func num(numerals []int, radix *big.Int) *big.Int {
+	x := new(big.Int)
+	digit := new(big.Int)
+	for _, numeral := range numerals {
+		x.Mul(x, radix)
+		x.Add(x, digit.SetInt64(int64(numeral)))
+	}
+	return x
+}
+
+// str returns the string of m numerals that represents x
+func str(x *big.Int, radix *big.Int, m int) []int {
+	numerals := make([]int, m)
+	x = new(big.Int).Set(x)
+	digit := new(big.Int)
+	for i := m - 1; i >= 0; i-- {
+		x.DivMod(x, radix, digit)
+		numerals[i] = int(digit.Int64())
+	}
+	return numerals
+}
@@ -0,0 +1,101 @@
+package fpe
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// numerals converts a string of digits and lowercase letters to numerals
+func numerals(s string) []int {
+	const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+	result := make([]int, len(s))
+	for i, c := range s {
+		result[i] = strings.IndexRune(digits, c)
+	}
+	return result
+}
+
+// text converts numerals to a string of digits and lowercase letters
+func text(numerals []int) string {
+	const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+	var s strings.Builder
+	for _, numeral := range numerals {
+		s.WriteByte(digits[numeral])
+	}
+	return s.String()
+}
+
+func TestFF1Samples(t *testing.T) {
+	// Samples of NIST SP 800-38G
+	tests := []struct {
+		key        string
+		radix      int
+		tweak      string
+		plaintext  string
+		ciphertext string
+	}{
+		{"2B7E151628AED2A6ABF7158809CF4F3C", 10, "", "0123456789", "2433477484"},
+		{"2B7E151628AED2A6ABF7158809CF4F3C", 10, "39383736353433323130", "0123456789", "6124200773"},
+		{"2B7E151628AED2A6ABF7158809CF4F3C", 36, "3737373770717273373737", "0123456789abcdefghi", "a9tv40mll9kdu509eum"},
+		{"2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F", 10, "", "0123456789", "2830668132"},
+		{"2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F", 10, "39383736353433323130", "0123456789", "2496655549"},
+		{"2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F", 36, "3737373770717273373737", "0123456789abcdefghi", "xbj3kv35jrawxv32ysr"},
+		{"2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F7F036D6F04FC6A94", 10, "", "0123456789", "6657667009"},
+		{"2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F7F036D6F04FC6A94", 10, "39383736353433323130", "0123456789", "1001623463"},
+		{"2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F7F036D6F04FC6A94", 36, "3737373770717273373737", "0123456789abcdefghi", "xs8a0azh2avyalyzuwd"},
+	}
+
+	for _, test := range tests {
+		key, _ := hex.DecodeString(test.key)
+		tweak, _ := hex.DecodeString(test.tweak)
+
+		ff1, err := NewFF1(key, test.radix)
+		if err != nil {
+			t.Fatalf("Failed to create cipher: %v", err)
+		}
+
+		ciphertext, err := ff1.Encrypt(numerals(test.plaintext), tweak)
+		if err != nil {
+			t.Fatalf("Failed to encrypt %s: %v", test.plaintext, err)
+		}
+		if text(ciphertext) != test.ciphertext {
+			t.Errorf("Expected %s to encrypt to %s with a %d byte key, got %s", test.plaintext, test.ciphertext, len(key), text(ciphertext))
+		}
+
+		plaintext, err := ff1.Decrypt(ciphertext, tweak)
+		if err != nil {
+			t.Fatalf("Failed to decrypt %s: %v", test.ciphertext, err)
+		}
+		if text(plaintext) != test.plaintext {
+			t.Errorf("Expected %s to decrypt to %s, got %s", test.ciphertext, test.plaintext, text(plaintext))
+		}
+	}
+}
+
+func TestFF1Errors(t *testing.T) {
+	key, _ := hex.DecodeString("2B7E151628AED2A6ABF7158809CF4F3C")
+
+	if _, err := NewFF1(key[:10], 10); err == nil {
+		t.Error("Expected error for a 10 byte key, got nil")
+	}
+	if _, err := NewFF1(key, 1); err == nil {
+		t.Error("Expected error for radix 1, got nil")
+	}
+
+	ff1, err := NewFF1(key, 10)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %v", err)
+	}
+	if ff1.MinLength() != 6 {
+		t.Errorf("Expected a minimum length of 6 in radix 10, got %d", ff1.MinLength())
+	}
+
+	// Fewer than a million values cannot be encrypted securely
+	if _, err := ff1.Encrypt(numerals("12345"), nil); err == nil {
+		t.Error("Expected error for 5 digits, got nil")
+	}
+	if _, err := ff1.Encrypt([]int{1, 2, 3, 4, 5, 10}, nil); err == nil {
+		t.Error("Expected error for a numeral out of the radix, got nil")
+	}
+}
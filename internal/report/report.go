@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/olekukonko/tablewriter"
@@ -32,20 +34,65 @@ type Report struct {
 		TotalFields       int   `json:"total_fields"`
 		TotalRowsScanned  int64 `json:"total_rows_scanned"`
 		TotalRowsAffected int64 `json:"total_rows_affected"`
+		TotalRowsDeleted  int64 `json:"total_rows_deleted"`
+		TotalRetries      int   `json:"total_retries"`
+		FailedTables      int   `json:"failed_tables"`
 	} `json:"summary"`
-	Tables []TableReport `json:"tables"`
-	Errors struct {
+	Tables            []TableReport            `json:"tables"`
+	Deletions         []DeletionReport         `json:"deletions,omitempty"`
+	ConsistencyGroups []ConsistencyGroupReport `json:"consistency_groups,omitempty"`
+	Errors            struct {
 		Count   int    `json:"count"`
 		LogFile string `json:"log_file"`
 	} `json:"errors"`
 }
 
+// Table actions as they appear in the report
+const (
+	// ActionAnonymized marks tables whose columns were rewritten
+	ActionAnonymized = "anonymized"
+	// ActionTruncated marks tables that were emptied
+	ActionTruncated = "truncated"
+)
+
 // TableReport represents the report for a single table
 type TableReport struct {
-	Name         string        `json:"name"`
-	RowsScanned  int64         `json:"rows_scanned"`
-	RowsAffected int64         `json:"rows_affected"`
-	Fields       []FieldReport `json:"fields"`
+	Name         string           `json:"name"`
+	Action       string           `json:"action"`
+	RowsScanned  int64            `json:"rows_scanned"`
+	RowsAffected int64            `json:"rows_affected"`
+	Retries      int              `json:"retries"`
+	Transaction  string           `json:"transaction,omitempty"`
+	Chunks       []ChunkReport    `json:"chunks,omitempty"`
+	Fields       []FieldReport    `json:"fields"`
+	Truncated    *TruncatedReport `json:"truncated,omitempty"`
+	Errors       []string         `json:"errors,omitempty"`
+}
+
+// ChunkReport represents whether the updates of a chunk of a table committed
+// or were rolled back
+type ChunkReport struct {
+	Chunk     int   `json:"chunk"`
+	Rows      int64 `json:"rows"`
+	Committed bool  `json:"committed"`
+}
+
+// TruncatedReport represents the details of a truncated table
+type TruncatedReport struct {
+	Method     string `json:"method"`
+	RowsBefore int64  `json:"rows_before"`
+	RowsAfter  int64  `json:"rows_after"`
+}
+
+// DeletionReport represents the rows deleted from a single table. Rows of
+// dependent tables name the parent table whose deleted rows they referenced.
+type DeletionReport struct {
+	Table       string `json:"table"`
+	Parent      string `json:"parent,omitempty"`
+	RowsMatched int64  `json:"rows_matched"`
+	RowsDeleted int64  `json:"rows_deleted"`
+	Retries     int    `json:"retries"`
+	Error       string `json:"error,omitempty"`
 }
 
 // FieldReport represents the report for a single field
@@ -53,19 +100,42 @@ type FieldReport struct {
 	Name         string `json:"name"`
 	Strategy     string `json:"strategy"`
 	RowsAffected int64  `json:"rows_affected"`
+	Retries      int    `json:"retries"`
+}
+
+// ConsistencyGroupReport represents the report for a single consistency group
+type ConsistencyGroupReport struct {
+	Name           string   `json:"name"`
+	Columns        []string `json:"columns"`
+	DistinctValues int64    `json:"distinct_values"`
 }
 
 // ExecutionResult represents the result of an anonymization operation
 type ExecutionResult struct {
 	TableName    string
 	FieldName    string
+	Action       string
+	Parent       string
 	RowsScanned  int64
 	RowsAffected int64
+	RowsBefore   int64
+	RowsAfter    int64
 	Strategy     string
+	Retries      int
+	Transaction  string
+	Chunk        int
+	Committed    bool
 	Duration     time.Duration
 	Error        error
 }
 
+// ConsistencyGroupResult represents a consistency group after execution
+type ConsistencyGroupResult struct {
+	Name           string
+	Columns        []string
+	DistinctValues int64
+}
+
 // Generator generates reports
 type Generator struct {
 	startTime time.Time
@@ -82,8 +152,9 @@ func NewGenerator(dryRun bool, errorLog string) *Generator {
 	}
 }
 
-// GenerateReport generates a report from the execution results
-func (g *Generator) GenerateReport(results []ExecutionResult) *Report {
+// GenerateReport generates a report from the execution results and the
+// consistency groups used during execution
+func (g *Generator) GenerateReport(results []ExecutionResult, groups []ConsistencyGroupResult) *Report {
 	report := &Report{}
 
 	// Set execution information
@@ -96,39 +167,122 @@ func (g *Generator) GenerateReport(results []ExecutionResult) *Report {
 	report.Execution.EndTime = time.Now()
 	report.Execution.DurationSeconds = int(report.Execution.EndTime.Sub(report.Execution.StartTime).Seconds())
 
-	// Group results by table
+	// Group results by table. The columns of a table are written by the same
+	// statements, so the rows and retries of a table are those of its first
+	// column, summed over its chunks.
 	tableMap := make(map[string]*TableReport)
+	firstFields := make(map[string]string)
+	fieldIndexes := make(map[string]int)
 	errorCount := 0
 
 	for _, result := range results {
 		if result.Error != nil {
 			errorCount++
+
+			// Deletions that failed are reported with the deleted rows
+			if result.Action == "delete" {
+				report.Deletions = append(report.Deletions, DeletionReport{
+					Table:   result.TableName,
+					Parent:  result.Parent,
+					Retries: result.Retries,
+					Error:   result.Error.Error(),
+				})
+				if result.Parent == "" {
+					report.Summary.TotalRetries += result.Retries
+				}
+				continue
+			}
+
+			tableReport := getTable(tableMap, result)
+			tableReport.Errors = append(tableReport.Errors, result.Error.Error())
+			tableReport.Retries += result.Retries
+
+			// Chunks committed in transactions are rolled back on errors
+			if result.Action == "anonymize" && isTransactional(result.Transaction) {
+				tableReport.Chunks = append(tableReport.Chunks, ChunkReport{
+					Chunk: result.Chunk,
+					Rows:  result.RowsScanned,
+				})
+			}
 			continue
 		}
 
-		// Get or create table report
-		tableReport, ok := tableMap[result.TableName]
-		if !ok {
-			tableReport = &TableReport{
+		// Deleted rows are reported separately from the tables
+		if result.Action == "delete" {
+			report.Deletions = append(report.Deletions, DeletionReport{
+				Table:       result.TableName,
+				Parent:      result.Parent,
+				RowsMatched: result.RowsScanned,
+				RowsDeleted: result.RowsAffected,
+				Retries:     result.Retries,
+			})
+			report.Summary.TotalRowsDeleted += result.RowsAffected
+			// The rows of a delete table and its dependents are deleted in one
+			// transaction, whose retries are counted once
+			if result.Parent == "" {
+				report.Summary.TotalRetries += result.Retries
+			}
+			continue
+		}
+
+		// Truncated tables are reported as a whole, without fields
+		if result.Action == "truncate" {
+			tableMap[result.TableName] = &TableReport{
 				Name:         result.TableName,
+				Action:       ActionTruncated,
 				RowsScanned:  result.RowsScanned,
 				RowsAffected: result.RowsAffected,
+				Retries:      result.Retries,
 				Fields:       make([]FieldReport, 0),
+				Truncated: &TruncatedReport{
+					Method:     result.Strategy,
+					RowsBefore: result.RowsBefore,
+					RowsAfter:  result.RowsAfter,
+				},
+			}
+			continue
+		}
+
+		// Get or create table report
+		tableReport := getTable(tableMap, result)
+		if _, ok := firstFields[result.TableName]; !ok {
+			firstFields[result.TableName] = result.FieldName
+		}
+		if firstFields[result.TableName] == result.FieldName {
+			tableReport.RowsScanned += result.RowsScanned
+			tableReport.RowsAffected += result.RowsAffected
+			tableReport.Retries += result.Retries
+			if isTransactional(result.Transaction) {
+				tableReport.Chunks = append(tableReport.Chunks, ChunkReport{
+					Chunk:     result.Chunk,
+					Rows:      result.RowsScanned,
+					Committed: result.Committed,
+				})
 			}
-			tableMap[result.TableName] = tableReport
 		}
 
-		// Add field report
+		// Add the field report, or add the chunk to it
+		fieldKey := result.TableName + "." + result.FieldName
+		if index, ok := fieldIndexes[fieldKey]; ok {
+			tableReport.Fields[index].RowsAffected += result.RowsAffected
+			tableReport.Fields[index].Retries += result.Retries
+			continue
+		}
+		fieldIndexes[fieldKey] = len(tableReport.Fields)
 		tableReport.Fields = append(tableReport.Fields, FieldReport{
 			Name:         result.FieldName,
 			Strategy:     result.Strategy,
 			RowsAffected: result.RowsAffected,
+			Retries:      result.Retries,
 		})
 	}
 
 	// Convert map to slice
 	report.Tables = make([]TableReport, 0, len(tableMap))
 	for _, tableReport := range tableMap {
+		sort.Slice(tableReport.Chunks, func(i, j int) bool {
+			return tableReport.Chunks[i].Chunk < tableReport.Chunks[j].Chunk
+		})
 		report.Tables = append(report.Tables, *tableReport)
 	}
 
@@ -138,6 +292,24 @@ func (g *Generator) GenerateReport(results []ExecutionResult) *Report {
 		report.Summary.TotalFields += len(table.Fields)
 		report.Summary.TotalRowsScanned += table.RowsScanned
 		report.Summary.TotalRowsAffected += table.RowsAffected
+		report.Summary.TotalRetries += table.Retries
+		if len(table.Errors) > 0 {
+			report.Summary.FailedTables++
+		}
+	}
+	for _, deletion := range report.Deletions {
+		if deletion.Error != "" {
+			report.Summary.FailedTables++
+		}
+	}
+
+	// Add consistency groups
+	for _, group := range groups {
+		report.ConsistencyGroups = append(report.ConsistencyGroups, ConsistencyGroupReport{
+			Name:           group.Name,
+			Columns:        group.Columns,
+			DistinctValues: group.DistinctValues,
+		})
 	}
 
 	// Set error information
@@ -147,6 +319,36 @@ func (g *Generator) GenerateReport(results []ExecutionResult) *Report {
 	return report
 }
 
+// getTable returns the report of the table of a result, creating it on first
+// use
+func getTable(tableMap map[string]*TableReport, result ExecutionResult) *TableReport {
+	tableReport, ok := tableMap[result.TableName]
+	if !ok {
+		tableReport = &TableReport{
+			Name:        result.TableName,
+			Action:      ActionAnonymized,
+			Transaction: result.Transaction,
+			Fields:      make([]FieldReport, 0),
+		}
+		if result.Action == "truncate" {
+			tableReport.Action = ActionTruncated
+		}
+		tableMap[result.TableName] = tableReport
+	}
+	return tableReport
+}
+
+// Failed reports whether any table or chunk of the run failed
+func (r *Report) Failed() bool {
+	return r.Errors.Count > 0
+}
+
+// isTransactional reports whether the chunks of a table commit in
+// transactions
+func isTransactional(transaction string) bool {
+	return transaction == "chunk" || transaction == "table"
+}
+
 // OutputJSON outputs the report as JSON
 func (g *Generator) OutputJSON(report *Report, outputFile string) error {
 	jsonData, err := json.MarshalIndent(report, "", "  ")
@@ -181,6 +383,15 @@ func (g *Generator) OutputText(report *Report) {
 	fmt.Printf("Total Fields: %d\n", report.Summary.TotalFields)
 	fmt.Printf("Total Rows Scanned: %d\n", report.Summary.TotalRowsScanned)
 	fmt.Printf("Total Rows Affected: %d\n", report.Summary.TotalRowsAffected)
+	if len(report.Deletions) > 0 {
+		fmt.Printf("Total Rows Deleted: %d\n", report.Summary.TotalRowsDeleted)
+	}
+	if report.Summary.TotalRetries > 0 {
+		fmt.Printf("Total Retries: %d\n", report.Summary.TotalRetries)
+	}
+	if report.Summary.FailedTables > 0 {
+		fmt.Printf("Failed Tables: %d\n", report.Summary.FailedTables)
+	}
 	fmt.Println()
 
 	// Print table information
@@ -191,6 +402,9 @@ func (g *Generator) OutputText(report *Report) {
 	table.SetColumnSeparator("|")
 
 	for _, tableReport := range report.Tables {
+		if tableReport.Truncated != nil || len(tableReport.Fields) == 0 {
+			continue
+		}
 		for i, fieldReport := range tableReport.Fields {
 			tableName := tableReport.Name
 			if i > 0 {
@@ -210,10 +424,155 @@ func (g *Generator) OutputText(report *Report) {
 	table.Render()
 	fmt.Println()
 
+	// Print deleted rows
+	if len(report.Deletions) > 0 {
+		fmt.Println("=== Deleted Rows ===")
+		deletions := tablewriter.NewWriter(os.Stdout)
+		deletions.SetHeader([]string{"Table", "Via", "Rows Matched", "Rows Deleted"})
+		deletions.SetBorder(false)
+		deletions.SetColumnSeparator("|")
+
+		for _, deletion := range report.Deletions {
+			deletions.Append([]string{
+				deletion.Table,
+				deletion.Parent,
+				fmt.Sprintf("%d", deletion.RowsMatched),
+				fmt.Sprintf("%d", deletion.RowsDeleted),
+			})
+		}
+
+		deletions.Render()
+		fmt.Println()
+	}
+
+	// Print truncated tables
+	truncated := tablewriter.NewWriter(os.Stdout)
+	truncated.SetHeader([]string{"Table", "Method", "Rows Before", "Rows After"})
+	truncated.SetBorder(false)
+	truncated.SetColumnSeparator("|")
+
+	truncatedCount := 0
+	for _, tableReport := range report.Tables {
+		if tableReport.Truncated == nil {
+			continue
+		}
+		truncated.Append([]string{
+			tableReport.Name,
+			tableReport.Truncated.Method,
+			fmt.Sprintf("%d", tableReport.Truncated.RowsBefore),
+			fmt.Sprintf("%d", tableReport.Truncated.RowsAfter),
+		})
+		truncatedCount++
+	}
+
+	if truncatedCount > 0 {
+		fmt.Println("=== Truncated Tables ===")
+		truncated.Render()
+		fmt.Println()
+	}
+
+	// Print the tables whose statements were retried
+	if report.Summary.TotalRetries > 0 {
+		fmt.Println("=== Retries ===")
+		retries := tablewriter.NewWriter(os.Stdout)
+		retries.SetHeader([]string{"Table", "Retries"})
+		retries.SetBorder(false)
+		retries.SetColumnSeparator("|")
+
+		for _, tableReport := range report.Tables {
+			if tableReport.Retries > 0 {
+				retries.Append([]string{tableReport.Name, fmt.Sprintf("%d", tableReport.Retries)})
+			}
+		}
+		for _, deletion := range report.Deletions {
+			if deletion.Parent == "" && deletion.Retries > 0 {
+				retries.Append([]string{deletion.Table, fmt.Sprintf("%d", deletion.Retries)})
+			}
+		}
+
+		retries.Render()
+		fmt.Println()
+	}
+
+	// Print the chunks that committed and those that were rolled back
+	transactions := tablewriter.NewWriter(os.Stdout)
+	transactions.SetHeader([]string{"Table", "Mode", "Chunks Committed", "Chunks Rolled Back"})
+	transactions.SetBorder(false)
+	transactions.SetColumnSeparator("|")
+
+	transactionCount := 0
+	for _, tableReport := range report.Tables {
+		if len(tableReport.Chunks) == 0 {
+			continue
+		}
+		committed := 0
+		var rolledBack []string
+		for _, chunk := range tableReport.Chunks {
+			if chunk.Committed {
+				committed++
+			} else {
+				rolledBack = append(rolledBack, fmt.Sprintf("%d", chunk.Chunk))
+			}
+		}
+		transactions.Append([]string{
+			tableReport.Name,
+			tableReport.Transaction,
+			fmt.Sprintf("%d", committed),
+			strings.Join(rolledBack, ", "),
+		})
+		transactionCount++
+	}
+
+	if transactionCount > 0 {
+		fmt.Println("=== Transactions ===")
+		transactions.Render()
+		fmt.Println()
+	}
+
+	// Print consistency groups
+	if len(report.ConsistencyGroups) > 0 {
+		fmt.Println("=== Consistency Groups ===")
+		groups := tablewriter.NewWriter(os.Stdout)
+		groups.SetHeader([]string{"Group", "Columns", "Distinct Values"})
+		groups.SetBorder(false)
+		groups.SetColumnSeparator("|")
+
+		for _, group := range report.ConsistencyGroups {
+			groups.Append([]string{
+				group.Name,
+				strings.Join(group.Columns, ", "),
+				fmt.Sprintf("%d", group.DistinctValues),
+			})
+		}
+
+		groups.Render()
+		fmt.Println()
+	}
+
 	// Print error information
 	fmt.Println("=== Errors ===")
 	fmt.Printf("Error Count: %d\n", report.Errors.Count)
 	if report.Errors.Count > 0 {
 		fmt.Printf("Error Log: %s\n", report.Errors.LogFile)
+		fmt.Println()
+
+		errors := tablewriter.NewWriter(os.Stdout)
+		errors.SetHeader([]string{"Table", "Error"})
+		errors.SetBorder(false)
+		errors.SetColumnSeparator("|")
+		errors.SetAutoWrapText(false)
+
+		for _, tableReport := range report.Tables {
+			for _, message := range tableReport.Errors {
+				errors.Append([]string{tableReport.Name, message})
+			}
+		}
+		for _, deletion := range report.Deletions {
+			if deletion.Error != "" {
+				errors.Append([]string{deletion.Table, deletion.Error})
+			}
+		}
+
+		errors.Render()
 	}
 }
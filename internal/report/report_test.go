@@ -0,0 +1,67 @@
+package report
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGenerateReport(t *testing.T) {
+	results := []ExecutionResult{
+		{TableName: "customers", FieldName: "email", Action: "anonymize", Strategy: "faker.email", RowsScanned: 2, RowsAffected: 2, Transaction: "chunk", Chunk: 0, Committed: true},
+		{TableName: "customers", FieldName: "name", Action: "anonymize", Strategy: "value", RowsScanned: 2, RowsAffected: 2, Transaction: "chunk", Chunk: 0, Committed: true},
+		{TableName: "customers", FieldName: "email", Action: "anonymize", Strategy: "faker.email", RowsScanned: 1, RowsAffected: 1, Retries: 1, Transaction: "chunk", Chunk: 2, Committed: true},
+		{TableName: "customers", FieldName: "name", Action: "anonymize", Strategy: "value", RowsScanned: 1, RowsAffected: 1, Retries: 1, Transaction: "chunk", Chunk: 2, Committed: true},
+		{TableName: "customers", Action: "anonymize", RowsScanned: 2, Transaction: "chunk", Chunk: 1, Error: errors.New("failed to process chunk 1: deadlock")},
+		{TableName: "sessions", Action: "truncate", Error: errors.New("permission denied")},
+		{TableName: "orders", Action: "delete", Error: errors.New("failed to delete rows from orders: lock wait timeout")},
+	}
+
+	report := NewGenerator(false, "errors.log").GenerateReport(results, nil)
+
+	if report.Errors.Count != 3 || !report.Failed() {
+		t.Errorf("Expected 3 errors, got %d", report.Errors.Count)
+	}
+	if report.Summary.FailedTables != 3 {
+		t.Errorf("Expected 3 failed tables, got %d", report.Summary.FailedTables)
+	}
+
+	tables := make(map[string]TableReport)
+	for _, table := range report.Tables {
+		tables[table.Name] = table
+	}
+
+	// The chunks of a table are summed, and every field is reported once
+	customers := tables["customers"]
+	if customers.RowsScanned != 3 || customers.RowsAffected != 3 || customers.Retries != 1 {
+		t.Errorf("Expected customers to scan and update 3 rows with 1 retry, got %+v", customers)
+	}
+	if len(customers.Fields) != 2 || customers.Fields[0].RowsAffected != 3 {
+		t.Errorf("Expected 2 fields updating 3 rows each, got %+v", customers.Fields)
+	}
+	if len(customers.Errors) != 1 {
+		t.Errorf("Expected the failed chunk of customers to be reported, got %v", customers.Errors)
+	}
+	expected := []ChunkReport{{Chunk: 0, Rows: 2, Committed: true}, {Chunk: 1, Rows: 2}, {Chunk: 2, Rows: 1, Committed: true}}
+	if len(customers.Chunks) != len(expected) {
+		t.Fatalf("Expected chunks %v, got %v", expected, customers.Chunks)
+	}
+	for i, chunk := range expected {
+		if customers.Chunks[i] != chunk {
+			t.Errorf("Expected chunk %v, got %v", chunk, customers.Chunks[i])
+		}
+	}
+
+	// Failed tables are reported with their error
+	if sessions := tables["sessions"]; sessions.Action != ActionTruncated || len(sessions.Errors) != 1 {
+		t.Errorf("Expected the failed truncation of sessions, got %+v", sessions)
+	}
+	if len(report.Deletions) != 1 || report.Deletions[0].Error == "" {
+		t.Errorf("Expected the failed deletion of orders, got %+v", report.Deletions)
+	}
+
+	// A run without errors succeeds
+	report = NewGenerator(false, "errors.log").GenerateReport(results[:4], nil)
+	if report.Failed() || report.Summary.FailedTables != 0 {
+		t.Errorf("Expected the run to succeed, got %d errors", report.Errors.Count)
+	}
+}
@@ -0,0 +1,155 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// VerificationResult represents the verification of a column, or of a whole
+// table for truncated and delete tables
+type VerificationResult struct {
+	TableName    string
+	FieldName    string
+	Strategy     string
+	RowsChecked  int64
+	RowsCompared int64
+	Missing      int64
+	Unchanged    int64
+	Invalid      int64
+	Passed       bool
+	Skipped      bool
+	Message      string
+}
+
+// VerificationReport represents the report of a verification
+type VerificationReport struct {
+	Time     time.Time `json:"time"`
+	Snapshot string    `json:"snapshot,omitempty"`
+	Summary  struct {
+		Passed  int `json:"passed"`
+		Failed  int `json:"failed"`
+		Skipped int `json:"skipped"`
+	} `json:"summary"`
+	Checks []CheckReport `json:"checks"`
+}
+
+// Check statuses as they appear in the report
+const (
+	// StatusPassed marks checks that passed
+	StatusPassed = "passed"
+	// StatusFailed marks checks that failed
+	StatusFailed = "failed"
+	// StatusSkipped marks checks that were not run
+	StatusSkipped = "skipped"
+)
+
+// CheckReport represents the verification of a single column or table
+type CheckReport struct {
+	Table        string `json:"table"`
+	Field        string `json:"field,omitempty"`
+	Strategy     string `json:"strategy"`
+	Status       string `json:"status"`
+	RowsChecked  int64  `json:"rows_checked"`
+	RowsCompared int64  `json:"rows_compared"`
+	Missing      int64  `json:"missing"`
+	Unchanged    int64  `json:"unchanged"`
+	Invalid      int64  `json:"invalid"`
+	Message      string `json:"message,omitempty"`
+}
+
+// NewVerificationReport creates the report of a verification. snapshot is
+// the path of the snapshot the values were compared with, if any.
+func NewVerificationReport(results []VerificationResult, snapshot string) *VerificationReport {
+	report := &VerificationReport{
+		Time:     time.Now(),
+		Snapshot: snapshot,
+		Checks:   make([]CheckReport, 0, len(results)),
+	}
+
+	for _, result := range results {
+		status := StatusPassed
+		switch {
+		case result.Skipped:
+			status = StatusSkipped
+			report.Summary.Skipped++
+		case !result.Passed:
+			status = StatusFailed
+			report.Summary.Failed++
+		default:
+			report.Summary.Passed++
+		}
+
+		report.Checks = append(report.Checks, CheckReport{
+			Table:        result.TableName,
+			Field:        result.FieldName,
+			Strategy:     result.Strategy,
+			Status:       status,
+			RowsChecked:  result.RowsChecked,
+			RowsCompared: result.RowsCompared,
+			Missing:      result.Missing,
+			Unchanged:    result.Unchanged,
+			Invalid:      result.Invalid,
+			Message:      result.Message,
+		})
+	}
+
+	return report
+}
+
+// Passed reports whether no check failed
+func (r *VerificationReport) Passed() bool {
+	return r.Summary.Failed == 0
+}
+
+// OutputJSON outputs the report as JSON
+func (r *VerificationReport) OutputJSON(outputFile string) error {
+	jsonData, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal verification report to JSON: %w", err)
+	}
+
+	if err := os.WriteFile(outputFile, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write JSON verification report to file: %w", err)
+	}
+
+	return nil
+}
+
+// OutputText outputs the report as text
+func (r *VerificationReport) OutputText() {
+	fmt.Println("=== Verification Report ===")
+	if r.Snapshot != "" {
+		fmt.Printf("Snapshot: %s\n", r.Snapshot)
+	} else {
+		fmt.Println("Snapshot: none, original values not compared")
+	}
+	fmt.Printf("Passed: %d\n", r.Summary.Passed)
+	fmt.Printf("Failed: %d\n", r.Summary.Failed)
+	fmt.Printf("Skipped: %d\n", r.Summary.Skipped)
+	fmt.Println()
+
+	fmt.Println("=== Checks ===")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Table", "Field", "Strategy", "Status", "Rows Checked", "Rows Compared", "Message"})
+	table.SetBorder(false)
+	table.SetColumnSeparator("|")
+
+	for _, check := range r.Checks {
+		table.Append([]string{
+			check.Table,
+			check.Field,
+			check.Strategy,
+			check.Status,
+			fmt.Sprintf("%d", check.RowsChecked),
+			fmt.Sprintf("%d", check.RowsCompared),
+			check.Message,
+		})
+	}
+
+	table.Render()
+	fmt.Println()
+}
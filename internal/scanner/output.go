@@ -0,0 +1,208 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// columnStrategy is the configuration proposed for a column of a kind
+type columnStrategy struct {
+	fields [][2]string
+	// converter names a converter of converterStrategies the column uses
+	converter string
+}
+
+var (
+	// kindStrategies maps each kind to the column configuration proposed
+	// for it. Emails share a consistency group, so the same address maps to
+	// the same fake address in every table.
+	kindStrategies = map[string]columnStrategy{
+		KindEmail:      {fields: [][2]string{{"type", "faker.email"}, {"consistency_group", "email"}}},
+		KindPhone:      {fields: [][2]string{{"type", "faker.phone"}}},
+		KindIBAN:       {converter: "iban"},
+		KindCreditCard: {fields: [][2]string{{"type", "faker.creditcard"}}},
+		KindIP:         {fields: [][2]string{{"type", "faker.ipv4"}}},
+		KindPostcode:   {fields: [][2]string{{"type", "faker.postcode"}}},
+		KindName:       {fields: [][2]string{{"type", "faker.name"}}},
+		KindFirstName:  {fields: [][2]string{{"type", "faker.firstname"}}},
+		KindLastName:   {fields: [][2]string{{"type", "faker.lastname"}}},
+		KindAddress:    {fields: [][2]string{{"type", "faker.address"}}},
+		KindCity:       {fields: [][2]string{{"type", "faker.city"}}},
+		KindBirthdate:  {fields: [][2]string{{"null", "true"}}},
+	}
+
+	// converterStrategies holds the converters proposed columns may use, as
+	// YAML lines below the converter name
+	converterStrategies = map[string][]string{
+		"iban": {
+			"type: faker.numerify",
+			"params:",
+			`  format: "DE## #### #### #### #### ##"`,
+		},
+	}
+
+	// plainKeyPattern matches YAML keys that need no quotes
+	plainKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+)
+
+// WriteDraftConfig writes a draft configuration that anonymizes the columns
+// of findings, with the evidence for each column as a comment. The draft has
+// no database section; it is meant to be reviewed and then included from a
+// configuration that has one.
+func WriteDraftConfig(w io.Writer, findings []Finding) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintln(out, "# Draft anonymization configuration written by anonymize-db scan.")
+	fmt.Fprintln(out, "# Review every column before use: columns are judged by their names")
+	fmt.Fprintln(out, "# and a sample of their values only. Include this file from a")
+	fmt.Fprintln(out, "# configuration with a database section.")
+
+	// Group the findings by table, in order
+	byTable := make(map[string][]Finding)
+	var tables []string
+	for _, finding := range findings {
+		if _, ok := byTable[finding.Table]; !ok {
+			tables = append(tables, finding.Table)
+		}
+		byTable[finding.Table] = append(byTable[finding.Table], finding)
+	}
+	sort.Strings(tables)
+
+	if len(tables) == 0 {
+		fmt.Fprintln(out, "tables: {}")
+		return out.Flush()
+	}
+
+	converters := make(map[string]bool)
+	fmt.Fprintln(out, "tables:")
+	for _, table := range tables {
+		fmt.Fprintf(out, "  %s:\n", yamlKey(table))
+		fmt.Fprintln(out, "    columns:")
+		for _, finding := range byTable[table] {
+			strategy := kindStrategies[finding.Kind]
+			fmt.Fprintf(out, "      # %s: %s, score %.2f\n", finding.Kind, Evidence(finding), finding.Score)
+			fmt.Fprintf(out, "      %s:\n", yamlKey(finding.Column))
+			for _, field := range strategy.fields {
+				fmt.Fprintf(out, "        %s: %s\n", field[0], field[1])
+			}
+			if strategy.converter != "" {
+				fmt.Fprintf(out, "        converter: %s\n", strategy.converter)
+				converters[strategy.converter] = true
+			}
+		}
+	}
+
+	if len(converters) > 0 {
+		names := make([]string, 0, len(converters))
+		for name := range converters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintln(out, "converters:")
+		for _, name := range names {
+			fmt.Fprintf(out, "  %s:\n", name)
+			for _, line := range converterStrategies[name] {
+				fmt.Fprintf(out, "    %s\n", line)
+			}
+		}
+	}
+
+	return out.Flush()
+}
+
+// yamlKey renders a table or column name as a YAML mapping key, quoting
+// names that YAML would read as something else than a plain string
+func yamlKey(name string) string {
+	switch strings.ToLower(name) {
+	case "null", "true", "false", "yes", "no", "on", "off", "y", "n":
+		return strconv.Quote(name)
+	}
+	if plainKeyPattern.MatchString(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// Evidence describes why a finding looks like personal data
+func Evidence(finding Finding) string {
+	var evidence []string
+	if finding.NameMatch {
+		evidence = append(evidence, "name")
+	}
+	if finding.Matched > 0 {
+		evidence = append(evidence, fmt.Sprintf("%d/%d sampled values", finding.Matched, finding.Sampled))
+	}
+	return strings.Join(evidence, " and ")
+}
+
+// Report is the result of a scan
+type Report struct {
+	Summary struct {
+		TotalFindings int `json:"total_findings"`
+		Uncovered     int `json:"uncovered"`
+	} `json:"summary"`
+	Findings []Finding `json:"findings"`
+}
+
+// NewReport creates the report of the findings of a scan
+func NewReport(findings []Finding) *Report {
+	report := &Report{Findings: findings}
+	report.Summary.TotalFindings = len(findings)
+	report.Summary.Uncovered = len(Uncovered(findings))
+	return report
+}
+
+// OutputJSON outputs the report as JSON
+func (r *Report) OutputJSON(outputFile string) error {
+	jsonData, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal scan report to JSON: %w", err)
+	}
+
+	if err := os.WriteFile(outputFile, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write JSON scan report to file: %w", err)
+	}
+
+	return nil
+}
+
+// OutputText outputs the report as text
+func (r *Report) OutputText() {
+	fmt.Println("=== PII Scan Report ===")
+	fmt.Printf("Columns Found: %d\n", r.Summary.TotalFindings)
+	fmt.Printf("Columns Not Covered: %d\n", r.Summary.Uncovered)
+	fmt.Println()
+
+	if r.Summary.Uncovered == 0 {
+		return
+	}
+
+	fmt.Println("=== Columns Not Covered by the Configuration ===")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Table", "Column", "Kind", "Score", "Evidence"})
+	table.SetBorder(false)
+	table.SetColumnSeparator("|")
+
+	for _, finding := range Uncovered(r.Findings) {
+		table.Append([]string{
+			finding.Table,
+			finding.Column,
+			finding.Kind,
+			fmt.Sprintf("%.2f", finding.Score),
+			Evidence(finding),
+		})
+	}
+
+	table.Render()
+	fmt.Println()
+}
@@ -0,0 +1,194 @@
+package scanner
+
+import (
+	"math/big"
+	"net"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Kinds of personal data the scanner recognizes
+const (
+	KindEmail      = "email"
+	KindPhone      = "phone"
+	KindIBAN       = "iban"
+	KindCreditCard = "creditcard"
+	KindIP         = "ip"
+	KindPostcode   = "postcode"
+	KindName       = "name"
+	KindFirstName  = "firstname"
+	KindLastName   = "lastname"
+	KindAddress    = "address"
+	KindCity       = "city"
+	KindBirthdate  = "birthdate"
+)
+
+// rule recognizes one kind of personal data by column name and, for kinds
+// with a recognizable format, by value
+type rule struct {
+	kind string
+	// name matches the normalized column name, see normalizeName
+	name *regexp.Regexp
+	// value reports whether a sampled value has the format of the kind
+	value func(value string) bool
+	// valueOnly is set for formats distinctive enough to flag a column by
+	// its values alone, whatever its name
+	valueOnly bool
+}
+
+var (
+	emailPattern    = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[A-Za-z]{2,}$`)
+	phonePattern    = regexp.MustCompile(`^\+?[0-9(][0-9 ()./-]{5,}[0-9]$`)
+	ibanPattern     = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+	cardPattern     = regexp.MustCompile(`^[0-9]{13,19}$`)
+	postcodePattern = regexp.MustCompile(`(?i)^[A-Z0-9][A-Z0-9 -]{1,8}[A-Z0-9]$`)
+
+	// rules are tried in order; the first rule whose name pattern matches a
+	// column wins the name match, so specific names come before general ones
+	rules = []rule{
+		{kind: KindEmail, name: regexp.MustCompile(`e_?mail`), value: emailPattern.MatchString, valueOnly: true},
+		{kind: KindIP, name: regexp.MustCompile(`(^|_)(ip|ip_?address|remote_?addr|remote_?ip|x_forwarded_for)(_|$)`), value: isIP, valueOnly: true},
+		{kind: KindIBAN, name: regexp.MustCompile(`(^|_)iban(_|$)`), value: isIBAN, valueOnly: true},
+		{kind: KindCreditCard, name: regexp.MustCompile(`(^|_)(cc_?(number|num)|card_?(number|num|no)|credit_?card)(_|$)`), value: isCardNumber, valueOnly: true},
+		{kind: KindPhone, name: regexp.MustCompile(`(^|_)(phone|phone_?number|telephone|tel|mobile|cell|fax)(_|$)`), value: isPhone},
+		{kind: KindPostcode, name: regexp.MustCompile(`(^|_)(postcode|post_code|postal_?code|zip|zip_?code)(_|$)`), value: postcodePattern.MatchString},
+		{kind: KindFirstName, name: regexp.MustCompile(`(^|_)(first_?name|given_?name|fname|forename)(_|$)`)},
+		{kind: KindLastName, name: regexp.MustCompile(`(^|_)(last_?name|sur_?name|family_?name|lname)(_|$)`)},
+		{kind: KindName, name: regexp.MustCompile(`(^|_)(customer|billing|shipping|contact|person|full|account_holder|card_?holder|holder|owner|middle|recipient)_?name$`)},
+		{kind: KindAddress, name: regexp.MustCompile(`(^|_)(street|street_?address|address|address_?line_?[0-9]?|addr)(_|$)`)},
+		{kind: KindCity, name: regexp.MustCompile(`(^|_)(city|town)(_|$)`)},
+		{kind: KindBirthdate, name: regexp.MustCompile(`(^|_)(dob|birth_?date|date_?of_?birth|birthday)(_|$)`)},
+	}
+)
+
+// classify scores how much a column looks like personal data from its name
+// and a sample of its non-NULL values. It returns the best scoring kind; a
+// name match scores 0.5 and values of the kind's format add up to 0.5 in
+// proportion to the sample. Kinds recognized by value alone score half the
+// share of matching values. Columns that match nothing score 0.
+func classify(column string, values []string) (string, float64, bool, int) {
+	name := normalizeName(column)
+
+	// References such as customer_address_id hold keys, not personal data
+	nameMatched := strings.HasSuffix(name, "_id") || strings.HasSuffix(name, "_ids")
+
+	bestKind, bestScore, bestNameMatch, bestMatched := "", 0.0, false, 0
+	for _, rule := range rules {
+		nameMatch := !nameMatched && rule.name.MatchString(name)
+		if nameMatch {
+			nameMatched = true
+		}
+		if !nameMatch && !rule.valueOnly {
+			continue
+		}
+
+		matched := 0
+		if rule.value != nil {
+			for _, value := range values {
+				if rule.value(strings.TrimSpace(value)) {
+					matched++
+				}
+			}
+		}
+
+		score := 0.0
+		if nameMatch {
+			score = 0.5
+		}
+		if len(values) > 0 {
+			score += 0.5 * float64(matched) / float64(len(values))
+		}
+
+		if score > bestScore {
+			bestKind, bestScore, bestNameMatch, bestMatched = rule.kind, score, nameMatch, matched
+		}
+	}
+
+	return bestKind, bestScore, bestNameMatch, bestMatched
+}
+
+// normalizeName lowercases a column name and separates its words with
+// underscores, so that customerEmail, CustomerEMail and customer_email all
+// read customer_email
+func normalizeName(name string) string {
+	var normalized strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])) {
+				normalized.WriteByte('_')
+			}
+			normalized.WriteRune(unicode.ToLower(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			normalized.WriteRune(r)
+		default:
+			normalized.WriteByte('_')
+		}
+	}
+	return normalized.String()
+}
+
+// isIP reports whether value is an IPv4 or IPv6 address
+func isIP(value string) bool {
+	return strings.ContainsAny(value, ".:") && net.ParseIP(value) != nil
+}
+
+// isPhone reports whether value looks like a phone number with at least
+// seven digits
+func isPhone(value string) bool {
+	if !phonePattern.MatchString(value) {
+		return false
+	}
+	digits := 0
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7
+}
+
+// isIBAN reports whether value is an IBAN with a valid check sum
+func isIBAN(value string) bool {
+	value = strings.ToUpper(strings.ReplaceAll(value, " ", ""))
+	if !ibanPattern.MatchString(value) {
+		return false
+	}
+
+	// Move the country code and check digits to the end and read letters
+	// as numbers from 10 for A to 35 for Z; the result modulo 97 is 1
+	var digits strings.Builder
+	for _, r := range value[4:] + value[:4] {
+		if r >= 'A' && r <= 'Z' {
+			digits.WriteString(big.NewInt(int64(r-'A') + 10).String())
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+	number, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(number, big.NewInt(97)).Int64() == 1
+}
+
+// isCardNumber reports whether value is a payment card number with a valid
+// Luhn check digit
+func isCardNumber(value string) bool {
+	value = strings.NewReplacer(" ", "", "-", "").Replace(value)
+	if !cardPattern.MatchString(value) {
+		return false
+	}
+
+	sum := 0
+	for i := len(value) - 1; i >= 0; i-- {
+		digit := int(value[i] - '0')
+		if (len(value)-i)%2 == 0 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
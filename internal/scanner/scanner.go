@@ -0,0 +1,204 @@
+package scanner
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/database"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+// DefaultSampleSize is the number of rows sampled per table when no sample
+// size is set
+const DefaultSampleSize = 1000
+
+// MinScore is the score from which a column is reported as personal data
+const MinScore = 0.4
+
+// Finding is a column that looks like personal data
+type Finding struct {
+	Table     string  `json:"table"`
+	Column    string  `json:"column"`
+	Kind      string  `json:"kind"`
+	Score     float64 `json:"score"`
+	NameMatch bool    `json:"name_match"`
+	Sampled   int     `json:"sampled"`
+	Matched   int     `json:"matched"`
+	Covered   bool    `json:"covered"`
+}
+
+// Scanner looks for columns holding personal data in a database, judging
+// each column by its name and by a sample of its values
+type Scanner struct {
+	db         *sql.DB
+	dialect    database.Dialect
+	logger     *logger.Logger
+	sampleSize int
+}
+
+// NewScanner creates a scanner that samples up to sampleSize rows per table
+func NewScanner(db *sql.DB, dialect database.Dialect, logger *logger.Logger, sampleSize int) *Scanner {
+	if sampleSize <= 0 {
+		sampleSize = DefaultSampleSize
+	}
+	return &Scanner{
+		db:         db,
+		dialect:    dialect,
+		logger:     logger,
+		sampleSize: sampleSize,
+	}
+}
+
+// Scan scans every table of the database and returns the columns that look
+// like personal data, ordered by table and column
+func (s *Scanner) Scan(ctx context.Context) ([]Finding, error) {
+	tables, err := database.GetTables(s.db, s.dialect.Driver())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tables: %w", err)
+	}
+
+	findings := make([]Finding, 0)
+	for _, table := range tables {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		tableFindings, err := s.ScanTable(ctx, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan table %s: %w", table, err)
+		}
+
+		s.logger.Info("Scanned table", map[string]interface{}{
+			"table":    table,
+			"findings": len(tableFindings),
+		})
+
+		findings = append(findings, tableFindings...)
+	}
+
+	return findings, nil
+}
+
+// ScanTable scans the columns of a table
+func (s *Scanner) ScanTable(ctx context.Context, table string) ([]Finding, error) {
+	columns, err := database.GetTableColumns(s.db, s.dialect.Driver(), table)
+	if err != nil {
+		return nil, err
+	}
+
+	samples, err := s.sample(ctx, table, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for i, column := range columns {
+		kind, score, nameMatch, matched := classify(column, samples[i])
+		if score < MinScore {
+			continue
+		}
+		findings = append(findings, Finding{
+			Table:     table,
+			Column:    column,
+			Kind:      kind,
+			Score:     score,
+			NameMatch: nameMatch,
+			Sampled:   len(samples[i]),
+			Matched:   matched,
+		})
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].Column < findings[j].Column
+	})
+	return findings, nil
+}
+
+// sample reads the first rows of a table and returns the non-NULL values of
+// each column as text
+func (s *Scanner) sample(ctx context.Context, table string, columns []string) ([][]string, error) {
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quoted = append(quoted, s.dialect.QuoteIdentifier(column))
+	}
+
+	top, limit := s.dialect.LimitClauses(s.sampleSize)
+	selectList := strings.Join(quoted, ", ")
+	if top != "" {
+		selectList = fmt.Sprintf("%s %s", top, selectList)
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s %s", selectList, s.dialect.QuoteIdentifier(table), limit)
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([][]string, len(columns))
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		for i, value := range values {
+			if value.Valid {
+				samples[i] = append(samples[i], value.String)
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// MarkCovered marks the findings whose columns the configuration already
+// anonymizes, either as a configured column or by truncating the table
+func MarkCovered(findings []Finding, cfg *config.Config) {
+	for i := range findings {
+		findings[i].Covered = isCovered(cfg, findings[i].Table, findings[i].Column)
+	}
+}
+
+// isCovered reports whether the configuration anonymizes a column. Names
+// are compared case insensitively, as most databases do.
+func isCovered(cfg *config.Config, table, column string) bool {
+	for tableName, tableConfig := range cfg.Tables {
+		if !strings.EqualFold(tableName, table) {
+			continue
+		}
+		if tableConfig.ShouldTruncate() {
+			return true
+		}
+		for columnName := range tableConfig.Columns {
+			if strings.EqualFold(columnName, column) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Uncovered returns the findings the configuration does not cover
+func Uncovered(findings []Finding) []Finding {
+	uncovered := make([]Finding, 0)
+	for _, finding := range findings {
+		if !finding.Covered {
+			uncovered = append(uncovered, finding)
+		}
+	}
+	return uncovered
+}
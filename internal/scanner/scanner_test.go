@@ -0,0 +1,204 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"db-gdpr-anonymizer/internal/config"
+	"db-gdpr-anonymizer/internal/database"
+	"db-gdpr-anonymizer/internal/logger"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		column    string
+		values    []string
+		kind      string
+		nameMatch bool
+	}{
+		{"customer_email", nil, KindEmail, true},
+		{"E_Mail", []string{"jane@example.com"}, KindEmail, true},
+		{"billing_name", nil, KindName, true},
+		{"firstname", nil, KindFirstName, true},
+		{"customerLastName", nil, KindLastName, true},
+		{"telephone", []string{"+49 30 1234567"}, KindPhone, true},
+		{"remote_ip", []string{"192.168.1.10"}, KindIP, true},
+		{"ip_address", nil, KindIP, true},
+		{"email_address", nil, KindEmail, true},
+		{"postcode", []string{"10115"}, KindPostcode, true},
+		{"street", nil, KindAddress, true},
+		{"dob", nil, KindBirthdate, true},
+		// Values alone flag distinctive formats
+		{"comment", []string{"jane@example.com", "john@example.com"}, KindEmail, false},
+		{"account", []string{"DE89 3704 0044 0532 0130 00"}, KindIBAN, false},
+		{"payment", []string{"4111111111111111"}, KindCreditCard, false},
+		{"origin", []string{"2001:db8::1"}, KindIP, false},
+	}
+
+	for _, test := range tests {
+		kind, score, nameMatch, _ := classify(test.column, test.values)
+		if kind != test.kind || nameMatch != test.nameMatch || score < MinScore {
+			t.Errorf("Expected %s to be %s (name match %v), got %s (name match %v) with score %.2f",
+				test.column, test.kind, test.nameMatch, kind, nameMatch, score)
+		}
+	}
+
+	// Neither the names nor the values of these look like personal data
+	negatives := []struct {
+		column string
+		values []string
+	}{
+		{"customer_address_id", []string{"1", "2"}},
+		{"name", []string{"Blue Shirt"}},
+		{"sku", []string{"24-MB01"}},
+		{"description", []string{"Soft cotton"}},
+		{"amount", []string{"10115", "12.50"}},
+		{"card_token", []string{"4111111111111112"}},
+		{"account", []string{"DE89 3704 0044 0532 0130 01"}},
+	}
+	for _, negative := range negatives {
+		if kind, score, _, _ := classify(negative.column, negative.values); score >= MinScore {
+			t.Errorf("Expected %s not to be personal data, got %s with score %.2f", negative.column, kind, score)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := map[string]string{
+		"customer_email": "customer_email",
+		"CustomerEmail":  "customer_email",
+		"E-Mail":         "e_mail",
+		"ZIPCode":        "zipcode",
+		"Address2":       "address2",
+	}
+	for name, expected := range tests {
+		if normalized := normalizeName(name); normalized != expected {
+			t.Errorf("Expected %s to normalize to %s, got %s", name, expected, normalized)
+		}
+	}
+}
+
+func TestScannerSQLite(t *testing.T) {
+	db, err := database.Connect(database.Config{
+		Driver: database.SQLite,
+		Name:   filepath.Join(t.TempDir(), "shop.db"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	statements := []string{
+		`CREATE TABLE customers (id INTEGER PRIMARY KEY, email TEXT, firstname TEXT, note TEXT, created_at TEXT)`,
+		`CREATE TABLE creditmemo_grid (id INTEGER PRIMARY KEY, billing_name TEXT, customer_address_id INTEGER, "null" TEXT)`,
+		`CREATE TABLE products (id INTEGER PRIMARY KEY, name TEXT, price REAL)`,
+		`INSERT INTO customers VALUES (1, 'jane@example.com', 'Jane', 'jane.doe@example.org', '2024-01-01'), (2, NULL, 'John', 'john@example.com', '2024-01-02')`,
+		`INSERT INTO creditmemo_grid VALUES (1, 'Jane Doe', 1, '10.0.0.1')`,
+		`INSERT INTO products VALUES (1, 'Blue Shirt', 19.99)`,
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to set up database: %v", err)
+		}
+	}
+
+	log, err := logger.NewLogger(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer log.Close()
+
+	findings, err := NewScanner(db, database.SQLiteDialect{}, log, 10).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to scan database: %v", err)
+	}
+
+	found := make(map[string]string)
+	for _, finding := range findings {
+		found[finding.Table+"."+finding.Column] = finding.Kind
+	}
+	expected := map[string]string{
+		"creditmemo_grid.billing_name": KindName,
+		"creditmemo_grid.null":         KindIP,
+		"customers.email":              KindEmail,
+		"customers.firstname":          KindFirstName,
+		"customers.note":               KindEmail,
+	}
+	if len(found) != len(expected) {
+		t.Errorf("Expected findings %v, got %v", expected, found)
+	}
+	for column, kind := range expected {
+		if found[column] != kind {
+			t.Errorf("Expected %s to be found as %s, got '%s'", column, kind, found[column])
+		}
+	}
+
+	// Columns of the configuration are covered
+	MarkCovered(findings, &config.Config{
+		Tables: map[string]config.TableConfig{
+			"customers": {
+				Columns: map[string]config.ColumnConfig{
+					"email":     {Type: "faker.email"},
+					"firstname": {Type: "faker.firstname"},
+				},
+			},
+		},
+	})
+	uncovered := Uncovered(findings)
+	if len(uncovered) != 3 || uncovered[0].Column != "billing_name" {
+		t.Errorf("Expected 3 uncovered columns starting with billing_name, got %v", uncovered)
+	}
+
+	// The draft configuration loads when included from a configuration
+	var draft bytes.Buffer
+	if err := WriteDraftConfig(&draft, uncovered); err != nil {
+		t.Fatalf("Failed to write draft configuration: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "draft.yaml"), draft.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write draft: %v", err)
+	}
+	content := "include: draft.yaml\ndatabase:\n  driver: sqlite\n  name: shop.db\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cfg, err := config.LoadConfig(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load draft configuration: %v\n%s", err, draft.String())
+	}
+	if column := cfg.Tables["customers"].Columns["note"]; column.Type != "faker.email" || column.ConsistencyGroup != "email" {
+		t.Errorf("Expected note to be anonymized as email, got %+v", column)
+	}
+	if column := cfg.Tables["creditmemo_grid"].Columns["null"]; column.Type != "faker.ipv4" {
+		t.Errorf("Expected null column to be anonymized as IP address, got %+v", column)
+	}
+	if !strings.Contains(draft.String(), "# name: name, score 0.50\n      billing_name:\n        type: faker.name\n") {
+		t.Errorf("Unexpected draft configuration:\n%s", draft.String())
+	}
+}
+
+func TestWriteDraftConfigConverters(t *testing.T) {
+	var draft bytes.Buffer
+	findings := []Finding{{Table: "dbo.Customers", Column: "Bank Account", Kind: KindIBAN, Score: 0.5, Matched: 1, Sampled: 2}}
+	if err := WriteDraftConfig(&draft, findings); err != nil {
+		t.Fatalf("Failed to write draft configuration: %v", err)
+	}
+
+	expected := `  dbo.Customers:
+    columns:
+      # iban: 1/2 sampled values, score 0.50
+      "Bank Account":
+        converter: iban
+converters:
+  iban:
+    type: faker.numerify
+`
+	if !strings.Contains(draft.String(), expected) {
+		t.Errorf("Expected draft to contain\n%s\ngot\n%s", expected, draft.String())
+	}
+}